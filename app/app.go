@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pathshala/config"
+	"pathshala/storage"
+	"pathshala/utils"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// App holds what routes, controllers and workers share: the configuration
+// and the connections opened from it
+type App struct {
+	Config  *config.Config
+	DB      *gorm.DB
+	Redis   *redis.Client
+	Mailer  utils.Mailer
+	Tokens  *utils.Tokens
+	Storage storage.Storage
+
+	// Background workers run until shutdown cancels workerCtx
+	workerCtx    context.Context
+	stopWorkers  context.CancelFunc
+	workersGroup sync.WaitGroup
+}
+
+// New opens the database, Redis and file storage described by cfg
+func New(ctx context.Context, cfg *config.Config) (*App, error) {
+	db, err := config.OpenDB(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the database: %w", err)
+	}
+	if err := utils.RegisterTenantScopes(db); err != nil {
+		closeDB(db)
+		return nil, fmt.Errorf("registering tenant scopes: %w", err)
+	}
+
+	rdb, err := config.OpenRedis(ctx, cfg.Redis)
+	if err != nil {
+		closeDB(db)
+		return nil, fmt.Errorf("connecting to Redis at %s: %w", cfg.Redis.Addr, err)
+	}
+
+	store, err := storage.Open(ctx, cfg.Storage)
+	if err != nil {
+		rdb.Close()
+		closeDB(db)
+		return nil, fmt.Errorf("opening %s storage: %w", cfg.Storage.Backend, err)
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	return &App{
+		Config:      cfg,
+		DB:          db,
+		Redis:       rdb,
+		Mailer:      utils.NewSendGridMailer(cfg.Mail),
+		Tokens:      utils.NewTokens(cfg.JWT, rdb),
+		Storage:     store,
+		workerCtx:   workerCtx,
+		stopWorkers: stopWorkers,
+	}, nil
+}
+
+// Go runs a background worker until the app shuts down. The worker must
+// return once its context is cancelled, unless it is a short task that
+// finishes first: shutdown waits for it either way.
+func (a *App) Go(worker func(ctx context.Context)) {
+	a.workersGroup.Add(1)
+	go func() {
+		defer a.workersGroup.Done()
+		worker(a.workerCtx)
+	}()
+}
+
+// Serve handles requests on the configured address until ctx is cancelled,
+// then stops accepting connections, waits for in-flight requests and
+// background workers to finish, and returns
+func (a *App) Serve(ctx context.Context, handler http.Handler) error {
+	server := &http.Server{Addr: a.Config.Addr, Handler: handler}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", a.Config.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		a.stopWorkers()
+		a.workersGroup.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, draining requests for up to %s", a.Config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	a.stopWorkers()
+
+	workersDone := make(chan struct{})
+	go func() {
+		a.workersGroup.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		err = errors.Join(err, errors.New("background workers did not stop in time"))
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println("Server stopped")
+	return nil
+}
+
+// Close releases the database and Redis connections
+func (a *App) Close() error {
+	a.stopWorkers()
+	return errors.Join(a.Redis.Close(), closeDB(a.DB))
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
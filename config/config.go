@@ -0,0 +1,412 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type DatabaseConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN is the PostgreSQL connection string
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+type JWTConfig struct {
+	Secret        string
+	RefreshSecret string
+}
+
+type MailConfig struct {
+	SendGridAPIKey string
+	From           string
+}
+
+// StorageConfig selects where uploads are kept. Both backends can be
+// configured at once so files can be copied from one to the other.
+type StorageConfig struct {
+	Backend   string
+	LocalDir  string
+	URLSecret string        // Signs download links of the local backend
+	URLExpiry time.Duration // How long download links work
+	S3        S3Config
+}
+
+// S3Config addresses an S3-compatible bucket, e.g. AWS S3 or MinIO
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// MFAConfig controls TOTP multi-factor authentication
+type MFAConfig struct {
+	Issuer        string        // Account name shown in authenticator apps
+	EncryptionKey string        // Encrypts TOTP secrets at rest
+	RequiredRoles []string      // Roles that cannot log in without MFA
+	ChallengeTTL  time.Duration // How long the second login step may take
+}
+
+// LoginGuardConfig throttles failed logins per account and per IP. Past the
+// free attempts each failure makes the next attempt wait twice as long, up
+// to MaxDelay; at the lockout count attempts are refused for
+// LockoutDuration. IPs get far more attempts than accounts, since a whole
+// campus can share one address. Password reset requests are limited per
+// account over the same window.
+type LoginGuardConfig struct {
+	Window           time.Duration // How long failures are counted
+	AccountFree      int
+	AccountLockout   int
+	IPFree           int
+	IPLockout        int
+	MaxDelay         time.Duration
+	LockoutDuration  time.Duration
+	ResetsPerAccount int
+}
+
+// AdminConfig is the default admin created when there are no users
+type AdminConfig struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+// Config is the server configuration. Load reads it from defaults, the env
+// file, the environment and flags, each overriding the one before.
+type Config struct {
+	Addr            string
+	ShutdownTimeout time.Duration
+	FrontendURL     string
+	TrashRetention  time.Duration
+	PasswordReset   time.Duration // How long password reset links work
+	PDFFont         string        // TrueType font for PDF reports instead of the built-in one
+	TrustedProxies  []string      // IPs or CIDRs of proxies whose X-Forwarded-For is believed
+	TrustedPlatform string        // Header a hosting platform sets to the client IP, e.g. CF-Connecting-IP
+
+	Database DatabaseConfig
+	Redis    RedisConfig
+	JWT      JWTConfig
+	Mail     MailConfig
+	Admin    AdminConfig
+	Storage  StorageConfig
+	MFA      MFAConfig
+	Login    LoginGuardConfig
+}
+
+func defaults() *Config {
+	return &Config{
+		Addr:            ":8080",
+		ShutdownTimeout: 30 * time.Second,
+		FrontendURL:     "http://localhost:3000",
+		TrashRetention:  30 * 24 * time.Hour,
+		PasswordReset:   30 * time.Minute,
+		Database:        DatabaseConfig{Host: "localhost", Port: 5432, SSLMode: "disable"},
+		Redis:           RedisConfig{Addr: "localhost:6379"},
+		Storage: StorageConfig{
+			Backend:   "local",
+			LocalDir:  "uploads",
+			URLExpiry: 15 * time.Minute,
+			S3:        S3Config{Region: "us-east-1", UseSSL: true},
+		},
+		MFA: MFAConfig{Issuer: "Pathshala", ChallengeTTL: 5 * time.Minute},
+		Login: LoginGuardConfig{
+			Window:           15 * time.Minute,
+			AccountFree:      5,
+			AccountLockout:   10,
+			IPFree:           50,
+			IPLockout:        500,
+			MaxDelay:         30 * time.Second,
+			LockoutDuration:  15 * time.Minute,
+			ResetsPerAccount: 3,
+		},
+	}
+}
+
+// Load builds the configuration from args (without the program name) and
+// returns the arguments left after the flags, e.g. a subcommand. Callers
+// validate the parts they use.
+func Load(args []string) (*Config, []string, error) {
+	cfg := defaults()
+
+	flags := flag.NewFlagSet("pathshala", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	envFile := flags.String("env-file", ".env", "file of KEY=value settings; the environment takes precedence")
+	addr := flags.String("addr", "", "address to listen on (overrides ADDR)")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 0, "how long to drain requests on shutdown (overrides SHUTDOWN_TIMEOUT)")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// The default env file is optional; one named on the command line is not
+	envFileSet := false
+	flags.Visit(func(f *flag.Flag) { envFileSet = envFileSet || f.Name == "env-file" })
+	if err := godotenv.Load(*envFile); err != nil && (envFileSet || !errors.Is(err, os.ErrNotExist)) {
+		return nil, nil, fmt.Errorf("loading %s: %w", *envFile, err)
+	}
+
+	env := envReader{}
+	env.str("ADDR", &cfg.Addr)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	env.str("FRONTEND_URL", &cfg.FrontendURL)
+	env.days("TRASH_RETENTION_DAYS", &cfg.TrashRetention)
+	env.duration("PASSWORD_RESET_TTL", &cfg.PasswordReset)
+	env.str("PDF_FONT", &cfg.PDFFont)
+	env.list("TRUSTED_PROXIES", &cfg.TrustedProxies)
+	env.str("TRUSTED_PLATFORM", &cfg.TrustedPlatform)
+	env.str("DB_HOST", &cfg.Database.Host)
+	env.integer("DB_PORT", &cfg.Database.Port)
+	env.str("DB_USER", &cfg.Database.User)
+	env.str("DB_PASSWORD", &cfg.Database.Password)
+	env.str("DB_NAME", &cfg.Database.Name)
+	env.str("DB_SSLMODE", &cfg.Database.SSLMode)
+	env.str("REDIS_ADDR", &cfg.Redis.Addr)
+	env.str("REDIS_PASSWORD", &cfg.Redis.Password)
+	env.integer("REDIS_DB", &cfg.Redis.DB)
+	env.str("JWT_SECRET", &cfg.JWT.Secret)
+	env.str("JWT_REFRESH_SECRET", &cfg.JWT.RefreshSecret)
+	env.str("SENDGRID_API_KEY", &cfg.Mail.SendGridAPIKey)
+	env.str("EMAIL_FROM", &cfg.Mail.From)
+	env.str("ADMIN_NAME", &cfg.Admin.Name)
+	env.str("ADMIN_EMAIL", &cfg.Admin.Email)
+	env.str("ADMIN_PASSWORD", &cfg.Admin.Password)
+	env.str("STORAGE_BACKEND", &cfg.Storage.Backend)
+	env.str("STORAGE_LOCAL_DIR", &cfg.Storage.LocalDir)
+	env.str("STORAGE_URL_SECRET", &cfg.Storage.URLSecret)
+	env.duration("STORAGE_URL_EXPIRY", &cfg.Storage.URLExpiry)
+	env.str("S3_ENDPOINT", &cfg.Storage.S3.Endpoint)
+	env.str("S3_REGION", &cfg.Storage.S3.Region)
+	env.str("S3_BUCKET", &cfg.Storage.S3.Bucket)
+	env.str("S3_ACCESS_KEY", &cfg.Storage.S3.AccessKey)
+	env.str("S3_SECRET_KEY", &cfg.Storage.S3.SecretKey)
+	env.boolean("S3_USE_SSL", &cfg.Storage.S3.UseSSL)
+	env.str("MFA_ISSUER", &cfg.MFA.Issuer)
+	env.str("MFA_ENCRYPTION_KEY", &cfg.MFA.EncryptionKey)
+	env.list("MFA_REQUIRED_ROLES", &cfg.MFA.RequiredRoles)
+	env.duration("MFA_CHALLENGE_TTL", &cfg.MFA.ChallengeTTL)
+	env.duration("LOGIN_FAILURE_WINDOW", &cfg.Login.Window)
+	env.integer("LOGIN_ACCOUNT_FREE_ATTEMPTS", &cfg.Login.AccountFree)
+	env.integer("LOGIN_ACCOUNT_LOCKOUT_ATTEMPTS", &cfg.Login.AccountLockout)
+	env.integer("LOGIN_IP_FREE_ATTEMPTS", &cfg.Login.IPFree)
+	env.integer("LOGIN_IP_LOCKOUT_ATTEMPTS", &cfg.Login.IPLockout)
+	env.duration("LOGIN_MAX_DELAY", &cfg.Login.MaxDelay)
+	env.duration("LOGIN_LOCKOUT_DURATION", &cfg.Login.LockoutDuration)
+	env.integer("PASSWORD_RESETS_PER_ACCOUNT", &cfg.Login.ResetsPerAccount)
+	if len(env.errs) > 0 {
+		return nil, nil, errors.Join(env.errs...)
+	}
+
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *shutdownTimeout != 0 {
+		cfg.ShutdownTimeout = *shutdownTimeout
+	}
+	return cfg, flags.Args(), nil
+}
+
+// Validate reports every setting the server needs that is missing or out
+// of range
+func (c *Config) Validate() error {
+	errs := []error{c.Database.Validate(), c.Storage.Validate(c.Storage.Backend), c.Login.Validate()}
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+
+	require(c.Addr, "ADDR")
+	require(c.Redis.Addr, "REDIS_ADDR")
+	require(c.JWT.Secret, "JWT_SECRET")
+	require(c.JWT.RefreshSecret, "JWT_REFRESH_SECRET")
+	if c.JWT.Secret != "" && c.JWT.Secret == c.JWT.RefreshSecret {
+		errs = append(errs, errors.New("JWT_SECRET and JWT_REFRESH_SECRET must differ"))
+	}
+	if c.Storage.Backend == "local" {
+		// The server signs download links of local files itself
+		require(c.Storage.URLSecret, "STORAGE_URL_SECRET")
+	}
+	require(c.MFA.Issuer, "MFA_ISSUER")
+	if len(c.MFA.EncryptionKey) < 32 {
+		errs = append(errs, errors.New("MFA_ENCRYPTION_KEY must be at least 32 characters"))
+	}
+	if c.MFA.ChallengeTTL <= 0 {
+		errs = append(errs, errors.New("MFA_CHALLENGE_TTL must be positive"))
+	}
+	if c.Redis.DB < 0 {
+		errs = append(errs, errors.New("REDIS_DB cannot be negative"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.TrashRetention <= 0 {
+		errs = append(errs, errors.New("TRASH_RETENTION_DAYS must be positive"))
+	}
+	if c.PasswordReset <= 0 {
+		errs = append(errs, errors.New("PASSWORD_RESET_TTL must be positive"))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP or CIDR", proxy))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports login throttling settings that are out of range
+func (l LoginGuardConfig) Validate() error {
+	var errs []error
+	if l.Window <= 0 || l.MaxDelay <= 0 || l.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("LOGIN_FAILURE_WINDOW, LOGIN_MAX_DELAY and LOGIN_LOCKOUT_DURATION must be positive"))
+	}
+	if l.AccountFree < 1 || l.AccountLockout <= l.AccountFree {
+		errs = append(errs, errors.New("LOGIN_ACCOUNT_FREE_ATTEMPTS must be positive and below LOGIN_ACCOUNT_LOCKOUT_ATTEMPTS"))
+	}
+	if l.IPFree < 1 || l.IPLockout <= l.IPFree {
+		errs = append(errs, errors.New("LOGIN_IP_FREE_ATTEMPTS must be positive and below LOGIN_IP_LOCKOUT_ATTEMPTS"))
+	}
+	if l.ResetsPerAccount < 1 {
+		errs = append(errs, errors.New("PASSWORD_RESETS_PER_ACCOUNT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports missing connection settings; it is all the migrate
+// subcommand needs
+func (d DatabaseConfig) Validate() error {
+	var errs []error
+	for _, setting := range [][2]string{{"DB_HOST", d.Host}, {"DB_USER", d.User}, {"DB_NAME", d.Name}} {
+		if strings.TrimSpace(setting[1]) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", setting[0]))
+		}
+	}
+	if d.Port <= 0 || d.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT %d is not a valid port", d.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports missing settings of a backend; it is all the storage
+// subcommand needs
+func (s StorageConfig) Validate(backend string) error {
+	var errs []error
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required for %s storage", name, backend))
+		}
+	}
+
+	switch backend {
+	case "local":
+		require(s.LocalDir, "STORAGE_LOCAL_DIR")
+	case "s3":
+		require(s.S3.Endpoint, "S3_ENDPOINT")
+		require(s.S3.Bucket, "S3_BUCKET")
+		require(s.S3.AccessKey, "S3_ACCESS_KEY")
+		require(s.S3.SecretKey, "S3_SECRET_KEY")
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_BACKEND must be local or s3, got %q", backend))
+	}
+	if s.URLExpiry <= 0 {
+		errs = append(errs, errors.New("STORAGE_URL_EXPIRY must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// envReader overrides settings with the environment variables that are set,
+// collecting the ones that do not parse
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) lookup(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	return strings.TrimSpace(value), ok && strings.TrimSpace(value) != ""
+}
+
+func (r *envReader) str(key string, dst *string) {
+	if value, ok := r.lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (r *envReader) integer(key string, dst *int) {
+	if value, ok := r.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a number, got %q", key, value))
+			return
+		}
+		*dst = n
+	}
+}
+
+// list reads a comma-separated value, skipping empty items
+func (r *envReader) list(key string, dst *[]string) {
+	if value, ok := r.lookup(key); ok {
+		*dst = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+	}
+}
+
+func (r *envReader) boolean(key string, dst *bool) {
+	if value, ok := r.lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be true or false, got %q", key, value))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (r *envReader) duration(key string, dst *time.Duration) {
+	if value, ok := r.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a duration like 30s, got %q", key, value))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (r *envReader) days(key string, dst *time.Duration) {
+	if value, ok := r.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a number of days, got %q", key, value))
+			return
+		}
+		*dst = time.Duration(n) * 24 * time.Hour
+	}
+}
@@ -1,24 +1,21 @@
 package config
 
 import (
-	"log"
-
-	"github.com/redis/go-redis/v9" // Ensure you're using v9
 	"context"
-)
 
-var RedisClient *redis.Client
-var Ctx = context.Background()
+	"github.com/redis/go-redis/v9"
+)
 
-func InitRedis() {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
+// OpenRedis connects to Redis and checks that it answers
+func OpenRedis(ctx context.Context, cfg RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
-
-	// For go-redis v9: use Ping(ctx)
-	if _, err := RedisClient.Ping(Ctx).Result(); err != nil {
-		log.Fatalf("Redis init failed: %v", err)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
 	}
+	return client, nil
 }
@@ -1,14 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func SubmitAnswers(c *gin.Context) {
+func SubmitAnswers(c *gin.Context, db *gorm.DB) {
 	var answers []models.StudentAnswer
 
 	if err := c.ShouldBindJSON(&answers); err != nil {
@@ -16,12 +18,32 @@ func SubmitAnswers(c *gin.Context) {
 		return
 	}
 
-	for _, ans := range answers {
-		if err := config.DB.Create(&ans).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userIDFloat, ok := userIDInterface.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	// The whole batch is saved or none of it is. Graders' batches belong to
+	// no attempt, so their keys are scoped to the grader alone.
+	replayed, err := services.SaveAnswerBatch(db, uint(userIDFloat), 0, c.GetHeader(services.IdempotencyKeyHeader), answers)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidIdempotencyKey):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answers"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Answers saved successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Answers saved successfully", "replayed": replayed})
 }
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	Service services.AuditServiceInterface
+}
+
+func NewAuditController(service services.AuditServiceInterface) *AuditController {
+	return &AuditController{Service: service}
+}
+
+// auditFilter reads actor_id, action, entity_type, entity_id and a from/to
+// range (RFC 3339 or YYYY-MM-DD, to exclusive) from the query
+func auditFilter(c *gin.Context) (services.AuditFilter, bool) {
+	filter := services.AuditFilter{
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+	}
+	if value := c.Query("actor_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return filter, false
+		}
+		actor := uint(id)
+		filter.ActorID = &actor
+	}
+	for _, bound := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s, use RFC 3339 or YYYY-MM-DD", bound.name)})
+			return filter, false
+		}
+		*bound.value = &t
+	}
+	return filter, true
+}
+
+func (ac *AuditController) GetAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	entries, total, err := ac.Service.WithContext(utils.RequestContext(c)).ListAuditLogs(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       entries,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// ExportAuditLogs downloads every matching entry as CSV
+func (ac *AuditController) ExportAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := ac.Service.WithContext(utils.RequestContext(c)).ExportAuditCSV(&buf, filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit logs"})
+		return
+	}
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
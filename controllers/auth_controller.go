@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"context"
+	"pathshala/services"
+	"pathshala/utils"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// AuthController logs users in and out, manages their second factor and
+// resets passwords
+type AuthController struct {
+	DB          *gorm.DB
+	Redis       *redis.Client
+	Tokens      *utils.Tokens
+	Mailer      utils.Mailer
+	FrontendURL string // Base of the links sent in emails
+	MFA         services.MFAServiceInterface
+	Sessions    services.SessionServiceInterface
+	Resets      services.PasswordResetServiceInterface
+	Guard       services.LoginGuardServiceInterface
+
+	// Go runs work that outlives its request, such as mailing a reset link,
+	// so that shutdown waits for it: app.Go in the server
+	Go func(task func(ctx context.Context))
+}
+
+func NewAuthController(db *gorm.DB, rdb *redis.Client, tokens *utils.Tokens, mailer utils.Mailer, frontendURL string,
+	mfa services.MFAServiceInterface, sessions services.SessionServiceInterface, resets services.PasswordResetServiceInterface,
+	guard services.LoginGuardServiceInterface, run func(task func(ctx context.Context))) *AuthController {
+	return &AuthController{
+		DB: db, Redis: rdb, Tokens: tokens, Mailer: mailer, FrontendURL: frontendURL,
+		MFA: mfa, Sessions: sessions, Resets: resets, Guard: guard, Go: run,
+	}
+}
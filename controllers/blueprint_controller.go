@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BlueprintController struct {
+	DB      *gorm.DB
+	Service services.BlueprintServiceInterface
+}
+
+func NewBlueprintController(db *gorm.DB, service services.BlueprintServiceInterface) *BlueprintController {
+	return &BlueprintController{DB: db, Service: service}
+}
+
+// blueprintTestID reads the test from the path and checks that the logged-in
+// user holds the permission over it
+func blueprintTestID(c *gin.Context, db *gorm.DB, permission string) (uint, bool) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return 0, false
+	}
+
+	if err := utils.AuthorizeTest(c, db, permission, uint(testID)); err != nil {
+		if errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to modify this test"})
+		}
+		return 0, false
+	}
+	return uint(testID), true
+}
+
+func (bc *BlueprintController) GetBlueprint(c *gin.Context) {
+	testID, ok := blueprintTestID(c, bc.DB, utils.PermTestView)
+	if !ok {
+		return
+	}
+
+	rules, err := bc.Service.WithContext(utils.RequestContext(c)).GetBlueprint(testID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blueprint"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_id": testID, "blueprint": rules})
+}
+
+func (bc *BlueprintController) SetBlueprint(c *gin.Context) {
+	testID, ok := blueprintTestID(c, bc.DB, utils.PermTestEdit)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Rules []services.BlueprintRuleInput `json:"rules" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	rules, err := bc.Service.WithContext(utils.RequestContext(c)).SetBlueprint(testID, input.Rules)
+	if err != nil {
+		var shortage *services.PoolShortageError
+		switch {
+		case errors.Is(err, services.ErrInvalidBlueprint):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.As(err, &shortage):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "shortages": shortage.Shortages})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save blueprint"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blueprint saved successfully", "blueprint": rules})
+}
+
+// Whether the question bank holds enough questions for every rule of the blueprint
+func (bc *BlueprintController) CheckPools(c *gin.Context) {
+	testID, ok := blueprintTestID(c, bc.DB, utils.PermTestView)
+	if !ok {
+		return
+	}
+
+	shortages, err := bc.Service.WithContext(utils.RequestContext(c)).CheckPools(testID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check question pools"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_id": testID, "satisfiable": len(shortages) == 0, "shortages": shortages})
+}
@@ -4,18 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"path/filepath"
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
 	"pathshala/utils"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func AddCategory(c *gin.Context) {
+func AddCategory(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - User ID not found"})
@@ -34,6 +33,7 @@ func AddCategory(c *gin.Context) {
 	name := c.PostForm("name")
 	description := c.PostForm("description")
 	macroCategoryIDStr := c.PostForm("macro_category_id")
+	shared := c.PostForm("shared") == "true"
 
 	if name == "" || macroCategoryIDStr == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and macro_category_id are required"})
@@ -54,15 +54,12 @@ func AddCategory(c *gin.Context) {
 		return
 	}
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".bmp": true}
-	if !allowedExts[ext] {
+	// Save image, checking its content rather than its name
+	imagePath, err := storage.SaveUpload(c.Request.Context(), store, storage.FolderCategories, file, storage.CategoryImageTypes)
+	if errors.Is(err, storage.ErrUnsupportedType) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed: jpg, jpeg, png, bmp"})
 		return
 	}
-
-	// Save image using utils
-	imagePath, err := utils.SaveUploadedFile(file, "uploads/categories")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
 		return
@@ -70,7 +67,8 @@ func AddCategory(c *gin.Context) {
 
 	// Fetch user and related college
 	var user models.User
-	if err := config.DB.Preload("College").First(&user, userID).Error; err != nil {
+	if err := db.Preload("College").First(&user, userID).Error; err != nil {
+		storage.Remove(c.Request.Context(), store, imagePath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
 		return
 	}
@@ -81,13 +79,13 @@ func AddCategory(c *gin.Context) {
 		Description:     &description,
 		ImagePath:       &imagePath,
 		MacroCategoryID: ptrUint(uint(macroCategoryID)), // Use the helper function to convert to *uint
-		CollegeName:     &user.College.Name,
-		State:           &user.College.State,
+		CollegeID:       user.CollegeID,
+		Shared:          shared,
 		CreatorName:     user.Name,
 	}
 
-	if err := config.DB.Create(&category).Error; err != nil {
-		utils.DeleteFileIfExists(imagePath) // Clean up uploaded file on failure
+	if err := db.Create(&category).Error; err != nil {
+		storage.Remove(c.Request.Context(), store, imagePath) // Clean up uploaded file on failure
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category "})
 		return
 	}
@@ -100,14 +98,14 @@ func ptrUint(u uint) *uint {
 	return &u
 }
 
-func GetAllCategories(c *gin.Context) {
+func GetAllCategories(c *gin.Context, db *gorm.DB) {
 	column := c.Query("column")
 	value := c.Query("value")
 
 	var categories []models.Category
 
-	// Start DB query with preload
-	query := config.DB.Preload("MacroCategory")
+	// Start DB query with preload; other colleges' categories are only listed when shared
+	query := utils.ScopeToTenant(c, db).Preload("MacroCategory").Preload("College")
 
 	// Filtering logic
 	if column != "" && value != "" {
@@ -116,8 +114,12 @@ func GetAllCategories(c *gin.Context) {
 				Where("macro_categories.name ILIKE ?", "%"+value+"%")
 		} else {
 			switch column {
-			case "name", "state", "college_name", "creator_name":
-				query = query.Where(fmt.Sprintf("%s ILIKE ?", column), "%"+value+"%")
+			case "name", "creator_name":
+				query = query.Where(fmt.Sprintf("categories.%s ILIKE ?", column), "%"+value+"%")
+			case "state", "college_name":
+				field := map[string]string{"state": "colleges.state", "college_name": "colleges.name"}[column]
+				query = query.Joins("JOIN colleges ON colleges.id = categories.college_id").
+					Where(fmt.Sprintf("%s ILIKE ?", field), "%"+value+"%")
 			default:
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid column for filtering"})
 				return
@@ -138,15 +140,14 @@ func GetAllCategories(c *gin.Context) {
 			ID:            cat.ID,
 			Name:          cat.Name,
 			MacroCategory: "",
+			Shared:        cat.Shared,
 		}
 		if cat.MacroCategory != nil {
 			resp.MacroCategory = cat.MacroCategory.Name
 		}
-		if cat.CollegeName != nil {
-			resp.CollegeName = *cat.CollegeName
-		}
-		if cat.State != nil {
-			resp.State = *cat.State
+		if cat.College != nil {
+			resp.CollegeName = cat.College.Name
+			resp.State = cat.College.State
 		}
 		response = append(response, resp)
 	}
@@ -155,13 +156,53 @@ func GetAllCategories(c *gin.Context) {
 	utils.PaginateSlice(c, response)
 }
 
-// Get category by ID
-func GetCategoryByID(c *gin.Context) {
-	id := c.Param("id")
+// findCategory loads a category visible to the logged-in user's college.
+// With write set it must also belong to that college.
+func findCategory(c *gin.Context, db *gorm.DB, id interface{}, write bool) (*models.Category, bool) {
 	var category models.Category
+	if err := utils.ScopeToTenant(c, db).Preload("College").First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find category"})
+		return nil, false
+	}
+	if write {
+		tenant, err := utils.CurrentTenant(c, db)
+		if err != nil || !tenant.Owns(category.CollegeID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Category belongs to another college"})
+			return nil, false
+		}
+	}
+	return &category, true
+}
+
+// ownsCategory answers 403 unless the logged-in user's college owns the
+// category; questions are only added to and moved between such categories
+func ownsCategory(c *gin.Context, db *gorm.DB, categoryID uint) bool {
+	var category models.Category
+	err := db.Select("id", "college_id").First(&category, categoryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category does not exist"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find category"})
+		return false
+	}
+	tenant, err := utils.CurrentTenant(c, db)
+	if err != nil || !tenant.Owns(category.CollegeID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Category belongs to another college"})
+		return false
+	}
+	return true
+}
 
-	if err := config.DB.First(&category, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+// Get category by ID
+func GetCategoryByID(c *gin.Context, db *gorm.DB) {
+	category, ok := findCategory(c, db, c.Param("id"), false)
+	if !ok {
 		return
 	}
 
@@ -169,12 +210,9 @@ func GetCategoryByID(c *gin.Context) {
 }
 
 // Update an existing category
-func UpdateCategory(c *gin.Context) {
-	id := c.Param("id")
-	var category models.Category
-
-	if err := config.DB.First(&category, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+func UpdateCategory(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	category, ok := findCategory(c, db, c.Param("id"), true)
+	if !ok {
 		return
 	}
 
@@ -182,8 +220,7 @@ func UpdateCategory(c *gin.Context) {
 	name := c.PostForm("name")
 	description := c.PostForm("description")
 	macroCategoryIDStr := c.PostForm("macro_category_id")
-	collegeName := c.PostForm("college_name")
-	state := c.PostForm("state")
+	shared := c.PostForm("shared")
 
 	if name != "" {
 		category.Name = name
@@ -191,11 +228,8 @@ func UpdateCategory(c *gin.Context) {
 	if description != "" {
 		category.Description = &description
 	}
-	if collegeName != "" {
-		category.CollegeName = &collegeName
-	}
-	if state != "" {
-		category.State = &state
+	if shared != "" {
+		category.Shared = shared == "true"
 	}
 	if macroCategoryIDStr != "" {
 		macroCategoryID, err := strconv.ParseUint(macroCategoryIDStr, 10, 64)
@@ -207,40 +241,40 @@ func UpdateCategory(c *gin.Context) {
 	}
 
 	// Handle optional image update
+	var oldImagePath, newImagePath string
 	file, err := c.FormFile("image")
 	if err == nil {
-		ext := strings.ToLower(filepath.Ext(file.Filename))
-		allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".bmp": true}
-		if !allowedExts[ext] {
+		// Save new image
+		newImagePath, err = storage.SaveUpload(c.Request.Context(), store, storage.FolderCategories, file, storage.CategoryImageTypes)
+		if errors.Is(err, storage.ErrUnsupportedType) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed: jpg, jpeg, png, bmp"})
 			return
 		}
-
-		// Save new image
-		newImagePath, err := utils.SaveUploadedFile(file, "uploads/categories")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save new image"})
 			return
 		}
 
-		// Delete old image if exists
 		if category.ImagePath != nil {
-			utils.DeleteFileIfExists(*category.ImagePath)
+			oldImagePath = *category.ImagePath
 		}
-
 		category.ImagePath = &newImagePath
 	}
 
-	if err := config.DB.Save(&category).Error; err != nil {
+	if err := db.Omit("College").Save(category).Error; err != nil {
+		storage.Remove(c.Request.Context(), store, newImagePath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
 		return
 	}
 
+	// Delete old image once the category no longer points at it
+	storage.Remove(c.Request.Context(), store, oldImagePath)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": category})
 }
 
 // Delete category
-func DeleteCategory(c *gin.Context) {
+func DeleteCategory(c *gin.Context, db *gorm.DB) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -248,17 +282,13 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	var category models.Category
-	if err := config.DB.First(&category, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find category"})
+	category, ok := findCategory(c, db, id, true)
+	if !ok {
 		return
 	}
 
-	if err := config.DB.Delete(&category).Error; err != nil {
+	// Questions of the category go to the trash with it
+	if err := services.NewTrashService(db, nil, 0).Delete(services.TrashCategories, category.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
 		return
 	}
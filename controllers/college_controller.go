@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"pathshala/models"
+	"pathshala/services"
 	"pathshala/utils"
 	"strconv"
 
@@ -65,6 +66,7 @@ func CreateCollege(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	utils.Audit(c, "create", "colleges", college.ID, nil, college)
 	c.JSON(http.StatusCreated, college)
 }
 
@@ -176,6 +178,8 @@ func UpdateCollege(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	before := college
+
 	// Update the college
 	college.Name = input.Name
 	college.Description = input.Description
@@ -188,27 +192,29 @@ func UpdateCollege(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	utils.Audit(c, "update", "colleges", college.ID, before, college)
 	c.JSON(http.StatusOK, college)
 }
 
 func DeleteCollege(c *gin.Context, db *gorm.DB) {
 	id := c.Param("id")
 
-	var count int64
-	if err := db.Model(&models.User{}).Where("college_id = ?", id).Count(&count).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-
-	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete college. It is referenced by existing users."})
+	var college models.College
+	if err := db.First(&college, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "College not found"})
 		return
 	}
 
-	if err := db.Delete(&models.College{}, id).Error; err != nil {
+	// Users and categories in the trash still belong to the college
+	if err := services.NewTrashService(db, nil, 0).Delete(services.TrashColleges, college.ID); err != nil {
+		if errors.Is(err, services.ErrCollegeInUse) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete college. It is referenced by users or categories, including deleted ones."})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
 		return
 	}
+	utils.Audit(c, "delete", "colleges", college.ID, college, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "College deleted successfully"})
 }
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/models"
+	"pathshala/storage"
+	"pathshala/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FileController struct {
+	DB      *gorm.DB
+	Storage storage.Storage
+	Expiry  time.Duration // How long download links work
+}
+
+func NewFileController(db *gorm.DB, store storage.Storage, expiry time.Duration) *FileController {
+	return &FileController{DB: db, Storage: store, Expiry: expiry}
+}
+
+func respondFileError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file key"})
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case errors.Is(err, utils.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this file"})
+	case errors.Is(err, storage.ErrInvalidURL):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// fileKey reads the storage key from the wildcard path
+func fileKey(c *gin.Context) (string, error) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	return key, storage.CheckKey(key)
+}
+
+// authorizeFile checks that the logged-in user can read a record that
+// references the file: a question or one of its revisions, a category, or a
+// profile
+func (fc *FileController) authorizeFile(c *gin.Context, key string) error {
+	folder, _, _ := strings.Cut(key, "/")
+	var count int64
+	switch folder {
+	case storage.FolderQuestions:
+		subject, err := utils.CurrentSubject(c, fc.DB)
+		if err != nil {
+			return err
+		}
+		if !subject.HasPermission(utils.PermQuestionView) && !subject.HasPermission(utils.PermTestTake) {
+			return utils.ErrForbidden
+		}
+		var revised []uint
+		if err := fc.DB.Model(&models.QuestionRevision{}).Where("image1 = ? OR image2 = ?", key, key).
+			Distinct().Pluck("question_id", &revised).Error; err != nil {
+			return err
+		}
+		if err := utils.ScopeToTenant(c, fc.DB).Model(&models.Question{}).
+			Where("image1 = ? OR image2 = ? OR id IN ?", key, key, revised).Count(&count).Error; err != nil {
+			return err
+		}
+
+	case storage.FolderCategories:
+		if err := utils.ScopeToTenant(c, fc.DB).Model(&models.Category{}).Where("image_path = ?", key).Count(&count).Error; err != nil {
+			return err
+		}
+
+	case storage.FolderProfiles:
+		var user models.User
+		if err := fc.DB.Where("profile_image = ?", key).First(&user).Error; err != nil {
+			return err
+		}
+		if user.ID == uint(c.GetFloat64("user_id")) {
+			return nil
+		}
+		res, err := utils.UserResource(fc.DB, user.ID)
+		if err != nil {
+			return err
+		}
+		return utils.Authorize(c, fc.DB, utils.PermUserView, res)
+	}
+
+	if count == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// GetFileURL returns a short-lived download link for a stored file
+func (fc *FileController) GetFileURL(c *gin.Context) {
+	key, err := fileKey(c)
+	if err == nil {
+		err = fc.authorizeFile(c, key)
+	}
+	if err != nil {
+		respondFileError(c, err, "Failed to fetch file")
+		return
+	}
+
+	url, err := fc.Storage.URL(c.Request.Context(), key, fc.Expiry)
+	if err != nil {
+		respondFileError(c, err, "Failed to create download link")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": time.Now().Add(fc.Expiry)})
+}
+
+// ServeLocalFile sends a file of the local backend to the holder of a link
+// made by GetFileURL
+func (fc *FileController) ServeLocalFile(c *gin.Context) {
+	local, ok := fc.Storage.(*storage.Local)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	key, err := fileKey(c)
+	if err == nil {
+		err = local.Verify(key, c.Query("expires"), c.Query("signature"), time.Now())
+	}
+	if err != nil {
+		respondFileError(c, err, "Failed to fetch file")
+		return
+	}
+
+	r, info, err := local.Get(c.Request.Context(), key)
+	if err != nil {
+		respondFileError(c, err, "Failed to fetch file")
+		return
+	}
+	defer r.Close()
+
+	// The type was sniffed when the file was stored; browsers must not guess
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=300")
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, r, nil)
+}
@@ -1,55 +1,65 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
-	"os"
-	"pathshala/config"
-	"pathshala/models"
+	"net/url"
+	"pathshala/services"
 	"pathshala/utils"
-	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// Allows override in tests
-var SendResetEmail = utils.SendResetEmailGrid
+// forgotPasswordMessage is the answer to every well-formed request, so the
+// endpoint does not reveal which emails have accounts
+const forgotPasswordMessage = "If the email is registered, a reset link has been sent to it"
 
-func ForgotPassword(c *gin.Context) {
-	godotenv.Load()
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
 	var req struct {
-		Email string `json:"email"`
+		Email string `json:"email" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Email not registered"})
+	// Each account gets a few links per window, however many IPs ask
+	if err := ac.Guard.ResetRequested(c.Request.Context(), req.Email); err != nil {
+		respondThrottled(c, err)
 		return
 	}
 
-	token, _, err := utils.GenerateTokens(user.Email, user.ID)
+	// The link is made and mailed after answering: known and unknown emails
+	// then take equally long, which would otherwise tell who has an account.
+	// A link being mailed at shutdown is still sent.
+	email := req.Email
+	ac.Go(func(ctx context.Context) { ac.sendResetLink(context.WithoutCancel(ctx), email) })
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// sendResetLink mails a reset link to the account using email, if there is
+// one. Failures are only logged; the link can be requested again.
+func (ac *AuthController) sendResetLink(ctx context.Context, email string) {
+	user, token, err := ac.Resets.CreateToken(ctx, email)
+	if errors.Is(err, services.ErrResetUnknownEmail) {
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		log.Printf("Failed to create reset link: %v", err)
 		return
 	}
 
-	frontendURL := os.Getenv("FRONTEND_URL") // should be http://localhost:3000
-	resetLink := frontendURL + "/reset-password?token=" + token
-
-	if err := SendResetEmail(user.Email, resetLink); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
-		return
+	resetLink := ac.FrontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	if err := ac.Mailer.SendResetEmail(user.Email, resetLink); err != nil {
+		log.Printf("Failed to send reset email to user %d: %v", user.ID, err)
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Reset link sent successfully", "token": token})
 }
 
-func ResetPassword(c *gin.Context) {
+func (ac *AuthController) ResetPassword(c *gin.Context) {
 	var req struct {
+		Token           string `json:"token" binding:"required"`
 		NewPassword     string `json:"new_password"`
 		ConfirmPassword string `json:"confirm_password"`
 	}
@@ -59,42 +69,27 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-		return
-	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	claims, err := utils.ValidateToken(tokenString, false)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
-	}
-
-	email, ok := claims["email"].(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
-		return
-	}
-
 	// Confirm password match
 	if req.NewPassword != req.ConfirmPassword {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
 		return
 	}
 
-	// Validate password format
+	// Validate password format before the token is used up
 	if err := utils.ValidatePassword(req.NewPassword); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	hashedPwd, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err := config.DB.Model(&models.User{}).Where("email = ?", email).Update("password", hashedPwd).Error; err != nil {
+	err := ac.Resets.Reset(c.Request.Context(), req.Token, req.NewPassword)
+	if errors.Is(err, services.ErrResetTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful. Log in again on every device."})
 }
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GradingController struct {
+	DB      *gorm.DB
+	Service services.GradingServiceInterface
+}
+
+func NewGradingController(db *gorm.DB, service services.GradingServiceInterface) *GradingController {
+	return &GradingController{DB: db, Service: service}
+}
+
+// authorizeGrading checks that the logged-in user may grade the test
+func authorizeGrading(c *gin.Context, db *gorm.DB, testID uint) (uint, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return 0, false
+	}
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
+		return 0, false
+	}
+	userID := uint(userIDFloat)
+
+	if err := utils.AuthorizeTest(c, db, utils.PermTestGrade, testID); err != nil {
+		if errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to grade this test"})
+		}
+		return 0, false
+	}
+	return userID, true
+}
+
+// authorizeRubric checks that the logged-in user may grade the tests that use
+// a question: one of them to read its rubric, all of them to change it, as
+// the rubric applies to every one. The rubric of a question no test uses
+// concerns no grades and is edited like the question. Questions the user's
+// tenant cannot see are not found.
+func (gc *GradingController) authorizeRubric(c *gin.Context, questionID uint, change bool) bool {
+	var question models.Question
+	if err := utils.RequestDB(c, gc.DB).Select("id").First(&question, questionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		}
+		return false
+	}
+
+	// Tests of every college count, since the rubric grades all of them
+	testIDs, err := gc.Service.QuestionTests(questionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if len(testIDs) == 0 {
+		if err := utils.Authorize(c, gc.DB, utils.PermQuestionEdit, utils.Resource{}); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to manage this rubric"})
+			return false
+		}
+		return true
+	}
+
+	allowed := 0
+	for _, testID := range testIDs {
+		if err := utils.AuthorizeTest(c, gc.DB, utils.PermTestGrade, testID); err == nil {
+			allowed++
+		} else if !errors.Is(err, utils.ErrForbidden) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return false
+		}
+	}
+	if allowed == 0 || (change && allowed < len(testIDs)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to grade every test that uses this question"})
+		return false
+	}
+	return true
+}
+
+// Ungraded descriptive answers of a test
+func (gc *GradingController) GetGradingQueue(c *gin.Context) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return
+	}
+	if _, ok := authorizeGrading(c, gc.DB, uint(testID)); !ok {
+		return
+	}
+
+	queue, err := gc.Service.WithContext(utils.RequestContext(c)).GradingQueue(uint(testID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grading queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_id": testID, "pending": len(queue), "answers": queue})
+}
+
+func (gc *GradingController) GradeAnswer(c *gin.Context) {
+	answerID, err := strconv.ParseUint(c.Param("answer_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid answer_id"})
+		return
+	}
+
+	answer, err := gc.Service.WithContext(utils.RequestContext(c)).FindAnswer(uint(answerID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+		return
+	}
+	graderID, ok := authorizeGrading(c, gc.DB, answer.TestID)
+	if !ok {
+		return
+	}
+
+	var input services.GradeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	graded, err := gc.Service.WithContext(utils.RequestContext(c)).GradeAnswer(uint(answerID), graderID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidGrade):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotDescriptive):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only descriptive answers are graded manually"})
+		case errors.Is(err, services.ErrAttemptNotFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": "Attempt has not been submitted yet"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade answer"})
+		}
+		return
+	}
+
+	utils.Audit(c, "grade", "student_answers", answer.ID, answer, graded)
+	c.JSON(http.StatusOK, gin.H{"message": "Answer graded successfully", "answer": graded})
+}
+
+func (gc *GradingController) GetRubric(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("question_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question_id"})
+		return
+	}
+	if !gc.authorizeRubric(c, uint(questionID), false) {
+		return
+	}
+
+	rubric, err := gc.Service.WithContext(utils.RequestContext(c)).GetRubric(uint(questionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rubric"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"question_id": questionID, "rubric": rubric})
+}
+
+func (gc *GradingController) SetRubric(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("question_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question_id"})
+		return
+	}
+	if !gc.authorizeRubric(c, uint(questionID), true) {
+		return
+	}
+
+	var input struct {
+		Criteria []services.RubricInput `json:"criteria" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	rubric, err := gc.Service.WithContext(utils.RequestContext(c)).SetRubric(uint(questionID), input.Criteria)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrQuestionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		case errors.Is(err, services.ErrNotDescriptive):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rubrics apply to descriptive questions only"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rubric"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rubric saved successfully", "rubric": rubric})
+}
+
+func (gc *GradingController) SetScoringPolicy(c *gin.Context) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return
+	}
+	if _, ok := authorizeGrading(c, gc.DB, uint(testID)); !ok {
+		return
+	}
+
+	var input services.ScoringInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	test, err := gc.Service.WithContext(utils.RequestContext(c)).SetScoringPolicy(uint(testID), input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scoring policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Scoring policy saved. Re-score the test to update existing results",
+		"test_id":          test.ID,
+		"negative_marking": test.NegativeMarking,
+		"easy_marks":       test.EasyMarks,
+		"medium_marks":     test.MediumMarks,
+		"hard_marks":       test.HardMarks,
+		"all_or_nothing":   test.AllOrNothing,
+	})
+}
+
+// Override the marks of one question of a test; null restores the difficulty default
+func (gc *GradingController) SetQuestionMarks(c *gin.Context) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return
+	}
+	questionID, err := strconv.ParseUint(c.Param("question_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question_id"})
+		return
+	}
+	if _, ok := authorizeGrading(c, gc.DB, uint(testID)); !ok {
+		return
+	}
+
+	var input struct {
+		Marks *float64 `json:"marks"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	testQuestion, err := gc.Service.WithContext(utils.RequestContext(c)).SetQuestionMarks(uint(testID), uint(questionID), input.Marks)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidGrade):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrQuestionNotInTest):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found in this test"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question marks"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_id": testQuestion.TestID, "question_id": testQuestion.QuestionID, "marks": testQuestion.Marks})
+}
+
+// Recompute every stored result of a test under its current scoring policy
+func (gc *GradingController) RescoreTest(c *gin.Context) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return
+	}
+	if _, ok := authorizeGrading(c, gc.DB, uint(testID)); !ok {
+		return
+	}
+
+	rescored, err := gc.Service.WithContext(utils.RequestContext(c)).RescoreTest(uint(testID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to re-score test"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test re-scored successfully", "test_id": testID, "results": rescored})
+}
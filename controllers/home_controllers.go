@@ -2,17 +2,18 @@ package controllers
 
 import (
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/utils"
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	// This is required for *gorm.DB
 )
 
-func GetTeacherHomeStats(c *gin.Context) {
-	role := c.GetString("role")
-
+// GetTeacherHomeStats counts what the logged-in user created; the route
+// requires dashboard:view
+func GetTeacherHomeStats(c *gin.Context, db *gorm.DB) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
@@ -26,11 +27,6 @@ func GetTeacherHomeStats(c *gin.Context) {
 	}
 	userID := uint(userIDFloat)
 
-	if role != "teacher" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	var (
 		testCount        int64
 		questionCount    int64
@@ -40,12 +36,12 @@ func GetTeacherHomeStats(c *gin.Context) {
 	)
 
 	// Count total tests created by teacher
-	config.DB.Model(&models.Test{}).
+	db.Model(&models.Test{}).
 		Where("user_id = ?", userID).
 		Count(&testCount)
 
 	// Count all test questions (across all tests created by teacher)
-	config.DB.
+	db.
 		Table("test_questions").
 		Joins("JOIN tests ON tests.id = test_questions.test_id").
 		Where("tests.user_id = ?", userID).
@@ -53,24 +49,24 @@ func GetTeacherHomeStats(c *gin.Context) {
 
 	// Count categories created by the teacher (based on creator name matching user name)
 	var teacher models.User
-	if err := config.DB.First(&teacher, userID).Error; err != nil {
+	if err := db.First(&teacher, userID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user info"})
 		return
 	}
 
-	config.DB.Model(&models.Category{}).
+	db.Model(&models.Category{}).
 		Where("creator_name = ?", teacher.Name).
 		Count(&categoryCount)
 
 	// Count questions in categories created by this teacher (assuming test linkage)
-	config.DB.
+	db.
 		Table("test_questions").
 		Joins("JOIN tests ON tests.id = test_questions.test_id").
 		Where("tests.user_id = ?", userID).
 		Count(&catQuestionCount)
 
 	// Count students registered by this teacher
-	config.DB.Model(&models.Student{}).
+	db.Model(&models.Student{}).
 		Where("registered_by = ?", userID).
 		Count(&studentCount)
 
@@ -83,9 +79,7 @@ func GetTeacherHomeStats(c *gin.Context) {
 	})
 }
 
-func GetHomeStats(c *gin.Context) {
-	db := config.DB
-
+func GetHomeStats(c *gin.Context, db *gorm.DB) {
 	var (
 		totalUsers              int64
 		totalColleges           int64
@@ -115,13 +109,13 @@ func GetHomeStats(c *gin.Context) {
 	// Active Teachers
 	go func() {
 		defer wg.Done()
-		db.Model(&models.Teacher{}).Where("status = ?", "active").Count(&activeTeachers)
+		db.Model(&models.User{}).Where("role = ? AND status = ?", utils.RoleTeacher, utils.StatusActive).Count(&activeTeachers)
 	}()
 
 	// Active Students
 	go func() {
 		defer wg.Done()
-		db.Model(&models.Student{}).Where("status = ?", "active").Count(&activeStudents)
+		db.Model(&models.User{}).Where("role = ? AND status = ?", utils.RoleStudent, utils.StatusActive).Count(&activeStudents)
 	}()
 
 	// Total Test Questions
@@ -139,23 +133,20 @@ func GetHomeStats(c *gin.Context) {
 	// Categories with questions (excluding 'New Category')
 	go func() {
 		defer wg.Done()
-		db.Raw(`
-		SELECT COUNT(DISTINCT c.id)
-		FROM categories c
-		INNER JOIN questions q ON c.id = q.category_id
-		WHERE c.name IS NOT NULL AND TRIM(c.name) != 'New Category'
-	`).Scan(&categoriesWithQuestions)
+		db.Model(&models.Category{}).
+			Joins("JOIN questions ON questions.category_id = categories.id AND questions.deleted_at IS NULL").
+			Where("categories.name IS NOT NULL AND TRIM(categories.name) != ?", "New Category").
+			Distinct("categories.id").
+			Count(&categoriesWithQuestions)
 	}()
 
 	// Questions in categories (excluding 'New Category')
 	go func() {
 		defer wg.Done()
-		db.Raw(`
-		SELECT COUNT(q.id)
-		FROM questions q
-		INNER JOIN categories c ON c.id = q.category_id
-		WHERE c.name IS NOT NULL AND TRIM(c.name) != 'New Category'
-	`).Scan(&questionsInCategories)
+		db.Model(&models.Question{}).
+			Joins("JOIN categories ON categories.id = questions.category_id AND categories.deleted_at IS NULL").
+			Where("categories.name IS NOT NULL AND TRIM(categories.name) != ?", "New Category").
+			Count(&questionsInCategories)
 	}()
 
 	// Wait for all goroutines
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultMinServed is how many students must have seen a question before its
+// difficulty is set from the statistics
+const defaultMinServed = 20
+
+type ItemAnalysisController struct {
+	DB      *gorm.DB
+	Service services.ItemAnalysisServiceInterface
+}
+
+func NewItemAnalysisController(db *gorm.DB, service services.ItemAnalysisServiceInterface) *ItemAnalysisController {
+	return &ItemAnalysisController{DB: db, Service: service}
+}
+
+// analysisTestID reads the test from the path and checks that the logged-in user may view its reports
+func analysisTestID(c *gin.Context, db *gorm.DB) (uint, uint, bool) {
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return 0, 0, false
+	}
+
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return 0, 0, false
+	}
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
+		return 0, 0, false
+	}
+
+	if err := utils.AuthorizeTest(c, db, utils.PermReportView, uint(testID)); err != nil {
+		if errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this test"})
+		}
+		return 0, 0, false
+	}
+	return uint(testID), uint(userIDFloat), true
+}
+
+// Item statistics of every question of a test
+func (ac *ItemAnalysisController) AnalyzeTest(c *gin.Context) {
+	testID, _, ok := analysisTestID(c, ac.DB)
+	if !ok {
+		return
+	}
+
+	analysis, err := ac.Service.WithContext(utils.RequestContext(c)).AnalyzeTest(testID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze test"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+// Set question difficulties from their observed difficulty index
+func (ac *ItemAnalysisController) ApplyDifficulty(c *gin.Context) {
+	testID, userID, ok := analysisTestID(c, ac.DB)
+	if !ok {
+		return
+	}
+
+	minServed, err := strconv.Atoi(c.DefaultQuery("min_served", strconv.Itoa(defaultMinServed)))
+	if err != nil || minServed < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_served must be a positive number"})
+		return
+	}
+
+	changes, err := ac.Service.WithContext(utils.RequestContext(c)).ApplySuggestedDifficulty(testID, minServed, &userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question difficulty"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question difficulty updated", "changes": changes})
+}
@@ -2,17 +2,20 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log"
+	"math"
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/services"
 	"pathshala/utils"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Login(c *gin.Context) {
+func (ac *AuthController) Login(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
@@ -23,40 +26,97 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	config.DB.Where("email = ?", input.Email).First(&user)
-	if user.ID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// The attempt counts as failed from here until the login succeeds
+	ctx, ip := c.Request.Context(), c.ClientIP()
+	if err := ac.Guard.Attempt(ctx, input.Email, ip); err != nil {
+		respondThrottled(c, err)
 		return
 	}
 
-	if !utils.CheckPasswordHash(input.Password, user.Password) {
+	var user models.User
+	ac.DB.Where("email = ?", input.Email).First(&user)
+	if user.ID == 0 || !utils.CheckPasswordHash(input.Password, user.Password) {
+		ac.Guard.Failed()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if user.Status != utils.StatusActive {
+		ac.passed(ctx, input.Email, ip)
+		c.JSON(http.StatusForbidden, gin.H{"error": utils.StatusMessage(user.Status), "status": user.Status})
+		return
+	}
 
-	accessToken, refreshToken, _ := utils.GenerateTokens(user.Email, user.ID)
-
-	ctx := context.Background()
-	err := config.RedisClient.Set(ctx, "access_token:"+accessToken, "valid", 15*time.Minute).Err()
+	needsMFA, err := ac.MFA.LoginNeedsMFA(&user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store access token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check MFA"})
+		return
+	}
+	if needsMFA {
+		// The password was right; the tokens, and clearing the failures,
+		// wait for the second step
+		ac.passed(ctx, input.Email, ip)
+		challenge, err := ac.MFA.StartChallenge(c.Request.Context(), &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA challenge"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":        true,
+			"mfa_token":           challenge.Token,
+			"enrollment_required": challenge.EnrollmentRequired,
+			"expires_in":          challenge.ExpiresIn,
+		})
 		return
 	}
 
-	err = config.RedisClient.Set(ctx, "refresh_token:"+user.Email, refreshToken, 7*24*time.Hour).Err()
+	if err := ac.Guard.Succeeded(ctx, input.Email, ip); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+	tokens, err := ac.issueTokens(c, &user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, tokens)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+// passed tells the guard a password was right although the user is not
+// logged in yet
+func (ac *AuthController) passed(ctx context.Context, email, ip string) {
+	if err := ac.Guard.Passed(ctx, email, ip); err != nil {
+		log.Printf("Failed to record correct password: %v", err)
+	}
 }
 
-func Logout(c *gin.Context) {
+// respondThrottled refuses a login attempt the guard did not allow
+func respondThrottled(c *gin.Context, err error) {
+	var throttled *services.ThrottledError
+	if !errors.As(err, &throttled) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error(), "locked": throttled.Locked, "retry_after": retryAfter})
+}
+
+// issueTokens starts a session for a logged-in user on the requesting device
+func (ac *AuthController) issueTokens(c *gin.Context, user *models.User) (gin.H, error) {
+	tokens, err := ac.Sessions.Create(c.Request.Context(), user, requestDevice(c))
+	if err != nil {
+		return nil, errors.New("failed to start session")
+	}
+	return gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	}, nil
+}
+
+func requestDevice(c *gin.Context) services.Device {
+	return services.Device{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func (ac *AuthController) Logout(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -73,7 +133,7 @@ func Logout(c *gin.Context) {
 
 	//Check if token exists in Redis (whitelisted)
 	redisKey := "access_token:" + accessToken
-	exists, err := config.RedisClient.Exists(config.Ctx, redisKey).Result()
+	exists, err := ac.Redis.Exists(c.Request.Context(), redisKey).Result()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking token status"})
 		return
@@ -83,25 +143,22 @@ func Logout(c *gin.Context) {
 		return
 	}
 
-	//Delete the access token from Redis
-	if err := config.RedisClient.Del(config.Ctx, redisKey).Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete access token"})
-		return
-	}
-
-	//Extract email from token claims to delete refresh token
-	claims, err := utils.ValidateToken(accessToken, false)
+	claims, err := ac.Tokens.ValidateToken(c.Request.Context(), accessToken, false)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
 
-	email := claims["email"].(string)
-
-	//Delete refresh token using email key
-	refreshKey := "refresh_token:" + email
-	if err := config.RedisClient.Del(config.Ctx, refreshKey).Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete refresh token"})
+	// Ending the session drops its refresh token and this access token;
+	// the user's other devices stay logged in
+	sessionID, _ := claims["sid"].(string)
+	userID, _ := claims["user_id"].(float64)
+	err = ac.Sessions.Revoke(c.Request.Context(), uint(userID), sessionID)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		err = ac.Redis.Del(c.Request.Context(), redisKey).Err()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
 		return
 	}
 
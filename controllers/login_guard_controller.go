@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LoginGuardController lets admins lift login lockouts before they expire
+type LoginGuardController struct {
+	DB    *gorm.DB
+	Guard services.LoginGuardServiceInterface
+}
+
+func NewLoginGuardController(db *gorm.DB, guard services.LoginGuardServiceInterface) *LoginGuardController {
+	return &LoginGuardController{DB: db, Guard: guard}
+}
+
+// UnlockUser clears the failed logins and lockout of a user's account
+func (lc *LoginGuardController) UnlockUser(c *gin.Context) {
+	var user models.User
+	if err := lc.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	res, err := utils.UserResource(lc.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	if !authorizeUserChange(c, lc.DB, user.Role, res) {
+		return
+	}
+
+	if err := lc.Guard.Unlock(c.Request.Context(), services.LockAccount, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	utils.Audit(c, "unlock", "users", user.ID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// UnlockIP clears the failed logins and lockout of an IP, e.g. a campus
+// behind one NAT address
+func (lc *LoginGuardController) UnlockIP(c *gin.Context) {
+	var input struct {
+		IP string `json:"ip" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || net.ParseIP(input.IP) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid ip is required"})
+		return
+	}
+
+	if err := lc.Guard.Unlock(c.Request.Context(), services.LockIP, input.IP); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock IP"})
+		return
+	}
+	utils.Audit(c, "unlock", "login_ips", input.IP, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "IP unlocked"})
+}
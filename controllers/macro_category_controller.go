@@ -3,15 +3,15 @@ package controllers
 import (
 	"fmt"
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreateMacroCategory adds a new macro category
-func CreateMacroCategory(c *gin.Context) {
+func CreateMacroCategory(c *gin.Context, db *gorm.DB) {
 	var macroCategory models.MacroCategory
 
 	if err := c.ShouldBindJSON(&macroCategory); err != nil {
@@ -24,7 +24,7 @@ func CreateMacroCategory(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Create(&macroCategory).Error; err != nil {
+	if err := db.Create(&macroCategory).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create macro category"})
 		return
 	}
@@ -32,7 +32,7 @@ func CreateMacroCategory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Macro category created successfully", "data": macroCategory})
 }
 
-func GetAllMacroCategories(c *gin.Context) {
+func GetAllMacroCategories(c *gin.Context, db *gorm.DB) {
 	column := c.Query("column")
 	value := c.Query("value")
 
@@ -46,7 +46,7 @@ func GetAllMacroCategories(c *gin.Context) {
 
 	var total int64
 	var macroCategories []models.MacroCategory
-	query := config.DB.Model(&models.MacroCategory{})
+	query := db.Model(&models.MacroCategory{})
 
 	// Search by column if provided
 	if column != "" && value != "" {
@@ -82,7 +82,7 @@ func GetAllMacroCategories(c *gin.Context) {
 }
 
 // UpdateMacroCategory modifies a macro category by ID
-func UpdateMacroCategory(c *gin.Context) {
+func UpdateMacroCategory(c *gin.Context, db *gorm.DB) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -91,7 +91,7 @@ func UpdateMacroCategory(c *gin.Context) {
 	}
 
 	var macroCategory models.MacroCategory
-	if err := config.DB.First(&macroCategory, id).Error; err != nil {
+	if err := db.First(&macroCategory, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Macro category not found"})
 		return
 	}
@@ -106,7 +106,7 @@ func UpdateMacroCategory(c *gin.Context) {
 	macroCategory.Description = updatedData.Description
 	// macroCategory.UserID = updatedData.UserID
 
-	if err := config.DB.Save(&macroCategory).Error; err != nil {
+	if err := db.Save(&macroCategory).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update macro category"})
 		return
 	}
@@ -115,7 +115,7 @@ func UpdateMacroCategory(c *gin.Context) {
 }
 
 // DeleteMacroCategory removes a macro category by ID
-func DeleteMacroCategory(c *gin.Context) {
+func DeleteMacroCategory(c *gin.Context, db *gorm.DB) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -123,7 +123,7 @@ func DeleteMacroCategory(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&models.MacroCategory{}, id).Error; err != nil {
+	if err := db.Delete(&models.MacroCategory{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete macro category"})
 		return
 	}
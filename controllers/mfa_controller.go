@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrMFAInvalidCode), errors.Is(err, services.ErrMFAChallengeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFANotEnrolled), errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFARequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// mfaLoginInput is the second login step. Code is a TOTP code or a recovery
+// code.
+type mfaLoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// EnrollMFALogin starts enrollment for a user whose role requires MFA and
+// who has none yet, as part of logging in
+func (ac *AuthController) EnrollMFALogin(c *gin.Context) {
+	var input mfaLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := ac.MFA.ChallengeEnrollment(c.Request.Context(), input.MFAToken)
+	if err != nil {
+		respondMFAError(c, err, "Failed to start MFA enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// VerifyMFALogin finishes a login that needs a second factor. For a user who
+// was enrolling, the code confirms the enrollment and the recovery codes
+// come back with the tokens. Codes are throttled as login attempts of the
+// account, and only a right one clears its failed logins.
+func (ac *AuthController) VerifyMFALogin(c *gin.Context) {
+	var input mfaLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required"})
+		return
+	}
+
+	ctx, ip := c.Request.Context(), c.ClientIP()
+	challenged, err := ac.MFA.ChallengeUser(ctx, input.MFAToken)
+	if err != nil {
+		respondMFAError(c, err, "Failed to verify code")
+		return
+	}
+	if err := ac.Guard.Attempt(ctx, challenged.Email, ip); err != nil {
+		respondThrottled(c, err)
+		return
+	}
+
+	user, recoveryCodes, err := ac.MFA.CompleteChallenge(ctx, input.MFAToken, input.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAInvalidCode) {
+			ac.Guard.Failed()
+		}
+		respondMFAError(c, err, "Failed to verify code")
+		return
+	}
+	// The status may have changed since the password step
+	if user.Status != utils.StatusActive {
+		ac.passed(ctx, user.Email, ip)
+		c.JSON(http.StatusForbidden, gin.H{"error": utils.StatusMessage(user.Status), "status": user.Status})
+		return
+	}
+	if err := ac.Guard.Succeeded(ctx, user.Email, ip); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+
+	tokens, err := ac.issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if recoveryCodes != nil {
+		tokens["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// currentUser loads the logged-in user
+func (ac *AuthController) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := ac.DB.First(&user, uint(c.GetFloat64("user_id"))).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// mfaCodeInput confirms account changes with a current code
+type mfaCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (ac *AuthController) GetMFAStatus(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+	status, err := ac.MFA.Status(user)
+	if err != nil {
+		respondMFAError(c, err, "Failed to fetch MFA status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// BeginMFAEnrollment returns a new secret and its provisioning URI. MFA is
+// not on until ConfirmMFAEnrollment.
+func (ac *AuthController) BeginMFAEnrollment(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+	enrollment, err := ac.MFA.BeginEnrollment(user)
+	if err != nil {
+		respondMFAError(c, err, "Failed to start MFA enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (ac *AuthController) ConfirmMFAEnrollment(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := ac.MFA.ConfirmEnrollment(uint(c.GetFloat64("user_id")), input.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to enable MFA")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "MFA enabled", "recovery_codes": codes})
+}
+
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := ac.MFA.RegenerateRecoveryCodes(uint(c.GetFloat64("user_id")), input.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to create recovery codes")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (ac *AuthController) DisableMFA(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := ac.MFA.Disable(user, input.Code); err != nil {
+		respondMFAError(c, err, "Failed to disable MFA")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
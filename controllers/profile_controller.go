@@ -1,20 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"path/filepath"
-	"pathshala/config"
 	"pathshala/models"
-	"pathshala/utils"
-	"strings"
+	"pathshala/storage"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
 	_ "github.com/lib/pq"
 )
 
-func GetProfile(c *gin.Context) {
+func GetProfile(c *gin.Context, db *gorm.DB) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -23,7 +22,7 @@ func GetProfile(c *gin.Context) {
 	userID := uint(userIDInterface.(float64))
 
 	var user models.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
+	if err := db.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -38,7 +37,7 @@ func GetProfile(c *gin.Context) {
 	})
 }
 
-func UpdateProfile(c *gin.Context) {
+func UpdateProfile(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -47,7 +46,7 @@ func UpdateProfile(c *gin.Context) {
 	userID := uint(userIDInterface.(float64))
 
 	var user models.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
+	if err := db.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -67,19 +66,14 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	// Handle image upload
+	oldImage := user.Profile_image
 	if imageFile != nil {
-		ext := strings.ToLower(filepath.Ext(imageFile.Filename))
-		allowed := map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
-		if !allowed[ext] {
+		// Save new image
+		savedPath, err := storage.SaveUpload(c.Request.Context(), store, storage.FolderProfiles, imageFile, storage.ProfileImageTypes)
+		if errors.Is(err, storage.ErrUnsupportedType) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported image format"})
 			return
 		}
-
-		// Delete old image if exists
-		utils.DeleteFileIfExists(user.Profile_image)
-
-		// Save new image
-		savedPath, err := utils.SaveUploadedFile(imageFile, "uploads/profiles")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
 			return
@@ -88,10 +82,18 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	// Save to DB
-	if err := config.DB.Save(&user).Error; err != nil {
+	if err := db.Save(&user).Error; err != nil {
+		if user.Profile_image != oldImage {
+			storage.Remove(c.Request.Context(), store, user.Profile_image)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
+	// Delete old image once the profile no longer points at it
+	if user.Profile_image != oldImage {
+		storage.Remove(c.Request.Context(), store, oldImage)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
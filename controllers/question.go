@@ -10,11 +10,13 @@ import (
 	"strings"
 	"time"
 
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
 	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -47,36 +49,54 @@ type DescriptiveRequest struct {
 }
 
 // 1. Add Questions
-func AddQuestion(c *gin.Context) {
+func AddQuestion(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	questionType := strings.ToUpper(c.PostForm("question_type"))
 
+	var question *models.Question
+	var err error
 	switch questionType {
 	case "MCQ":
-		handleMCQQuestion(c)
+		question, err = handleMCQQuestion(c, db, store)
 	case "TRUE_FALSE":
-		handleTrueFalseQuestion(c)
+		question, err = handleTrueFalseQuestion(c, db, store)
 	case "DESCRIPTIVE":
-		handleDescriptiveQuestion(c)
+		question, err = handleDescriptiveQuestion(c, db, store)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question_type. Must be MCQ, TRUE_FALSE, or DESCRIPTIVE"})
+		return
+	}
+	if err == nil {
+		utils.Audit(c, "create", "questions", question.ID, nil, questionSnapshot(db, question.ID))
+	}
+}
+
+// questionSnapshot is a question with its options, as recorded in the audit log
+func questionSnapshot(db *gorm.DB, id uint) *models.Question {
+	var question models.Question
+	if err := db.Preload("Options").First(&question, id).Error; err != nil {
+		return nil
 	}
+	return &question
 }
 
 // MCQ
-func handleMCQQuestion(c *gin.Context) (*models.Question, error) {
+func handleMCQQuestion(c *gin.Context, db *gorm.DB, store storage.Storage) (*models.Question, error) {
 	var req MCQRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
 
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -106,7 +126,7 @@ func handleMCQQuestion(c *gin.Context) (*models.Question, error) {
 		CommentDisplayTime: req.CommentTime,
 	}
 
-	if err := config.DB.Create(&question).Error; err != nil {
+	if err := db.Create(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		return nil, errors.New("something went wrong")
 	}
@@ -121,7 +141,7 @@ func handleMCQQuestion(c *gin.Context) (*models.Question, error) {
 				OptionText: optionText,
 				IsCorrect:  isCorrect,
 			}
-			config.DB.Create(&option)
+			db.Create(&option)
 		}
 	}
 
@@ -131,20 +151,23 @@ func handleMCQQuestion(c *gin.Context) (*models.Question, error) {
 }
 
 // True/False
-func handleTrueFalseQuestion(c *gin.Context) (*models.Question, error) {
+func handleTrueFalseQuestion(c *gin.Context, db *gorm.DB, store storage.Storage) (*models.Question, error) {
 	var req TrueFalseRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
 
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -174,7 +197,7 @@ func handleTrueFalseQuestion(c *gin.Context) (*models.Question, error) {
 		CommentDisplayTime: req.CommentTime,
 	}
 
-	if err := config.DB.Create(&question).Error; err != nil {
+	if err := db.Create(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		return nil, errors.New("something went wrong")
 	}
@@ -188,7 +211,7 @@ func handleTrueFalseQuestion(c *gin.Context) (*models.Question, error) {
 			OptionText: text,
 			IsCorrect:  isCorrect,
 		}
-		config.DB.Create(&option)
+		db.Create(&option)
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "True/False question added successfully"})
@@ -197,20 +220,23 @@ func handleTrueFalseQuestion(c *gin.Context) (*models.Question, error) {
 }
 
 // Descriptive
-func handleDescriptiveQuestion(c *gin.Context) (*models.Question, error) {
+func handleDescriptiveQuestion(c *gin.Context, db *gorm.DB, store storage.Storage) (*models.Question, error) {
 	var req DescriptiveRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
 
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -239,7 +265,7 @@ func handleDescriptiveQuestion(c *gin.Context) (*models.Question, error) {
 		CommentDisplayTime: req.CommentTime,
 	}
 
-	if err := config.DB.Create(&question).Error; err != nil {
+	if err := db.Create(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		return nil, errors.New("something went wrong")
 	}
@@ -253,7 +279,7 @@ func handleDescriptiveQuestion(c *gin.Context) (*models.Question, error) {
 	}
 
 	// log.Println("Descriptive Answer:", req.DescriptiveAnswer)
-	if err := config.DB.Create(&descriptiveOption).Error; err != nil {
+	if err := db.Create(&descriptiveOption).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save descriptive answer"})
 		return nil, errors.New("something went wrong")
 	}
@@ -263,7 +289,7 @@ func handleDescriptiveQuestion(c *gin.Context) (*models.Question, error) {
 	return &question, nil
 }
 
-func handleOptionalImage(c *gin.Context, field string, displayTime *int) (string, error) {
+func handleOptionalImage(c *gin.Context, store storage.Storage, field string, displayTime *int) (string, error) {
 	file, err := c.FormFile(field)
 	if err != nil {
 		if displayTime != nil {
@@ -282,33 +308,45 @@ func handleOptionalImage(c *gin.Context, field string, displayTime *int) (string
 		return "", fmt.Errorf("%s must be less than %dKB", field, maxSizeKB)
 	}
 
-	uploadPath := "uploads/questions/"
-	savedPath, err := utils.SaveUploadedFile(file, uploadPath)
+	key, err := storage.SaveUpload(c.Request.Context(), store, storage.FolderQuestions, file, storage.ImageTypes)
+	if errors.Is(err, storage.ErrUnsupportedType) {
+		return "", fmt.Errorf("%s must be a PNG, JPEG, GIF, WebP or BMP image", field)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to save %s: %v", field, err)
 	}
 
-	return savedPath, nil
+	return key, nil
 }
 
 // 2. Edit Questions
-func EditQuestion(c *gin.Context) {
+func EditQuestion(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	questionType := strings.ToUpper(c.PostForm("question_type"))
 	questionID := c.Param("id")
+	var before *models.Question
+	if id, err := strconv.ParseUint(questionID, 10, 64); err == nil {
+		before = questionSnapshot(db, uint(id))
+	}
 
+	var question *models.Question
+	var err error
 	switch questionType {
 	case "MCQ":
-		handleEditMCQ(c, questionID)
+		question, err = handleEditMCQ(c, db, store, questionID)
 	case "TRUE_FALSE":
-		handleEditTrueFalse(c, questionID)
+		question, err = handleEditTrueFalse(c, db, store, questionID)
 	case "DESCRIPTIVE":
-		handleEditDescriptive(c, questionID)
+		question, err = handleEditDescriptive(c, db, store, questionID)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question_type. Must be MCQ, TRUE_FALSE, or DESCRIPTIVE"})
+		return
+	}
+	if err == nil {
+		utils.Audit(c, "update", "questions", question.ID, before, questionSnapshot(db, question.ID))
 	}
 }
 
-func handleEditMCQ(c *gin.Context, questionID string) (*models.Question, error) {
+func handleEditMCQ(c *gin.Context, db *gorm.DB, store storage.Storage, questionID string) (*models.Question, error) {
 	var req MCQRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
@@ -316,18 +354,27 @@ func handleEditMCQ(c *gin.Context, questionID string) (*models.Question, error)
 	}
 
 	var question models.Question
-	if err := config.DB.First(&question, questionID).Error; err != nil {
+	if err := utils.ScopeToTenant(c, db).First(&question, questionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, question.CategoryID) || !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	// Keep the question as it is now, attempts may have been served it
+	if _, err := services.EnsureQuestionRevision(db, question.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record question revision"})
+		return nil, errors.New("something went wrong")
+	}
+
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
 
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -353,23 +400,21 @@ func handleEditMCQ(c *gin.Context, questionID string) (*models.Question, error)
 	question.CommentDisplayTime = req.CommentTime
 
 	if image1Path != "" {
-		utils.DeleteFileIfExists(question.Image1) // delete old image
 		question.Image1 = image1Path
 		question.Image1DisplayTime = req.Image1Time
 	}
 	if image2Path != "" {
-		utils.DeleteFileIfExists(question.Image2) // delete old image
 		question.Image2 = image2Path
 		question.Image2DisplayTime = req.Image2Time
 	}
 
-	if err := config.DB.Save(&question).Error; err != nil {
+	if err := db.Save(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
 		return nil, errors.New("something went wrong")
 	}
 
 	// Delete existing options
-	config.DB.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{})
+	db.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{})
 
 	// Add new options
 	for i := 1; i <= 5; i++ {
@@ -382,15 +427,19 @@ func handleEditMCQ(c *gin.Context, questionID string) (*models.Question, error)
 				OptionText: optionText,
 				IsCorrect:  isCorrect,
 			}
-			config.DB.Create(&option)
+			db.Create(&option)
 		}
 	}
 
+	if !recordEditedQuestion(c, db, question.ID) {
+		return nil, errors.New("something went wrong")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "MCQ question updated successfully"})
 	return &question, nil
 }
 
-func handleEditTrueFalse(c *gin.Context, questionID string) (*models.Question, error) {
+func handleEditTrueFalse(c *gin.Context, db *gorm.DB, store storage.Storage, questionID string) (*models.Question, error) {
 	var req TrueFalseRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
@@ -398,17 +447,26 @@ func handleEditTrueFalse(c *gin.Context, questionID string) (*models.Question, e
 	}
 
 	var question models.Question
-	if err := config.DB.First(&question, questionID).Error; err != nil {
+	if err := utils.ScopeToTenant(c, db).First(&question, questionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, question.CategoryID) || !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
+
+	// Keep the question as it is now, attempts may have been served it
+	if _, err := services.EnsureQuestionRevision(db, question.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record question revision"})
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -433,23 +491,21 @@ func handleEditTrueFalse(c *gin.Context, questionID string) (*models.Question, e
 	question.CommentDisplayTime = req.CommentTime
 
 	if image1Path != "" {
-		utils.DeleteFileIfExists(question.Image1) // delete old image
 		question.Image1 = image1Path
 		question.Image1DisplayTime = req.Image1Time
 	}
 	if image2Path != "" {
-		utils.DeleteFileIfExists(question.Image2) // delete old image
 		question.Image2 = image2Path
 		question.Image2DisplayTime = req.Image2Time
 	}
 
-	if err := config.DB.Save(&question).Error; err != nil {
+	if err := db.Save(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
 		return nil, errors.New("something went wrong")
 	}
 
 	// Replace True/False options
-	config.DB.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{})
+	db.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{})
 	options := []string{"True", "False"}
 	for i, text := range options {
 		isCorrect := uint(i+1) == req.CorrectOptionID
@@ -459,14 +515,18 @@ func handleEditTrueFalse(c *gin.Context, questionID string) (*models.Question, e
 			OptionText: text,
 			IsCorrect:  isCorrect,
 		}
-		config.DB.Create(&option)
+		db.Create(&option)
+	}
+
+	if !recordEditedQuestion(c, db, question.ID) {
+		return nil, errors.New("something went wrong")
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "True/False question updated successfully"})
 	return &question, nil
 }
 
-func handleEditDescriptive(c *gin.Context, questionID string) (*models.Question, error) {
+func handleEditDescriptive(c *gin.Context, db *gorm.DB, store storage.Storage, questionID string) (*models.Question, error) {
 	var req DescriptiveRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
@@ -474,17 +534,26 @@ func handleEditDescriptive(c *gin.Context, questionID string) (*models.Question,
 	}
 
 	var question models.Question
-	if err := config.DB.First(&question, questionID).Error; err != nil {
+	if err := utils.ScopeToTenant(c, db).First(&question, questionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		return nil, errors.New("something went wrong")
 	}
+	if !ownsCategory(c, db, question.CategoryID) || !ownsCategory(c, db, req.CategoryID) {
+		return nil, errors.New("something went wrong")
+	}
+
+	// Keep the question as it is now, attempts may have been served it
+	if _, err := services.EnsureQuestionRevision(db, question.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record question revision"})
+		return nil, errors.New("something went wrong")
+	}
 
-	image1Path, err := handleOptionalImage(c, "image1", req.Image1Time)
+	image1Path, err := handleOptionalImage(c, store, "image1", req.Image1Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
 	}
-	image2Path, err := handleOptionalImage(c, "image2", req.Image2Time)
+	image2Path, err := handleOptionalImage(c, store, "image2", req.Image2Time)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return nil, errors.New("something went wrong")
@@ -508,39 +577,58 @@ func handleEditDescriptive(c *gin.Context, questionID string) (*models.Question,
 	question.CommentDisplayTime = req.CommentTime
 
 	if image1Path != "" {
-		utils.DeleteFileIfExists(question.Image1) // delete old image
 		question.Image1 = image1Path
 		question.Image1DisplayTime = req.Image1Time
 	}
 	if image2Path != "" {
-		utils.DeleteFileIfExists(question.Image1) // delete old image
 		question.Image2 = image2Path
 		question.Image2DisplayTime = req.Image2Time
 	}
 
-	if err := config.DB.Save(&question).Error; err != nil {
+	if err := db.Save(&question).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
 		return nil, errors.New("something went wrong")
 	}
 
-	// Save descriptive answer in question_options
+	// Replace descriptive answer in question_options
+	db.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{})
 	descriptiveOption := models.QuestionOption{
 		QuestionID: question.ID,
 		OptionID:   1, // Default value for descriptive
 		OptionText: req.DescriptiveAnswer,
 		IsCorrect:  true,
 	}
-	if err := config.DB.Create(&descriptiveOption).Error; err != nil {
+	if err := db.Create(&descriptiveOption).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save descriptive answer"})
 		return nil, errors.New("something went wrong")
 	}
 
+	if !recordEditedQuestion(c, db, question.ID) {
+		return nil, errors.New("something went wrong")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Descriptive question updated successfully"})
 	return &question, nil
 }
 
+// recordEditedQuestion stores the edited question as a new revision
+func recordEditedQuestion(c *gin.Context, db *gorm.DB, questionID uint) bool {
+	var editorID *uint
+	if userIDVal, exists := c.Get("user_id"); exists {
+		if userIDFloat, ok := userIDVal.(float64); ok {
+			id := uint(userIDFloat)
+			editorID = &id
+		}
+	}
+	if _, err := services.RecordQuestionRevision(db, questionID, editorID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record question revision"})
+		return false
+	}
+	return true
+}
+
 // 3. Delete questions
-func DeleteQuestion(c *gin.Context) {
+func DeleteQuestion(c *gin.Context, db *gorm.DB) {
 	// Parse question ID from the path
 	idParam := c.Param("id")
 	questionID, err := strconv.Atoi(idParam)
@@ -551,7 +639,7 @@ func DeleteQuestion(c *gin.Context) {
 
 	// Check if the question exists
 	var question models.Question
-	if err := config.DB.First(&question, questionID).Error; err != nil {
+	if err := utils.ScopeToTenant(c, db).First(&question, questionID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		} else {
@@ -559,39 +647,19 @@ func DeleteQuestion(c *gin.Context) {
 		}
 		return
 	}
-
-	// Begin transaction
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+	if !ownsCategory(c, db, question.CategoryID) {
 		return
 	}
+	before := questionSnapshot(db, question.ID)
 
-	// Delete options
-	if err := tx.Where("question_id = ?", question.ID).Delete(&models.QuestionOption{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question options"})
-		return
-	}
-
-	// Delete images from disk before deleting the question record
-	utils.DeleteFileIfExists(question.Image1)
-	utils.DeleteFileIfExists(question.Image2)
-
-	// Delete question
-	if err := tx.Delete(&question).Error; err != nil {
-		tx.Rollback()
+	// Options and images are kept until the question is purged from the trash
+	if err := services.NewTrashService(db, nil, 0).Delete(services.TrashQuestions, question.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question"})
 		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Question and its options deleted successfully"})
+	utils.Audit(c, "delete", "questions", question.ID, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Question moved to trash"})
 }
 
 type QuestionResponse struct {
@@ -601,7 +669,7 @@ type QuestionResponse struct {
 }
 
 // 4. Get Questions
-func GetQuestions(c *gin.Context) {
+func GetQuestions(c *gin.Context, db *gorm.DB, cache *redis.Client) {
 	column := c.Query("column")
 	value := c.Query("value")
 
@@ -616,10 +684,17 @@ func GetQuestions(c *gin.Context) {
 	}
 	var totalCount int64
 
+	// Questions are listed per college, so the cache is too
+	tenant, err := utils.CurrentTenant(c, db)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+		return
+	}
+	cacheKey := fmt.Sprintf("questions:tenant:%s:page:%d:limit:%d", tenant.Key(), page, limit)
+
 	// Check cache for first page without filters
 	if column == "" && value == "" && page == 1 {
-		cacheKey := fmt.Sprintf("questions:page:%d:limit:%d", page, limit)
-		cachedData, err := config.RedisClient.Get(config.Ctx, cacheKey).Result()
+		cachedData, err := cache.Get(c.Request.Context(), cacheKey).Result()
 		if err == nil {
 			log.Println("Cache hit for questions")
 
@@ -634,12 +709,14 @@ func GetQuestions(c *gin.Context) {
 	}
 
 	// Build query
-	query := config.DB.Table("questions").
+	query := utils.ScopeToTenant(c, db).Table("questions").
 		Select("questions.id, questions.question_text, categories.name AS category_name").
-		Joins("LEFT JOIN categories ON questions.category_id = categories.id")
+		Joins("LEFT JOIN categories ON questions.category_id = categories.id").
+		Where("questions.deleted_at IS NULL")
 
-	countQuery := config.DB.Table("questions").
-		Joins("LEFT JOIN categories ON questions.category_id = categories.id")
+	countQuery := utils.ScopeToTenant(c, db).Table("questions").
+		Joins("LEFT JOIN categories ON questions.category_id = categories.id").
+		Where("questions.deleted_at IS NULL")
 
 	// Apply filters
 	switch strings.ToLower(column) {
@@ -678,8 +755,7 @@ func GetQuestions(c *gin.Context) {
 	// Cache the response if it's page 1 and no filters
 	if column == "" && value == "" && page == 1 {
 		cacheData, _ := json.Marshal(responseData)
-		cacheKey := fmt.Sprintf("questions:page:%d:limit:%d", page, limit)
-		err := config.RedisClient.Set(config.Ctx, cacheKey, cacheData, 10*time.Minute).Err()
+		err := cache.Set(c.Request.Context(), cacheKey, cacheData, 10*time.Minute).Err()
 		if err != nil {
 			log.Printf(" Failed to cache data: %v", err)
 		} else {
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 6. Export the questions of a category, macro-category or test as QTI 2.1, Moodle XML or GIFT
+func ExportQuestions(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	var scope services.ExportScope
+	for name, target := range map[string]*uint{
+		"category_id":       &scope.CategoryID,
+		"macro_category_id": &scope.MacroCategoryID,
+		"test_id":           &scope.TestID,
+	} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", name)})
+			return
+		}
+		*target = uint(id)
+	}
+
+	if scope.TestID != 0 {
+		if err := utils.AuthorizeTest(c, db, utils.PermTestView, scope.TestID); err != nil {
+			if errors.Is(err, utils.ErrTestNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+			} else {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to export this test"})
+			}
+			return
+		}
+	}
+
+	questions, err := services.LoadExportQuestions(db, scope)
+	if errors.Is(err, services.ErrExportScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	readImage := func(key string) ([]byte, error) {
+		return storage.ReadAll(c.Request.Context(), store, key)
+	}
+
+	var buf bytes.Buffer
+	var contentType, filename string
+	switch c.DefaultQuery("format", services.ExportQTI) {
+	case services.ExportQTI:
+		err = services.WriteQTIPackage(&buf, questions, readImage)
+		contentType, filename = "application/zip", "questions_qti.zip"
+	case services.ExportMoodle:
+		err = services.WriteMoodleXML(&buf, questions, readImage)
+		contentType, filename = "application/xml", "questions_moodle.xml"
+	case services.ExportGIFT:
+		contentType, filename = "text/plain; charset=utf-8", "questions.gift"
+		if hasImages(questions) {
+			err = writeGIFTPackage(&buf, questions, readImage)
+			contentType, filename = "application/zip", "questions_gift.zip"
+		} else {
+			err = services.WriteGIFT(&buf, questions)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be qti, moodle or gift"})
+		return
+	}
+	if errors.Is(err, services.ErrExportImage) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export questions", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export questions"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func hasImages(questions []models.Question) bool {
+	for _, q := range questions {
+		if q.Image1 != "" || q.Image2 != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGIFTPackage zips a GIFT file with the images it names, ready to be
+// sent back to the import as its images archive
+func writeGIFTPackage(buf *bytes.Buffer, questions []models.Question, readImage services.ImageReader) error {
+	archive := zip.NewWriter(buf)
+	f, err := archive.Create("questions.gift")
+	if err != nil {
+		return err
+	}
+	if err := services.WriteGIFT(f, questions); err != nil {
+		return err
+	}
+
+	for _, q := range questions {
+		for _, image := range []string{q.Image1, q.Image2} {
+			if image == "" {
+				continue
+			}
+			data, err := services.ReadQuestionImage(readImage, q, image)
+			if err != nil {
+				return err
+			}
+			f, err := archive.Create("images/" + path.Base(image))
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// maxImportImageKB matches the limit of images uploaded with a single question
+const maxImportImageKB = 100
+
+// 5. Import questions from a CSV, JSON, Moodle XML or GIFT file, with images in
+// an optional zip. category_id applies to questions that do not name one.
+func ImportQuestions(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", c.PostForm("dry_run")))
+
+	var defaultCategoryID uint
+	if value := c.DefaultQuery("category_id", c.PostForm("category_id")); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+			return
+		}
+		defaultCategoryID = uint(id)
+	}
+
+	tenant, err := utils.CurrentTenant(c, db)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	images := services.ImageArchive{}
+	if imagesHeader, err := c.FormFile("images"); err == nil {
+		archiveFile, err := imagesHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read images"})
+			return
+		}
+		defer archiveFile.Close()
+
+		images, err = services.ReadImageArchive(archiveFile, imagesHeader.Size)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "images must be a zip archive"})
+			return
+		}
+	}
+
+	var rows []services.QuestionImportRow
+	var parseErrors [][]string
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		rows, parseErrors, err = services.ParseQuestionCSV(file)
+	case ".json":
+		rows, err = services.ParseQuestionJSON(file)
+	case ".xml":
+		rows, parseErrors, err = services.ParseMoodleXML(file, images)
+	case ".gift", ".txt":
+		rows, parseErrors, err = services.ParseGIFT(file)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file must be a .csv, .json, .xml (Moodle) or .gift file"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := services.ImportReport{DryRun: dryRun}
+	for i, row := range rows {
+		result := services.ImportRowResult{Row: i + 1}
+		if row.CategoryID == 0 {
+			row.CategoryID = defaultCategoryID
+		}
+		if i < len(parseErrors) {
+			result.Errors = parseErrors[i]
+		}
+
+		question, options, errs := validateImportRow(db, row, images, tenant)
+		result.Errors = append(result.Errors, errs...)
+		if len(result.Errors) > 0 {
+			result.Status = services.ImportError
+			report.Add(result)
+			continue
+		}
+
+		if dryRun {
+			result.Status = services.ImportValid
+			report.Add(result)
+			continue
+		}
+
+		if err := saveImportImages(c.Request.Context(), store, question, row, images); err != nil {
+			result.Status = services.ImportError
+			result.Errors = []string{err.Error()}
+			report.Add(result)
+			continue
+		}
+		if err := services.SaveImportedQuestion(db, question, options); err != nil {
+			storage.Remove(c.Request.Context(), store, question.Image1)
+			storage.Remove(c.Request.Context(), store, question.Image2)
+			result.Status = services.ImportError
+			result.Errors = []string{"failed to save question"}
+			report.Add(result)
+			continue
+		}
+		result.Status = services.ImportCreated
+		result.QuestionID = question.ID
+		report.Add(result)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// validateImportRow applies the rules of the single-question request structs
+// to an imported row and builds the question it describes
+func validateImportRow(db *gorm.DB, row services.QuestionImportRow, images services.ImageArchive, tenant utils.Tenant) (*models.Question, []models.QuestionOption, []string) {
+	base := BaseQuestionRequest{
+		QuestionText: strings.TrimSpace(row.QuestionText),
+		Difficulty:   strings.ToLower(strings.TrimSpace(row.Difficulty)),
+		CategoryID:   row.CategoryID,
+		Image1Time:   row.Image1Time,
+		Image2Time:   row.Image2Time,
+		Comment:      strings.TrimSpace(row.Comment),
+		CommentTime:  row.CommentTime,
+	}
+	questionType := strings.ToUpper(strings.TrimSpace(row.QuestionType))
+
+	var req interface{}
+	switch questionType {
+	case "MCQ":
+		req = MCQRequest{BaseQuestionRequest: base, CorrectOptionID: row.CorrectOptionID, QuestionType: questionType}
+	case "TRUE_FALSE":
+		req = TrueFalseRequest{BaseQuestionRequest: base, CorrectOptionID: row.CorrectOptionID, QuestionType: questionType}
+	case "DESCRIPTIVE":
+		req = DescriptiveRequest{BaseQuestionRequest: base, QuestionType: questionType, DescriptiveAnswer: strings.TrimSpace(row.DescriptiveAnswer)}
+	default:
+		return nil, nil, []string{"question_type must be MCQ, TRUE_FALSE, or DESCRIPTIVE"}
+	}
+
+	var errs []string
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		for field, message := range utils.FormatValidationError(err) {
+			errs = append(errs, fmt.Sprintf("%s: %s", field, message))
+		}
+		sort.Strings(errs)
+	}
+
+	if base.Comment != "" && base.CommentTime == nil {
+		errs = append(errs, "comment_display_time required if comment is provided")
+	}
+	if base.Comment == "" && base.CommentTime != nil {
+		errs = append(errs, "comment required if comment_display_time is provided")
+	}
+	errs = append(errs, validateImportImage("image1", row.Image1, row.Image1Time, images)...)
+	errs = append(errs, validateImportImage("image2", row.Image2, row.Image2Time, images)...)
+
+	if base.CategoryID != 0 {
+		var category models.Category
+		if err := db.Select("id", "college_id").First(&category, base.CategoryID).Error; err != nil {
+			errs = append(errs, fmt.Sprintf("category %d does not exist", base.CategoryID))
+		} else if !tenant.Owns(category.CollegeID) {
+			errs = append(errs, fmt.Sprintf("category %d belongs to another college", base.CategoryID))
+		}
+	}
+
+	var options []models.QuestionOption
+	switch questionType {
+	case "MCQ":
+		for i, text := range row.Options {
+			text = strings.TrimSpace(text)
+			if i >= 5 || text == "" {
+				continue
+			}
+			options = append(options, models.QuestionOption{
+				OptionID:   uint(i + 1),
+				OptionText: text,
+				IsCorrect:  uint(i+1) == row.CorrectOptionID,
+			})
+		}
+		if row.CorrectOptionID >= 1 && row.CorrectOptionID <= 5 &&
+			(int(row.CorrectOptionID) > len(row.Options) || strings.TrimSpace(row.Options[row.CorrectOptionID-1]) == "") {
+			errs = append(errs, fmt.Sprintf("option_%d is the correct option but is empty", row.CorrectOptionID))
+		}
+	case "TRUE_FALSE":
+		for i, text := range []string{"True", "False"} {
+			options = append(options, models.QuestionOption{
+				OptionID:   uint(i + 1),
+				OptionText: text,
+				IsCorrect:  uint(i+1) == row.CorrectOptionID,
+			})
+		}
+	case "DESCRIPTIVE":
+		options = append(options, models.QuestionOption{
+			OptionID:   1, // Default value for descriptive
+			OptionText: strings.TrimSpace(row.DescriptiveAnswer),
+			IsCorrect:  true,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	question := &models.Question{
+		QuestionText:       base.QuestionText,
+		QuestionType:       questionType,
+		Difficulty:         base.Difficulty,
+		CategoryID:         base.CategoryID,
+		Image1DisplayTime:  base.Image1Time,
+		Image2DisplayTime:  base.Image2Time,
+		Comment:            base.Comment,
+		CommentDisplayTime: base.CommentTime,
+	}
+	if questionType != "DESCRIPTIVE" {
+		correctOptionID := row.CorrectOptionID
+		question.CorrectOptionID = &correctOptionID
+	}
+	return question, options, nil
+}
+
+// validateImportImage pairs an image with its display time like handleOptionalImage does
+func validateImportImage(field, name string, displayTime *int, images services.ImageArchive) []string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		if displayTime != nil {
+			return []string{fmt.Sprintf("%s is required if %s_display_time is provided", field, field)}
+		}
+		return nil
+	}
+	if displayTime == nil {
+		return []string{fmt.Sprintf("%s_display_time is required if %s is provided", field, field)}
+	}
+
+	image, ok := images.Lookup(name)
+	if !ok {
+		return []string{fmt.Sprintf("%s %q is not in the images archive", field, name)}
+	}
+	if image.Size > maxImportImageKB*1024 {
+		return []string{fmt.Sprintf("%s must be less than %dKB", field, maxImportImageKB)}
+	}
+	return nil
+}
+
+// saveImportImages copies the images of a row out of the archive
+func saveImportImages(ctx context.Context, store storage.Storage, question *models.Question, row services.QuestionImportRow, images services.ImageArchive) error {
+	save := func(field, name string) (string, error) {
+		if strings.TrimSpace(name) == "" {
+			return "", nil
+		}
+		image, _ := images.Lookup(name)
+		key, err := saveArchivedImage(ctx, store, image)
+		if errors.Is(err, storage.ErrUnsupportedType) {
+			return "", fmt.Errorf("%s %q is not a PNG, JPEG, GIF, WebP or BMP image", field, name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to save %s: %v", field, err)
+		}
+		return key, nil
+	}
+
+	var err error
+	if question.Image1, err = save("image1", row.Image1); err != nil {
+		return err
+	}
+	if question.Image2, err = save("image2", row.Image2); err != nil {
+		storage.Remove(ctx, store, question.Image1)
+		return err
+	}
+	return nil
+}
+
+func saveArchivedImage(ctx context.Context, store storage.Storage, image *services.ImportImage) (string, error) {
+	if image == nil {
+		return "", errors.New("image not found")
+	}
+	src, err := image.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return storage.Save(ctx, store, storage.FolderQuestions, src, int64(image.Size), storage.ImageTypes)
+}
@@ -1,17 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"pathshala/config"
-	"pathshala/models"
-	"pathshala/utils"
+	"pathshala/services"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RefreshToken(c *gin.Context) {
+// RefreshToken rotates the refresh token of a session: the response holds a
+// new pair and the presented refresh token stops working
+func (ac *AuthController) RefreshToken(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -25,37 +25,15 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	refreshToken := tokenParts[1]
-
-	claims, err := utils.ValidateToken(refreshToken, true)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	tokens, err := ac.Sessions.Refresh(c.Request.Context(), tokenParts[1], requestDevice(c))
+	switch {
+	case errors.Is(err, services.ErrSessionInvalid), errors.Is(err, services.ErrRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
-	}
-
-	email := claims["email"].(string)
-
-	// Check if refresh token is whitelisted
-	storedToken, err := config.RedisClient.Get(config.Ctx, "refresh_token:"+email).Result()
-	if err != nil || storedToken != refreshToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired or invalidated"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
 		return
 	}
 
-	var user models.User
-	config.DB.Where("email = ?", email).First(&user)
-	if user.ID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-		return
-	}
-
-	accessToken, newRefreshToken, _ := utils.GenerateTokens(user.Email, user.ID)
-
-	_ = config.RedisClient.Set(config.Ctx, "access_token:"+accessToken, "valid", 15*time.Minute).Err()
-	_ = config.RedisClient.Set(config.Ctx, "refresh_token:"+email, newRefreshToken, 7*24*time.Hour).Err()
-
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": newRefreshToken,
-	})
+	c.JSON(http.StatusOK, tokens)
 }
@@ -3,21 +3,15 @@ package controllers
 
 import (
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
 	"pathshala/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func Register(c *gin.Context) {
-	requesterRole, exists := c.Get("role")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
+func Register(c *gin.Context, db *gorm.DB) {
 	var input struct {
 		Name            string  `json:"name" binding:"required"`
 		Email           string  `json:"email" binding:"required,email"`
@@ -44,8 +38,8 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	if requesterRole == "teacher" && input.User_role != "student" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Teachers can only create students"})
+	// Users registered here belong to no college, so this takes a global grant
+	if !authorizeUserChange(c, db, input.User_role, utils.Resource{}) {
 		return
 	}
 
@@ -56,7 +50,7 @@ func Register(c *gin.Context) {
 	}
 
 	user := models.User{Name: input.Name, Email: input.Email, Password: hashedPassword, SecondaryEmail: input.SecondaryEmail, Role: input.User_role}
-	result := config.DB.Create(&user)
+	result := db.Create(&user)
 	if result.Error != nil {
 		if strings.Contains(result.Error.Error(), "duplicate key value violates unique constraint") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
@@ -66,6 +60,7 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	utils.Audit(c, "create", "users", user.ID, nil, user)
 	c.JSON(http.StatusOK, gin.H{"register_successfully": user})
 
 }
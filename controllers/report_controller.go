@@ -1,79 +1,116 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
 	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type ReportController struct {
+	DB      *gorm.DB
 	Service services.ReportServiceInterface
 }
 
-func NewReportController(service services.ReportServiceInterface) *ReportController {
-	return &ReportController{Service: service}
+func NewReportController(db *gorm.DB, service services.ReportServiceInterface) *ReportController {
+	return &ReportController{DB: db, Service: service}
 }
 
 func (rc ReportController) GetReportTypes(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	userRole, _ := c.Get("userRole")
-
-	if userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
-		return
-	}
-
-	types, err := rc.Service.GetAllReportTypes()
+	types, err := rc.Service.WithContext(utils.RequestContext(c)).GetAllReportTypes()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch report types"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"requested_by": userID,
+		"requested_by": c.GetFloat64("user_id"),
 		"types":        types,
 	})
 }
 
-func (rc ReportController) GetTestStudentScores(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	userRole, _ := c.Get("userRole")
+// GetReport generates a report as JSON, CSV or PDF. Reports on a test need
+// report:view over the test; reports across tests need it globally.
+func (rc ReportController) GetReport(c *gin.Context) {
+	reportType := c.Param("type")
+	var params services.ReportParams
+	if value := c.Query("test_id"); value != "" {
+		testID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+			return
+		}
+		params.TestID = uint(testID)
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		params.Limit = limit
+	}
 
-	if userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or pdf"})
 		return
 	}
 
-	testID := c.Param("test_id") // No conversion, keep UUID as string
+	if params.TestID == 0 {
+		if err := utils.Authorize(c, rc.DB, utils.PermReportView, utils.Resource{}); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+			return
+		}
+	} else if err := utils.AuthorizeTest(c, rc.DB, utils.PermReportView, params.TestID); err != nil {
+		if errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this test"})
+		}
+		return
+	}
 
-	data, err := rc.Service.GetTestWithStudentScores(testID)
+	report, err := rc.Service.WithContext(utils.RequestContext(c)).GenerateReport(reportType, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch test scores"})
+		switch {
+		case errors.Is(err, services.ErrUnknownReport):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrReportNeedsTest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"requested_by": userID,
-		"data":         data,
-	})
-}
-
-func (rc ReportController) StudentParticipationRanking(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	userRole, _ := c.Get("userRole")
-
-	if userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
-		return
+	filename := report.Type
+	if report.TestID != nil {
+		filename = fmt.Sprintf("%s_test_%d", report.Type, *report.TestID)
 	}
 
-	data, err := rc.Service.GetStudentParticipationRanking()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch participation ranking"})
-		return
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		if err := services.WriteReportCSV(&buf, report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write report"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "pdf":
+		if err := services.WriteReportPDF(&buf, report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write report"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".pdf"))
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	default:
+		c.JSON(http.StatusOK, report)
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"requested_by": userID,
-		"data":         data,
-	})
 }
@@ -1,51 +1,43 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"pathshala/config"
 	"strconv"
-	"strings"
 	"time"
 
 	"pathshala/models"
+	"pathshala/services"
 
 	"fmt"
 
 	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Response structure for enriched result output
 type EnrichedResult struct {
-	ID          uint   `json:"id"`
-	TestID      uint   `json:"test_id"`
-	UserID      uint   `json:"user_id"`
-	StudentName string `json:"student_name"`
-	CollegeName string `json:"college_name"`
-	Branch      string `json:"branch"`
-	Score       int    `json:"score"`
-	Correct     int    `json:"correct"`
-	Incorrect   int    `json:"incorrect"`
-	Ignored     int    `json:"ignored"`
-	TimeTaken   string `json:"time_taken"`
+	ID               uint    `json:"id"`
+	TestID           uint    `json:"test_id"`
+	UserID           uint    `json:"user_id"`
+	StudentName      string  `json:"student_name"`
+	CollegeName      string  `json:"college_name"`
+	Branch           string  `json:"branch"`
+	Score            float64 `json:"score"`
+	MaxScore         float64 `json:"max_score"`
+	Correct          int     `json:"correct"`
+	Incorrect        int     `json:"incorrect"`
+	Ignored          int     `json:"ignored"`
+	TimeTaken        string  `json:"time_taken"`
+	TimeTakenSeconds int64   `json:"time_taken_seconds"` // Queryable form of TimeTaken
+	AutoSubmitted    bool    `json:"auto_submitted"`
 }
 
 // Get Results with optional search filters
 
-func GetResults(c *gin.Context) {
-	userIDInterface, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	userIDFloat, ok := userIDInterface.(float64)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-
+func GetResults(c *gin.Context, db *gorm.DB) {
 	// test_id required
 	testIDStr := c.Query("test_id")
 	if testIDStr == "" {
@@ -54,15 +46,14 @@ func GetResults(c *gin.Context) {
 	}
 	testID, _ := strconv.Atoi(testIDStr)
 
-	// Verify teacher owns test
-	var test models.Test
-	if err := config.DB.First(&test, testID).Error; err != nil || test.UserID != userID {
+	// Verify the user may view the results of the test
+	if err := utils.AuthorizeTest(c, db, utils.PermReportView, uint(testID)); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	// Prepare query with test ID
-	query := config.DB.Model(&models.Result{}).Where("test_id = ?", testID)
+	query := db.Model(&models.Result{}).Where("test_id = ?", testID)
 
 	// Apply search filter
 	searchColumn := c.Query("column") // e.g., score, correct
@@ -82,21 +73,24 @@ func GetResults(c *gin.Context) {
 		var user models.User
 		var student models.Student
 
-		config.DB.Preload("College").First(&user, result.UserID)
-		config.DB.Where("user_id = ?", result.UserID).First(&student)
+		db.Preload("College").First(&user, result.UserID)
+		db.Where("user_id = ?", result.UserID).First(&student)
 
 		enrichedResults = append(enrichedResults, EnrichedResult{
-			ID:          result.ID,
-			TestID:      result.TestID,
-			UserID:      result.UserID,
-			StudentName: user.Name,
-			CollegeName: user.College.Name,
-			Branch:      student.Branch,
-			Score:       result.Score,
-			Correct:     result.Correct,
-			Incorrect:   result.Incorrect,
-			Ignored:     result.Ignored,
-			TimeTaken:   result.TimeTaken,
+			ID:               result.ID,
+			TestID:           result.TestID,
+			UserID:           result.UserID,
+			StudentName:      user.Name,
+			CollegeName:      user.College.Name,
+			Branch:           student.Branch,
+			Score:            result.Score,
+			MaxScore:         result.MaxScore,
+			Correct:          result.Correct,
+			Incorrect:        result.Incorrect,
+			Ignored:          result.Ignored,
+			TimeTaken:        formatTimeTaken(result.TimeTakenSeconds),
+			TimeTakenSeconds: result.TimeTakenSeconds,
+			AutoSubmitted:    result.AutoSubmitted,
 		})
 	}
 
@@ -133,7 +127,7 @@ func GetResults(c *gin.Context) {
 	})
 }
 
-func SubmitResults(c *gin.Context) {
+func SubmitResults(c *gin.Context, db *gorm.DB) {
 	type SubmitResultInput struct {
 		TestID uint `json:"test_id" binding:"required"`
 		UserID uint `json:"user_id" binding:"required"`
@@ -145,100 +139,76 @@ func SubmitResults(c *gin.Context) {
 		return
 	}
 
+	// Results are submitted on a student's behalf by whoever grades the test
+	if err := utils.AuthorizeTest(c, db, utils.PermTestGrade, req.TestID); err != nil {
+		if errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to grade this test"})
+		}
+		return
+	}
+
 	// Get user
 	var user models.User
-	if err := config.DB.Preload("College").First(&user, req.UserID).Error; err != nil {
+	if err := db.Preload("College").First(&user, req.UserID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
 	// Get student by user_id
 	var student models.Student
-	if err := config.DB.Where("user_id = ?", req.UserID).First(&student).Error; err != nil {
+	if err := db.Where("user_id = ?", req.UserID).First(&student).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
 		return
 	}
 
-	// Get all answers for this test + student
-	var answers []models.StudentAnswer
-	if err := config.DB.Where("student_id = ? AND test_id = ?", student.ID, req.TestID).Find(&answers).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch student answers"})
-		return
-	}
-
-	correct, incorrect, ignored := 0, 0, 0
-
-	for _, ans := range answers {
-		var question models.Question
-		if err := config.DB.Preload("Options").First(&question, ans.QuestionID).Error; err != nil {
-			continue
-		}
-
-		selectedTrimmed := strings.TrimSpace(ans.Selected)
-		if selectedTrimmed == "" || question.QuestionType == "Descriptive" {
-			ignored++
-			continue
-		}
-
-		optionIndex, err := strconv.Atoi(selectedTrimmed)
-		if err != nil || optionIndex < 1 || optionIndex > len(question.Options) {
-			ignored++
-			continue
-		}
-
-		selectedOption := question.Options[optionIndex-1]
-		if question.CorrectOptionID != nil && selectedOption.ID == *question.CorrectOptionID {
-			correct++
-		} else {
-			incorrect++
-		}
-	}
-
-	// Get test start time
-	var studentTest models.StudentTest
-	if err := config.DB.Where("student_id = ? AND test_id = ?", student.UserID, req.TestID).First(&studentTest).Error; err != nil {
+	// Grade the attempt the test was assigned under
+	attemptService := services.NewAttemptService(db)
+	studentTest, err := attemptService.FindAttempt(req.TestID, req.UserID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Test assignment not found"})
 		return
 	}
 
-	duration := time.Since(studentTest.StartTime)
-
-	// Save result to DB before responding
-	newResult := models.Result{
-		TestID:    req.TestID,
-		UserID:    req.UserID,
-		Score:     correct,
-		Correct:   correct,
-		Incorrect: incorrect,
-		Ignored:   ignored,
-		TimeTaken: duration.String(),
-	}
-
-	if err := config.DB.Create(&newResult).Error; err != nil {
+	previousStatus := studentTest.Status
+	result, err := attemptService.FinalizeAttempt(studentTest)
+	if err != nil {
+		if errors.Is(err, services.ErrAttemptSubmitted) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Result already submitted for this test"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save result"})
 		return
 	}
 
+	utils.Audit(c, "submit", "results", result.ID, gin.H{"test_id": req.TestID, "student_id": req.UserID, "status": previousStatus}, result)
+
 	// Final response
 	c.JSON(http.StatusOK, gin.H{
 		"student_name": user.Name,
 		"college_name": user.College.Name,
 		"branch":       student.Branch,
-		"score":        correct,
-		"correct":      correct,
-		"incorrect":    incorrect,
-		"ignored":      ignored,
-		"time_taken":   duration.String(),
+		"score":        result.Score,
+		"max_score":    result.MaxScore,
+		"correct":      result.Correct,
+		"incorrect":    result.Incorrect,
+		"ignored":      result.Ignored,
+		"time_taken":   formatTimeTaken(result.TimeTakenSeconds),
 	})
 }
 
+func formatTimeTaken(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
 // Get Result of a Specific Student for a Specific Test
-func GetStudentTestResult(c *gin.Context) {
+func GetStudentTestResult(c *gin.Context, db *gorm.DB) {
 	studentName := c.Param("student_name")
 	testID := c.Param("test_id")
 
 	var result models.Result
-	if err := config.DB.Where("student_name = ? AND test_id = ?", studentName, testID).First(&result).Error; err != nil {
+	if err := db.Where("student_name = ? AND test_id = ?", studentName, testID).First(&result).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found for the given student and test"})
 		return
 	}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RevisionController struct {
+	DB      *gorm.DB
+	Service services.RevisionServiceInterface
+}
+
+func NewRevisionController(db *gorm.DB, service services.RevisionServiceInterface) *RevisionController {
+	return &RevisionController{DB: db, Service: service}
+}
+
+// revisionParams reads the question and, when present, the revision number from the path
+func revisionParams(c *gin.Context) (uint, int, bool) {
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question ID"})
+		return 0, 0, false
+	}
+	revision := 0
+	if value := c.Param("revision"); value != "" {
+		revision, err = strconv.Atoi(value)
+		if err != nil || revision < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+			return 0, 0, false
+		}
+	}
+	return uint(questionID), revision, true
+}
+
+// Edit history of a question with the changes every revision made
+func (rc *RevisionController) GetHistory(c *gin.Context) {
+	questionID, _, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	history, err := rc.Service.WithContext(utils.RequestContext(c)).GetHistory(questionID)
+	if err != nil {
+		if errors.Is(err, services.ErrQuestionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch question history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"question_id": questionID, "revisions": history})
+}
+
+func (rc *RevisionController) GetRevision(c *gin.Context) {
+	questionID, revision, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	found, err := rc.Service.WithContext(utils.RequestContext(c)).GetRevision(questionID, revision)
+	if err != nil {
+		if errors.Is(err, services.ErrQuestionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+			return
+		}
+		if errors.Is(err, services.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// Regrade the submitted attempts that were served the question against a
+// revision, in the tests the logged-in user may grade
+func (rc *RevisionController) Regrade(c *gin.Context) {
+	questionID, revision, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	revisions := rc.Service.WithContext(utils.RequestContext(c))
+	affected, err := revisions.RegradeTests(questionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade attempts"})
+		return
+	}
+	allowed := make([]uint, 0, len(affected))
+	for _, testID := range affected {
+		err := utils.AuthorizeTest(c, rc.DB, utils.PermTestGrade, testID)
+		if err == nil {
+			allowed = append(allowed, testID)
+		} else if !errors.Is(err, utils.ErrForbidden) && !errors.Is(err, utils.ErrTestNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+	}
+	if len(affected) > 0 && len(allowed) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to grade the tests that used this question"})
+		return
+	}
+
+	summary, err := revisions.RegradeWithRevision(questionID, revision, allowed)
+	if err != nil {
+		if errors.Is(err, services.ErrQuestionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+			return
+		}
+		if errors.Is(err, services.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Attempts regraded successfully",
+		"regrade":       summary,
+		"skipped_tests": len(affected) - len(allowed), // Tests of others, left as they were
+	})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleController struct {
+	DB      *gorm.DB
+	Service services.RoleServiceInterface
+}
+
+func NewRoleController(db *gorm.DB, service services.RoleServiceInterface) *RoleController {
+	return &RoleController{DB: db, Service: service}
+}
+
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrRoleAssignmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role assignment not found"})
+	case errors.Is(err, services.ErrUnknownRole), errors.Is(err, services.ErrInvalidRoleAssignment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to assign this role"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// roleUserID reads the user whose roles are managed from the path
+func roleUserID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// GetMyPermissions lists the permissions of the logged-in user with their scopes
+func (rc *RoleController) GetMyPermissions(c *gin.Context) {
+	subject, err := utils.CurrentSubject(c, rc.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, subject)
+}
+
+// GetRoles lists every role with the permissions it grants
+func (rc *RoleController) GetRoles(c *gin.Context) {
+	roles, err := rc.Service.WithContext(utils.RequestContext(c)).ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (rc *RoleController) GetAssignments(c *gin.Context) {
+	userID, ok := roleUserID(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := rc.Service.WithContext(utils.RequestContext(c)).GetAssignments(userID)
+	if err != nil {
+		respondRoleError(c, err, "Failed to fetch role assignments")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "assignments": assignments})
+}
+
+// AssignRole gives a user a role scoped to a college or a state
+func (rc *RoleController) AssignRole(c *gin.Context) {
+	userID, ok := roleUserID(c)
+	if !ok {
+		return
+	}
+
+	var input services.RoleAssignmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	res, err := rc.Service.WithContext(utils.RequestContext(c)).AssignmentResource(input)
+	if err == nil {
+		err = utils.Authorize(c, rc.DB, utils.PermRoleManage, res)
+	}
+	if err != nil {
+		respondRoleError(c, err, "Failed to assign role")
+		return
+	}
+
+	assignment, err := rc.Service.WithContext(utils.RequestContext(c)).AssignRole(userID, input, uint(c.GetFloat64("user_id")))
+	if err != nil {
+		respondRoleError(c, err, "Failed to assign role")
+		return
+	}
+	c.JSON(http.StatusCreated, assignment)
+}
+
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	userID, ok := roleUserID(c)
+	if !ok {
+		return
+	}
+	assignmentID, err := strconv.ParseUint(c.Param("assignment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	// Revoking takes role:manage over the college or state the role covers
+	assignments, err := rc.Service.WithContext(utils.RequestContext(c)).GetAssignments(userID)
+	if err != nil {
+		respondRoleError(c, err, "Failed to revoke role")
+		return
+	}
+	for _, a := range assignments {
+		if a.ID != uint(assignmentID) {
+			continue
+		}
+		res, err := rc.Service.WithContext(utils.RequestContext(c)).AssignmentResource(services.RoleAssignmentInput{Role: a.Role, CollegeID: a.CollegeID, State: a.State})
+		if err == nil {
+			err = utils.Authorize(c, rc.DB, utils.PermRoleManage, res)
+		}
+		if err != nil {
+			respondRoleError(c, err, "Failed to revoke role")
+			return
+		}
+	}
+
+	if err := rc.Service.WithContext(utils.RequestContext(c)).RevokeRole(userID, uint(assignmentID)); err != nil {
+		respondRoleError(c, err, "Failed to revoke role")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked successfully"})
+}
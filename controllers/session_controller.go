@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionController lets users see where they are logged in and end those
+// sessions
+type SessionController struct {
+	Sessions services.SessionServiceInterface
+}
+
+func NewSessionController(sessions services.SessionServiceInterface) *SessionController {
+	return &SessionController{Sessions: sessions}
+}
+
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	sessions, err := sc.Sessions.List(c.Request.Context(), uint(c.GetFloat64("user_id")), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	err := sc.Sessions.Revoke(c.Request.Context(), uint(c.GetFloat64("user_id")), c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
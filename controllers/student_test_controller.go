@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StudentTestController struct {
+	Service services.AttemptServiceInterface
+}
+
+func NewStudentTestController(service services.AttemptServiceInterface) *StudentTestController {
+	return &StudentTestController{Service: service}
+}
+
+// attemptParams reads the student ID from the token and the test ID from the path
+func attemptParams(c *gin.Context) (uint, uint, bool) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, false
+	}
+	userIDFloat, ok := userIDInterface.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return 0, 0, false
+	}
+
+	testID, err := strconv.ParseUint(c.Param("test_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_id"})
+		return 0, 0, false
+	}
+
+	return uint(testID), uint(userIDFloat), true
+}
+
+func respondAttemptError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAttemptNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not assigned to you"})
+	case errors.Is(err, services.ErrAttemptNotStarted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Test has not been started"})
+	case errors.Is(err, services.ErrAttemptSubmitted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Test has already been submitted"})
+	case errors.Is(err, services.ErrAttemptNotFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Test has not been submitted yet"})
+	case errors.Is(err, services.ErrTestNotOpen):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Test is not open yet"})
+	case errors.Is(err, services.ErrTestClosed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Test is closed"})
+	case errors.Is(err, services.ErrAttemptExpired):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Time is up for this test"})
+	case errors.Is(err, services.ErrPoolTooSmall):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQuestionNotInTest), errors.Is(err, services.ErrInvalidIdempotencyKey),
+		errors.Is(err, services.ErrOptionNotInQuestion), errors.Is(err, services.ErrOptionIDRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// List tests sent to the logged-in student
+func (sc *StudentTestController) GetAssignedTests(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userIDFloat, ok := userIDInterface.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	tests, err := sc.Service.WithContext(utils.RequestContext(c)).ListAssignedTests(uint(userIDFloat))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assigned tests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tests": tests})
+}
+
+func (sc *StudentTestController) StartTest(c *gin.Context) {
+	testID, userID, ok := attemptParams(c)
+	if !ok {
+		return
+	}
+
+	attempt, err := sc.Service.WithContext(utils.RequestContext(c)).StartAttempt(testID, userID)
+	if err != nil {
+		respondAttemptError(c, err, "Failed to start test")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Test started",
+		"test_id":    attempt.TestID,
+		"status":     attempt.Status,
+		"start_time": attempt.StartTime,
+		"deadline":   attempt.Deadline,
+	})
+}
+
+func (sc *StudentTestController) GetTestQuestions(c *gin.Context) {
+	testID, userID, ok := attemptParams(c)
+	if !ok {
+		return
+	}
+
+	questions, err := sc.Service.WithContext(utils.RequestContext(c)).GetAttemptQuestions(testID, userID)
+	if err != nil {
+		respondAttemptError(c, err, "Failed to fetch questions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_id": testID, "questions": questions})
+}
+
+func (sc *StudentTestController) SaveAnswers(c *gin.Context) {
+	testID, userID, ok := attemptParams(c)
+	if !ok {
+		return
+	}
+
+	var answers []services.AnswerInput
+	if err := c.ShouldBindJSON(&answers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	replayed, err := sc.Service.WithContext(utils.RequestContext(c)).SaveAnswersIdempotent(testID, userID, c.GetHeader(services.IdempotencyKeyHeader), answers)
+	if err != nil {
+		respondAttemptError(c, err, "Failed to save answers")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Answers saved successfully", "saved": len(answers), "replayed": replayed})
+}
+
+func (sc *StudentTestController) SubmitTest(c *gin.Context) {
+	testID, userID, ok := attemptParams(c)
+	if !ok {
+		return
+	}
+
+	result, err := sc.Service.WithContext(utils.RequestContext(c)).SubmitAttempt(testID, userID)
+	if err != nil {
+		respondAttemptError(c, err, "Failed to submit test")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Test submitted successfully",
+		"score":      result.Score,
+		"max_score":  result.MaxScore,
+		"correct":    result.Correct,
+		"incorrect":  result.Incorrect,
+		"ignored":    result.Ignored,
+		"time_taken": formatTimeTaken(result.TimeTakenSeconds),
+	})
+}
+
+// Result of a submitted attempt, with grading feedback
+func (sc *StudentTestController) GetTestResult(c *gin.Context) {
+	testID, userID, ok := attemptParams(c)
+	if !ok {
+		return
+	}
+
+	result, err := sc.Service.WithContext(utils.RequestContext(c)).GetAttemptResult(testID, userID)
+	if err != nil {
+		respondAttemptError(c, err, "Failed to fetch result")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
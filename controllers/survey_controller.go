@@ -1,25 +1,95 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"pathshala/models"
 	"pathshala/services"
+	"pathshala/utils"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type SurveyController struct {
+	DB      *gorm.DB
 	Service services.SurveyServiceInterface
 }
 
-func NewSurveyController(service services.SurveyServiceInterface) *SurveyController {
+func NewSurveyController(db *gorm.DB, service services.SurveyServiceInterface) *SurveyController {
 	return &SurveyController{
+		DB:      db,
 		Service: service,
 	}
 }
 
+// surveyUserID reads the logged-in user from the token
+func surveyUserID(c *gin.Context) (uint, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return 0, false
+	}
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
+		return 0, false
+	}
+	return uint(userIDFloat), true
+}
+
+func surveyID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// ownedSurveyID reads the survey from the path and checks that the logged-in
+// user holds survey:manage over it
+func (sc *SurveyController) ownedSurveyID(c *gin.Context) (uuid.UUID, bool) {
+	id, ok := surveyID(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+	res, err := sc.Service.WithContext(utils.RequestContext(c)).SurveyResource(id)
+	if err == nil {
+		err = utils.Authorize(c, sc.DB, utils.PermSurveyManage, res)
+	}
+	if err != nil {
+		respondSurveyError(c, err, "Failed to fetch survey")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondSurveyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrSurveyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Survey not found"})
+	case errors.Is(err, services.ErrSurveyNotAssigned):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Survey not assigned to you"})
+	case errors.Is(err, utils.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to modify this survey"})
+	case errors.Is(err, services.ErrSurveyResultsHidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Results of this survey are not shared"})
+	case errors.Is(err, services.ErrSurveyCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Survey has already been answered"})
+	case errors.Is(err, services.ErrSurveyNotCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Answer the survey to see its results"})
+	case errors.Is(err, services.ErrSurveyHasResponses):
+		c.JSON(http.StatusConflict, gin.H{"error": "Survey already has responses"})
+	case errors.Is(err, services.ErrInvalidSurvey), errors.Is(err, services.ErrInvalidSurveyAnswer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
 func (sc *SurveyController) CreateSurvey(c *gin.Context) {
 	var survey models.Survey
 
@@ -27,10 +97,15 @@ func (sc *SurveyController) CreateSurvey(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	userID, ok := surveyUserID(c)
+	if !ok {
+		return
+	}
+	survey.CreatedBy = userID
 
-	createdSurvey, err := sc.Service.CreateSurvey(&survey)
+	createdSurvey, err := sc.Service.WithContext(utils.RequestContext(c)).CreateSurvey(&survey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondSurveyError(c, err, "Failed to create survey")
 		return
 	}
 
@@ -38,10 +113,8 @@ func (sc *SurveyController) CreateSurvey(c *gin.Context) {
 }
 
 func (sc *SurveyController) UpdateSurvey(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
 		return
 	}
 
@@ -51,9 +124,9 @@ func (sc *SurveyController) UpdateSurvey(c *gin.Context) {
 		return
 	}
 
-	updatedSurvey, err := sc.Service.UpdateSurvey(id, updatedData)
+	updatedSurvey, err := sc.Service.WithContext(utils.RequestContext(c)).UpdateSurvey(id, updatedData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondSurveyError(c, err, "Failed to update survey")
 		return
 	}
 
@@ -61,15 +134,13 @@ func (sc *SurveyController) UpdateSurvey(c *gin.Context) {
 }
 
 func (sc *SurveyController) DeleteSurvey(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
 		return
 	}
 
-	if err := sc.Service.DeleteSurvey(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := sc.Service.WithContext(utils.RequestContext(c)).DeleteSurvey(id); err != nil {
+		respondSurveyError(c, err, "Failed to delete survey")
 		return
 	}
 
@@ -77,17 +148,14 @@ func (sc *SurveyController) DeleteSurvey(c *gin.Context) {
 }
 
 func (sc *SurveyController) GetSurveyByID(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+	id, ok := surveyID(c)
+	if !ok {
 		return
 	}
 
-	survey, err := sc.Service.GetSurveyByID(id)
-
+	survey, err := sc.Service.WithContext(utils.RequestContext(c)).GetSurveyByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondSurveyError(c, err, "Failed to fetch survey")
 		return
 	}
 
@@ -97,8 +165,14 @@ func (sc *SurveyController) GetSurveyByID(c *gin.Context) {
 func (sc *SurveyController) GetPaginatedSurveys(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
 
-	surveys, total, err := sc.Service.GetPaginatedSurveys(page, pageSize)
+	surveys, total, err := sc.Service.WithContext(utils.RequestContext(c)).GetPaginatedSurveys(page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -117,8 +191,14 @@ func (sc *SurveyController) SearchSurveys(c *gin.Context) {
 	query := c.Query("query")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
 
-	surveys, total, err := sc.Service.SearchSurveys(query, page, pageSize)
+	surveys, total, err := sc.Service.WithContext(utils.RequestContext(c)).SearchSurveys(query, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -132,3 +212,160 @@ func (sc *SurveyController) SearchSurveys(c *gin.Context) {
 		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
 	})
 }
+
+// SetQuestions replaces the questions of a survey
+func (sc *SurveyController) SetQuestions(c *gin.Context) {
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Questions []services.SurveyQuestionInput `json:"questions" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	questions, err := sc.Service.WithContext(utils.RequestContext(c)).SetQuestions(id, input.Questions)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to save survey questions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"survey_id": id, "questions": questions})
+}
+
+// AssignSurvey sends a survey to the students of a college or to listed students
+func (sc *SurveyController) AssignSurvey(c *gin.Context) {
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
+		return
+	}
+
+	var input services.SurveyAssignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	assigned, err := sc.Service.WithContext(utils.RequestContext(c)).AssignSurvey(id, input)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to assign survey")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Survey sent successfully", "survey_id": id, "students": assigned})
+}
+
+// GetResponses lists individual responses; anonymous surveys show no students
+func (sc *SurveyController) GetResponses(c *gin.Context) {
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
+		return
+	}
+
+	responses, err := sc.Service.WithContext(utils.RequestContext(c)).GetResponses(id)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to fetch survey responses")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"survey_id": id, "responses": responses})
+}
+
+func (sc *SurveyController) GetResults(c *gin.Context) {
+	id, ok := sc.ownedSurveyID(c)
+	if !ok {
+		return
+	}
+
+	results, err := sc.Service.WithContext(utils.RequestContext(c)).GetResults(id)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to aggregate survey results")
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GetAssignedSurveys lists the surveys sent to the logged-in student
+func (sc *SurveyController) GetAssignedSurveys(c *gin.Context) {
+	studentID, ok := surveyUserID(c)
+	if !ok {
+		return
+	}
+
+	surveys, err := sc.Service.WithContext(utils.RequestContext(c)).GetAssignedSurveys(studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch surveys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"surveys": surveys})
+}
+
+func (sc *SurveyController) GetStudentSurvey(c *gin.Context) {
+	id, ok := surveyID(c)
+	if !ok {
+		return
+	}
+	studentID, ok := surveyUserID(c)
+	if !ok {
+		return
+	}
+
+	survey, err := sc.Service.WithContext(utils.RequestContext(c)).GetStudentSurvey(id, studentID)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to fetch survey")
+		return
+	}
+
+	c.JSON(http.StatusOK, survey)
+}
+
+func (sc *SurveyController) SubmitResponse(c *gin.Context) {
+	id, ok := surveyID(c)
+	if !ok {
+		return
+	}
+	studentID, ok := surveyUserID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Answers []services.SurveyAnswerInput `json:"answers" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if _, err := sc.Service.WithContext(utils.RequestContext(c)).SubmitResponse(id, studentID, input.Answers); err != nil {
+		respondSurveyError(c, err, "Failed to save survey response")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Thank you for your response", "survey_id": id})
+}
+
+func (sc *SurveyController) GetStudentResults(c *gin.Context) {
+	id, ok := surveyID(c)
+	if !ok {
+		return
+	}
+	studentID, ok := surveyUserID(c)
+	if !ok {
+		return
+	}
+
+	results, err := sc.Service.WithContext(utils.RequestContext(c)).GetStudentResults(id, studentID)
+	if err != nil {
+		respondSurveyError(c, err, "Failed to aggregate survey results")
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -2,25 +2,27 @@ package controllers
 
 import (
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
 	"strings"
 	"time"
 
 	"fmt"
 
+	"pathshala/services"
 	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Get Tests
 
-func GetTests(c *gin.Context) {
+func GetTests(c *gin.Context, db *gorm.DB) {
 	var tests []models.Test
 
 	// Base query with JOIN to access teacher_name
-	query := config.DB.Model(&models.Test{}).
+	query := utils.ScopeToTenant(c, db).Model(&models.Test{}).
 		Joins("JOIN users ON users.id = tests.user_id").
 		Preload("User")
 
@@ -72,10 +74,13 @@ func GetTests(c *gin.Context) {
 	var formatted []gin.H
 	for _, t := range tests {
 		formatted = append(formatted, gin.H{
-			"id":            t.ID,
-			"name":          t.TestName,
-			"teacher_name":  t.User.Name,
-			"min_questions": t.MinQuestions,
+			"id":               t.ID,
+			"name":             t.TestName,
+			"teacher_name":     t.User.Name,
+			"min_questions":    t.MinQuestions,
+			"duration_minutes": t.DurationMinutes,
+			"opens_at":         t.OpensAt,
+			"closes_at":        t.ClosesAt,
 		})
 	}
 
@@ -91,11 +96,24 @@ func GetTests(c *gin.Context) {
 // Inline custom struct for validation
 
 type CreateTestInput struct {
-	TestName     string `json:"test_name" binding:"required,min=3"`
-	MinQuestions int    `json:"min_questions" binding:"required,gte=1"`
+	TestName        string     `json:"test_name" binding:"required,min=3"`
+	MinQuestions    int        `json:"min_questions" binding:"required,gte=1"`
+	DurationMinutes int        `json:"duration_minutes" binding:"gte=0"`
+	OpensAt         *time.Time `json:"opens_at"`
+	ClosesAt        *time.Time `json:"closes_at"`
+
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"`
+
+	// Scoring policy; zero marks keep the defaults
+	NegativeMarking float64 `json:"negative_marking" binding:"gte=0,lte=1"`
+	EasyMarks       float64 `json:"easy_marks" binding:"gte=0"`
+	MediumMarks     float64 `json:"medium_marks" binding:"gte=0"`
+	HardMarks       float64 `json:"hard_marks" binding:"gte=0"`
+	AllOrNothing    bool    `json:"all_or_nothing"`
 }
 
-func CreateTest(c *gin.Context) {
+func CreateTest(c *gin.Context, db *gorm.DB) {
 	var input CreateTestInput
 
 	// Validate incoming JSON
@@ -104,6 +122,11 @@ func CreateTest(c *gin.Context) {
 		return
 	}
 
+	if input.OpensAt != nil && input.ClosesAt != nil && !input.ClosesAt.After(*input.OpensAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "closes_at must be after opens_at"})
+		return
+	}
+
 	// Get teacher ID from context
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
@@ -123,43 +146,64 @@ func CreateTest(c *gin.Context) {
 
 	// Create test linked to teacher in context
 	test := models.Test{
-		TestName:     input.TestName,
-		MinQuestions: input.MinQuestions,
-		UserID:       userID,
-	}
-
-	if err := config.DB.Create(&test).Error; err != nil {
+		TestName:         input.TestName,
+		MinQuestions:     input.MinQuestions,
+		DurationMinutes:  input.DurationMinutes,
+		OpensAt:          input.OpensAt,
+		ClosesAt:         input.ClosesAt,
+		ShuffleQuestions: input.ShuffleQuestions,
+		ShuffleOptions:   input.ShuffleOptions,
+		NegativeMarking:  input.NegativeMarking,
+		EasyMarks:        input.EasyMarks,
+		MediumMarks:      input.MediumMarks,
+		HardMarks:        input.HardMarks,
+		AllOrNothing:     input.AllOrNothing,
+		UserID:           userID,
+	}
+
+	if err := db.Create(&test).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create test"})
 		return
 	}
 
 	// Preload teacher info
-	if err := config.DB.Preload("User").First(&test, test.ID).Error; err != nil {
+	if err := db.Preload("User").First(&test, test.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch test with teacher info"})
 		return
 	}
 
+	utils.Audit(c, "create", "tests", test.ID, nil, test)
 	c.JSON(http.StatusCreated, gin.H{
-		"id":            test.ID,
-		"test_name":     test.TestName,
-		"min_questions": test.MinQuestions,
-		"teacher_name":  test.User.Name, // Nested reference
+		"id":                test.ID,
+		"test_name":         test.TestName,
+		"min_questions":     test.MinQuestions,
+		"duration_minutes":  test.DurationMinutes,
+		"opens_at":          test.OpensAt,
+		"closes_at":         test.ClosesAt,
+		"shuffle_questions": test.ShuffleQuestions,
+		"shuffle_options":   test.ShuffleOptions,
+		"negative_marking":  test.NegativeMarking,
+		"easy_marks":        test.EasyMarks,
+		"medium_marks":      test.MediumMarks,
+		"hard_marks":        test.HardMarks,
+		"all_or_nothing":    test.AllOrNothing,
+		"teacher_name":      test.User.Name, // Nested reference
 	})
 
 }
 
 // Send Test to Students based on College & State
 
-func GetStates(c *gin.Context) {
+func GetStates(c *gin.Context, db *gorm.DB) {
 	var states []string
-	if err := config.DB.Model(&models.College{}).Distinct().Pluck("state", &states).Error; err != nil {
+	if err := db.Model(&models.College{}).Distinct().Pluck("state", &states).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch states"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"states": states})
 }
 
-func GetCollegesByState(c *gin.Context) {
+func GetCollegesByState(c *gin.Context, db *gorm.DB) {
 	state := c.Query("state")
 	if state == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "State is required"})
@@ -167,7 +211,7 @@ func GetCollegesByState(c *gin.Context) {
 	}
 
 	var colleges []models.College
-	if err := config.DB.Where("state = ?", state).Find(&colleges).Error; err != nil {
+	if err := db.Where("state = ?", state).Find(&colleges).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch colleges"})
 		return
 	}
@@ -175,8 +219,8 @@ func GetCollegesByState(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"colleges": colleges})
 }
 
-// SendTest sends a test to students, but only if the requesting teacher owns it
-func SendTest(c *gin.Context) {
+// SendTest sends a test to students, if the requesting user holds test:send over it
+func SendTest(c *gin.Context, db *gorm.DB) {
 	var request struct {
 		TestID    uint   `json:"test_id" binding:"required"`
 		CollegeID uint   `json:"college_id" binding:"required"`
@@ -188,119 +232,137 @@ func SendTest(c *gin.Context) {
 		return
 	}
 
-	//  Get user_id (teacher) from context
-	userIDInterface, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: user_id not found in context"})
-		return
-	}
-
-	// Convert user_id from float64 to uint
-	floatID, ok := userIDInterface.(float64)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id format"})
-		return
-	}
-	teacherID := uint(floatID)
-
-	// Check if this test belongs to the logged-in teacher
+	// Check that the logged-in user may send this test
 	var test models.Test
-	if err := config.DB.First(&test, request.TestID).Error; err != nil {
+	if err := db.First(&test, request.TestID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		return
 	}
-	if test.UserID != teacherID {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestSend, test.ID); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to send this test"})
 		return
 	}
 
 	//  Validate college exists in state
 	var college models.College
-	if err := config.DB.Where("id = ? AND state = ?", request.CollegeID, request.State).First(&college).Error; err != nil {
+	if err := db.Where("id = ? AND state = ?", request.CollegeID, request.State).First(&college).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "College not found in given state"})
 		return
 	}
 
 	//  Check number of questions in the test
 	var testQuestionsCount int64
-	if err := config.DB.Model(&models.TestQuestion{}).Where("test_id = ?", request.TestID).Count(&testQuestionsCount).Error; err != nil {
+	if err := db.Model(&models.TestQuestion{}).Where("test_id = ?", request.TestID).Count(&testQuestionsCount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count questions in test"})
 		return
 	}
 
+	// Every attempt also draws the questions of the blueprint
+	blueprintService := services.NewBlueprintService(db)
+	blueprintSize, err := blueprintService.BlueprintSize(request.TestID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read test blueprint"})
+		return
+	}
+
 	// If the number of questions is less than the minimum required, return an error
-	if testQuestionsCount < int64(test.MinQuestions) {
+	if testQuestionsCount+int64(blueprintSize) < int64(test.MinQuestions) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Test has fewer questions than the minimum required"})
 		return
 	}
 
-	//  Fetch students
+	shortages, err := blueprintService.CheckPools(request.TestID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check question pools"})
+		return
+	}
+	if len(shortages) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Question pools cannot satisfy the test blueprint", "shortages": shortages})
+		return
+	}
+
+	//  Fetch students; suspended, graduated and not yet activated ones get no tests
 	var students []models.User
-	if err := config.DB.Where("college_id = ? AND role=?", college.ID, "student").Find(&students).Error; err != nil {
+	if err := db.Where("college_id = ? AND role = ? AND status = ?", college.ID, utils.RoleStudent, utils.StatusActive).Find(&students).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
 		return
 	}
+	if len(students) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The college has no active students"})
+		return
+	}
 
-	// Assign test
+	// Assign test to the students who do not have it yet; the attempt clock
+	// starts when the student starts the test
+	var assigned []uint
+	if err := db.Model(&models.StudentTest{}).Where("test_id = ?", request.TestID).Pluck("student_id", &assigned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assigned students"})
+		return
+	}
+	already := make(map[uint]bool, len(assigned))
+	for _, id := range assigned {
+		already[id] = true
+	}
 	var studentTests []models.StudentTest
 	for _, student := range students {
+		if already[student.ID] {
+			continue
+		}
 		studentTests = append(studentTests, models.StudentTest{
 			StudentID: student.ID,
 			TestID:    request.TestID,
-			StartTime: time.Now(),
+			Status:    services.AttemptAssigned,
 		})
 	}
 
-	if err := config.DB.Create(&studentTests).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign test"})
-		return
+	var sent int64
+	if len(studentTests) > 0 {
+		// A concurrent send may have assigned some of the students meanwhile
+		created := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&studentTests)
+		if created.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign test"})
+			return
+		}
+		sent = created.RowsAffected
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Test sent successfully",
-		"test_id":    request.TestID,
+	utils.Audit(c, "send", "tests", request.TestID, nil, gin.H{
 		"college_id": request.CollegeID,
 		"state":      request.State,
-		"students":   len(students),
+		"students":   sent,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Test sent successfully",
+		"test_id":          request.TestID,
+		"college_id":       request.CollegeID,
+		"state":            request.State,
+		"students":         sent,
+		"already_assigned": int64(len(students)) - sent,
 	})
 }
 
-// DeleteTest deletes a test, only if owned by the teacher
-func DeleteTest(c *gin.Context) {
+// DeleteTest deletes a test, if the requesting user holds test:edit over it
+func DeleteTest(c *gin.Context, db *gorm.DB) {
 	testID := c.Param("id")
 
-	// Get teacher ID from context
-	userIDInterface, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: user_id not found in context"})
-		return
-	}
-
-	// Convert user_id from float64 to uint
-	floatID, ok := userIDInterface.(float64)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id format"})
-		return
-	}
-	teacherID := uint(floatID)
-
-	// Check if test belongs to this teacher
+	// Check that the logged-in user may delete this test
 	var test models.Test
-	if err := config.DB.First(&test, testID).Error; err != nil {
+	if err := db.First(&test, testID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		return
 	}
 
-	if test.UserID != teacherID {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestEdit, test.ID); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this test"})
 		return
 	}
 
-	// Proceed with deletion
-	if err := config.DB.Delete(&models.Test{}, testID).Error; err != nil {
+	// Assignments, answers and results go to the trash with the test
+	if err := services.NewTrashService(db, nil, 0).Delete(services.TrashTests, test.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete test"})
 		return
 	}
 
+	utils.Audit(c, "delete", "tests", test.ID, test, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Test deleted successfully"})
 }
@@ -6,14 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"pathshala/config"
 	"pathshala/models"
+	"pathshala/storage"
 	"pathshala/utils"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -22,7 +23,7 @@ type AddQuestionToTestRequest struct {
 }
 
 // 1. Add existing question to test
-func AddExistingQuestionToTest(c *gin.Context) {
+func AddExistingQuestionToTest(c *gin.Context, db *gorm.DB) {
 	testIDStr := c.Param("test_id")
 	testID, err := strconv.Atoi(testIDStr)
 	if err != nil {
@@ -31,20 +32,7 @@ func AddExistingQuestionToTest(c *gin.Context) {
 	}
 
 	// Authorization check
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDFloat, ok := userIDVal.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-	role := c.GetString("role")
-
-	if err := utils.AuthorizeTestAccess(uint(testID), userID, role); err != nil {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestEdit, uint(testID)); err != nil {
 		if errors.Is(err, utils.ErrTestNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		} else {
@@ -66,7 +54,7 @@ func AddExistingQuestionToTest(c *gin.Context) {
 	for _, questionID := range req.QuestionIDs {
 		// Check if question exists
 		var question models.Question
-		if err := config.DB.First(&question, questionID).Error; err != nil {
+		if err := db.First(&question, questionID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				invalidIDs = append(invalidIDs, questionID)
 				continue
@@ -76,7 +64,7 @@ func AddExistingQuestionToTest(c *gin.Context) {
 		}
 		// Check if already added
 		var existing models.TestQuestion
-		err := config.DB.
+		err := db.
 			Where("test_id = ? AND question_id = ?", testID, questionID).
 			First(&existing).Error
 
@@ -93,7 +81,7 @@ func AddExistingQuestionToTest(c *gin.Context) {
 			TestID:     uint(testID),
 			QuestionID: questionID,
 		}
-		if err := config.DB.Create(&entry).Error; err != nil {
+		if err := db.Create(&entry).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add question to test"})
 			return
 		}
@@ -109,7 +97,7 @@ func AddExistingQuestionToTest(c *gin.Context) {
 }
 
 // 2. Add New question to test
-func AddNewQuestionToTest(c *gin.Context) {
+func AddNewQuestionToTest(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	testIDStr := c.Param("test_id")
 	testID, err := strconv.Atoi(testIDStr)
 	if err != nil {
@@ -118,19 +106,7 @@ func AddNewQuestionToTest(c *gin.Context) {
 	}
 
 	// Authorization check
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDFloat, ok := userIDVal.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-	role := c.GetString("role")
-	if err := utils.AuthorizeTestAccess(uint(testID), userID, role); err != nil {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestEdit, uint(testID)); err != nil {
 		if errors.Is(err, utils.ErrTestNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		} else {
@@ -143,27 +119,27 @@ func AddNewQuestionToTest(c *gin.Context) {
 
 	switch questionType {
 	case "MCQ":
-		question, err := handleMCQQuestion(c)
+		question, err := handleMCQQuestion(c, db, store)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		}
-		if err := LinkQuestionToTest(uint(testID), question.ID); err != nil {
+		if err := LinkQuestionToTest(db, uint(testID), question.ID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link question with test"})
 		}
 	case "TRUE_FALSE":
-		question, err := handleTrueFalseQuestion(c)
+		question, err := handleTrueFalseQuestion(c, db, store)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		}
-		if err := LinkQuestionToTest(uint(testID), question.ID); err != nil {
+		if err := LinkQuestionToTest(db, uint(testID), question.ID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link question with test"})
 		}
 	case "DESCRIPTIVE":
-		question, err := handleDescriptiveQuestion(c)
+		question, err := handleDescriptiveQuestion(c, db, store)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
 		}
-		if err := LinkQuestionToTest(uint(testID), question.ID); err != nil {
+		if err := LinkQuestionToTest(db, uint(testID), question.ID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link question with test"})
 		}
 	default:
@@ -171,15 +147,15 @@ func AddNewQuestionToTest(c *gin.Context) {
 	}
 }
 
-func LinkQuestionToTest(testID, questionID uint) error {
-	return config.DB.Create(&models.TestQuestion{
+func LinkQuestionToTest(db *gorm.DB, testID, questionID uint) error {
+	return db.Create(&models.TestQuestion{
 		TestID:     testID,
 		QuestionID: questionID,
 	}).Error
 }
 
 // 3. Delete question from a test
-func DeleteTestQuestion(c *gin.Context) {
+func DeleteTestQuestion(c *gin.Context, db *gorm.DB) {
 	testIDStr := c.Param("test_id")
 	questionIDStr := c.Param("question_id")
 
@@ -191,19 +167,7 @@ func DeleteTestQuestion(c *gin.Context) {
 	}
 
 	// Authorization check
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDFloat, ok := userIDVal.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-	role := c.GetString("role")
-	if err := utils.AuthorizeTestAccess(uint(testID), userID, role); err != nil {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestEdit, uint(testID)); err != nil {
 		if errors.Is(err, utils.ErrTestNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		} else {
@@ -220,13 +184,13 @@ func DeleteTestQuestion(c *gin.Context) {
 
 	// Try to find the test-question linkage
 	var testQuestion models.TestQuestion
-	if err := config.DB.Where("test_id = ? AND question_id = ?", testID, questionID).First(&testQuestion).Error; err != nil {
+	if err := db.Where("test_id = ? AND question_id = ?", testID, questionID).First(&testQuestion).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found in this test"})
 		return
 	}
 
 	// Delete the linkage, not the question itself
-	if err := config.DB.Delete(&testQuestion).Error; err != nil {
+	if err := db.Delete(&testQuestion).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete test-question link"})
 		return
 	}
@@ -235,7 +199,7 @@ func DeleteTestQuestion(c *gin.Context) {
 }
 
 // 4. Get Test Questions
-func GetTestQuestions(c *gin.Context) {
+func GetTestQuestions(c *gin.Context, db *gorm.DB, cache *redis.Client) {
 	testIDStr := c.Param("test_id")
 	testID, err := strconv.ParseUint(testIDStr, 10, 64)
 	if err != nil {
@@ -244,19 +208,7 @@ func GetTestQuestions(c *gin.Context) {
 	}
 
 	// Authorization check
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDFloat, ok := userIDVal.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-	role := c.GetString("role")
-	if err := utils.AuthorizeTestAccess(uint(testID), userID, role); err != nil {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestView, uint(testID)); err != nil {
 		if errors.Is(err, utils.ErrTestNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		} else {
@@ -281,7 +233,7 @@ func GetTestQuestions(c *gin.Context) {
 	// Redis caching for first page without filters
 	if column == "" && value == "" && page == 1 {
 		cacheKey := fmt.Sprintf("test_questions:test_id:%d:page:%d:limit:%d", testID, page, limit)
-		cachedData, err := config.RedisClient.Get(config.Ctx, cacheKey).Result()
+		cachedData, err := cache.Get(c.Request.Context(), cacheKey).Result()
 		if err == nil {
 			log.Println("Cache hit for test questions")
 			var cachedResponse map[string]interface{}
@@ -294,14 +246,14 @@ func GetTestQuestions(c *gin.Context) {
 		}
 	}
 
-	query := config.DB.Table("questions").
+	query := db.Table("questions").
 		Select("questions.id, questions.question_text").
 		Joins("LEFT JOIN test_questions ON questions.id = test_questions.question_id").
-		Where("test_questions.test_id = ?", testID)
+		Where("test_questions.test_id = ? AND questions.deleted_at IS NULL", testID)
 
-	countQuery := config.DB.Table("questions").
+	countQuery := db.Table("questions").
 		Joins("LEFT JOIN test_questions ON questions.id = test_questions.question_id").
-		Where("test_questions.test_id = ?", testID)
+		Where("test_questions.test_id = ? AND questions.deleted_at IS NULL", testID)
 
 	switch strings.ToLower(column) {
 	case "question":
@@ -335,7 +287,7 @@ func GetTestQuestions(c *gin.Context) {
 	if column == "" && value == "" && page == 1 {
 		cacheData, _ := json.Marshal(responseData)
 		cacheKey := fmt.Sprintf("test_questions:test_id:%d:page:%d:limit:%d", testID, page, limit)
-		err := config.RedisClient.Set(config.Ctx, cacheKey, cacheData, 10*time.Minute).Err()
+		err := cache.Set(c.Request.Context(), cacheKey, cacheData, 10*time.Minute).Err()
 		if err != nil {
 			log.Printf("Failed to cache test questions: %v", err)
 		} else {
@@ -347,7 +299,7 @@ func GetTestQuestions(c *gin.Context) {
 }
 
 // 5. Edit Test Questions
-func EditQuestionOfTest(c *gin.Context) {
+func EditQuestionOfTest(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	testIDStr := c.Param("test_id")
 	questionIDStr := c.Param("question_id")
 
@@ -358,19 +310,7 @@ func EditQuestionOfTest(c *gin.Context) {
 	}
 
 	// Authorization check
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDFloat, ok := userIDVal.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-	userID := uint(userIDFloat)
-	role := c.GetString("role")
-	if err := utils.AuthorizeTestAccess(uint(testID), userID, role); err != nil {
+	if err := utils.AuthorizeTest(c, db, utils.PermTestEdit, uint(testID)); err != nil {
 		if errors.Is(err, utils.ErrTestNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		} else {
@@ -387,7 +327,7 @@ func EditQuestionOfTest(c *gin.Context) {
 
 	// Check if the question belongs to the test
 	var testQuestion models.TestQuestion
-	if err := config.DB.Where("test_id = ? AND question_id = ?", testID, questionID).First(&testQuestion).Error; err != nil {
+	if err := db.Where("test_id = ? AND question_id = ?", testID, questionID).First(&testQuestion).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Question not linked to the given test"})
 		return
 	}
@@ -396,17 +336,17 @@ func EditQuestionOfTest(c *gin.Context) {
 
 	switch questionType {
 	case "MCQ":
-		_, err := handleEditMCQ(c, questionIDStr)
+		_, err := handleEditMCQ(c, db, store, questionIDStr)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update MCQ question"})
 		}
 	case "TRUE_FALSE":
-		_, err := handleEditTrueFalse(c, questionIDStr)
+		_, err := handleEditTrueFalse(c, db, store, questionIDStr)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update True/False question"})
 		}
 	case "DESCRIPTIVE":
-		_, err := handleEditDescriptive(c, questionIDStr)
+		_, err := handleEditDescriptive(c, db, store, questionIDStr)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Descriptive question"})
 		}
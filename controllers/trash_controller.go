@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/services"
+	"pathshala/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TrashController struct {
+	Service services.TrashServiceInterface
+}
+
+func NewTrashController(service services.TrashServiceInterface) *TrashController {
+	return &TrashController{Service: service}
+}
+
+func respondTrashError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUnknownTrashType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be tests, questions, users, colleges or categories"})
+	case errors.Is(err, services.ErrNotInTrash), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item is not in the trash"})
+	case errors.Is(err, services.ErrTrashParentDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetTrash lists deleted items of one type with when they will be purged
+func (tc *TrashController) GetTrash(c *gin.Context) {
+	kind := c.Param("type")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	items, total, err := tc.Service.WithContext(utils.RequestContext(c)).ListTrash(kind, page, pageSize)
+	if err != nil {
+		respondTrashError(c, err, "Failed to fetch trash")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       items,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// RestoreItem takes an item, and what was deleted with it, out of the trash
+func (tc *TrashController) RestoreItem(c *gin.Context) {
+	kind := c.Param("type")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := tc.Service.WithContext(utils.RequestContext(c)).Restore(kind, uint(id)); err != nil {
+		respondTrashError(c, err, "Failed to restore item")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item restored successfully", "type": kind, "id": id})
+}
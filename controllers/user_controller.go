@@ -3,15 +3,75 @@ package controllers
 import (
 	"net/http"
 	"pathshala/models"
+	"pathshala/services"
 	"pathshala/utils"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+// userPermission is the permission needed to create or change a user of a role
+func userPermission(role string) string {
+	switch role {
+	case utils.RoleStudent:
+		return utils.PermUserManage
+	case utils.RoleTeacher:
+		return utils.PermTeacherManage
+	default:
+		return utils.PermRoleManage
+	}
+}
+
+// authorizeUserChange checks that the logged-in user may manage users of a
+// role in the college of the resource
+func authorizeUserChange(c *gin.Context, db *gorm.DB, role string, res utils.Resource) bool {
+	if err := utils.Authorize(c, db, userPermission(role), res); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage this user"})
+		return false
+	}
+	return true
+}
+
+// collegeResource is a college as a resource, or the zero resource for no college
+func collegeResource(c *gin.Context, db *gorm.DB, collegeID *uint) (utils.Resource, bool) {
+	if collegeID == nil {
+		return utils.Resource{}, true
+	}
+	res, err := utils.CollegeResource(db, *collegeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "College not found"})
+		return utils.Resource{}, false
+	}
+	return res, true
+}
+
+// userSnapshot is a user with their student or teacher profile, as recorded
+// in the audit log
+func userSnapshot(db *gorm.DB, userID uint) gin.H {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil
+	}
+	snapshot := gin.H{"id": user.ID, "name": user.Name, "email": user.Email, "college_id": user.CollegeID, "role": user.Role, "status": user.Status}
+	switch user.Role {
+	case "student":
+		var student models.Student
+		if db.Where("user_id = ?", user.ID).First(&student).Error == nil {
+			snapshot["student"] = gin.H{"branch": student.Branch, "gender": student.Gender}
+		}
+	case "teacher":
+		var teacher models.Teacher
+		if db.Where("user_id = ?", user.ID).First(&teacher).Error == nil {
+			snapshot["teacher"] = gin.H{"state": teacher.State, "teacher_type": teacher.TeacherType, "super": teacher.Super}
+		}
+	}
+	return snapshot
+}
+
 func CreateStudent(c *gin.Context, db *gorm.DB) {
 	var input struct {
 		Name           string  `json:"name" binding:"required"`
@@ -21,7 +81,7 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 		CollegeName    string  `json:"college_name" binding:"required"`
 		Branch         string  `json:"branch" binding:"required"`
 		Gender         string  `json:"gender" binding:"required,oneof=male female"`
-		Status         string  `json:"status" binding:"required,oneof=active inactive"` // ✅ Add this
+		Status         string  `json:"status" binding:"omitempty,oneof=invited active"` // Active unless given
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -40,6 +100,9 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid college name"})
 		return
 	}
+	if !authorizeUserChange(c, db, utils.RoleStudent, utils.Resource{CollegeID: &college.ID, State: college.State}) {
+		return
+	}
 
 	//  Hash the password
 	hashedPassword, err := utils.HashPassword(input.Password)
@@ -56,6 +119,7 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 		SecondaryEmail: input.SecondaryEmail,
 		CollegeID:      &college.ID,
 		Role:           "student",
+		Status:         input.Status,
 	}
 
 	if err := db.Create(&user).Error; err != nil {
@@ -68,7 +132,6 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 		UserID: user.ID,
 		Branch: input.Branch,
 		Gender: input.Gender,
-		Status: input.Status,
 	}
 
 	if err := db.Create(&student).Error; err != nil {
@@ -76,6 +139,7 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	utils.Audit(c, "create", "users", user.ID, nil, userSnapshot(db, user.ID))
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Student created successfully",
 		"user_id": user.ID,
@@ -83,11 +147,6 @@ func CreateStudent(c *gin.Context, db *gorm.DB) {
 }
 
 func CreateTeacher(c *gin.Context, db *gorm.DB) {
-	requesterRole, exists := c.Get("role")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
 	var input struct {
 		Name         string `json:"name" binding:"required"`
 		Email        string `json:"email" binding:"required,email"`
@@ -96,7 +155,7 @@ func CreateTeacher(c *gin.Context, db *gorm.DB) {
 		CollegeName  string `json:"college_name" binding:"required"`
 		SuperTeacher bool   `json:"super_teacher"`
 		TeacherType  string `json:"teacher_type" binding:"required"`
-		Status       string `json:"status" binding:"required,oneof=active inactive"` // ✅ Add this
+		Status       string `json:"status" binding:"omitempty,oneof=invited active"` // Active unless given
 
 	}
 
@@ -116,6 +175,15 @@ func CreateTeacher(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "College not found"})
 		return
 	}
+	collegeRes := utils.Resource{CollegeID: &college.ID, State: college.State}
+	if !authorizeUserChange(c, db, utils.RoleTeacher, collegeRes) {
+		return
+	}
+	// Super teachers manage the whole college, so only those who assign roles may create them
+	if input.SuperTeacher && utils.Authorize(c, db, utils.PermRoleManage, collegeRes) != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to create super teachers"})
+		return
+	}
 
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
@@ -130,12 +198,9 @@ func CreateTeacher(c *gin.Context, db *gorm.DB) {
 		Password:  hashedPassword,
 		Role:      "teacher",
 		CollegeID: &college.ID,
+		Status:    input.Status,
 	}
 
-	if requesterRole == "teacher" && user.Role == "teacher" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Teachers can only create students"})
-		return
-	}
 	result := db.Create(&user)
 	if result.Error != nil {
 		if strings.Contains(result.Error.Error(), "duplicate key value violates unique constraint") {
@@ -152,7 +217,6 @@ func CreateTeacher(c *gin.Context, db *gorm.DB) {
 		State:       input.State,
 		TeacherType: input.TeacherType,
 		Super:       input.SuperTeacher,
-		Status:      input.Status,
 	}
 
 	if err := db.Create(&teacher).Error; err != nil {
@@ -160,6 +224,7 @@ func CreateTeacher(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	utils.Audit(c, "create", "users", user.ID, nil, userSnapshot(db, user.ID))
 	c.JSON(http.StatusCreated, gin.H{
 		"message":       "Teacher created successfully",
 		"user_id":       user.ID,
@@ -179,14 +244,15 @@ func GetUsersByRole(c *gin.Context, db *gorm.DB, role string) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	offset := (page - 1) * limit
+	db = utils.ScopeToTenant(c, db) // Only users of the caller's colleges
 
 	if role == "student" {
 		var results []models.StudentResponse
 		query := db.Table("users").
-			Select("users.id, users.name, users.email, users.college_id, COALESCE(colleges.name, 'N/A') as college, users.role, students.status").
+			Select("users.id, users.name, users.email, users.college_id, COALESCE(colleges.name, 'N/A') as college, users.role, users.status").
 			Joins("LEFT JOIN students ON users.id = students.user_id").
 			Joins("LEFT JOIN colleges ON users.college_id = colleges.id").
-			Where("users.role = ?", role)
+			Where("users.role = ? AND users.deleted_at IS NULL", role)
 
 		// Apply search filter if provided
 		if column != "" && value != "" {
@@ -194,7 +260,7 @@ func GetUsersByRole(c *gin.Context, db *gorm.DB, role string) {
 				"name":    "users.name",
 				"email":   "users.email",
 				"college": "colleges.name",
-				"status":  "students.status",
+				"status":  "users.status",
 			}
 
 			dbColumn, ok := validColumns[column]
@@ -228,10 +294,10 @@ func GetUsersByRole(c *gin.Context, db *gorm.DB, role string) {
 	if role == "teacher" {
 		var results []models.TeacherResponse
 		query := db.Table("users").
-			Select("users.id, users.name, users.email, users.college_id, COALESCE(colleges.name, 'N/A') as college, users.role, teachers.state, teachers.teacher_type").
+			Select("users.id, users.name, users.email, users.college_id, COALESCE(colleges.name, 'N/A') as college, users.role, users.status, teachers.state, teachers.teacher_type").
 			Joins("LEFT JOIN teachers ON users.id = teachers.user_id").
 			Joins("LEFT JOIN colleges ON users.college_id = colleges.id").
-			Where("users.role = ?", role)
+			Where("users.role = ? AND users.deleted_at IS NULL", role)
 
 		// Apply search filter if provided
 		if column != "" && value != "" {
@@ -241,6 +307,7 @@ func GetUsersByRole(c *gin.Context, db *gorm.DB, role string) {
 				"college":      "colleges.name",
 				"state":        "teachers.state",
 				"teacher_type": "teachers.teacher_type",
+				"status":       "users.status",
 			}
 
 			dbColumn, ok := validColumns[column]
@@ -275,8 +342,9 @@ func GetUsersByRole(c *gin.Context, db *gorm.DB, role string) {
 	c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported role"})
 }
 
-// After changes in user struct
-func UpdateUser(c *gin.Context, db *gorm.DB) {
+// UpdateUser changes a user's details. Their status has its own endpoint,
+// ChangeUserStatus.
+func UpdateUser(c *gin.Context, db *gorm.DB, rdb *redis.Client) {
 	id := c.Param("id")
 
 	var existingUser models.User
@@ -290,7 +358,6 @@ func UpdateUser(c *gin.Context, db *gorm.DB) {
 		Email       string `json:"email"`
 		CollegeID   *uint  `json:"college_id"`
 		Role        string `json:"role"`
-		Status      string `json:"status"`       // For student
 		State       string `json:"state"`        // For teacher
 		TeacherType string `json:"teacher_type"` // For teacher
 	}
@@ -300,6 +367,21 @@ func UpdateUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	// The user must be manageable both as they are and as they will be
+	current, err := utils.UserResource(db, existingUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	target, ok := collegeResource(c, db, input.CollegeID)
+	if !ok {
+		return
+	}
+	if !authorizeUserChange(c, db, existingUser.Role, current) || !authorizeUserChange(c, db, input.Role, target) {
+		return
+	}
+	before := userSnapshot(db, existingUser.ID)
+
 	// Update User fields
 	existingUser.Name = input.Name
 	existingUser.Email = input.Email
@@ -311,34 +393,56 @@ func UpdateUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	// Update role-specific fields
-	switch input.Role {
-	case "student":
-		db.Model(&models.Student{}).Where("user_id = ?", existingUser.ID).Updates(models.Student{Status: input.Status})
-	case "teacher":
+	// AuthMiddleware caches the role
+	if err := utils.InvalidateUserCache(c.Request.Context(), rdb, existingUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	// Update teacher-specific fields
+	if input.Role == "teacher" {
 		db.Model(&models.Teacher{}).Where("user_id = ?", existingUser.ID).Updates(models.Teacher{
 			State:       input.State,
 			TeacherType: input.TeacherType,
 		})
 	}
 
+	utils.Audit(c, "update", "users", existingUser.ID, before, userSnapshot(db, existingUser.ID))
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
-func DeleteUser(c *gin.Context, db *gorm.DB) {
+// DeleteUser moves a user to the trash and logs them out everywhere
+func DeleteUser(c *gin.Context, db *gorm.DB, rdb *redis.Client, sessions services.SessionServiceInterface) {
 	var user models.User
 	if err := db.First(&user, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	res, err := utils.UserResource(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+	if !authorizeUserChange(c, db, user.Role, res) {
+		return
+	}
+	before := userSnapshot(db, user.ID)
 
-	switch user.Role {
-	case "student":
-		db.Where("user_id = ?", user.ID).Delete(&models.Student{})
-	case "teacher":
-		db.Where("user_id = ?", user.ID).Delete(&models.Teacher{})
+	// The student or teacher profile goes to the trash with the user
+	if err := services.NewTrashService(db, nil, 0).Delete(services.TrashUsers, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
 	}
+	utils.Audit(c, "delete", "users", user.ID, before, nil)
 
-	db.Delete(&user)
+	// AuthMiddleware caches the user, and their tokens outlive the account
+	if err := utils.InvalidateUserCache(c.Request.Context(), rdb, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User deleted, but could not be logged out"})
+		return
+	}
+	if err := sessions.RevokeAll(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User deleted, but could not be logged out"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
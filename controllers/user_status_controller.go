@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserStatusController moves users through their lifecycle
+type UserStatusController struct {
+	DB       *gorm.DB
+	Statuses services.UserStatusServiceInterface
+}
+
+func NewUserStatusController(db *gorm.DB, statuses services.UserStatusServiceInterface) *UserStatusController {
+	return &UserStatusController{DB: db, Statuses: statuses}
+}
+
+// ChangeUserStatus sets a user's lifecycle status, e.g. suspends them
+func (uc *UserStatusController) ChangeUserStatus(c *gin.Context) {
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := uc.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	res, err := utils.UserResource(uc.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change status"})
+		return
+	}
+	if !authorizeUserChange(c, uc.DB, user.Role, res) {
+		return
+	}
+	if user.ID == uint(c.GetFloat64("user_id")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own status"})
+		return
+	}
+
+	before := user.Status
+	err = uc.Statuses.ChangeStatus(c.Request.Context(), &user, input.Status)
+	switch {
+	case errors.Is(err, services.ErrInvalidUserStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrStatusTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change status"})
+		return
+	}
+
+	utils.Audit(c, "status", "users", user.ID, gin.H{"status": before}, gin.H{"status": user.Status})
+	c.JSON(http.StatusOK, gin.H{"message": "Status changed", "status": user.Status})
+}
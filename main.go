@@ -1,53 +1,177 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"pathshala/app"
 	"pathshala/config"
+	"pathshala/controllers"
 	"pathshala/middlewares"
 	"pathshala/migrations"
 	"pathshala/routes"
+	"pathshala/services"
+	"pathshala/storage"
 	"pathshala/utils"
+	"pathshala/workers"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	cfg, args, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			return migrate(cfg.Database, args[1:])
+		case "storage":
+			return storage.RunCommand(context.Background(), cfg.Storage, args[1:], os.Stdout)
+		}
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	// SIGINT and SIGTERM start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	a, err := app.New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	migrator, err := migrations.NewMigrator(a.DB, migrations.Files)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	if err := migrator.Check(); err != nil {
+		return fmt.Errorf("refusing to start: %w. Run `migrate status` to inspect the schema", err)
+	}
+
+	if cfg.PDFFont != "" {
+		font, err := os.ReadFile(cfg.PDFFont)
+		if err != nil {
+			return fmt.Errorf("reading PDF_FONT: %w", err)
+		}
+		if err := utils.SetPDFFont(font); err != nil {
+			return fmt.Errorf("PDF_FONT %s: %w", cfg.PDFFont, err)
+		}
+	}
+
+	// Initialize Services
+	surveyService := services.NewSurveyService(a.DB)
+	reportService := services.NewReportService(a.DB)
+	attemptService := services.NewAttemptService(a.DB)
+	gradingService := services.NewGradingService(a.DB, attemptService)
+	blueprintService := services.NewBlueprintService(a.DB)
+	revisionService := services.NewRevisionService(a.DB, attemptService)
+	itemAnalysisService := services.NewItemAnalysisService(a.DB, attemptService)
+	roleService := services.NewRoleService(a.DB)
+	auditService := services.NewAuditService(a.DB)
+	trashService := services.NewTrashService(a.DB, a.Storage, cfg.TrashRetention)
+	mfaService, err := services.NewMFAService(a.DB, a.Redis, cfg.MFA)
+	if err != nil {
+		return fmt.Errorf("setting up MFA: %w", err)
+	}
+	sessionService := services.NewSessionService(a.Redis, a.Tokens)
+	passwordResetService := services.NewPasswordResetService(a.DB, a.Redis, sessionService, cfg.PasswordReset)
+	loginGuardService := services.NewLoginGuardService(a.Redis, cfg.Login)
+	userStatusService := services.NewUserStatusService(a.DB, a.Redis, sessionService)
+
+	if err := utils.SeedAdminUser(a.DB, cfg.Admin); err != nil {
+		return fmt.Errorf("seeding admin user: %w", err)
+	}
+	if err := utils.SeedRolePermissions(a.DB); err != nil {
+		return fmt.Errorf("seeding role permissions: %w", err)
+	}
+	if err := services.SeedReportTypes(a.DB); err != nil {
+		return fmt.Errorf("seeding report types: %w", err)
+	}
+
+	// Background workers stop when the server shuts down
+	a.Go(func(ctx context.Context) { workers.RunAttemptExpiry(ctx, attemptService, time.Minute) })
+	a.Go(func(ctx context.Context) { workers.RunTrashPurge(ctx, trashService, time.Hour) })
+
 	r := gin.Default()
+	// Client IPs throttle logins and go into the audit log, so forwarding
+	// headers are only believed from the proxies in front of the server
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	r.TrustedPlatform = cfg.TrustedPlatform
 
 	r.Use(middlewares.PrometheusMiddleware())
 
 	// Prometheus metrics endpoint
 	r.GET("/metrics", middlewares.MetricsHandler())
 
-	// Initialize DB
-	config.ConnectDB()
-
-	//Initialize REDIS
-	config.InitRedis()
+	// Every mutating request below is recorded in the audit log
+	r.Use(middlewares.AuditMiddleware(auditService))
 
-	// 3. Initialize Services
-	// surveyService := services.NewSurveyService(config.DB)
-	// reportService := services.NewReportService(config.DB)
-
-	// Migration
-	migrations.MigrateQuestions()
+	// Register Routes
+	routes.SetupAuthRoutes(r, a, controllers.NewAuthController(a.DB, a.Redis, a.Tokens, a.Mailer, cfg.FrontendURL, mfaService, sessionService, passwordResetService, loginGuardService, a.Go))
+	routes.SetupUserRoutes(r, a, sessionService)
+	routes.SetupProfileRoutes(r, a)
+	routes.SetupCollegeRoutes(r, a)
+	routes.SetupCollegeTypeRoutes(r, a)
+	routes.SetupCategoryRoutes(r, a)
+	routes.SetupMacroCategoryRoutes(r, a)
+	routes.SetupHomeRouter(r, a)
+	routes.SetupQuestionRoutes(r, a)
+	routes.SetupTestRoutes(r, a)
+	routes.SetupAnswerRoutes(r, a)
+	routes.SetupResultRoutes(r, a)
+	routes.SetupStudentRoutes(r, a, controllers.NewStudentTestController(attemptService))
+	routes.SetupGradingRoutes(r, a, controllers.NewGradingController(a.DB, gradingService))
+	routes.SetupBlueprintRoutes(r, a, controllers.NewBlueprintController(a.DB, blueprintService))
+	routes.SetupRevisionRoutes(r, a, controllers.NewRevisionController(a.DB, revisionService))
+	routes.SetupItemAnalysisRoutes(r, a, controllers.NewItemAnalysisController(a.DB, itemAnalysisService))
+	routes.SetupReportRoutes(r, a, controllers.NewReportController(a.DB, reportService))
+	routes.SetupRoleRoutes(r, a, controllers.NewRoleController(a.DB, roleService))
+	routes.SetupSurveyRoutes(r, a, controllers.NewSurveyController(a.DB, surveyService))
+	routes.SetupAuditRoutes(r, a, controllers.NewAuditController(auditService))
+	routes.SetupTrashRoutes(r, a, controllers.NewTrashController(trashService))
+	routes.SetupSessionRoutes(r, a, controllers.NewSessionController(sessionService))
+	routes.SetupLoginGuardRoutes(r, a, controllers.NewLoginGuardController(a.DB, loginGuardService))
+	routes.SetupUserStatusRoutes(r, a, controllers.NewUserStatusController(a.DB, userStatusService))
+	routes.SetupFileRoutes(r, a, controllers.NewFileController(a.DB, a.Storage, cfg.Storage.URLExpiry))
 
-	utils.SeedAdminUser()
+	return a.Serve(ctx, r)
+}
 
-	// Register Routes
-	routes.SetupAuthRoutes(r)
-	routes.SetupUserRoutes(r, config.DB)
-	routes.SetupProfileRoutes(r)
-	routes.SetupCollegeRoutes(r, config.DB)
-	routes.SetupCollegeTypeRoutes(r, config.DB)
-	routes.SetupCategoryRoutes(r)
-	routes.SetupMacroCategoryRoutes(r)
-	routes.SetupHomeRouter(r)
-	routes.SetupQuestionRoutes(r)
-	routes.SetupTestRoutes(r)
-	routes.SetupAnswerRoutes(r)
-	routes.SetupResultRoutes(r)
-	// routes.SetupReportRoutes(r, controllers.NewReportController(reportService))
-	// routes.SetupSurveyRoutes()
-
-	r.Run(":8080")
+// migrate runs the migrate subcommand, which only needs the database
+func migrate(cfg config.DatabaseConfig, args []string) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	db, err := config.OpenDB(cfg)
+	if err != nil {
+		return fmt.Errorf("connecting to the database: %w", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := migrations.NewMigrator(db, migrations.Files)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	return migrations.RunCommand(migrator, args, os.Stdout)
 }
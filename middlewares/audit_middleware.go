@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditActions name the change a request made when its handler does not
+var auditActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// AuditMiddleware records every mutating request of a logged-in staff member
+// in the audit log, with the change the handler described with utils.Audit.
+// Student requests are only recorded when their handler calls utils.Audit.
+func AuditMiddleware(service services.AuditServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, mutating := auditActions[c.Request.Method]
+		if !mutating {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		entry := models.AuditLog{
+			Action:     action,
+			EntityType: auditEntity(c.FullPath()),
+			EntityID:   c.Param("id"),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Route:      c.FullPath(),
+			StatusCode: c.Writer.Status(),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(float64); ok {
+				actor := uint(id)
+				entry.ActorID = &actor
+			}
+		}
+		if role, ok := c.Get("role"); ok {
+			entry.ActorRole, _ = role.(string)
+		}
+
+		change, described := utils.AuditedChange(c)
+		if !described && (entry.ActorID == nil || entry.ActorRole == utils.RoleStudent) {
+			return
+		}
+		if described {
+			entry.Action = change.Action
+			entry.EntityType = change.EntityType
+			entry.EntityID = change.EntityID
+			entry.Before = change.Before
+			entry.After = change.After
+		}
+
+		if err := service.Record(&entry); err != nil {
+			log.Printf("Failed to record audit log for %s %s: %v", entry.Method, entry.Path, err)
+		}
+	}
+}
+
+// auditEntity is the resource a route acts on, e.g. "users" for /api/users/:id
+func auditEntity(route string) string {
+	for _, segment := range strings.Split(strings.Trim(route, "/"), "/") {
+		if segment != "" && segment != "api" && !strings.HasPrefix(segment, ":") {
+			return segment
+		}
+	}
+	return ""
+}
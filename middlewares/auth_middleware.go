@@ -1,19 +1,16 @@
 package middlewares
 
 import (
-	"context"
-	"fmt"
 	"net/http"
-	"pathshala/config"
-	"pathshala/models"
 	"pathshala/utils"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB, rdb *redis.Client, tokens *utils.Tokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
@@ -23,7 +20,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		claims, err := utils.ValidateToken(tokenString, false)
+		ctx := c.Request.Context()
+		claims, err := tokens.ValidateToken(ctx, tokenString, false)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -32,26 +30,27 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		c.Set("email", claims["email"])
 		c.Set("user_id", claims["user_id"])
+		c.Set("session_id", claims["sid"])
 
-		redisKey := fmt.Sprintf("user:role:%s", claims["email"])
-		role, err := config.RedisClient.Get(config.Ctx, redisKey).Result()
+		userID, _ := claims["user_id"].(float64)
+		user, err := utils.LoadCachedUser(ctx, db, rdb, uint(userID))
 		if err != nil {
-			var user models.User
-			if err := config.DB.Where("email = ?", claims["email"]).First(&user).Error; err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-				c.Abort()
-				return
-			}
-			role = user.Role
-			_ = config.RedisClient.Set(config.Ctx, redisKey, role, 15*time.Minute).Err()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		// Tokens issued before a suspension stop working with the next request
+		if user.Status != utils.StatusActive {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": utils.StatusMessage(user.Status), "status": user.Status})
+			return
 		}
 
-		c.Set("role", role)
+		c.Set("role", user.Role)
 
 		// fmt.Println(c.Get("role"))
 
 		// Access token must exist in Redis
-		exists, err := config.RedisClient.Exists(context.Background(), "access_token:"+tokenString).Result()
+		exists, err := rdb.Exists(ctx, "access_token:"+tokenString).Result()
 		if err != nil || exists == 0 {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token not whitelisted"})
 			return
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PermissionMiddleware lets a request through when the logged-in user holds
+// one of the permissions in some scope, and stores their utils.Subject on the
+// request. Controllers check the scope against the resource with utils.Authorize.
+func PermissionMiddleware(db *gorm.DB, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		userIDFloat, ok := userIDVal.(float64)
+		if !exists || !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		subject, err := utils.LoadSubject(db, uint(userIDFloat))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Set("subject", subject)
+
+		// Reads through utils.RequestDB only see the colleges of this subject
+		tenant, err := utils.LoadTenant(db, subject)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			return
+		}
+		c.Request = c.Request.WithContext(utils.WithTenant(c.Request.Context(), tenant))
+
+		for _, permission := range permissions {
+			if subject.HasPermission(permission) {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	}
+}
@@ -1,32 +1,45 @@
 package middlewares
 
 import (
+	"math"
+	"math/rand"
 	"net/http"
-	"pathshala/config"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 )
 
-func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+// RateLimitMiddleware lets each client IP make limit requests in any window
+// of time to the routes it guards. name keeps the counts of different route
+// groups apart. Requests are kept in a Redis sorted set by time, so the
+// window slides instead of resetting all at once.
+func RateLimitMiddleware(rdb *redis.Client, name string, limit int, window time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		key := "rate_limit:" + ip
+		ctx := c.Request.Context()
+		key := "rate_limit:" + name + ":" + c.ClientIP()
+		now := time.Now().UnixMilli()
+		member := strconv.FormatInt(now, 10) + "-" + strconv.FormatInt(rand.Int63(), 36)
 
-		// Increment the counter
-		count, err := config.RedisClient.Incr(config.Ctx, key).Result()
-		if err != nil {
+		// Refused requests count too, so a client that keeps hammering stays refused
+		pipe := rdb.TxPipeline()
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now-window.Milliseconds(), 10))
+		count := pipe.ZCard(ctx, key)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now), Member: member})
+		pipe.PExpire(ctx, key, window)
+		if _, err := pipe.Exec(ctx); err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Rate limit error"})
 			return
 		}
 
-		// Set expiration if it's the first time
-		if count == 1 {
-			config.RedisClient.Expire(config.Ctx, key, window)
-		}
-
 		// If over the limit
-		if count > int64(limit) {
+		if count.Val() >= int64(limit) {
+			retryAfter := window
+			if oldest, err := rdb.ZRangeWithScores(ctx, key, 0, 0).Result(); err == nil && len(oldest) == 1 {
+				retryAfter = time.Duration(int64(oldest[0].Score)+window.Milliseconds()-now) * time.Millisecond
+			}
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded. Try again later."})
 			return
 		}
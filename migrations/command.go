@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const commandUsage = "usage: migrate up | down | status | force VERSION"
+
+// RunCommand runs the migrate subcommand given its arguments
+func RunCommand(m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(commandUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := m.Up()
+		if count > 0 {
+			fmt.Fprintf(out, "Applied %d migration(s)\n", count)
+		}
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			fmt.Fprintln(out, "Schema is up to date")
+		}
+		return nil
+
+	case "down":
+		migration, err := m.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back %d_%s\n", migration.Version, migration.Name)
+		return nil
+
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Dirty {
+				state = "dirty"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := m.Force(uint(version)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema forced to version %d\n", version)
+		return nil
+	}
+	return errors.New(commandUsage)
+}
@@ -1,17 +1,298 @@
 package migrations
 
 import (
-	"pathshala/config"
-	"pathshala/models"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
 )
 
-// Migrate creates the necessary tables
-func MigrateQuestions() {
-	config.DB.AutoMigrate(&models.User{}, &models.CollegeType{}, &models.College{})
-	config.DB.AutoMigrate(&models.Teacher{}, &models.Student{})
-	config.DB.AutoMigrate(&models.MacroCategory{}, &models.Category{})
-	config.DB.AutoMigrate(&models.Question{}, &models.QuestionOption{})
-	config.DB.AutoMigrate(&models.Test{}, &models.TestQuestion{})
-	config.DB.AutoMigrate(&models.StudentAnswer{}, &models.StudentTest{}, &models.Result{})
-	config.DB.AutoMigrate(&models.Survey{}, &models.ReportType{})
+// Files are the versioned schema migrations, named
+// NNNN_description.up.sql and NNNN_description.down.sql
+//
+//go:embed sql/*.sql
+var Files embed.FS
+
+var (
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+	ErrDirtySchema       = errors.New("database schema is dirty")
+	ErrUnknownVersion    = errors.New("database schema has a migration this build does not know")
+	ErrNoMigrations      = errors.New("no migrations have been applied")
+)
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration. A migration stays dirty when
+// its script failed part way, until an operator fixes the schema and forces
+// the version.
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration // Ordered by version
+}
+
+// NewMigrator loads the migrations in the sql directory of fsys
+func NewMigrator(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	dir, err := fs.Sub(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Load reads the up and down scripts in fsys. Every version needs both.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (m *Migrator) applied() (map[uint]SchemaMigration, error) {
+	if err := m.DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := m.DB.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) known(version uint) bool {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Check fails unless every migration has been applied cleanly, so the
+// server never runs against a schema it was not built for
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	for version, row := range applied {
+		if row.Dirty {
+			return fmt.Errorf("%w: migration %d_%s did not finish", ErrDirtySchema, row.Version, row.Name)
+		}
+		if !m.known(version) {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			return fmt.Errorf("%w: %d_%s is not applied", ErrPendingMigrations, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// run marks a migration dirty, runs its script in a transaction and then
+// records the outcome with done. A failed script leaves the mark behind.
+func (m *Migrator) run(migration Migration, script string, done func(tx *gorm.DB) error) error {
+	mark := SchemaMigration{Version: migration.Version, Name: migration.Name, Dirty: true, AppliedAt: time.Now()}
+	if err := m.DB.Save(&mark).Error; err != nil {
+		return err
+	}
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(script).Error; err != nil {
+			return err
+		}
+		return done(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// Up applies every pending migration in order and returns how many ran
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range applied {
+		if row.Dirty {
+			return 0, fmt.Errorf("%w: fix migration %d_%s by hand, then force a version", ErrDirtySchema, row.Version, row.Name)
+		}
+	}
+
+	count := 0
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.run(migration, migration.Up, func(tx *gorm.DB) error {
+			return tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).
+				Updates(map[string]interface{}{"dirty": false, "applied_at": time.Now()}).Error
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down rolls back the most recently applied migration and returns it
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var latest *SchemaMigration
+	for _, row := range applied {
+		if row.Dirty {
+			return nil, fmt.Errorf("%w: fix migration %d_%s by hand, then force a version", ErrDirtySchema, row.Version, row.Name)
+		}
+		if latest == nil || row.Version > latest.Version {
+			latest = &row
+		}
+	}
+	if latest == nil {
+		return nil, ErrNoMigrations
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version != latest.Version {
+			continue
+		}
+		err := m.run(migration, migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &migration, nil
+	}
+	return nil, fmt.Errorf("%w: version %d", ErrUnknownVersion, latest.Version)
+}
+
+// Force records that exactly the migrations up to version are applied,
+// clearing any dirty mark. It runs no scripts; use it after repairing a
+// failed migration by hand. Version 0 records that none are applied.
+func (m *Migrator) Force(version uint) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+	}
+	if _, err := m.applied(); err != nil {
+		return err
+	}
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&SchemaMigration{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, migration := range m.Migrations {
+			if migration.Version > version {
+				break
+			}
+			row := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: now}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration with whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.Dirty = row.Dirty
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
 }
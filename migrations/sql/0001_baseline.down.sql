@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS "audit_logs";
+DROP TABLE IF EXISTS "report_types";
+DROP TABLE IF EXISTS "survey_answers";
+DROP TABLE IF EXISTS "survey_responses";
+DROP TABLE IF EXISTS "survey_assignments";
+DROP TABLE IF EXISTS "survey_questions";
+DROP TABLE IF EXISTS "surveys";
+DROP TABLE IF EXISTS "answer_batches";
+DROP TABLE IF EXISTS "answer_criterion_scores";
+DROP TABLE IF EXISTS "results";
+DROP TABLE IF EXISTS "student_test_questions";
+DROP TABLE IF EXISTS "student_tests";
+DROP TABLE IF EXISTS "student_answers";
+DROP TABLE IF EXISTS "test_blueprints";
+DROP TABLE IF EXISTS "test_questions";
+DROP TABLE IF EXISTS "tests";
+DROP TABLE IF EXISTS "rubric_criterions";
+DROP TABLE IF EXISTS "question_revisions";
+DROP TABLE IF EXISTS "question_options";
+DROP TABLE IF EXISTS "questions";
+DROP TABLE IF EXISTS "categories";
+DROP TABLE IF EXISTS "macro_categories";
+DROP TABLE IF EXISTS "students";
+DROP TABLE IF EXISTS "teachers";
+DROP TABLE IF EXISTS "role_assignments";
+DROP TABLE IF EXISTS "role_permissions";
+DROP TABLE IF EXISTS "users";
+DROP TABLE IF EXISTS "colleges";
+DROP TABLE IF EXISTS "college_types";
@@ -0,0 +1,473 @@
+-- Schema as created by AutoMigrate before versioned migrations. Every
+-- statement is guarded so databases created by AutoMigrate can be baselined;
+-- columns added after a table first appeared are added again with ALTER
+-- TABLE for databases AutoMigrated by an older release.
+
+CREATE TABLE IF NOT EXISTS "college_types" (
+    "id" bigserial,
+    "name" text NOT NULL,
+    "type_description" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_college_types_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "colleges" (
+    "id" bigserial,
+    "name" text,
+    "description" text,
+    "state" text,
+    "college_type_id" bigint,
+    "active_candidates" bigint,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_colleges_college_type" FOREIGN KEY ("college_type_id") REFERENCES "college_types"("id")
+);
+ALTER TABLE "colleges" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_colleges_deleted_at" ON "colleges" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" bigserial,
+    "name" text,
+    "email" text,
+    "password" text NOT NULL,
+    "college_id" bigint,
+    "role" text,
+    "secondary_email" text,
+    "profile_image" text,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_college" FOREIGN KEY ("college_id") REFERENCES "colleges"("id"),
+    CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "role_permissions" (
+    "id" bigserial,
+    "role" varchar(30) NOT NULL,
+    "permission" varchar(50) NOT NULL,
+    "scope" varchar(10) NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_role_permission" ON "role_permissions" ("role","permission");
+
+CREATE TABLE IF NOT EXISTS "role_assignments" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "role" varchar(30) NOT NULL,
+    "college_id" bigint,
+    "state" text,
+    "granted_by" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_role_assignments_user_id" ON "role_assignments" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "teachers" (
+    "id" bigserial,
+    "user_id" bigint,
+    "state" text,
+    "teacher_type" text,
+    "super" boolean,
+    "status" text,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_teachers_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+ALTER TABLE "teachers" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_teachers_deleted_at" ON "teachers" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "students" (
+    "id" bigserial,
+    "user_id" bigint,
+    "status" text,
+    "branch" text,
+    "gender" text,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_students_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+ALTER TABLE "students" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_students_deleted_at" ON "students" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "macro_categories" (
+    "id" bigserial,
+    "name" varchar(100) NOT NULL,
+    "description" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "categories" (
+    "id" bigserial,
+    "name" varchar(100) NOT NULL,
+    "macro_category_id" bigint,
+    "college_id" bigint,
+    "shared" boolean DEFAULT false,
+    "creator_name" varchar(100),
+    "description" text,
+    "image_path" text,
+    "status" text DEFAULT 'draft',
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_categories_macro_category" FOREIGN KEY ("macro_category_id") REFERENCES "macro_categories"("id"),
+    CONSTRAINT "fk_categories_college" FOREIGN KEY ("college_id") REFERENCES "colleges"("id")
+);
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "college_id" bigint;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "shared" boolean DEFAULT false;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+
+-- Link categories to the college whose name they recorded before categories
+-- referenced colleges. A category without a college is platform content every
+-- college reads, so names matching no college get a college of their own
+-- rather than publishing the category.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'categories' AND column_name = 'college_name') THEN
+        EXECUTE 'INSERT INTO "colleges" ("name", "description")
+            SELECT DISTINCT "categories"."college_name", ''Added by the baseline migration for categories naming no known college''
+            FROM "categories"
+            WHERE "categories"."college_id" IS NULL AND TRIM("categories"."college_name") <> ''''
+            AND NOT EXISTS (SELECT 1 FROM "colleges" WHERE "colleges"."name" = "categories"."college_name")';
+        EXECUTE 'UPDATE "categories" SET "college_id" = (
+            SELECT MIN("colleges"."id") FROM "colleges" WHERE "colleges"."name" = "categories"."college_name")
+            WHERE "college_id" IS NULL AND TRIM("college_name") <> ''''';
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_categories_college') THEN
+        ALTER TABLE "categories" ADD CONSTRAINT "fk_categories_college" FOREIGN KEY ("college_id") REFERENCES "colleges"("id");
+    END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS "idx_categories_deleted_at" ON "categories" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_categories_college_id" ON "categories" ("college_id");
+
+CREATE TABLE IF NOT EXISTS "questions" (
+    "id" bigserial,
+    "question_type" varchar(20) NOT NULL,
+    "question_text" text NOT NULL,
+    "correct_option_id" bigint DEFAULT null,
+    "difficulty" varchar(10) NOT NULL,
+    "category_id" bigint NOT NULL,
+    "image1" text DEFAULT null,
+    "image1_display_time" bigint DEFAULT null,
+    "image2" text DEFAULT null,
+    "image2_display_time" bigint DEFAULT null,
+    "comment" text DEFAULT null,
+    "comment_display_time" bigint DEFAULT null,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_questions_category" FOREIGN KEY ("category_id") REFERENCES "categories"("id")
+);
+ALTER TABLE "questions" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_questions_deleted_at" ON "questions" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "question_options" (
+    "id" bigserial,
+    "question_id" bigint NOT NULL,
+    "option_id" bigint NOT NULL,
+    "option_text" text NOT NULL,
+    "is_correct" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_questions_options" FOREIGN KEY ("question_id") REFERENCES "questions"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "question_revisions" (
+    "id" bigserial,
+    "question_id" bigint NOT NULL,
+    "revision" bigint NOT NULL,
+    "question_type" varchar(20) NOT NULL,
+    "question_text" text NOT NULL,
+    "correct_option_id" bigint,
+    "difficulty" varchar(10) NOT NULL,
+    "category_id" bigint,
+    "image1" text,
+    "image1_display_time" bigint,
+    "image2" text,
+    "image2_display_time" bigint,
+    "comment" text,
+    "comment_display_time" bigint,
+    "options" text,
+    "edited_by" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_question_revision" ON "question_revisions" ("question_id","revision");
+
+CREATE TABLE IF NOT EXISTS "rubric_criterions" (
+    "id" bigserial,
+    "question_id" bigint NOT NULL,
+    "description" text NOT NULL,
+    "max_points" decimal NOT NULL,
+    "position" bigint,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_rubric_criterions_question_id" ON "rubric_criterions" ("question_id");
+
+CREATE TABLE IF NOT EXISTS "tests" (
+    "id" bigserial,
+    "test_name" text,
+    "user_id" bigint,
+    "min_questions" bigint,
+    "duration_minutes" bigint,
+    "opens_at" timestamptz,
+    "closes_at" timestamptz,
+    "shuffle_questions" boolean,
+    "shuffle_options" boolean,
+    "negative_marking" decimal DEFAULT 0,
+    "easy_marks" decimal DEFAULT 1,
+    "medium_marks" decimal DEFAULT 2,
+    "hard_marks" decimal DEFAULT 3,
+    "all_or_nothing" boolean,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_tests_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "duration_minutes" bigint;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "opens_at" timestamptz;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "closes_at" timestamptz;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "shuffle_questions" boolean;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "shuffle_options" boolean;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "negative_marking" decimal DEFAULT 0;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "easy_marks" decimal DEFAULT 1;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "medium_marks" decimal DEFAULT 2;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "hard_marks" decimal DEFAULT 3;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "all_or_nothing" boolean;
+ALTER TABLE "tests" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_tests_deleted_at" ON "tests" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "test_questions" (
+    "id" bigserial,
+    "test_id" bigint NOT NULL,
+    "question_id" bigint NOT NULL,
+    "marks" decimal,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "test_questions" ADD COLUMN IF NOT EXISTS "marks" decimal;
+
+CREATE TABLE IF NOT EXISTS "test_blueprints" (
+    "id" bigserial,
+    "test_id" bigint NOT NULL,
+    "category_id" bigint NOT NULL,
+    "difficulty" varchar(10) NOT NULL,
+    "count" bigint NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_test_blueprints_test_id" ON "test_blueprints" ("test_id");
+
+CREATE TABLE IF NOT EXISTS "student_answers" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "test_id" bigint,
+    "student_id" bigint,
+    "question_id" bigint,
+    "selected" text,
+    "selected_option_id" bigint,
+    "revision_id" bigint,
+    "points" decimal,
+    "feedback" text,
+    "graded_by" bigint,
+    "graded_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "selected_option_id" bigint;
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "revision_id" bigint;
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "points" decimal;
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "feedback" text;
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "graded_by" bigint;
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "graded_at" timestamptz;
+
+-- Keep only the latest answer to each question so that the unique index can
+-- be created
+DELETE FROM "student_answers" WHERE "id" NOT IN (
+    SELECT MAX("id") FROM "student_answers" GROUP BY "test_id", "student_id", "question_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_student_answer" ON "student_answers" ("test_id","student_id","question_id");
+CREATE INDEX IF NOT EXISTS "idx_student_answers_deleted_at" ON "student_answers" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "student_tests" (
+    "id" bigserial,
+    "student_id" bigint,
+    "test_id" bigint,
+    "status" varchar(20) DEFAULT 'assigned',
+    "assigned_at" timestamptz,
+    "start_time" timestamptz,
+    "deadline" timestamptz,
+    "submitted_at" timestamptz,
+    "shuffle_seed" bigint,
+    "question_order" text,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "status" varchar(20) DEFAULT 'assigned';
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "assigned_at" timestamptz;
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "deadline" timestamptz;
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "submitted_at" timestamptz;
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "shuffle_seed" bigint;
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "question_order" text;
+ALTER TABLE "student_tests" ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_student_tests_deleted_at" ON "student_tests" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "student_test_questions" (
+    "id" bigserial,
+    "student_test_id" bigint NOT NULL,
+    "question_id" bigint NOT NULL,
+    "blueprint_id" bigint,
+    "revision_id" bigint,
+    "position" bigint,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "student_test_questions" ADD COLUMN IF NOT EXISTS "revision_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_student_test_questions_student_test_id" ON "student_test_questions" ("student_test_id");
+
+CREATE TABLE IF NOT EXISTS "results" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "test_id" bigint,
+    "user_id" bigint,
+    "score" decimal,
+    "max_score" decimal,
+    "correct" bigint,
+    "incorrect" bigint,
+    "ignored" bigint,
+    "pending_grading" bigint,
+    "time_taken_seconds" bigint,
+    "auto_submitted" boolean,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "results" ADD COLUMN IF NOT EXISTS "max_score" decimal;
+ALTER TABLE "results" ADD COLUMN IF NOT EXISTS "pending_grading" bigint;
+ALTER TABLE "results" ADD COLUMN IF NOT EXISTS "time_taken_seconds" bigint;
+ALTER TABLE "results" ADD COLUMN IF NOT EXISTS "auto_submitted" boolean;
+ALTER TABLE "results" ALTER COLUMN "score" TYPE decimal;
+CREATE INDEX IF NOT EXISTS "idx_results_deleted_at" ON "results" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "answer_criterion_scores" (
+    "id" bigserial,
+    "student_answer_id" bigint NOT NULL,
+    "criterion_id" bigint NOT NULL,
+    "points" decimal,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_answer_criterion_scores_student_answer_id" ON "answer_criterion_scores" ("student_answer_id");
+
+CREATE TABLE IF NOT EXISTS "answer_batches" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "idempotency_key" varchar(100) NOT NULL,
+    "answers" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_answer_batch_key" ON "answer_batches" ("user_id","idempotency_key");
+
+CREATE TABLE IF NOT EXISTS "surveys" (
+    "id" uuid,
+    "name" text NOT NULL,
+    "description" text,
+    "category" text,
+    "survey_type" text,
+    "show_results" boolean,
+    "anonymous" boolean,
+    "num_questions" bigint,
+    "created_by" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "surveys" ADD COLUMN IF NOT EXISTS "anonymous" boolean;
+
+-- Surveys recorded their creator as a UUID that matched no user; creators are
+-- user IDs now, so those values cannot be kept
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'surveys' AND column_name = 'created_by') <> 'bigint' THEN
+        ALTER TABLE "surveys" ALTER COLUMN "created_by" TYPE bigint USING NULL;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS "survey_questions" (
+    "id" bigserial,
+    "survey_id" uuid NOT NULL,
+    "position" bigint,
+    "question_type" varchar(20) NOT NULL,
+    "question_text" text NOT NULL,
+    "options" text,
+    "scale" bigint,
+    "required" boolean,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_surveys_questions" FOREIGN KEY ("survey_id") REFERENCES "surveys"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_survey_questions_survey_id" ON "survey_questions" ("survey_id");
+
+CREATE TABLE IF NOT EXISTS "survey_assignments" (
+    "id" bigserial,
+    "survey_id" uuid NOT NULL,
+    "student_id" bigint NOT NULL,
+    "status" varchar(20) DEFAULT 'assigned',
+    "assigned_at" timestamptz,
+    "completed_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_survey_student" ON "survey_assignments" ("survey_id","student_id");
+
+CREATE TABLE IF NOT EXISTS "survey_responses" (
+    "id" bigserial,
+    "survey_id" uuid NOT NULL,
+    "student_id" bigint,
+    "submitted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_survey_responses_survey_id" ON "survey_responses" ("survey_id");
+
+CREATE TABLE IF NOT EXISTS "survey_answers" (
+    "id" bigserial,
+    "response_id" bigint NOT NULL,
+    "question_id" bigint NOT NULL,
+    "likert_value" bigint,
+    "option_index" bigint,
+    "text" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_survey_responses_answers" FOREIGN KEY ("response_id") REFERENCES "survey_responses"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_survey_answers_response_id" ON "survey_answers" ("response_id");
+
+CREATE TABLE IF NOT EXISTS "report_types" (
+    "id" bigserial,
+    "type" text NOT NULL,
+    "title" varchar(100),
+    "description" text,
+    "per_test" boolean,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_report_types_type" UNIQUE ("type")
+);
+ALTER TABLE "report_types" ADD COLUMN IF NOT EXISTS "title" varchar(100);
+ALTER TABLE "report_types" ADD COLUMN IF NOT EXISTS "description" text;
+ALTER TABLE "report_types" ADD COLUMN IF NOT EXISTS "per_test" boolean;
+
+CREATE TABLE IF NOT EXISTS "audit_logs" (
+    "id" bigserial,
+    "actor_id" bigint,
+    "actor_role" varchar(50),
+    "action" varchar(50),
+    "entity_type" varchar(50),
+    "entity_id" varchar(64),
+    "before" text,
+    "after" text,
+    "method" varchar(10),
+    "path" text,
+    "route" text,
+    "status_code" bigint,
+    "ip" varchar(64),
+    "user_agent" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_actor_id" ON "audit_logs" ("actor_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_created_at" ON "audit_logs" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_entity" ON "audit_logs" ("entity_type","entity_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_action" ON "audit_logs" ("action");
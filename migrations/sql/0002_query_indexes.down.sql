@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_users_college_role";
+DROP INDEX IF EXISTS "idx_results_test_id";
@@ -0,0 +1,5 @@
+-- Indexes for the hottest report and listing queries.
+-- Answers by (test_id, student_id) are already served by the leading columns
+-- of the unique idx_student_answer (test_id, student_id, question_id).
+CREATE INDEX IF NOT EXISTS "idx_results_test_id" ON "results" ("test_id");
+CREATE INDEX IF NOT EXISTS "idx_users_college_role" ON "users" ("college_id", "role");
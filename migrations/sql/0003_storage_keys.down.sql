@@ -0,0 +1,6 @@
+UPDATE "users" SET "profile_image" = 'uploads/' || "profile_image" WHERE "profile_image" LIKE 'profiles/%';
+UPDATE "categories" SET "image_path" = 'uploads/' || "image_path" WHERE "image_path" LIKE 'categories/%';
+UPDATE "question_revisions" SET "image2" = 'uploads/' || "image2" WHERE "image2" LIKE 'questions/%';
+UPDATE "question_revisions" SET "image1" = 'uploads/' || "image1" WHERE "image1" LIKE 'questions/%';
+UPDATE "questions" SET "image2" = 'uploads/' || "image2" WHERE "image2" LIKE 'questions/%';
+UPDATE "questions" SET "image1" = 'uploads/' || "image1" WHERE "image1" LIKE 'questions/%';
@@ -0,0 +1,9 @@
+-- Uploads used to be recorded as paths under the local uploads/ directory.
+-- They are now storage keys relative to the storage root, so the same value
+-- works for the local and the S3 backend.
+UPDATE "questions" SET "image1" = SUBSTR("image1", 9) WHERE "image1" LIKE 'uploads/%';
+UPDATE "questions" SET "image2" = SUBSTR("image2", 9) WHERE "image2" LIKE 'uploads/%';
+UPDATE "question_revisions" SET "image1" = SUBSTR("image1", 9) WHERE "image1" LIKE 'uploads/%';
+UPDATE "question_revisions" SET "image2" = SUBSTR("image2", 9) WHERE "image2" LIKE 'uploads/%';
+UPDATE "categories" SET "image_path" = SUBSTR("image_path", 9) WHERE "image_path" LIKE 'uploads/%';
+UPDATE "users" SET "profile_image" = SUBSTR("profile_image", 9) WHERE "profile_image" LIKE 'uploads/%';
@@ -0,0 +1,23 @@
+-- TOTP authenticators and their recovery codes. The secret is encrypted
+-- with MFA_ENCRYPTION_KEY; recovery codes are stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS "user_mfa" (
+    "user_id" bigint NOT NULL,
+    "secret" text NOT NULL,
+    "enabled" boolean NOT NULL DEFAULT false,
+    "last_used_step" bigint,
+    "confirmed_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("user_id")
+);
+
+CREATE TABLE IF NOT EXISTS "mfa_recovery_codes" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "code_hash" varchar(64) NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_mfa_recovery_codes_user_id" ON "mfa_recovery_codes" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_mfa_recovery_codes_code_hash" ON "mfa_recovery_codes" ("code_hash");
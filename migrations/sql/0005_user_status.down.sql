@@ -0,0 +1,7 @@
+ALTER TABLE "students" ADD COLUMN "status" text;
+ALTER TABLE "teachers" ADD COLUMN "status" text;
+UPDATE "students" SET "status" = CASE WHEN "user_id" IN (SELECT "id" FROM "users" WHERE "status" = 'active') THEN 'active' ELSE 'inactive' END;
+UPDATE "teachers" SET "status" = CASE WHEN "user_id" IN (SELECT "id" FROM "users" WHERE "status" = 'active') THEN 'active' ELSE 'inactive' END;
+
+DROP INDEX IF EXISTS "idx_users_status";
+ALTER TABLE "users" DROP COLUMN "status";
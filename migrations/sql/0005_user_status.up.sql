@@ -0,0 +1,11 @@
+-- Users get one lifecycle status: invited, active, suspended, graduated or
+-- archived. It replaces the active/inactive status of students and teachers,
+-- which nothing enforced; inactive users become suspended.
+ALTER TABLE "users" ADD COLUMN "status" varchar(20) NOT NULL DEFAULT 'active';
+UPDATE "users" SET "status" = 'suspended'
+WHERE "id" IN (SELECT "user_id" FROM "students" WHERE "status" = 'inactive')
+   OR "id" IN (SELECT "user_id" FROM "teachers" WHERE "status" = 'inactive');
+CREATE INDEX IF NOT EXISTS "idx_users_status" ON "users" ("status");
+
+ALTER TABLE "students" DROP COLUMN "status";
+ALTER TABLE "teachers" DROP COLUMN "status";
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "idx_answer_batch_key";
+DELETE FROM "answer_batches" WHERE "id" NOT IN (SELECT MIN("id") FROM "answer_batches" GROUP BY "user_id", "idempotency_key");
+ALTER TABLE "answer_batches" DROP COLUMN "payload_hash";
+ALTER TABLE "answer_batches" DROP COLUMN "student_test_id";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_answer_batch_key" ON "answer_batches" ("user_id","idempotency_key");
@@ -0,0 +1,7 @@
+-- Idempotency keys of answer batches are scoped to the attempt, and the
+-- answers are hashed so that a key reused for a different batch is refused.
+-- Batches saved by graders belong to no attempt and keep 0.
+ALTER TABLE "answer_batches" ADD COLUMN "student_test_id" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "answer_batches" ADD COLUMN "payload_hash" varchar(64) NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS "idx_answer_batch_key";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_answer_batch_key" ON "answer_batches" ("student_test_id","user_id","idempotency_key");
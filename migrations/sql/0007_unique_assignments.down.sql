@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_result_test_user";
+DROP INDEX IF EXISTS "idx_student_test";
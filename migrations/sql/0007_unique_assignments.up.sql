@@ -0,0 +1,17 @@
+-- A test is assigned to a student once and gives them one result. Duplicates
+-- left by re-sending a test are moved to the trash first: the most advanced
+-- attempt and the latest result are kept.
+UPDATE "student_tests" SET "deleted_at" = NOW()
+WHERE "deleted_at" IS NULL AND "id" NOT IN (
+    SELECT DISTINCT ON ("test_id", "student_id") "id" FROM "student_tests"
+    WHERE "deleted_at" IS NULL
+    ORDER BY "test_id", "student_id",
+        CASE "status" WHEN 'submitted' THEN 0 WHEN 'in_progress' THEN 1 ELSE 2 END, "id"
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_student_test" ON "student_tests" ("test_id", "student_id") WHERE "deleted_at" IS NULL;
+
+UPDATE "results" SET "deleted_at" = NOW()
+WHERE "deleted_at" IS NULL AND "id" NOT IN (
+    SELECT MAX("id") FROM "results" WHERE "deleted_at" IS NULL GROUP BY "test_id", "user_id"
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_result_test_user" ON "results" ("test_id", "user_id") WHERE "deleted_at" IS NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "idx_student_test_question";
@@ -0,0 +1,6 @@
+-- An attempt is given each question once. Concurrent starts could give an
+-- attempt its questions twice; the copies are dropped.
+DELETE FROM "student_test_questions" WHERE "id" NOT IN (
+    SELECT MIN("id") FROM "student_test_questions" GROUP BY "student_test_id", "question_id"
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_student_test_question" ON "student_test_questions" ("student_test_id", "question_id");
@@ -0,0 +1 @@
+ALTER TABLE "student_answers" DROP COLUMN IF EXISTS "max_points";
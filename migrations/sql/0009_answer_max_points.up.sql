@@ -0,0 +1,10 @@
+-- Graded answers keep what the rubric made a full answer worth, so editing a
+-- rubric does not rescore answers graded against the old one
+ALTER TABLE "student_answers" ADD COLUMN IF NOT EXISTS "max_points" decimal;
+
+UPDATE "student_answers" SET "max_points" = COALESCE(
+    (SELECT SUM("max_points") FROM "rubric_criterions"
+     WHERE "rubric_criterions"."question_id" = "student_answers"."question_id"),
+    1)
+WHERE "points" IS NOT NULL AND "max_points" IS NULL
+  AND "question_id" IN (SELECT "id" FROM "questions" WHERE "question_type" = 'DESCRIPTIVE');
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditAppendOnly = errors.New("audit log entries cannot be changed")
+
+// AuditLog is one mutating request: who did what to which entity, the entity
+// before and after the change, and where the request came from
+type AuditLog struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	ActorID    *uint       `gorm:"index" json:"actor_id"`
+	ActorRole  string      `gorm:"type:varchar(50)" json:"actor_role"`
+	Action     string      `gorm:"type:varchar(50);index" json:"action"` // create, update, delete, submit, grade...
+	EntityType string      `gorm:"type:varchar(50);index:idx_audit_entity" json:"entity_type"`
+	EntityID   string      `gorm:"type:varchar(64);index:idx_audit_entity" json:"entity_id"`
+	Before     interface{} `gorm:"type:text;serializer:json" json:"before"`
+	After      interface{} `gorm:"type:text;serializer:json" json:"after"`
+	Method     string      `gorm:"type:varchar(10)" json:"method"`
+	Path       string      `gorm:"type:text" json:"path"`
+	Route      string      `gorm:"type:text" json:"route"`
+	StatusCode int         `json:"status_code"`
+	IP         string      `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string      `gorm:"type:text" json:"user_agent"`
+	CreatedAt  time.Time   `gorm:"index" json:"created_at"`
+}
+
+// The audit trail is append-only
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error { return ErrAuditAppendOnly }
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error { return ErrAuditAppendOnly }
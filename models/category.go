@@ -1,5 +1,7 @@
 package models
 
+import "gorm.io/gorm"
+
 type MacroCategory struct {
 	ID          uint   `gorm:"primaryKey" json:"id"`
 	Name        string `gorm:"type:varchar(100);not null" json:"name"`
@@ -13,12 +15,14 @@ type Category struct {
 	Name            string         `gorm:"type:varchar(100);not null" json:"name"`
 	MacroCategoryID *uint          `json:"-"`
 	MacroCategory   *MacroCategory `gorm:"foreignKey:MacroCategoryID" json:"macro_category,omitempty"`
-	CollegeName     *string        `gorm:"type:varchar(100)" json:"college_name,omitempty"`
-	State           *string        `gorm:"type:varchar(100)" json:"state,omitempty"`
+	CollegeID       *uint          `gorm:"index" json:"college_id"` // Nil for platform categories every college sees
+	College         *College       `gorm:"foreignKey:CollegeID" json:"college,omitempty"`
+	Shared          bool           `gorm:"default:false" json:"shared"` // Visible to other colleges
 	CreatorName     string         `gorm:"type:varchar(100)" json:"creator_name"`
 	Description     *string        `gorm:"type:text" json:"description,omitempty"`
 	ImagePath       *string        `gorm:"type:text" json:"image_path,omitempty"`
 	Status          string         `json:"status" gorm:"default:'draft'"` // values: "draft", "active"
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type CategoryResponse struct {
@@ -27,6 +31,7 @@ type CategoryResponse struct {
 	MacroCategory string `json:"macro_category"`
 	CollegeName   string `json:"college_name,omitempty"`
 	State         string `json:"state,omitempty"`
+	Shared        bool   `json:"shared"`
 	// CreatorName   string `json:"creator_name"`
 }
 
@@ -1,13 +1,16 @@
 package models
 
+import "gorm.io/gorm"
+
 type College struct {
-	ID               uint        `gorm:"primaryKey" json:"id"`
-	Name             string      `json:"name" binding:"required"`
-	Description      string      `json:"description" binding:"required"`
-	State            string      `json:"state" binding:"required"`
-	CollegeTypeID    uint        `json:"college_type_id" binding:"required"`
-	ActiveCandidates int         `json:"active_candidates" binding:"gte=0"`
-	CollegeType      CollegeType `gorm:"foreignKey:CollegeTypeID;references:ID" json:"-"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	Name             string         `json:"name" binding:"required"`
+	Description      string         `json:"description" binding:"required"`
+	State            string         `json:"state" binding:"required"`
+	CollegeTypeID    uint           `json:"college_type_id" binding:"required"`
+	ActiveCandidates int            `json:"active_candidates" binding:"gte=0"`
+	CollegeType      CollegeType    `gorm:"foreignKey:CollegeTypeID;references:ID" json:"-"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type CollegeType struct {
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// UserMFA is a user's TOTP authenticator. The secret is encrypted; it only
+// protects logins once Enabled is set by confirming a first code.
+type UserMFA struct {
+	UserID       uint       `gorm:"primaryKey" json:"user_id"`
+	Secret       string     `gorm:"type:text;not null" json:"-"`
+	Enabled      bool       `gorm:"not null;default:false" json:"enabled"`
+	LastUsedStep int64      `json:"-"` // Time step of the last accepted code, so codes cannot be replayed
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (UserMFA) TableName() string { return "user_mfa" }
+
+// MFARecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only its SHA-256 hash is kept; codes are random
+// enough that a slow hash adds nothing.
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// RolePermission grants a permission to everyone holding a role, within a
+// scope: global, state, college or own (resources the user created)
+type RolePermission struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Role       string `gorm:"type:varchar(30);not null;uniqueIndex:idx_role_permission" json:"role"`
+	Permission string `gorm:"type:varchar(50);not null;uniqueIndex:idx_role_permission" json:"permission"`
+	Scope      string `gorm:"type:varchar(10);not null" json:"scope"`
+}
+
+// RoleAssignment gives a user an extra role limited to a college or a state,
+// e.g. a state coordinator for Goa
+type RoleAssignment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Role      string    `gorm:"type:varchar(30);not null" json:"role"`
+	CollegeID *uint     `json:"college_id,omitempty"`
+	State     string    `json:"state,omitempty"`
+	GrantedBy *uint     `json:"granted_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// QuestionRevision is an immutable snapshot of a question and its options.
+// Attempts record the revision they were served, so later edits to the
+// question do not change how past answers are read.
+type QuestionRevision struct {
+	ID                 uint             `gorm:"primaryKey" json:"id"`
+	QuestionID         uint             `gorm:"not null;uniqueIndex:idx_question_revision" json:"question_id"`
+	Revision           int              `gorm:"not null;uniqueIndex:idx_question_revision" json:"revision"` // 1, 2, ... per question
+	QuestionType       string           `gorm:"type:varchar(20);not null" json:"question_type"`
+	QuestionText       string           `gorm:"type:text;not null" json:"question_text"`
+	CorrectOptionID    *uint            `json:"correct_option_id"`
+	Difficulty         string           `gorm:"type:varchar(10);not null" json:"difficulty"`
+	CategoryID         uint             `json:"category_id"`
+	Image1             string           `gorm:"type:text" json:"image1,omitempty"`
+	Image1DisplayTime  *int             `json:"image1_display_time,omitempty"`
+	Image2             string           `gorm:"type:text" json:"image2,omitempty"`
+	Image2DisplayTime  *int             `json:"image2_display_time,omitempty"`
+	Comment            string           `gorm:"type:text" json:"comment,omitempty"`
+	CommentDisplayTime *int             `json:"comment_display_time,omitempty"`
+	Options            []RevisionOption `gorm:"type:text;serializer:json" json:"options"`
+	EditedBy           *uint            `json:"edited_by,omitempty"`
+	CreatedAt          time.Time        `json:"created_at"`
+}
+
+// RevisionOption is an option as it was in a revision. ID is the
+// QuestionOption row the option was stored as, which answers refer to.
+type RevisionOption struct {
+	ID         uint   `json:"id"`
+	OptionID   uint   `json:"option_id"`
+	OptionText string `json:"option_text"`
+	IsCorrect  bool   `json:"is_correct"`
+}
+
+// AsQuestion rebuilds the question as it was in this revision
+func (r QuestionRevision) AsQuestion() Question {
+	q := Question{
+		ID:                 r.QuestionID,
+		QuestionType:       r.QuestionType,
+		QuestionText:       r.QuestionText,
+		CorrectOptionID:    r.CorrectOptionID,
+		Difficulty:         r.Difficulty,
+		CategoryID:         r.CategoryID,
+		Image1:             r.Image1,
+		Image1DisplayTime:  r.Image1DisplayTime,
+		Image2:             r.Image2,
+		Image2DisplayTime:  r.Image2DisplayTime,
+		Comment:            r.Comment,
+		CommentDisplayTime: r.CommentDisplayTime,
+	}
+	for _, opt := range r.Options {
+		q.Options = append(q.Options, QuestionOption{
+			ID:         opt.ID,
+			QuestionID: r.QuestionID,
+			OptionID:   opt.OptionID,
+			OptionText: opt.OptionText,
+			IsCorrect:  opt.IsCorrect,
+		})
+	}
+	return q
+}
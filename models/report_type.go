@@ -1,6 +1,9 @@
 package models
 
 type ReportType struct {
-	ID   uint   `gorm:"primaryKey" json:"id"`
-	Type string `gorm:"not null;unique" json:"type"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Type        string `gorm:"not null;unique" json:"type"`
+	Title       string `gorm:"type:varchar(100)" json:"title"`
+	Description string `gorm:"type:text" json:"description"`
+	PerTest     bool   `json:"per_test"` // Needs a test_id
 }
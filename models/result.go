@@ -4,11 +4,14 @@ import "gorm.io/gorm"
 
 type Result struct {
 	gorm.Model
-	TestID    uint   `json:"test_id"`
-	UserID    uint   `json:"user_id"` // Link to User
-	Score     int    `json:"score"`
-	Correct   int    `json:"correct"`
-	Incorrect int    `json:"incorrect"`
-	Ignored   int    `json:"ignored"`
-	TimeTaken string `json:"timeTaken"`
+	TestID           uint    `gorm:"index;uniqueIndex:idx_result_test_user,where:deleted_at IS NULL" json:"test_id"`
+	UserID           uint    `gorm:"uniqueIndex:idx_result_test_user,where:deleted_at IS NULL" json:"user_id"` // Link to User
+	Score            float64 `json:"score"`
+	MaxScore         float64 `json:"max_score"`
+	Correct          int     `json:"correct"`
+	Incorrect        int     `json:"incorrect"`
+	Ignored          int     `json:"ignored"`
+	PendingGrading   int     `json:"pending_grading"` // Descriptive answers awaiting a teacher
+	TimeTakenSeconds int64   `json:"time_taken_seconds"`
+	AutoSubmitted    bool    `json:"auto_submitted"` // Finalized by the expiry worker
 }
@@ -0,0 +1,18 @@
+package models
+
+// RubricCriterion is one line of the marking scheme of a descriptive question
+type RubricCriterion struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	QuestionID  uint    `gorm:"not null;index" json:"question_id"`
+	Description string  `gorm:"type:text;not null" json:"description"`
+	MaxPoints   float64 `gorm:"not null" json:"max_points"`
+	Position    int     `json:"position"`
+}
+
+// AnswerCriterionScore holds the points a teacher gave an answer for one rubric criterion
+type AnswerCriterionScore struct {
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	StudentAnswerID uint    `gorm:"not null;index" json:"student_answer_id"`
+	CriterionID     uint    `gorm:"not null" json:"criterion_id"`
+	Points          float64 `json:"points"`
+}
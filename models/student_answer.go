@@ -1,14 +1,38 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type StudentAnswer struct {
 	gorm.Model
-	TestID     uint   `json:"test_id"`
-	StudentID  uint   `json:"student_id"`
-	QuestionID uint   `json:"question_id"`
-	Selected   string `json:"selected"` // Selected option (e.g., "A", "B", "C", "D")
+	TestID     uint   `gorm:"uniqueIndex:idx_student_answer" json:"test_id"`
+	StudentID  uint   `gorm:"uniqueIndex:idx_student_answer" json:"student_id"`
+	QuestionID uint   `gorm:"uniqueIndex:idx_student_answer" json:"question_id"`
+	Selected   string `json:"selected"` // Answer text, or the 1-based position of the option in older answers
+
+	SelectedOptionID *uint `json:"selected_option_id"` // QuestionOption.ID of the chosen option, independent of display order
+	RevisionID       *uint `json:"revision_id"`        // QuestionRevision the answer was given to
+
+	// Manual grading of descriptive answers
+	Points    *float64   `json:"points"`               // Nil until graded
+	MaxPoints *float64   `json:"max_points,omitempty"` // What the rubric made a full answer worth when graded
+	Feedback  string     `gorm:"type:text" json:"feedback,omitempty"`
+	GradedBy  *uint      `json:"graded_by,omitempty"`
+	GradedAt  *time.Time `json:"graded_at,omitempty"`
+}
 
+// AnswerBatch records a batch of answers saved under an idempotency key, so a
+// retried request is acknowledged without being applied twice. Keys are
+// scoped to the attempt, and a key reused for different answers is refused.
+type AnswerBatch struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	StudentTestID  uint      `gorm:"not null;default:0;uniqueIndex:idx_answer_batch_key" json:"student_test_id"` // Attempt of the batch; 0 for answers saved by graders
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_answer_batch_key" json:"user_id"`                   // Who sent the batch
+	IdempotencyKey string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_answer_batch_key" json:"idempotency_key"`
+	PayloadHash    string    `gorm:"type:varchar(64);not null;default:''" json:"-"` // SHA-256 of the answers
+	Answers        int       `json:"answers"`
+	CreatedAt      time.Time `json:"created_at"`
 }
@@ -1,11 +1,36 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // StudentTest model (for mapping students to tests)
 type StudentTest struct {
-	ID        uint `gorm:"primaryKey"`
-	StudentID uint
-	TestID    uint      `json:"test_id" binding:"required"`
-	StartTime time.Time `json:"start_time"` // Automatically added when test is assigned
+	ID          uint       `gorm:"primaryKey"`
+	StudentID   uint       `gorm:"uniqueIndex:idx_student_test,priority:2,where:deleted_at IS NULL"`
+	TestID      uint       `gorm:"uniqueIndex:idx_student_test,priority:1,where:deleted_at IS NULL" json:"test_id" binding:"required"`
+	Status      string     `gorm:"type:varchar(20);default:'assigned'" json:"status"` // assigned, in_progress, submitted
+	AssignedAt  time.Time  `gorm:"autoCreateTime" json:"assigned_at"`
+	StartTime   *time.Time `json:"start_time"` // Set when the student starts the attempt
+	Deadline    *time.Time `json:"deadline"`   // Answers are rejected after this
+	SubmittedAt *time.Time `json:"submitted_at"`
+
+	// Seed of the student's question and option order, and the question order it produced
+	ShuffleSeed   int64  `json:"-"`
+	QuestionOrder string `gorm:"type:text" json:"-"` // Comma-separated question IDs
+
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// StudentTestQuestion is a question an attempt was given, either a fixed
+// question of the test or one drawn from a blueprint pool
+type StudentTestQuestion struct {
+	ID            uint  `gorm:"primaryKey" json:"id"`
+	StudentTestID uint  `gorm:"not null;index;uniqueIndex:idx_student_test_question" json:"student_test_id"`
+	QuestionID    uint  `gorm:"not null;uniqueIndex:idx_student_test_question" json:"question_id"`
+	BlueprintID   *uint `json:"blueprint_id"` // Nil for fixed questions
+	RevisionID    *uint `json:"revision_id"`  // QuestionRevision served to the student
+	Position      int   `json:"position"`
 }
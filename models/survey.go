@@ -8,20 +8,74 @@ import (
 )
 
 type Survey struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;"  json:"id"`
-	Name         string    `gorm:"not null"  json:"name"`
-	Description  string    `json:"description"`
-	Category     string    `json:"category"`                    //example golang react
-	SurveyType   string    `json:"survey_type"`                 //multiple choice
-	ShowResults  bool      `json:"show_results"`                //example true false or toggle
-	NumQuestions int       `json:"num_questions"`               //total number of questions
-	CreatedBy    uuid.UUID `json:"type:uuid" json:"created_by"` //user (teacher/admin) who created it it store the user id who created it
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uuid.UUID        `gorm:"type:uuid;primaryKey;"  json:"id"`
+	Name         string           `gorm:"not null"  json:"name"`
+	Description  string           `json:"description"`
+	Category     string           `json:"category"`      //example golang react
+	SurveyType   string           `json:"survey_type"`   //example course_feedback
+	ShowResults  bool             `json:"show_results"`  //students may see aggregated results once they have responded
+	Anonymous    bool             `json:"anonymous"`     //responses are stored without the student who gave them
+	NumQuestions int              `json:"num_questions"` //total number of questions, kept in sync with Questions
+	CreatedBy    uint             `json:"created_by"`    //user (teacher/admin) who created it
+	Questions    []SurveyQuestion `gorm:"foreignKey:SurveyID" json:"questions,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
 }
 
 // Hook: generate UUID automatically before create
 func (s *Survey) BeforeCreate(tx *gorm.DB) (err error) {
-	s.ID = uuid.New()
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
 	return
 }
+
+// Survey question types
+const (
+	SurveyLikert         = "likert"
+	SurveyMultipleChoice = "multiple_choice"
+	SurveyText           = "text"
+)
+
+// SurveyQuestion is a question of a survey. Likert questions are answered on
+// a scale of 1 to Scale, multiple choice questions with one of Options.
+type SurveyQuestion struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	SurveyID     uuid.UUID `gorm:"type:uuid;not null;index" json:"survey_id"`
+	Position     int       `json:"position"`
+	QuestionType string    `gorm:"type:varchar(20);not null" json:"question_type"` // likert, multiple_choice, text
+	QuestionText string    `gorm:"type:text;not null" json:"question_text"`
+	Options      []string  `gorm:"type:text;serializer:json" json:"options,omitempty"`
+	Scale        int       `json:"scale,omitempty"`
+	Required     bool      `json:"required"`
+}
+
+// SurveyAssignment maps a survey to a student who is asked to respond
+type SurveyAssignment struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	SurveyID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_survey_student" json:"survey_id"`
+	StudentID   uint       `gorm:"not null;uniqueIndex:idx_survey_student" json:"student_id"`
+	Status      string     `gorm:"type:varchar(20);default:'assigned'" json:"status"` // assigned, completed
+	AssignedAt  time.Time  `gorm:"autoCreateTime" json:"assigned_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// SurveyResponse is one submission of a survey. StudentID is nil for
+// anonymous surveys, whose assignment only records that the student responded.
+type SurveyResponse struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	SurveyID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"survey_id"`
+	StudentID   *uint          `json:"student_id"`
+	SubmittedAt time.Time      `gorm:"autoCreateTime" json:"submitted_at"`
+	Answers     []SurveyAnswer `gorm:"foreignKey:ResponseID" json:"answers"`
+}
+
+// SurveyAnswer is the answer to one question of a response
+type SurveyAnswer struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ResponseID  uint   `gorm:"not null;index" json:"response_id"`
+	QuestionID  uint   `gorm:"not null" json:"question_id"`
+	LikertValue *int   `json:"likert_value,omitempty"`
+	OptionIndex *int   `json:"option_index,omitempty"` // Index into the question's Options
+	Text        string `gorm:"type:text" json:"text,omitempty"`
+}
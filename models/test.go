@@ -1,9 +1,31 @@
 package models
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type Test struct {
-	ID           uint   `gorm:"primaryKey" json:"id"`
-	TestName     string `json:"test_name"`
-	UserID       uint   `json:"teacher_id"`
-	User         User   `gorm:"foreignKey:UserID" json:"user"`
-	MinQuestions int    `json:"min_questions"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	TestName        string     `json:"test_name"`
+	UserID          uint       `json:"teacher_id"`
+	User            User       `gorm:"foreignKey:UserID" json:"user"`
+	MinQuestions    int        `json:"min_questions"`
+	DurationMinutes int        `json:"duration_minutes"` // 0 means the attempt is not timed
+	OpensAt         *time.Time `json:"opens_at"`         // Attempts cannot start before this
+	ClosesAt        *time.Time `json:"closes_at"`        // Attempts cannot run past this
+
+	// Every student gets their own order, seeded when the attempt starts
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"` // MCQ options only
+
+	// Scoring policy
+	NegativeMarking float64 `gorm:"default:0" json:"negative_marking"` // Fraction of marks deducted per wrong answer
+	EasyMarks       float64 `gorm:"default:1" json:"easy_marks"`
+	MediumMarks     float64 `gorm:"default:2" json:"medium_marks"`
+	HardMarks       float64 `gorm:"default:3" json:"hard_marks"`
+	AllOrNothing    bool    `json:"all_or_nothing"` // Descriptive answers earn marks only for full rubric points
+
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
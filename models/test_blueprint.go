@@ -0,0 +1,11 @@
+package models
+
+// TestBlueprint is one rule of a blueprint-based test, e.g. "5 EASY from
+// category 3". Every attempt draws its own questions for each rule.
+type TestBlueprint struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	TestID     uint   `gorm:"not null;index" json:"test_id"`
+	CategoryID uint   `gorm:"not null" json:"category_id"`
+	Difficulty string `gorm:"type:varchar(10);not null" json:"difficulty"` // EASY, MEDIUM, HARD
+	Count      int    `gorm:"not null" json:"count"`
+}
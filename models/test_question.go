@@ -1,9 +1,10 @@
 package models
 
 type TestQuestion struct {
-	ID         uint `gorm:"primaryKey"`
-	TestID     uint `gorm:"not null"`
-	QuestionID uint `gorm:"not null"`
+	ID         uint     `gorm:"primaryKey"`
+	TestID     uint     `gorm:"not null"`
+	QuestionID uint     `gorm:"not null"`
+	Marks      *float64 `json:"marks"` // Overrides the test's marks for the question's difficulty
 }
 
 // // will remove it later
@@ -1,35 +1,38 @@
 package models
 
+import "gorm.io/gorm"
+
 type User struct {
-	ID             uint    `json:"id" gorm:"primaryKey"`
-	Name           string  `json:"name" binding:"required"`
-	Email          string  `gorm:"unique" json:"email" binding:"required,email"`
-	Password       string  `json:"-" gorm:"not null"`
-	CollegeID      *uint   `json:"college_id"` // Nullable
-	College        College `gorm:"foreignKey:CollegeID" json:"college,omitempty"`
-	Role           string  `json:"role" binding:"required,oneof=student teacher admin"`
-	SecondaryEmail *string `json:"secondary_email,omitempty"`
-	Profile_image  string  `json:"profile_image,omitempty"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	Name           string         `json:"name" binding:"required"`
+	Email          string         `gorm:"unique" json:"email" binding:"required,email"`
+	Password       string         `json:"-" gorm:"not null"`
+	CollegeID      *uint          `json:"college_id" gorm:"index:idx_users_college_role"` // Nullable
+	College        College        `gorm:"foreignKey:CollegeID" json:"college,omitempty"`
+	Role           string         `json:"role" gorm:"index:idx_users_college_role" binding:"required,oneof=student teacher admin"`
+	SecondaryEmail *string        `json:"secondary_email,omitempty"`
+	Profile_image  string         `json:"profile_image,omitempty"`
+	Status         string         `json:"status" gorm:"type:varchar(20);not null;default:active;index"` // Lifecycle status, see utils.StatusActive
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type Student struct {
-	ID     uint   `gorm:"primaryKey"`
-	UserID uint   `json:"user_id" binding:"required"`
-	Status string `json:"status" binding:"required,oneof=active inactive"`
-	User   User   `gorm:"foreignKey:UserID" json:"user"`
-	Branch string `json:"branch"`
-	Gender string `json:"gender"`
-	//Status string `gorm:"default:active"`
+	ID        uint           `gorm:"primaryKey"`
+	UserID    uint           `json:"user_id" binding:"required"`
+	User      User           `gorm:"foreignKey:UserID" json:"user"`
+	Branch    string         `json:"branch"`
+	Gender    string         `json:"gender"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type Teacher struct {
-	ID          uint   `gorm:"primaryKey"`
-	UserID      uint   `json:"user_id" binding:"required"`
-	State       string `json:"state" binding:"required"`
-	TeacherType string `json:"teacher_type" binding:"required"`
-	User        User   `gorm:"foreignKey:UserID" json:"user"`
-	Super       bool   `json:"super_teacher"` // True if added as super teacher
-	Status      string `json:"status" binding:"required,oneof=active inactive"`
+	ID          uint           `gorm:"primaryKey"`
+	UserID      uint           `json:"user_id" binding:"required"`
+	State       string         `json:"state" binding:"required"`
+	TeacherType string         `json:"teacher_type" binding:"required"`
+	User        User           `gorm:"foreignKey:UserID" json:"user"`
+	Super       bool           `json:"super_teacher"` // True if added as super teacher
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type StudentResponse struct {
@@ -47,5 +50,5 @@ type TeacherResponse struct {
 	State       string `json:"state"`
 	College     string `json:"college"` // Just college name
 	TeacherType string `json:"teacher_type"`
-	Status      string `json:"status" binding:"required,oneof=active inactive"`
+	Status      string `json:"status"`
 }
@@ -1,15 +1,17 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAnswerRoutes(router *gin.Engine) {
-	answers := router.Group("/api/answers").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+func SetupAnswerRoutes(router *gin.Engine, a *app.App) {
+	answers := router.Group("/api/answers").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermTestGrade))
 	{
-		answers.POST("/", controllers.SubmitAnswers)
+		answers.POST("/", withDB(a.DB, controllers.SubmitAnswers))
 	}
 }
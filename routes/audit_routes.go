@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAuditRoutes exposes the audit trail of mutating requests
+func SetupAuditRoutes(r *gin.Engine, a *app.App, auditController *controllers.AuditController) {
+	audit := r.Group("/api/audit-logs").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermAuditView))
+
+	audit.GET("", auditController.GetAuditLogs)           // Filter by actor_id, action, entity_type, entity_id, from, to
+	audit.GET("/export", auditController.ExportAuditLogs) // Same filters, as CSV
+}
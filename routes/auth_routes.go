@@ -1,19 +1,37 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	middlewares "pathshala/middlewares"
+	"pathshala/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAuthRoutes(r *gin.Engine) {
-	r.POST("/register", middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"), middlewares.TimeoutMiddleware(5*time.Second), controllers.Register)
+func SetupAuthRoutes(r *gin.Engine, a *app.App, authController *controllers.AuthController) {
+	// Per-IP ceilings behind the guard, which throttles failed logins per
+	// account and IP and reset requests per account. A campus sharing one
+	// address still gets a login every two seconds.
+	loginLimit := middlewares.RateLimitMiddleware(a.Redis, "login", 30, time.Minute)
+	resetLimit := middlewares.RateLimitMiddleware(a.Redis, "password_reset", 30, 15*time.Minute)
+
+	r.POST("/register", authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermUserManage, utils.PermTeacherManage, utils.PermRoleManage), middlewares.TimeoutMiddleware(5*time.Second), withDB(a.DB, controllers.Register))
 	// r.POST("/register", controllers.Register)
-	r.POST("/login", middlewares.TimeoutMiddleware(5*time.Second), controllers.Login)
-	r.POST("/refresh", controllers.RefreshToken)
-	r.POST("/forgot-password", middlewares.TimeoutMiddleware(5*time.Second), controllers.ForgotPassword)
-	r.POST("/reset-password", controllers.ResetPassword)
-	r.POST("/logout", controllers.Logout)
+	r.POST("/login", loginLimit, middlewares.TimeoutMiddleware(5*time.Second), authController.Login)
+	r.POST("/login/mfa", loginLimit, middlewares.TimeoutMiddleware(5*time.Second), authController.VerifyMFALogin)
+	r.POST("/login/mfa/enroll", loginLimit, middlewares.TimeoutMiddleware(5*time.Second), authController.EnrollMFALogin)
+	r.POST("/refresh", authController.RefreshToken)
+	r.POST("/forgot-password", resetLimit, middlewares.TimeoutMiddleware(5*time.Second), authController.ForgotPassword)
+	r.POST("/reset-password", resetLimit, authController.ResetPassword)
+	r.POST("/logout", authController.Logout)
+
+	mfa := r.Group("/api/mfa").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermProfileEdit))
+
+	mfa.GET("/", authController.GetMFAStatus)
+	mfa.POST("/enroll", authController.BeginMFAEnrollment)
+	mfa.POST("/confirm", authController.ConfirmMFAEnrollment)
+	mfa.POST("/recovery-codes", authController.RegenerateRecoveryCodes)
+	mfa.DELETE("/", authController.DisableMFA)
 }
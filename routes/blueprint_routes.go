@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupBlueprintRoutes initializes the question pools tests draw from
+func SetupBlueprintRoutes(r *gin.Engine, a *app.App, blueprintController *controllers.BlueprintController) {
+	blueprints := r.Group("/api/tests").Use(authenticated(a))
+
+	blueprints.GET("/:test_id/blueprint", middlewares.PermissionMiddleware(a.DB, utils.PermTestView), blueprintController.GetBlueprint)     // Rules of the test
+	blueprints.PUT("/:test_id/blueprint", middlewares.PermissionMiddleware(a.DB, utils.PermTestEdit), blueprintController.SetBlueprint)     // Replace the rules
+	blueprints.GET("/:test_id/blueprint/check", middlewares.PermissionMiddleware(a.DB, utils.PermTestView), blueprintController.CheckPools) // Can every pool satisfy its rule
+}
@@ -1,19 +1,21 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupCategoryRoutes(router *gin.Engine) {
-	category := router.Group("/api/categories").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+func SetupCategoryRoutes(router *gin.Engine, a *app.App) {
+	category := router.Group("/api/categories").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermCategoryManage))
 	{
-		category.POST("/", controllers.AddCategory)
-		category.GET("/", controllers.GetAllCategories)
-		category.GET("/:id", controllers.GetCategoryByID)
-		category.PUT("/:id", controllers.UpdateCategory)
-		category.DELETE("/:id", controllers.DeleteCategory)
+		category.POST("/", withStorage(a, controllers.AddCategory))
+		category.GET("/", withDB(a.DB, controllers.GetAllCategories))
+		category.GET("/:id", withDB(a.DB, controllers.GetCategoryByID))
+		category.PUT("/:id", withStorage(a, controllers.UpdateCategory))
+		category.DELETE("/:id", withDB(a.DB, controllers.DeleteCategory))
 	}
 }
@@ -1,28 +1,31 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	middlewares "pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupCollegeRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupCollegeRoutes(r *gin.Engine, a *app.App) {
+	db := a.DB
+
 	collegeGroup := r.Group("/api/colleges")
 
-	collegeGroup.Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	collegeGroup.Use(authenticated(a))
 
-	collegeGroup.POST("/", func(c *gin.Context) {
+	collegeGroup.POST("/", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.CreateCollege(c, db)
 	})
-	collegeGroup.GET("/", func(c *gin.Context) {
+	collegeGroup.GET("/", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeView), func(c *gin.Context) {
 		controllers.GetColleges(c, db)
 	})
-	collegeGroup.PUT("/:id", func(c *gin.Context) {
+	collegeGroup.PUT("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.UpdateCollege(c, db)
 	})
-	collegeGroup.DELETE("/:id", func(c *gin.Context) {
+	collegeGroup.DELETE("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.DeleteCollege(c, db)
 	})
 }
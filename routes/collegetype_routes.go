@@ -1,40 +1,43 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupCollegeTypeRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupCollegeTypeRoutes(r *gin.Engine, a *app.App) {
+	db := a.DB
+
 	collegeTypeGroup := r.Group("/api/college_types")
 
-	collegeTypeGroup.Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	collegeTypeGroup.Use(authenticated(a))
 
 	// Create a new college type
-	collegeTypeGroup.POST("/", func(c *gin.Context) {
+	collegeTypeGroup.POST("/", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.CreateCollegeType(c, db)
 	})
 
 	// Get all college types
-	collegeTypeGroup.GET("/", func(c *gin.Context) {
+	collegeTypeGroup.GET("/", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeView), func(c *gin.Context) {
 		controllers.GetAllCollegeTypes(c, db)
 	})
 
 	// Get a single college type by ID
-	collegeTypeGroup.GET("/:id", func(c *gin.Context) {
+	collegeTypeGroup.GET("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeView), func(c *gin.Context) {
 		controllers.GetCollegeTypeByID(c, db)
 	})
 
 	// Update a college type by ID
-	collegeTypeGroup.PUT("/:id", func(c *gin.Context) {
+	collegeTypeGroup.PUT("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.UpdateCollegeType(c, db)
 	})
 
 	// Delete a college type by ID
-	collegeTypeGroup.DELETE("/:id", func(c *gin.Context) {
+	collegeTypeGroup.DELETE("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeManage), func(c *gin.Context) {
 		controllers.DeleteCollegeType(c, db)
 	})
 
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupFileRoutes hands out download links for uploaded files and, for the
+// local backend, serves the files those links point at
+func SetupFileRoutes(r *gin.Engine, a *app.App, fileController *controllers.FileController) {
+	r.GET("/api/files/*key", authenticated(a), fileController.GetFileURL) // Signed link to a file the user can see
+	r.GET("/files/*key", fileController.ServeLocalFile)                   // Download through a signed link
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupGradingRoutes initializes manual grading of descriptive answers and test scoring
+func SetupGradingRoutes(r *gin.Engine, a *app.App, gradingController *controllers.GradingController) {
+	grading := r.Group("/api/grading").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermTestGrade))
+
+	grading.GET("/tests/:test_id/queue", gradingController.GetGradingQueue)    // Ungraded descriptive answers
+	grading.POST("/answers/:answer_id", gradingController.GradeAnswer)         // Grade an answer with feedback
+	grading.GET("/questions/:question_id/rubric", gradingController.GetRubric) // Rubric of a descriptive question
+	grading.PUT("/questions/:question_id/rubric", gradingController.SetRubric) // Replace the rubric
+
+	grading.PUT("/tests/:test_id/scoring", gradingController.SetScoringPolicy)                      // Marks and negative marking
+	grading.PUT("/tests/:test_id/questions/:question_id/marks", gradingController.SetQuestionMarks) // Per-question marks
+	grading.POST("/tests/:test_id/rescore", gradingController.RescoreTest)                          // Apply the policy to stored results
+}
@@ -1,17 +1,19 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupHomeRouter(router *gin.Engine) {
-	api := router.Group("/api/home").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+func SetupHomeRouter(router *gin.Engine, a *app.App) {
+	api := router.Group("/api/home").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermDashboardView))
 
-	api.GET("/stats", controllers.GetHomeStats)
+	api.GET("/stats", withDB(a.DB, controllers.GetHomeStats))
 
-	api.GET("/teacher/stats", controllers.GetTeacherHomeStats)
+	api.GET("/teacher/stats", withDB(a.DB, controllers.GetTeacherHomeStats))
 }
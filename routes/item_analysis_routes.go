@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupItemAnalysisRoutes initializes the item statistics of tests
+func SetupItemAnalysisRoutes(r *gin.Engine, a *app.App, itemAnalysisController *controllers.ItemAnalysisController) {
+	analysis := r.Group("/api/tests").Use(authenticated(a))
+
+	analysis.GET("/:test_id/item-analysis", middlewares.PermissionMiddleware(a.DB, utils.PermReportView), itemAnalysisController.AnalyzeTest)                         // Difficulty, discrimination, distractors and KR-20
+	analysis.POST("/:test_id/item-analysis/apply-difficulty", middlewares.PermissionMiddleware(a.DB, utils.PermQuestionEdit), itemAnalysisController.ApplyDifficulty) // Feed observed difficulty back into the questions
+}
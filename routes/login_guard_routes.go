@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupLoginGuardRoutes lets admins lift login lockouts
+func SetupLoginGuardRoutes(r *gin.Engine, a *app.App, loginGuardController *controllers.LoginGuardController) {
+	r.POST("/api/users/:id/unlock", authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermUserManage, utils.PermTeacherManage, utils.PermRoleManage), loginGuardController.UnlockUser)
+	r.POST("/api/login-locks/ip/unlock", authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermRoleManage), loginGuardController.UnlockIP)
+}
@@ -1,18 +1,20 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupMacroCategoryRoutes(router *gin.Engine) {
-	macro := router.Group("/api/macro-categories").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+func SetupMacroCategoryRoutes(router *gin.Engine, a *app.App) {
+	macro := router.Group("/api/macro-categories").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermCategoryManage))
 	{
-		macro.POST("/", controllers.CreateMacroCategory)
-		macro.GET("/", controllers.GetAllMacroCategories)
-		macro.PUT("/:id", controllers.UpdateMacroCategory)
-		macro.DELETE("/:id", controllers.DeleteMacroCategory)
+		macro.POST("/", withDB(a.DB, controllers.CreateMacroCategory))
+		macro.GET("/", withDB(a.DB, controllers.GetAllMacroCategories))
+		macro.PUT("/:id", withDB(a.DB, controllers.UpdateMacroCategory))
+		macro.DELETE("/:id", withDB(a.DB, controllers.DeleteMacroCategory))
 	}
 }
@@ -1,17 +1,19 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupProfileRoutes(r *gin.Engine) {
+func SetupProfileRoutes(r *gin.Engine, a *app.App) {
 
-	profile := r.Group("/api/profile").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	profile := r.Group("/api/profile").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermProfileEdit))
 
-	profile.GET("/", controllers.GetProfile)
-	profile.PUT("/", controllers.UpdateProfile)
+	profile.GET("/", withDB(a.DB, controllers.GetProfile))
+	profile.PUT("/", withStorage(a, controllers.UpdateProfile))
 
 }
@@ -1,28 +1,39 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupQuestionRoutes initializes question-related routes
-func SetupQuestionRoutes(r *gin.Engine) {
-	questionGroup := r.Group("/api/questions").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+func SetupQuestionRoutes(r *gin.Engine, a *app.App) {
+	questionGroup := r.Group("/api/questions").Use(authenticated(a))
+	view := middlewares.PermissionMiddleware(a.DB, utils.PermQuestionView)
+	edit := middlewares.PermissionMiddleware(a.DB, utils.PermQuestionEdit)
+	// Question listings are cached in Redis per tenant
+	getQuestions := func(c *gin.Context) { controllers.GetQuestions(c, utils.RequestDB(c, a.DB), a.Redis) }
+	getTestQuestions := func(c *gin.Context) { controllers.GetTestQuestions(c, utils.RequestDB(c, a.DB), a.Redis) }
 
-	questionGroup.POST("/", controllers.AddQuestion)                                               // Add question
-	questionGroup.PUT("/:id", controllers.EditQuestion)                                            // Edit question
-	questionGroup.DELETE("/:id", controllers.DeleteQuestion)                                       // Delete question
-	questionGroup.GET("/", controllers.GetQuestions, middlewares.TimeoutMiddleware(5*time.Second)) // Get and Search questions
+	questionGroup.POST("/", edit, withStorage(a, controllers.AddQuestion))                   // Add question
+	questionGroup.POST("/import", edit, withStorage(a, controllers.ImportQuestions))         // Bulk import from CSV, JSON, Moodle XML or GIFT
+	questionGroup.GET("/export", view, withStorage(a, controllers.ExportQuestions))          // Export as QTI, Moodle XML or GIFT
+	questionGroup.PUT("/:id", edit, withStorage(a, controllers.EditQuestion))                // Edit question
+	questionGroup.DELETE("/:id", edit, withDB(a.DB, controllers.DeleteQuestion))             // Delete question
+	questionGroup.GET("/", view, getQuestions, middlewares.TimeoutMiddleware(5*time.Second)) // Get and Search questions
 
-	testQuestionGroup := r.Group("/api/tests").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	testQuestionGroup := r.Group("/api/tests").Use(authenticated(a))
+	testView := middlewares.PermissionMiddleware(a.DB, utils.PermTestView)
+	testEdit := middlewares.PermissionMiddleware(a.DB, utils.PermTestEdit)
 
-	testQuestionGroup.POST("/:test_id/addExstingQuestion", controllers.AddExistingQuestionToTest)                             // Add existing questions to test
-	testQuestionGroup.POST("/:test_id/addNewQuestion", controllers.AddNewQuestionToTest)                                      // Add new question to test
-	testQuestionGroup.DELETE("/:test_id/questions/:question_id", controllers.DeleteTestQuestion)                              // Delete a questions from test
-	testQuestionGroup.GET("/:test_id/questions/", controllers.GetTestQuestions, middlewares.TimeoutMiddleware(5*time.Second)) // Get and Search questions from a test
-	testQuestionGroup.PUT("/:test_id/questions/:question_id", controllers.EditQuestionOfTest)                                 // Edit questions from a test
+	testQuestionGroup.POST("/:test_id/addExstingQuestion", testEdit, withDB(a.DB, controllers.AddExistingQuestionToTest))   // Add existing questions to test
+	testQuestionGroup.POST("/:test_id/addNewQuestion", testEdit, withStorage(a, controllers.AddNewQuestionToTest))          // Add new question to test
+	testQuestionGroup.DELETE("/:test_id/questions/:question_id", testEdit, withDB(a.DB, controllers.DeleteTestQuestion))    // Delete a questions from test
+	testQuestionGroup.GET("/:test_id/questions/", testView, getTestQuestions, middlewares.TimeoutMiddleware(5*time.Second)) // Get and Search questions from a test
+	testQuestionGroup.PUT("/:test_id/questions/:question_id", testEdit, withStorage(a, controllers.EditQuestionOfTest))     // Edit questions from a test
 
 }
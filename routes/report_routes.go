@@ -1,15 +1,18 @@
 package routes
 
-// import (
-// 	"pathshala/controllers"
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
 
-// 	"github.com/gin-gonic/gin"
-// )
+	"github.com/gin-gonic/gin"
+)
 
-// func SetupReportRoutes(rg *gin.RouterGroup, reportController *controllers.ReportController) {
-// 	reports := rg.Group("/report")
+// SetupReportRoutes initializes the reports listed in the report types table
+func SetupReportRoutes(r *gin.Engine, a *app.App, reportController *controllers.ReportController) {
+	reports := r.Group("/api/reports").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermReportView))
 
-// 	reports.GET("/types", reportController.GetReportTypes)
-// 	reports.GET("/test-report/:test_id", reportController.GetTestStudentScores)
-// 	reports.GET("/participation-ranking", reportController.StudentParticipationRanking)
-// }
+	reports.GET("/types", reportController.GetReportTypes) // Available reports
+	reports.GET("/:type", reportController.GetReport)      // A report as JSON, CSV or PDF (?format=)
+}
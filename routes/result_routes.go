@@ -1,14 +1,16 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupResultRoutes(router *gin.Engine) {
-	results := router.Group("api/results").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
-	results.POST("/", controllers.SubmitResults)
-	results.GET("/", controllers.GetResults)
+func SetupResultRoutes(router *gin.Engine, a *app.App) {
+	results := router.Group("api/results").Use(authenticated(a))
+	results.POST("/", middlewares.PermissionMiddleware(a.DB, utils.PermTestGrade), withDB(a.DB, controllers.SubmitResults))
+	results.GET("/", middlewares.PermissionMiddleware(a.DB, utils.PermReportView), withDB(a.DB, controllers.GetResults))
 }
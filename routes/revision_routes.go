@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupRevisionRoutes initializes the edit history of questions
+func SetupRevisionRoutes(r *gin.Engine, a *app.App, revisionController *controllers.RevisionController) {
+	revisions := r.Group("/api/questions").Use(authenticated(a))
+
+	revisions.GET("/:id/revisions", middlewares.PermissionMiddleware(a.DB, utils.PermQuestionView), revisionController.GetHistory)              // Revisions with their changes
+	revisions.GET("/:id/revisions/:revision", middlewares.PermissionMiddleware(a.DB, utils.PermQuestionView), revisionController.GetRevision)   // One revision
+	revisions.POST("/:id/revisions/:revision/regrade", middlewares.PermissionMiddleware(a.DB, utils.PermTestGrade), revisionController.Regrade) // Regrade past attempts of own tests with a revision
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupRoleRoutes exposes roles, their permissions and scoped role assignments
+func SetupRoleRoutes(r *gin.Engine, a *app.App, roleController *controllers.RoleController) {
+	r.GET("/api/permissions/me", authenticated(a), roleController.GetMyPermissions) // Permissions of the logged-in user
+
+	roles := r.Group("/api").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermRoleManage))
+
+	roles.GET("/roles", roleController.GetRoles)                               // Roles and the permissions they grant
+	roles.GET("/users/:id/roles", roleController.GetAssignments)               // Scoped roles of a user
+	roles.POST("/users/:id/roles", roleController.AssignRole)                  // Assign a role for a college or state
+	roles.DELETE("/users/:id/roles/:assignment_id", roleController.RevokeRole) // Revoke a role assignment
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/middlewares"
+	"pathshala/storage"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// authenticated checks the access token with the app's database, Redis and
+// signing keys
+func authenticated(a *app.App) gin.HandlerFunc {
+	return middlewares.AuthMiddleware(a.DB, a.Redis, a.Tokens)
+}
+
+// withDB adapts a handler that works on the database to gin. The handler's
+// reads are limited to the logged-in user's tenant.
+func withDB(db *gorm.DB, handler func(*gin.Context, *gorm.DB)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler(c, utils.RequestDB(c, db))
+	}
+}
+
+// withStorage adapts a handler that also stores uploaded files to gin
+func withStorage(a *app.App, handler func(*gin.Context, *gorm.DB, storage.Storage)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler(c, utils.RequestDB(c, a.DB), a.Storage)
+	}
+}
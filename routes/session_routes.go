@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupSessionRoutes lets users manage the devices they are logged in on
+func SetupSessionRoutes(r *gin.Engine, a *app.App, sessionController *controllers.SessionController) {
+	sessions := r.Group("/api/sessions").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermProfileEdit))
+
+	sessions.GET("/", sessionController.ListSessions)        // Sessions of the logged-in user
+	sessions.DELETE("/:id", sessionController.RevokeSession) // Log a device out
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupStudentRoutes exposes the tests sent to the logged-in student
+func SetupStudentRoutes(r *gin.Engine, a *app.App, studentTestController *controllers.StudentTestController) {
+	student := r.Group("/api/student").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermTestTake))
+
+	student.GET("/tests", studentTestController.GetAssignedTests)                    // Tests assigned to the student
+	student.POST("/tests/:test_id/start", studentTestController.StartTest)           // Start (or resume) an attempt
+	student.GET("/tests/:test_id/questions", studentTestController.GetTestQuestions) // Questions without answer keys
+	student.POST("/tests/:test_id/answers", studentTestController.SaveAnswers)       // Save answers
+	student.POST("/tests/:test_id/submit", studentTestController.SubmitTest)         // Submit and grade the attempt
+	student.GET("/tests/:test_id/result", studentTestController.GetTestResult)       // Result with grading feedback
+}
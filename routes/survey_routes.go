@@ -1,29 +1,33 @@
 package routes
 
-// import (
-// 	"pathshala/controllers"
-// 	"pathshala/middlewares"
-// 	"pathshala/services"
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
 
-// 	"github.com/gin-gonic/gin"
-// )
+	"github.com/gin-gonic/gin"
+)
 
-// // routes/survey_routes.go
-// func SetupSurveyRoutes(rg *gin.RouterGroup, surveyService *services.SurveyService) {
-// 	surveyController := controllers.NewSurveyController(surveyService)
+// SetupSurveyRoutes initializes survey management for teachers and answering for students
+func SetupSurveyRoutes(r *gin.Engine, a *app.App, surveyController *controllers.SurveyController) {
+	surveys := r.Group("/api/surveys").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermSurveyManage))
 
-// 	// Create a sub-group for surveys and apply middleware in order.
-// 	surveys := rg.Group("/surveys")
-// 	// First, inject mock JWT values (userRole and userID).
-// 	surveys.Use(middlewares.MockJWT("teacher"))
-// 	// Then, check that the role is either "admin" or "teacher".
-// 	surveys.Use(middlewares.RoleMiddleware("admin", "teacher"))
+	surveys.POST("", surveyController.CreateSurvey)
+	surveys.GET("", surveyController.GetPaginatedSurveys)
+	surveys.GET("/search", surveyController.SearchSurveys)
+	surveys.GET("/:id", surveyController.GetSurveyByID)
+	surveys.PUT("/:id", surveyController.UpdateSurvey)
+	surveys.DELETE("/:id", surveyController.DeleteSurvey)
+	surveys.PUT("/:id/questions", surveyController.SetQuestions) // Replace the questions
+	surveys.POST("/:id/assign", surveyController.AssignSurvey)   // Send to a college or students
+	surveys.GET("/:id/responses", surveyController.GetResponses) // Individual responses
+	surveys.GET("/:id/results", surveyController.GetResults)     // Aggregated results
 
-// 	// Now define the survey endpoints.
-// 	surveys.POST("/", surveyController.CreateSurvey)
-// 	// surveys.GET("/", surveyController.GetAllSurveys)
-// 	surveys.GET("/:id", surveyController.GetSurveyByID)
-// 	surveys.PUT("/:id", surveyController.UpdateSurvey)
-// 	surveys.GET("/search", surveyController.SearchSurveys)
-// 	surveys.DELETE("/:id", surveyController.DeleteSurvey)
-// }
+	student := r.Group("/api/student/surveys").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermSurveyRespond))
+
+	student.GET("", surveyController.GetAssignedSurveys)            // Surveys sent to the student
+	student.GET("/:id", surveyController.GetStudentSurvey)          // Survey with its questions
+	student.POST("/:id/responses", surveyController.SubmitResponse) // Answer the survey
+	student.GET("/:id/results", surveyController.GetStudentResults) // Results, when the survey shares them
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	"pathshala/middlewares"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,25 +12,25 @@ import (
 // func RegisterTestRoutes(r *gin.Engine) {
 // 	testGroup := r.Group("/test")
 // 	{
-// 		testGroup.POST("/", controllers.CreateTest)
+// 		testGroup.POST("/", withDB(a.DB, controllers.CreateTest))
 // 	}
 // }
 
-func SetupTestRoutes(router *gin.Engine) {
+func SetupTestRoutes(router *gin.Engine, a *app.App) {
 
-	testRoutes := router.Group("/aditi/tests").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
-	testRoutes.GET("/", controllers.GetTests)
-	testRoutes.POST("/", controllers.CreateTest)
-	testRoutes.POST("/send-test", controllers.SendTest)
-	testRoutes.DELETE("/:id", controllers.DeleteTest)
-	testRoutes.GET("/states", controllers.GetStates)
-	testRoutes.GET("/colleges", controllers.GetCollegesByState)
+	testRoutes := router.Group("/aditi/tests").Use(authenticated(a))
+	testRoutes.GET("/", middlewares.PermissionMiddleware(a.DB, utils.PermTestView), withDB(a.DB, controllers.GetTests))
+	testRoutes.POST("/", middlewares.PermissionMiddleware(a.DB, utils.PermTestCreate), withDB(a.DB, controllers.CreateTest))
+	testRoutes.POST("/send-test", middlewares.PermissionMiddleware(a.DB, utils.PermTestSend), withDB(a.DB, controllers.SendTest))
+	testRoutes.DELETE("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermTestEdit), withDB(a.DB, controllers.DeleteTest))
+	testRoutes.GET("/states", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeView), withDB(a.DB, controllers.GetStates))
+	testRoutes.GET("/colleges", middlewares.PermissionMiddleware(a.DB, utils.PermCollegeView), withDB(a.DB, controllers.GetCollegesByState))
 
-	// protected := router.Group("/").Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	// protected := router.Group("/").Use(authenticated(a), middlewares.RoleMiddleware("admin", "teacher"))
 	// // protected.Use(middlewares.MockAuthMiddleware()) // <-- Use mock here
 	// {
-	// 	protected.POST("/tests", controllers.CreateTest)
-	// 	protected.POST("/send-test", controllers.SendTest)
-	// 	protected.DELETE("/tests/:id", controllers.DeleteTest)
+	// 	protected.POST("/tests", withDB(a.DB, controllers.CreateTest))
+	// 	protected.POST("/send-test", withDB(a.DB, controllers.SendTest))
+	// 	protected.DELETE("/tests/:id", withDB(a.DB, controllers.DeleteTest))
 	// }
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupTrashRoutes exposes deleted tests, questions, users, colleges and
+// categories until they are purged
+func SetupTrashRoutes(r *gin.Engine, a *app.App, trashController *controllers.TrashController) {
+	trash := r.Group("/api/trash").Use(authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermTrashManage))
+
+	trash.GET("/:type", trashController.GetTrash)                 // Deleted items of a type
+	trash.POST("/:type/:id/restore", trashController.RestoreItem) // Restore an item with its dependents
+}
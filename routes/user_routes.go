@@ -1,38 +1,42 @@
 package routes
 
 import (
+	"pathshala/app"
 	"pathshala/controllers"
 	middlewares "pathshala/middlewares"
+	"pathshala/services"
+	"pathshala/utils"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupUserRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupUserRoutes(r *gin.Engine, a *app.App, sessions services.SessionServiceInterface) {
+	db := a.DB
+
 	userGroup := r.Group("/api/users")
 
-	userGroup.Use(middlewares.AuthMiddleware(), middlewares.RoleMiddleware("admin", "teacher"))
+	userGroup.Use(authenticated(a))
 	{
 		// Common user management
-		userGroup.GET("/students", func(c *gin.Context) {
-			controllers.GetUsersByRole(c, db, "student")
+		userGroup.GET("/students", middlewares.PermissionMiddleware(a.DB, utils.PermUserView), func(c *gin.Context) {
+			controllers.GetUsersByRole(c, utils.RequestDB(c, db), "student")
 		})
-		userGroup.GET("/teachers", func(c *gin.Context) {
-			controllers.GetUsersByRole(c, db, "teacher")
+		userGroup.GET("/teachers", middlewares.PermissionMiddleware(a.DB, utils.PermUserView), func(c *gin.Context) {
+			controllers.GetUsersByRole(c, utils.RequestDB(c, db), "teacher")
 		})
-		userGroup.PUT("/:id", func(c *gin.Context) {
-			controllers.UpdateUser(c, db)
+		userGroup.PUT("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermUserManage), func(c *gin.Context) {
+			controllers.UpdateUser(c, utils.RequestDB(c, db), a.Redis)
 		})
-		userGroup.DELETE("/:id", func(c *gin.Context) {
-			controllers.DeleteUser(c, db)
+		userGroup.DELETE("/:id", middlewares.PermissionMiddleware(a.DB, utils.PermUserManage), func(c *gin.Context) {
+			controllers.DeleteUser(c, utils.RequestDB(c, db), a.Redis, sessions)
 		})
 
 		// New role-based user creation endpoints
-		userGroup.POST("/student", func(c *gin.Context) {
-			controllers.CreateStudent(c, db)
+		userGroup.POST("/student", middlewares.PermissionMiddleware(a.DB, utils.PermUserManage), func(c *gin.Context) {
+			controllers.CreateStudent(c, utils.RequestDB(c, db))
 		})
-		userGroup.POST("/teacher", func(c *gin.Context) {
-			controllers.CreateTeacher(c, db)
+		userGroup.POST("/teacher", middlewares.PermissionMiddleware(a.DB, utils.PermTeacherManage), func(c *gin.Context) {
+			controllers.CreateTeacher(c, utils.RequestDB(c, db))
 		})
 	}
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"pathshala/app"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupUserStatusRoutes lets user managers suspend, archive and reactivate
+// users
+func SetupUserStatusRoutes(r *gin.Engine, a *app.App, userStatusController *controllers.UserStatusController) {
+	r.PUT("/api/users/:id/status", authenticated(a), middlewares.PermissionMiddleware(a.DB, utils.PermUserManage, utils.PermTeacherManage, utils.PermRoleManage), userStatusController.ChangeUserStatus)
+}
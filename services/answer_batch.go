@@ -0,0 +1,130 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"pathshala/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyHeader lets clients retry an answer batch without applying it twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 100
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be at most 100 characters")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for different answers")
+)
+
+// gradingColumns are reset when an answer changes, as it has to be graded again
+var gradingColumns = []string{"points", "max_points", "feedback", "graded_by", "graded_at"}
+
+// unchangedAnswer holds when an upserted answer is the one already stored
+const unchangedAnswer = "student_answers.deleted_at IS NULL AND student_answers.selected = excluded.selected AND " +
+	"student_answers.selected_option_id IS NOT DISTINCT FROM excluded.selected_option_id"
+
+// SaveAnswerBatch stores a batch of answers in one transaction. Answers are
+// keyed on test, student and question, so the latest answer wins. When the
+// sender already used idempotencyKey in the attempt the batch is skipped and
+// replayed is true; a different batch under the same key is refused.
+func SaveAnswerBatch(db *gorm.DB, senderID, studentTestID uint, idempotencyKey string, answers []models.StudentAnswer) (replayed bool, err error) {
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return false, ErrInvalidIdempotencyKey
+	}
+
+	rows := latestAnswers(answers)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if idempotencyKey != "" {
+			batch := models.AnswerBatch{
+				StudentTestID:  studentTestID,
+				UserID:         senderID,
+				IdempotencyKey: idempotencyKey,
+				PayloadHash:    answersHash(rows),
+				Answers:        len(rows),
+			}
+			// A concurrent retry waits for this insert and then finds the key taken
+			claimed := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+			if claimed.Error != nil {
+				return claimed.Error
+			}
+			if claimed.RowsAffected == 0 {
+				var stored models.AnswerBatch
+				err := tx.Where("student_test_id = ? AND user_id = ? AND idempotency_key = ?", studentTestID, senderID, idempotencyKey).
+					First(&stored).Error
+				if err != nil {
+					return err
+				}
+				// Batches saved before payloads were hashed cannot be compared
+				if stored.PayloadHash != "" && stored.PayloadHash != batch.PayloadHash {
+					return ErrIdempotencyKeyReused
+				}
+				replayed = true
+				return nil
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		updates := clause.AssignmentColumns([]string{"selected", "selected_option_id", "revision_id", "updated_at", "deleted_at"})
+		for _, column := range gradingColumns {
+			updates = append(updates, clause.Assignment{
+				Column: clause.Column{Name: column},
+				Value:  gorm.Expr("CASE WHEN " + unchangedAnswer + " THEN student_answers." + column + " ELSE excluded." + column + " END"),
+			})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "test_id"}, {Name: "student_id"}, {Name: "question_id"}},
+			DoUpdates: updates,
+		}).Create(&rows).Error
+	})
+	return replayed, err
+}
+
+// answersHash fingerprints the answers of a batch, to tell a retry from a
+// different batch sent under the same key
+func answersHash(rows []models.StudentAnswer) string {
+	type answer struct {
+		TestID, StudentID, QuestionID uint
+		Selected                      string
+		OptionID                      *uint
+	}
+	answers := make([]answer, len(rows))
+	for i, row := range rows {
+		answers[i] = answer{row.TestID, row.StudentID, row.QuestionID, row.Selected, row.SelectedOptionID}
+	}
+	payload, _ := json.Marshal(answers)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// latestAnswers drops all but the last answer to each question of a batch
+func latestAnswers(answers []models.StudentAnswer) []models.StudentAnswer {
+	type answerKey struct{ TestID, StudentID, QuestionID uint }
+
+	position := make(map[answerKey]int, len(answers))
+	rows := make([]models.StudentAnswer, 0, len(answers))
+	for _, ans := range answers {
+		row := models.StudentAnswer{
+			TestID:           ans.TestID,
+			StudentID:        ans.StudentID,
+			QuestionID:       ans.QuestionID,
+			Selected:         ans.Selected,
+			SelectedOptionID: ans.SelectedOptionID,
+			RevisionID:       ans.RevisionID,
+		}
+		key := answerKey{ans.TestID, ans.StudentID, ans.QuestionID}
+		if i, ok := position[key]; ok {
+			rows[i] = row
+			continue
+		}
+		position[key] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows
+}
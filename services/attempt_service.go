@@ -0,0 +1,776 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pathshala/models"
+	"pathshala/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AttemptAssigned   = "assigned"
+	AttemptInProgress = "in_progress"
+	AttemptSubmitted  = "submitted"
+)
+
+var (
+	ErrAttemptNotFound     = errors.New("test is not assigned to this student")
+	ErrAttemptNotStarted   = errors.New("attempt has not been started")
+	ErrAttemptSubmitted    = errors.New("attempt has already been submitted")
+	ErrQuestionNotInTest   = errors.New("question does not belong to this test")
+	ErrTestNotOpen         = errors.New("test is not open yet")
+	ErrTestClosed          = errors.New("test is closed")
+	ErrAttemptExpired      = errors.New("attempt deadline has passed")
+	ErrOptionNotInQuestion = errors.New("option does not belong to this question")
+	ErrOptionIDRequired    = errors.New("options are shuffled: answer with the option_id")
+
+	// errAttemptClaimed rolls back a start that lost the race to another
+	errAttemptClaimed = errors.New("attempt was started by another request")
+)
+
+// AnswerGracePeriod absorbs network latency for answers sent right at the deadline
+const AnswerGracePeriod = 10 * time.Second
+
+type AttemptService struct {
+	DB *gorm.DB
+}
+
+func NewAttemptService(db *gorm.DB) *AttemptService {
+	return &AttemptService{DB: db}
+}
+
+// WithContext returns the service running its queries with ctx. Controllers
+// pass utils.RequestContext so reads are limited to the caller's tenant.
+func (s *AttemptService) WithContext(ctx context.Context) AttemptServiceInterface {
+	return s.withContext(ctx)
+}
+
+func (s *AttemptService) withContext(ctx context.Context) *AttemptService {
+	return &AttemptService{DB: s.DB.WithContext(ctx)}
+}
+
+// owned returns the service reading an attempt's test and questions past the
+// tenant scopes, once the attempt is known to be the student's: a test may be
+// sent to students of colleges other than its author's
+func (s *AttemptService) owned() *AttemptService {
+	ctx := s.DB.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return s.withContext(utils.SkipTenantScope(ctx))
+}
+
+// AssignedTest is a test as seen by the student it was sent to
+type AssignedTest struct {
+	TestID          uint       `json:"test_id"`
+	TestName        string     `json:"test_name"`
+	DurationMinutes int        `json:"duration_minutes"`
+	OpensAt         *time.Time `json:"opens_at"`
+	ClosesAt        *time.Time `json:"closes_at"`
+	Status          string     `json:"status"`
+	AssignedAt      time.Time  `json:"assigned_at"`
+	StartTime       *time.Time `json:"start_time"`
+	Deadline        *time.Time `json:"deadline"`
+	SubmittedAt     *time.Time `json:"submitted_at"`
+}
+
+// AttemptQuestion is a question served to a student, without any answer key
+type AttemptQuestion struct {
+	ID                 uint            `json:"id"`
+	QuestionType       string          `json:"question_type"`
+	QuestionText       string          `json:"question_text"`
+	Image1             string          `json:"image1,omitempty"`
+	Image1DisplayTime  *int            `json:"image1_display_time,omitempty"`
+	Image2             string          `json:"image2,omitempty"`
+	Image2DisplayTime  *int            `json:"image2_display_time,omitempty"`
+	Comment            string          `json:"comment,omitempty"`
+	CommentDisplayTime *int            `json:"comment_display_time,omitempty"`
+	Options            []AttemptOption `json:"options,omitempty"`
+}
+
+type AttemptOption struct {
+	ID         uint   `json:"id"`
+	OptionID   uint   `json:"option_id"`
+	OptionText string `json:"option_text"`
+}
+
+// AttemptResult is the outcome of a submitted attempt as shown to the student
+type AttemptResult struct {
+	Result      models.Result    `json:"result"`
+	QuestionIDs []uint           `json:"question_ids"` // The questions the student was given
+	Answers     []AnswerFeedback `json:"answers"`
+}
+
+type AnswerFeedback struct {
+	QuestionID       uint     `json:"question_id"`
+	Selected         string   `json:"selected"`
+	SelectedOptionID *uint    `json:"selected_option_id,omitempty"`
+	Points           *float64 `json:"points,omitempty"`
+	Feedback         string   `json:"feedback,omitempty"`
+}
+
+// AnswerInput is an answer sent by a student. Objective questions are answered
+// with the ID of the option, which does not depend on the order it was shown in.
+type AnswerInput struct {
+	QuestionID uint   `json:"question_id" binding:"required"`
+	OptionID   *uint  `json:"option_id"`
+	Selected   string `json:"selected"` // Answer text of descriptive questions
+}
+
+func (s *AttemptService) ListAssignedTests(userID uint) ([]AssignedTest, error) {
+	var tests []AssignedTest
+	err := s.DB.Table("student_tests").
+		Select("student_tests.test_id, tests.test_name, tests.duration_minutes, tests.opens_at, tests.closes_at, "+
+			"student_tests.status, student_tests.assigned_at, student_tests.start_time, student_tests.deadline, student_tests.submitted_at").
+		Joins("JOIN tests ON tests.id = student_tests.test_id").
+		Where("student_tests.student_id = ?", userID).
+		Order("student_tests.assigned_at DESC").
+		Scan(&tests).Error
+	return tests, err
+}
+
+// FindAttempt returns the assignment of a test to a student
+func (s *AttemptService) FindAttempt(testID, userID uint) (*models.StudentTest, error) {
+	var studentTest models.StudentTest
+	err := s.DB.Where("test_id = ? AND student_id = ?", testID, userID).Order("id").First(&studentTest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAttemptNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &studentTest, nil
+}
+
+// StartAttempt marks the attempt as in progress. Starting an attempt that is
+// already running is a no-op so a student can resume after a reload.
+func (s *AttemptService) StartAttempt(testID, userID uint) (*models.StudentTest, error) {
+	studentTest, err := s.FindAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch studentTest.Status {
+	case AttemptSubmitted:
+		return nil, ErrAttemptSubmitted
+	case AttemptInProgress:
+		return studentTest, nil
+	}
+	s = s.owned()
+
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if test.OpensAt != nil && now.Before(*test.OpensAt) {
+		return nil, ErrTestNotOpen
+	}
+	if test.ClosesAt != nil && !now.Before(*test.ClosesAt) {
+		return nil, ErrTestClosed
+	}
+
+	studentTest.Status = AttemptInProgress
+	studentTest.StartTime = &now
+	studentTest.Deadline = attemptDeadline(test, now)
+	studentTest.ShuffleSeed = newShuffleSeed()
+
+	// The attempt keeps the questions it starts with, drawn ones included, as
+	// they are now: later edits to a question do not reach this attempt
+	questions, err := drawQuestions(s.DB, testID, studentTest.ShuffleSeed)
+	if err != nil {
+		return nil, err
+	}
+	for i := range questions {
+		revision, err := EnsureQuestionRevision(s.DB, questions[i].QuestionID)
+		if err != nil {
+			return nil, err
+		}
+		questions[i].RevisionID = &revision.ID
+	}
+	if test.ShuffleQuestions {
+		questionIDs := make([]uint, len(questions))
+		for i, q := range questions {
+			questionIDs[i] = q.QuestionID
+		}
+		studentTest.QuestionOrder = encodeQuestionOrder(shuffledQuestionOrder(questionIDs, studentTest.ShuffleSeed))
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Only one of concurrent starts claims the attempt and gives it questions
+		claimed := tx.Model(&models.StudentTest{}).
+			Where("id = ? AND status = ?", studentTest.ID, AttemptAssigned).
+			Updates(map[string]interface{}{
+				"status":         studentTest.Status,
+				"start_time":     studentTest.StartTime,
+				"deadline":       studentTest.Deadline,
+				"shuffle_seed":   studentTest.ShuffleSeed,
+				"question_order": studentTest.QuestionOrder,
+			})
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return errAttemptClaimed
+		}
+		if len(questions) == 0 {
+			return nil
+		}
+		for i := range questions {
+			questions[i].StudentTestID = studentTest.ID
+		}
+		return tx.Create(&questions).Error
+	})
+	if errors.Is(err, errAttemptClaimed) {
+		// Another request started the attempt first; serve the one it started
+		studentTest, err = s.FindAttempt(testID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if studentTest.Status == AttemptSubmitted {
+			return nil, ErrAttemptSubmitted
+		}
+		return studentTest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return studentTest, nil
+}
+
+// attemptDeadline is the earlier of the test duration running out and the test closing
+func attemptDeadline(test models.Test, start time.Time) *time.Time {
+	var deadline *time.Time
+	if test.DurationMinutes > 0 {
+		end := start.Add(time.Duration(test.DurationMinutes) * time.Minute)
+		deadline = &end
+	}
+	if test.ClosesAt != nil && (deadline == nil || test.ClosesAt.Before(*deadline)) {
+		end := *test.ClosesAt
+		deadline = &end
+	}
+	return deadline
+}
+
+func (s *AttemptService) activeAttempt(testID, userID uint) (*models.StudentTest, error) {
+	studentTest, err := s.FindAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch studentTest.Status {
+	case AttemptSubmitted:
+		return nil, ErrAttemptSubmitted
+	case AttemptInProgress:
+		return studentTest, nil
+	default:
+		return nil, ErrAttemptNotStarted
+	}
+}
+
+// GetAttemptQuestions serves the questions of a running attempt in the
+// student's own order when the test shuffles them.
+func (s *AttemptService) GetAttemptQuestions(testID, userID uint) ([]AttemptQuestion, error) {
+	studentTest, err := s.activeAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+	s = s.owned()
+
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return nil, err
+	}
+
+	questions, err := s.attemptQuestions(studentTest)
+	if err != nil {
+		return nil, err
+	}
+	questions = orderQuestions(questions, decodeQuestionOrder(studentTest.QuestionOrder))
+
+	served := make([]AttemptQuestion, 0, len(questions))
+	for _, q := range questions {
+		if test.ShuffleOptions && q.QuestionType == "MCQ" {
+			shuffleOptions(q.Options, studentTest.ShuffleSeed, q.ID)
+		}
+		served = append(served, toAttemptQuestion(q))
+	}
+	return served, nil
+}
+
+// attemptQuestionIDs lists the questions an attempt was given. Attempts
+// without recorded questions, e.g. never started, use the questions of the test.
+func (s *AttemptService) attemptQuestionIDs(studentTest *models.StudentTest) ([]uint, error) {
+	var ids []uint
+	err := s.DB.Model(&models.StudentTestQuestion{}).Where("student_test_id = ?", studentTest.ID).Order("position").Pluck("question_id", &ids).Error
+	if err != nil || len(ids) > 0 {
+		return ids, err
+	}
+	err = s.DB.Model(&models.TestQuestion{}).Where("test_id = ?", studentTest.TestID).Order("id").Pluck("question_id", &ids).Error
+	return ids, err
+}
+
+// attemptQuestions loads the questions of an attempt in the order they were
+// given, with their options in authoring order. Questions are read as the
+// revision the attempt was served; attempts from before revisions were kept
+// read the current question.
+func (s *AttemptService) attemptQuestions(studentTest *models.StudentTest) ([]models.Question, error) {
+	ids, err := s.attemptQuestionIDs(studentTest)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var revisions []models.QuestionRevision
+	err = s.DB.Joins("JOIN student_test_questions ON student_test_questions.revision_id = question_revisions.id").
+		Where("student_test_questions.student_test_id = ?", studentTest.ID).
+		Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	questions := make([]models.Question, 0, len(ids))
+	served := make(map[uint]bool, len(revisions))
+	for _, revision := range revisions {
+		questions = append(questions, revision.AsQuestion())
+		served[revision.QuestionID] = true
+	}
+
+	var current []uint
+	for _, id := range ids {
+		if !served[id] {
+			current = append(current, id)
+		}
+	}
+	if len(current) > 0 {
+		var live []models.Question
+		err = s.DB.Preload("Options", func(db *gorm.DB) *gorm.DB {
+			return db.Order("option_id")
+		}).
+			Where("id IN ?", current).
+			Find(&live).Error
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, live...)
+	}
+	return orderQuestions(questions, ids), nil
+}
+
+// servedRevisions maps the questions of an attempt to the revision it was served
+func servedRevisions(db *gorm.DB, studentTestID uint) (map[uint]uint, error) {
+	var rows []models.StudentTestQuestion
+	if err := db.Where("student_test_id = ? AND revision_id IS NOT NULL", studentTestID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	revisions := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		revisions[row.QuestionID] = *row.RevisionID
+	}
+	return revisions, nil
+}
+
+func toAttemptQuestion(q models.Question) AttemptQuestion {
+	aq := AttemptQuestion{
+		ID:                 q.ID,
+		QuestionType:       q.QuestionType,
+		QuestionText:       q.QuestionText,
+		Image1:             q.Image1,
+		Image1DisplayTime:  q.Image1DisplayTime,
+		Image2:             q.Image2,
+		Image2DisplayTime:  q.Image2DisplayTime,
+		Comment:            q.Comment,
+		CommentDisplayTime: q.CommentDisplayTime,
+	}
+
+	// The only option of a descriptive question is its model answer
+	if q.QuestionType == "DESCRIPTIVE" {
+		return aq
+	}
+	for _, opt := range q.Options {
+		aq.Options = append(aq.Options, AttemptOption{
+			ID:         opt.ID,
+			OptionID:   opt.OptionID,
+			OptionText: opt.OptionText,
+		})
+	}
+	return aq
+}
+
+// SaveAnswers stores the student's answers, replacing any earlier answer to the same question
+func (s *AttemptService) SaveAnswers(testID, userID uint, answers []AnswerInput) error {
+	_, err := s.SaveAnswersIdempotent(testID, userID, "", answers)
+	return err
+}
+
+// SaveAnswersIdempotent stores the student's answers atomically. A batch sent
+// again with the same idempotency key is acknowledged without being reapplied,
+// so a late retry cannot overwrite newer answers; a different batch under a
+// key already used in the attempt is refused with ErrIdempotencyKeyReused.
+func (s *AttemptService) SaveAnswersIdempotent(testID, userID uint, idempotencyKey string, answers []AnswerInput) (bool, error) {
+	studentTest, err := s.activeAttempt(testID, userID)
+	if err != nil {
+		return false, err
+	}
+	if studentTest.Deadline != nil && time.Now().After(studentTest.Deadline.Add(AnswerGracePeriod)) {
+		return false, ErrAttemptExpired
+	}
+	s = s.owned()
+
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return false, err
+	}
+
+	// Options are checked against the revision the student was served
+	questions, err := s.attemptQuestions(studentTest)
+	if err != nil {
+		return false, err
+	}
+	revisions, err := servedRevisions(s.DB, studentTest.ID)
+	if err != nil {
+		return false, err
+	}
+	inTest := make(map[uint]bool, len(questions))
+	objective := make(map[uint]bool, len(questions))
+	optionQuestion := make(map[uint]uint)
+	for _, q := range questions {
+		inTest[q.ID] = true
+		objective[q.ID] = q.QuestionType != "DESCRIPTIVE"
+		for _, opt := range q.Options {
+			optionQuestion[opt.ID] = q.ID
+		}
+	}
+
+	batch := make([]models.StudentAnswer, 0, len(answers))
+	for _, ans := range answers {
+		if !inTest[ans.QuestionID] {
+			return false, fmt.Errorf("%w: %d", ErrQuestionNotInTest, ans.QuestionID)
+		}
+		if ans.OptionID != nil && optionQuestion[*ans.OptionID] != ans.QuestionID {
+			return false, fmt.Errorf("%w: option %d of question %d", ErrOptionNotInQuestion, *ans.OptionID, ans.QuestionID)
+		}
+		// A position means nothing when each student sees the options in their own order
+		if test.ShuffleOptions && objective[ans.QuestionID] && ans.OptionID == nil && strings.TrimSpace(ans.Selected) != "" {
+			return false, fmt.Errorf("%w: question %d", ErrOptionIDRequired, ans.QuestionID)
+		}
+		answer := models.StudentAnswer{
+			TestID:           testID,
+			StudentID:        userID,
+			QuestionID:       ans.QuestionID,
+			Selected:         ans.Selected,
+			SelectedOptionID: ans.OptionID,
+		}
+		if revisionID, ok := revisions[ans.QuestionID]; ok {
+			answer.RevisionID = &revisionID
+		}
+		batch = append(batch, answer)
+	}
+	return SaveAnswerBatch(s.DB, userID, studentTest.ID, idempotencyKey, batch)
+}
+
+// SubmitAttempt grades a running attempt on behalf of the student
+func (s *AttemptService) SubmitAttempt(testID, userID uint) (*models.Result, error) {
+	studentTest, err := s.activeAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.owned().FinalizeAttempt(studentTest)
+}
+
+// FinalizeAttempt grades the answers of an attempt, stores the result and
+// closes the attempt for further answers.
+func (s *AttemptService) FinalizeAttempt(studentTest *models.StudentTest) (*models.Result, error) {
+	return s.finalize(studentTest, false)
+}
+
+// FinalizeExpiredAttempts submits every running attempt whose deadline has
+// passed, and every attempt never started of a test that has closed, and
+// returns how many were finalized. An attempt that fails is logged and
+// retried on the next run without holding back the others.
+func (s *AttemptService) FinalizeExpiredAttempts(now time.Time) (int, error) {
+	var expired []models.StudentTest
+	err := s.DB.Where("status = ? AND deadline IS NOT NULL AND deadline < ?", AttemptInProgress, now.Add(-AnswerGracePeriod)).
+		Find(&expired).Error
+	if err != nil {
+		return 0, err
+	}
+	var unstarted []models.StudentTest
+	err = s.DB.Where("status = ? AND test_id IN (?)", AttemptAssigned,
+		s.DB.Model(&models.Test{}).Select("id").Where("closes_at IS NOT NULL AND closes_at < ?", now)).
+		Find(&unstarted).Error
+	if err != nil {
+		return 0, err
+	}
+	expired = append(expired, unstarted...)
+
+	finalized := 0
+	for i := range expired {
+		if _, err := s.finalize(&expired[i], true); err != nil {
+			// A student may have submitted in the meantime
+			if !errors.Is(err, ErrAttemptSubmitted) {
+				log.Printf("Failed to finalize attempt %d: %v", expired[i].ID, err)
+			}
+			continue
+		}
+		finalized++
+	}
+	return finalized, nil
+}
+
+func (s *AttemptService) finalize(studentTest *models.StudentTest, autoSubmitted bool) (*models.Result, error) {
+	if studentTest.Status == AttemptSubmitted {
+		return nil, ErrAttemptSubmitted
+	}
+
+	card, err := s.scoreAnswers(studentTest)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	end := now
+	if studentTest.Deadline != nil && studentTest.Deadline.Before(end) {
+		end = *studentTest.Deadline
+	}
+	var duration time.Duration
+	if studentTest.StartTime != nil && end.After(*studentTest.StartTime) {
+		duration = end.Sub(*studentTest.StartTime)
+	}
+
+	result := models.Result{
+		TestID:           studentTest.TestID,
+		UserID:           studentTest.StudentID,
+		Score:            card.Score,
+		MaxScore:         card.MaxScore,
+		Correct:          card.Correct,
+		Incorrect:        card.Incorrect,
+		Ignored:          card.Ignored,
+		PendingGrading:   card.Pending,
+		TimeTakenSeconds: int64(duration.Seconds()),
+		AutoSubmitted:    autoSubmitted,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Only one of the student, a teacher or the expiry worker may close the attempt
+		closed := tx.Model(&models.StudentTest{}).
+			Where("id = ? AND status <> ?", studentTest.ID, AttemptSubmitted).
+			Updates(map[string]interface{}{
+				"status":       AttemptSubmitted,
+				"submitted_at": now,
+			})
+		if closed.Error != nil {
+			return closed.Error
+		}
+		if closed.RowsAffected == 0 {
+			return ErrAttemptSubmitted
+		}
+		return tx.Create(&result).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	studentTest.Status = AttemptSubmitted
+	studentTest.SubmittedAt = &now
+	return &result, nil
+}
+
+// GetAttemptResult returns the result of a submitted attempt with the teacher's feedback
+func (s *AttemptService) GetAttemptResult(testID, userID uint) (*AttemptResult, error) {
+	studentTest, err := s.FindAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if studentTest.Status != AttemptSubmitted {
+		return nil, ErrAttemptNotFinished
+	}
+
+	var attemptResult AttemptResult
+	if err := s.DB.Where("test_id = ? AND user_id = ?", testID, userID).First(&attemptResult.Result).Error; err != nil {
+		return nil, err
+	}
+
+	attemptResult.QuestionIDs, err = s.attemptQuestionIDs(studentTest)
+	if err != nil {
+		return nil, err
+	}
+
+	var answers []models.StudentAnswer
+	if err := s.DB.Where("test_id = ? AND student_id = ?", testID, userID).Order("id").Find(&answers).Error; err != nil {
+		return nil, err
+	}
+	for _, ans := range answers {
+		attemptResult.Answers = append(attemptResult.Answers, AnswerFeedback{
+			QuestionID:       ans.QuestionID,
+			Selected:         ans.Selected,
+			SelectedOptionID: ans.SelectedOptionID,
+			Points:           ans.Points,
+			Feedback:         ans.Feedback,
+		})
+	}
+	return &attemptResult, nil
+}
+
+// scoreCard is the tally of an attempt's answers
+type scoreCard struct {
+	Score     float64
+	MaxScore  float64
+	Correct   int
+	Incorrect int
+	Ignored   int
+	Pending   int // Descriptive answers not graded yet
+}
+
+// scoreAnswers grades the answers of an attempt under the test's scoring policy
+func (s *AttemptService) scoreAnswers(studentTest *models.StudentTest) (scoreCard, error) {
+	var card scoreCard
+	testID, userID := studentTest.TestID, studentTest.StudentID
+
+	policy, err := LoadScoringPolicy(s.DB, testID)
+	if err != nil {
+		return card, err
+	}
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return card, err
+	}
+
+	questions, err := s.attemptQuestions(studentTest)
+	if err != nil {
+		return card, err
+	}
+	byID := make(map[uint]models.Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+		card.MaxScore += policy.Marks(q)
+	}
+
+	var answers []models.StudentAnswer
+	if err := s.DB.Where("student_id = ? AND test_id = ?", userID, testID).Find(&answers).Error; err != nil {
+		return card, err
+	}
+
+	for _, ans := range answers {
+		question, ok := byID[ans.QuestionID]
+		if !ok {
+			continue
+		}
+
+		if question.QuestionType == "DESCRIPTIVE" {
+			if strings.TrimSpace(ans.Selected) == "" {
+				card.Ignored++
+				continue
+			}
+			if ans.Points == nil {
+				card.Pending++
+				continue
+			}
+			maxPoints, err := gradedMaxPoints(s.DB, ans)
+			if err != nil {
+				return card, err
+			}
+			card.Score += policy.ScoreDescriptive(question, *ans.Points, maxPoints)
+			if *ans.Points > 0 {
+				card.Correct++
+			} else {
+				card.Incorrect++
+			}
+			continue
+		}
+
+		option, ok := selectedOption(question, ans, !test.ShuffleOptions)
+		if !ok {
+			card.Ignored++
+			continue
+		}
+
+		// The option's own flag: questions added through the API hold their
+		// CorrectOptionID as a position, not as the ID of an option
+		correct := option.IsCorrect
+		card.Score += policy.ScoreObjective(question, correct)
+		if correct {
+			card.Correct++
+		} else {
+			card.Incorrect++
+		}
+	}
+	return card, nil
+}
+
+// selectedOption resolves the option an answer chose. Answers saved before
+// options were answered by ID hold the 1-based position in authoring order,
+// which only identifies an option when positional is set, i.e. the test does
+// not shuffle options.
+func selectedOption(question models.Question, ans models.StudentAnswer, positional bool) (models.QuestionOption, bool) {
+	if ans.SelectedOptionID != nil {
+		for _, opt := range question.Options {
+			if opt.ID == *ans.SelectedOptionID {
+				return opt, true
+			}
+		}
+		return models.QuestionOption{}, false
+	}
+	if !positional {
+		return models.QuestionOption{}, false
+	}
+
+	optionIndex, err := strconv.Atoi(strings.TrimSpace(ans.Selected))
+	if err != nil || optionIndex < 1 || optionIndex > len(question.Options) {
+		return models.QuestionOption{}, false
+	}
+	return question.Options[optionIndex-1], true
+}
+
+// RescoreAttempt recomputes the stored result of a submitted attempt, e.g.
+// after its descriptive answers have been graded.
+func (s *AttemptService) RescoreAttempt(testID, userID uint) (*models.Result, error) {
+	var result models.Result
+	if err := s.DB.Where("test_id = ? AND user_id = ?", testID, userID).First(&result).Error; err != nil {
+		return nil, err
+	}
+
+	studentTest, err := s.FindAttempt(testID, userID)
+	if err != nil {
+		return nil, err
+	}
+	card, err := s.scoreAnswers(studentTest)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Score = card.Score
+	result.MaxScore = card.MaxScore
+	result.Correct = card.Correct
+	result.Incorrect = card.Incorrect
+	result.Ignored = card.Ignored
+	result.PendingGrading = card.Pending
+	if err := s.DB.Save(&result).Error; err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RescoreTest recomputes every stored result of a test, e.g. after its scoring
+// policy changed, and returns how many results were updated.
+func (s *AttemptService) RescoreTest(testID uint) (int, error) {
+	var userIDs []uint
+	if err := s.DB.Model(&models.Result{}).Where("test_id = ?", testID).Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	rescored := 0
+	for _, userID := range userIDs {
+		if _, err := s.RescoreAttempt(testID, userID); err != nil {
+			return rescored, err
+		}
+		rescored++
+	}
+	return rescored, nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type AttemptServiceInterface interface {
+	WithContext(ctx context.Context) AttemptServiceInterface
+	ListAssignedTests(userID uint) ([]AssignedTest, error)
+	FindAttempt(testID, userID uint) (*models.StudentTest, error)
+	StartAttempt(testID, userID uint) (*models.StudentTest, error)
+	GetAttemptQuestions(testID, userID uint) ([]AttemptQuestion, error)
+	SaveAnswers(testID, userID uint, answers []AnswerInput) error
+	SaveAnswersIdempotent(testID, userID uint, idempotencyKey string, answers []AnswerInput) (bool, error)
+	SubmitAttempt(testID, userID uint) (*models.Result, error)
+	FinalizeAttempt(studentTest *models.StudentTest) (*models.Result, error)
+	GetAttemptResult(testID, userID uint) (*AttemptResult, error)
+	RescoreTest(testID uint) (int, error)
+}
+
+var _ AttemptServiceInterface = &AttemptService{}
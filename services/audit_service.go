@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"pathshala/models"
+	"pathshala/utils"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AuditService struct {
+	DB *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{DB: db}
+}
+
+// WithContext returns the service running its queries with ctx
+func (s *AuditService) WithContext(ctx context.Context) AuditServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
+}
+
+// AuditFilter narrows the audit trail; zero fields match everything
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	EntityType string
+	EntityID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+func (s *AuditService) Record(entry *models.AuditLog) error {
+	return s.DB.Create(entry).Error
+}
+
+func (s *AuditService) filtered(filter AuditFilter) *gorm.DB {
+	query := s.DB.Model(&models.AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// ListAuditLogs returns a page of matching entries, newest first
+func (s *AuditService) ListAuditLogs(filter AuditFilter, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var total int64
+	if err := s.filtered(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	limit, offset := pageOffset(page, pageSize)
+	var entries []models.AuditLog
+	err := s.filtered(filter).Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&entries).Error
+	return entries, total, err
+}
+
+// auditCSVHeader are the columns of an audit export
+var auditCSVHeader = []string{"id", "created_at", "actor_id", "actor_role", "action", "entity_type", "entity_id",
+	"before", "after", "method", "path", "status_code", "ip", "user_agent"}
+
+// ExportAuditCSV writes every matching entry, oldest first, with the before
+// and after states as JSON
+func (s *AuditService) ExportAuditCSV(w io.Writer, filter AuditFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(auditCSVHeader); err != nil {
+		return err
+	}
+
+	var batch []models.AuditLog
+	err := s.filtered(filter).Order("created_at, id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			actor := ""
+			if entry.ActorID != nil {
+				actor = strconv.FormatUint(uint64(*entry.ActorID), 10)
+			}
+			record := []string{
+				strconv.FormatUint(uint64(entry.ID), 10), entry.CreatedAt.UTC().Format(time.RFC3339),
+				actor, entry.ActorRole, entry.Action, entry.EntityType, entry.EntityID,
+				auditJSON(entry.Before), auditJSON(entry.After),
+				entry.Method, entry.Path, strconv.Itoa(entry.StatusCode), entry.IP, entry.UserAgent,
+			}
+			for i := range record {
+				record[i] = utils.CSVCell(record[i])
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
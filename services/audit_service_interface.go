@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"io"
+	"pathshala/models"
+)
+
+type AuditServiceInterface interface {
+	WithContext(ctx context.Context) AuditServiceInterface
+	Record(entry *models.AuditLog) error
+	ListAuditLogs(filter AuditFilter, page, pageSize int) ([]models.AuditLog, int64, error)
+	ExportAuditCSV(w io.Writer, filter AuditFilter) error
+}
+
+var _ AuditServiceInterface = &AuditService{}
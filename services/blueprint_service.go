@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"pathshala/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPoolTooSmall     = errors.New("question pool cannot satisfy the blueprint")
+	ErrInvalidBlueprint = errors.New("invalid blueprint")
+)
+
+type BlueprintService struct {
+	DB *gorm.DB
+}
+
+func NewBlueprintService(db *gorm.DB) *BlueprintService {
+	return &BlueprintService{DB: db}
+}
+
+// WithContext returns the service running its queries with ctx
+func (s *BlueprintService) WithContext(ctx context.Context) BlueprintServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
+}
+
+type BlueprintRuleInput struct {
+	CategoryID uint   `json:"category_id" binding:"required"`
+	Difficulty string `json:"difficulty" binding:"required"`
+	Count      int    `json:"count" binding:"gte=1"`
+}
+
+// PoolShortage is a category and difficulty with fewer questions than the blueprint draws
+type PoolShortage struct {
+	CategoryID uint   `json:"category_id"`
+	Difficulty string `json:"difficulty"`
+	Required   int    `json:"required"`
+	Available  int    `json:"available"`
+}
+
+// PoolShortageError refuses a blueprint its pools cannot satisfy
+type PoolShortageError struct {
+	Shortages []PoolShortage
+}
+
+func (e *PoolShortageError) Error() string {
+	parts := make([]string, len(e.Shortages))
+	for i, p := range e.Shortages {
+		parts[i] = fmt.Sprintf("category %d has %d %s questions, %d needed", p.CategoryID, p.Available, p.Difficulty, p.Required)
+	}
+	return fmt.Sprintf("%s: %s", ErrPoolTooSmall, strings.Join(parts, "; "))
+}
+
+func (e *PoolShortageError) Unwrap() error {
+	return ErrPoolTooSmall
+}
+
+func (s *BlueprintService) GetBlueprint(testID uint) ([]models.TestBlueprint, error) {
+	var rules []models.TestBlueprint
+	err := s.DB.Where("test_id = ?", testID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// SetBlueprint replaces the blueprint of a test. An empty blueprint turns the
+// test back into a fixed list of questions. A blueprint naming an unknown
+// category is invalid, and one its pools cannot satisfy is refused with a
+// *PoolShortageError.
+func (s *BlueprintService) SetBlueprint(testID uint, input []BlueprintRuleInput) ([]models.TestBlueprint, error) {
+	categoryIDs := make([]uint, 0, len(input))
+	for _, r := range input {
+		categoryIDs = append(categoryIDs, r.CategoryID)
+	}
+	var known []uint
+	if len(categoryIDs) > 0 {
+		if err := s.DB.Model(&models.Category{}).Where("id IN ?", categoryIDs).Pluck("id", &known).Error; err != nil {
+			return nil, err
+		}
+	}
+	exists := make(map[uint]bool, len(known))
+	for _, id := range known {
+		exists[id] = true
+	}
+
+	rules := make([]models.TestBlueprint, 0, len(input))
+	for _, r := range input {
+		if !exists[r.CategoryID] {
+			return nil, fmt.Errorf("%w: category %d does not exist", ErrInvalidBlueprint, r.CategoryID)
+		}
+		difficulty := strings.ToUpper(strings.TrimSpace(r.Difficulty))
+		switch difficulty {
+		case "EASY", "MEDIUM", "HARD":
+		default:
+			return nil, fmt.Errorf("%w: difficulty must be EASY, MEDIUM or HARD", ErrInvalidBlueprint)
+		}
+		rules = append(rules, models.TestBlueprint{
+			TestID:     testID,
+			CategoryID: r.CategoryID,
+			Difficulty: difficulty,
+			Count:      r.Count,
+		})
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("test_id = ?", testID).Delete(&models.TestBlueprint{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		if err := tx.Create(&rules).Error; err != nil {
+			return err
+		}
+		shortages, err := poolShortages(tx, testID, rules)
+		if err != nil {
+			return err
+		}
+		if len(shortages) > 0 {
+			return &PoolShortageError{Shortages: shortages}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CheckPools reports every pool of the blueprint that holds too few questions,
+// e.g. after questions were deleted since the blueprint was saved
+func (s *BlueprintService) CheckPools(testID uint) ([]PoolShortage, error) {
+	rules, err := s.GetBlueprint(testID)
+	if err != nil {
+		return nil, err
+	}
+	return poolShortages(s.DB, testID, rules)
+}
+
+// poolShortages reports the pools of blueprint rules that hold too few
+// questions. Rules drawing from the same pool add up, and fixed questions of
+// the test are not available to draws.
+func poolShortages(db *gorm.DB, testID uint, rules []models.TestBlueprint) ([]PoolShortage, error) {
+	var fixedIDs []uint
+	if err := db.Model(&models.TestQuestion{}).Where("test_id = ?", testID).Pluck("question_id", &fixedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	type pool struct {
+		CategoryID uint
+		Difficulty string
+	}
+	required := make(map[pool]int)
+	var pools []pool
+	for _, rule := range rules {
+		p := pool{rule.CategoryID, rule.Difficulty}
+		if _, ok := required[p]; !ok {
+			pools = append(pools, p)
+		}
+		required[p] += rule.Count
+	}
+
+	var shortages []PoolShortage
+	for _, p := range pools {
+		var available int64
+		if err := poolQuery(db, p.CategoryID, p.Difficulty, fixedIDs).Count(&available).Error; err != nil {
+			return nil, err
+		}
+		if int(available) < required[p] {
+			shortages = append(shortages, PoolShortage{
+				CategoryID: p.CategoryID,
+				Difficulty: p.Difficulty,
+				Required:   required[p],
+				Available:  int(available),
+			})
+		}
+	}
+	return shortages, nil
+}
+
+// BlueprintSize is the number of questions every attempt draws
+func (s *BlueprintService) BlueprintSize(testID uint) (int, error) {
+	var size int64
+	err := s.DB.Model(&models.TestBlueprint{}).Where("test_id = ?", testID).
+		Select("COALESCE(SUM(count), 0)").Scan(&size).Error
+	return int(size), err
+}
+
+// poolQuery selects the questions of a category and difficulty, leaving out excluded IDs
+func poolQuery(db *gorm.DB, categoryID uint, difficulty string, excluded []uint) *gorm.DB {
+	query := db.Model(&models.Question{}).
+		Where("category_id = ? AND UPPER(difficulty) = ?", categoryID, strings.ToUpper(difficulty))
+	if len(excluded) > 0 {
+		query = query.Where("id NOT IN ?", excluded)
+	}
+	return query
+}
+
+// drawQuestions picks the questions of an attempt: the fixed questions of the
+// test in the order they were added, followed by a seeded random draw for
+// every blueprint rule.
+func drawQuestions(db *gorm.DB, testID uint, seed int64) ([]models.StudentTestQuestion, error) {
+	var fixedIDs []uint
+	if err := db.Model(&models.TestQuestion{}).Where("test_id = ?", testID).Order("id").Pluck("question_id", &fixedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var rules []models.TestBlueprint
+	if err := db.Where("test_id = ?", testID).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	// A question added to the test twice is given once
+	drawn := make([]models.StudentTestQuestion, 0, len(fixedIDs))
+	var taken []uint
+	seen := make(map[uint]bool, len(fixedIDs))
+	for _, id := range fixedIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		taken = append(taken, id)
+		drawn = append(drawn, models.StudentTestQuestion{QuestionID: id, Position: len(drawn) + 1})
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	for _, rule := range rules {
+		var candidates []uint
+		if err := poolQuery(db, rule.CategoryID, rule.Difficulty, taken).Order("id").Pluck("id", &candidates).Error; err != nil {
+			return nil, err
+		}
+		if len(candidates) < rule.Count {
+			return nil, fmt.Errorf("%w: category %d has %d %s questions, %d needed",
+				ErrPoolTooSmall, rule.CategoryID, len(candidates), rule.Difficulty, rule.Count)
+		}
+
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		for _, id := range candidates[:rule.Count] {
+			blueprintID := rule.ID
+			drawn = append(drawn, models.StudentTestQuestion{QuestionID: id, BlueprintID: &blueprintID, Position: len(drawn) + 1})
+			taken = append(taken, id)
+		}
+	}
+	return drawn, nil
+}
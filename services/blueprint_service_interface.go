@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type BlueprintServiceInterface interface {
+	WithContext(ctx context.Context) BlueprintServiceInterface
+	GetBlueprint(testID uint) ([]models.TestBlueprint, error)
+	SetBlueprint(testID uint, input []BlueprintRuleInput) ([]models.TestBlueprint, error)
+	CheckPools(testID uint) ([]PoolShortage, error)
+	BlueprintSize(testID uint) (int, error)
+}
+
+var _ BlueprintServiceInterface = &BlueprintService{}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDescriptivePoints is what a descriptive question without a rubric is worth
+const DefaultDescriptivePoints = 1.0
+
+var (
+	ErrAnswerNotFound     = errors.New("answer not found")
+	ErrNotDescriptive     = errors.New("only descriptive answers are graded manually")
+	ErrInvalidGrade       = errors.New("invalid grade")
+	ErrQuestionNotFound   = errors.New("question not found")
+	ErrAttemptNotFinished = errors.New("attempt has not been submitted yet")
+)
+
+type GradingService struct {
+	DB       *gorm.DB
+	Attempts *AttemptService
+}
+
+func NewGradingService(db *gorm.DB, attempts *AttemptService) *GradingService {
+	return &GradingService{DB: db, Attempts: attempts}
+}
+
+// WithContext is like AttemptService.WithContext
+func (s *GradingService) WithContext(ctx context.Context) GradingServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	if s.Attempts != nil {
+		scoped.Attempts = s.Attempts.withContext(ctx)
+	}
+	return &scoped
+}
+
+// PendingAnswer is an ungraded descriptive answer in a teacher's grading queue
+type PendingAnswer struct {
+	AnswerID     uint                     `json:"answer_id"`
+	StudentID    uint                     `json:"student_id"`
+	StudentName  string                   `json:"student_name"`
+	QuestionID   uint                     `json:"question_id"`
+	QuestionText string                   `json:"question_text"`
+	Answer       string                   `json:"answer"`
+	ModelAnswer  string                   `json:"model_answer"`
+	MaxPoints    float64                  `json:"max_points"`
+	Rubric       []models.RubricCriterion `json:"rubric"`
+	SubmittedAt  *time.Time               `json:"submitted_at"`
+}
+
+type CriterionPoints struct {
+	CriterionID uint    `json:"criterion_id" binding:"required"`
+	Points      float64 `json:"points" binding:"gte=0"`
+}
+
+type GradeInput struct {
+	Criteria []CriterionPoints `json:"criteria"` // Required when the question has a rubric
+	Points   *float64          `json:"points"`   // Used when the question has no rubric
+	Feedback string            `json:"feedback"`
+}
+
+// ScoringInput configures how the questions of a test are marked
+type ScoringInput struct {
+	NegativeMarking float64 `json:"negative_marking" binding:"gte=0,lte=1"`
+	EasyMarks       float64 `json:"easy_marks" binding:"gt=0"`
+	MediumMarks     float64 `json:"medium_marks" binding:"gt=0"`
+	HardMarks       float64 `json:"hard_marks" binding:"gt=0"`
+	AllOrNothing    bool    `json:"all_or_nothing"`
+}
+
+type RubricInput struct {
+	Description string  `json:"description" binding:"required"`
+	MaxPoints   float64 `json:"max_points" binding:"gt=0"`
+}
+
+// GradingQueue lists the ungraded descriptive answers of submitted attempts of a test
+func (s *GradingService) GradingQueue(testID uint) ([]PendingAnswer, error) {
+	var rows []struct {
+		AnswerID     uint
+		StudentID    uint
+		StudentName  string
+		QuestionID   uint
+		QuestionText string
+		Answer       string
+		SubmittedAt  *time.Time
+	}
+	err := s.DB.Table("student_answers").
+		Select("student_answers.id AS answer_id, student_answers.student_id, users.name AS student_name, "+
+			"questions.id AS question_id, questions.question_text, student_answers.selected AS answer, student_tests.submitted_at").
+		Joins("JOIN questions ON questions.id = student_answers.question_id").
+		Joins("JOIN users ON users.id = student_answers.student_id").
+		Joins("JOIN student_tests ON student_tests.test_id = student_answers.test_id AND student_tests.student_id = student_answers.student_id").
+		Where("student_answers.test_id = ? AND student_answers.deleted_at IS NULL", testID).
+		Where("questions.question_type = ? AND student_answers.points IS NULL AND TRIM(student_answers.selected) <> ''", "DESCRIPTIVE").
+		Where("student_tests.status = ?", AttemptSubmitted).
+		Order("student_tests.submitted_at, student_answers.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]PendingAnswer, 0, len(rows))
+	for _, row := range rows {
+		rubric, maxPoints, err := loadRubric(s.DB, row.QuestionID)
+		if err != nil {
+			return nil, err
+		}
+
+		var modelAnswer models.QuestionOption
+		s.DB.Where("question_id = ?", row.QuestionID).First(&modelAnswer)
+
+		queue = append(queue, PendingAnswer{
+			AnswerID:     row.AnswerID,
+			StudentID:    row.StudentID,
+			StudentName:  row.StudentName,
+			QuestionID:   row.QuestionID,
+			QuestionText: row.QuestionText,
+			Answer:       row.Answer,
+			ModelAnswer:  modelAnswer.OptionText,
+			MaxPoints:    maxPoints,
+			Rubric:       rubric,
+			SubmittedAt:  row.SubmittedAt,
+		})
+	}
+	return queue, nil
+}
+
+// gradedMaxPoints is what a graded descriptive answer was out of: the rubric
+// total kept when it was graded, so later rubric edits do not rescore it.
+// Answers graded before that was kept fall back to the current rubric.
+func gradedMaxPoints(db *gorm.DB, answer models.StudentAnswer) (float64, error) {
+	if answer.MaxPoints != nil {
+		return *answer.MaxPoints, nil
+	}
+	_, maxPoints, err := loadRubric(db, answer.QuestionID)
+	return maxPoints, err
+}
+
+// loadRubric returns the rubric of a question and the points a full answer earns
+func loadRubric(db *gorm.DB, questionID uint) ([]models.RubricCriterion, float64, error) {
+	var rubric []models.RubricCriterion
+	if err := db.Where("question_id = ?", questionID).Order("position, id").Find(&rubric).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(rubric) == 0 {
+		return rubric, DefaultDescriptivePoints, nil
+	}
+
+	total := 0.0
+	for _, criterion := range rubric {
+		total += criterion.MaxPoints
+	}
+	return rubric, total, nil
+}
+
+func (s *GradingService) FindAnswer(answerID uint) (*models.StudentAnswer, error) {
+	var answer models.StudentAnswer
+	err := s.DB.First(&answer, answerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAnswerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
+
+// GradeAnswer stores the teacher's points and feedback for a descriptive answer.
+// Once every descriptive answer of the attempt is graded, its result is recomputed.
+func (s *GradingService) GradeAnswer(answerID, graderID uint, input GradeInput) (*models.StudentAnswer, error) {
+	answer, err := s.FindAnswer(answerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var question models.Question
+	if err := s.DB.First(&question, answer.QuestionID).Error; err != nil {
+		return nil, ErrQuestionNotFound
+	}
+	if question.QuestionType != "DESCRIPTIVE" {
+		return nil, ErrNotDescriptive
+	}
+
+	attempt, err := s.Attempts.FindAttempt(answer.TestID, answer.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	if attempt.Status != AttemptSubmitted {
+		return nil, ErrAttemptNotFinished
+	}
+
+	rubric, maxPoints, err := loadRubric(s.DB, question.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var criterionScores []models.AnswerCriterionScore
+	points := 0.0
+	if len(rubric) > 0 {
+		given := make(map[uint]float64, len(input.Criteria))
+		for _, cp := range input.Criteria {
+			given[cp.CriterionID] = cp.Points
+		}
+		if len(given) != len(rubric) {
+			return nil, fmt.Errorf("%w: every rubric criterion must be scored", ErrInvalidGrade)
+		}
+		for _, criterion := range rubric {
+			p, ok := given[criterion.ID]
+			if !ok {
+				return nil, fmt.Errorf("%w: criterion %d is not part of this rubric", ErrInvalidGrade, criterion.ID)
+			}
+			if p < 0 || p > criterion.MaxPoints {
+				return nil, fmt.Errorf("%w: criterion %d allows 0 to %g points", ErrInvalidGrade, criterion.ID, criterion.MaxPoints)
+			}
+			points += p
+			criterionScores = append(criterionScores, models.AnswerCriterionScore{
+				StudentAnswerID: answer.ID,
+				CriterionID:     criterion.ID,
+				Points:          p,
+			})
+		}
+	} else {
+		if input.Points == nil {
+			return nil, fmt.Errorf("%w: points are required", ErrInvalidGrade)
+		}
+		points = *input.Points
+		if points < 0 || points > maxPoints {
+			return nil, fmt.Errorf("%w: points must be between 0 and %g", ErrInvalidGrade, maxPoints)
+		}
+	}
+
+	now := time.Now()
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("student_answer_id = ?", answer.ID).Delete(&models.AnswerCriterionScore{}).Error; err != nil {
+			return err
+		}
+		if len(criterionScores) > 0 {
+			if err := tx.Create(&criterionScores).Error; err != nil {
+				return err
+			}
+		}
+		answer.Points = &points
+		answer.MaxPoints = &maxPoints
+		answer.Feedback = input.Feedback
+		answer.GradedBy = &graderID
+		answer.GradedAt = &now
+		return tx.Save(answer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.rescoreIfGraded(answer.TestID, answer.StudentID); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// rescoreIfGraded recomputes the result once no descriptive answer of the attempt awaits grading
+func (s *GradingService) rescoreIfGraded(testID, userID uint) error {
+	var pending int64
+	err := s.DB.Model(&models.StudentAnswer{}).
+		Joins("JOIN questions ON questions.id = student_answers.question_id").
+		Where("student_answers.test_id = ? AND student_answers.student_id = ?", testID, userID).
+		Where("questions.question_type = ? AND student_answers.points IS NULL AND TRIM(student_answers.selected) <> ''", "DESCRIPTIVE").
+		Count(&pending).Error
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	_, err = s.Attempts.RescoreAttempt(testID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// QuestionTests lists the tests that contain a question or served it in an
+// attempt; their grading depends on the question's rubric
+func (s *GradingService) QuestionTests(questionID uint) ([]uint, error) {
+	var testIDs []uint
+	err := s.DB.Model(&models.Test{}).
+		Where("id IN (?) OR id IN (?)",
+			s.DB.Model(&models.TestQuestion{}).Select("test_id").Where("question_id = ?", questionID),
+			s.DB.Model(&models.StudentTest{}).Select("test_id").Where("id IN (?)",
+				s.DB.Model(&models.StudentTestQuestion{}).Select("student_test_id").Where("question_id = ?", questionID))).
+		Order("id").
+		Pluck("id", &testIDs).Error
+	return testIDs, err
+}
+
+func (s *GradingService) GetRubric(questionID uint) ([]models.RubricCriterion, error) {
+	rubric, _, err := loadRubric(s.DB, questionID)
+	return rubric, err
+}
+
+// SetRubric replaces the rubric of a descriptive question. Answers already
+// graded keep the points they were given out of the old rubric.
+func (s *GradingService) SetRubric(questionID uint, criteria []RubricInput) ([]models.RubricCriterion, error) {
+	var question models.Question
+	if err := s.DB.First(&question, questionID).Error; err != nil {
+		return nil, ErrQuestionNotFound
+	}
+	if question.QuestionType != "DESCRIPTIVE" {
+		return nil, ErrNotDescriptive
+	}
+
+	rubric := make([]models.RubricCriterion, 0, len(criteria))
+	for i, c := range criteria {
+		rubric = append(rubric, models.RubricCriterion{
+			QuestionID:  questionID,
+			Description: c.Description,
+			MaxPoints:   c.MaxPoints,
+			Position:    i + 1,
+		})
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("question_id = ?", questionID).Delete(&models.RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		if len(rubric) == 0 {
+			return nil
+		}
+		return tx.Create(&rubric).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+// SetScoringPolicy changes how a test is marked. Stored results keep their
+// scores until the test is re-scored.
+func (s *GradingService) SetScoringPolicy(testID uint, input ScoringInput) (*models.Test, error) {
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return nil, err
+	}
+
+	// A map so that zero values are written too
+	err := s.DB.Model(&test).Updates(map[string]interface{}{
+		"negative_marking": input.NegativeMarking,
+		"easy_marks":       input.EasyMarks,
+		"medium_marks":     input.MediumMarks,
+		"hard_marks":       input.HardMarks,
+		"all_or_nothing":   input.AllOrNothing,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &test, nil
+}
+
+// SetQuestionMarks overrides what a question of a test is worth. Nil marks
+// fall back to the test's marks for the question's difficulty.
+func (s *GradingService) SetQuestionMarks(testID, questionID uint, marks *float64) (*models.TestQuestion, error) {
+	if marks != nil && *marks <= 0 {
+		return nil, fmt.Errorf("%w: marks must be positive", ErrInvalidGrade)
+	}
+
+	var testQuestion models.TestQuestion
+	err := s.DB.Where("test_id = ? AND question_id = ?", testID, questionID).First(&testQuestion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrQuestionNotInTest
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(&testQuestion).Update("marks", marks).Error; err != nil {
+		return nil, err
+	}
+	testQuestion.Marks = marks
+	return &testQuestion, nil
+}
+
+// RescoreTest applies the current scoring policy to every result of a test
+func (s *GradingService) RescoreTest(testID uint) (int, error) {
+	return s.Attempts.RescoreTest(testID)
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type GradingServiceInterface interface {
+	WithContext(ctx context.Context) GradingServiceInterface
+	GradingQueue(testID uint) ([]PendingAnswer, error)
+	FindAnswer(answerID uint) (*models.StudentAnswer, error)
+	GradeAnswer(answerID, graderID uint, input GradeInput) (*models.StudentAnswer, error)
+	QuestionTests(questionID uint) ([]uint, error)
+	GetRubric(questionID uint) ([]models.RubricCriterion, error)
+	SetRubric(questionID uint, criteria []RubricInput) ([]models.RubricCriterion, error)
+	SetScoringPolicy(testID uint, input ScoringInput) (*models.Test, error)
+	SetQuestionMarks(testID, questionID uint, marks *float64) (*models.TestQuestion, error)
+	RescoreTest(testID uint) (int, error)
+}
+
+var _ GradingServiceInterface = &GradingService{}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"math"
+	"pathshala/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Thresholds of the classical item statistics used to flag questions
+const (
+	easyItemIndex          = 0.7  // Difficulty index at or above which an item is easy
+	hardItemIndex          = 0.3  // Difficulty index below which an item is hard
+	lowDiscrimination      = 0.2  // Point-biserial below which an item barely separates students
+	nonFunctioningDistract = 0.05 // Share of students below which a distractor is not doing its job
+)
+
+type ItemAnalysisService struct {
+	DB       *gorm.DB
+	Attempts *AttemptService
+}
+
+func NewItemAnalysisService(db *gorm.DB, attempts *AttemptService) *ItemAnalysisService {
+	return &ItemAnalysisService{DB: db, Attempts: attempts}
+}
+
+// WithContext is like AttemptService.WithContext
+func (s *ItemAnalysisService) WithContext(ctx context.Context) ItemAnalysisServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	if s.Attempts != nil {
+		scoped.Attempts = s.Attempts.withContext(ctx)
+	}
+	return &scoped
+}
+
+// ItemAnalysis holds the classical item statistics of a test's submitted attempts
+type ItemAnalysis struct {
+	TestID    uint    `json:"test_id"`
+	Attempts  int     `json:"attempts"`
+	MeanScore float64 `json:"mean_score"` // Mean percentage score
+	// KR-20 reliability over the objective items. Nil when attempts were not
+	// all served the same objective items or there are too few of them.
+	KR20  *float64         `json:"kr20"`
+	Items []ItemStatistics `json:"items"`
+}
+
+// ItemStatistics describes how a question performed. Students are only
+// counted for the questions they were served.
+type ItemStatistics struct {
+	QuestionID          uint                   `json:"question_id"`
+	QuestionText        string                 `json:"question_text"`
+	QuestionType        string                 `json:"question_type"`
+	Difficulty          string                 `json:"difficulty"` // As authored
+	Served              int                    `json:"served"`
+	Answered            int                    `json:"answered"`
+	Omitted             int                    `json:"omitted"`
+	DifficultyIndex     *float64               `json:"difficulty_index"` // Proportion correct, or mean share of rubric points
+	Discrimination      *float64               `json:"discrimination"`   // Point-biserial correlation with the percentage score
+	SuggestedDifficulty string                 `json:"suggested_difficulty,omitempty"`
+	Options             []DistractorStatistics `json:"options,omitempty"`
+	Flags               []string               `json:"flags"`
+}
+
+// DistractorStatistics is how often an option was chosen. Options are
+// identified by their position, which stays the same across revisions.
+type DistractorStatistics struct {
+	OptionID   uint     `json:"option_id"`
+	OptionText string   `json:"option_text"`
+	IsCorrect  bool     `json:"is_correct"`
+	Chosen     int      `json:"chosen"`
+	Proportion float64  `json:"proportion"`
+	MeanScore  *float64 `json:"mean_score"` // Mean percentage score of the students who chose it
+}
+
+// DifficultyChange is a question whose difficulty was set from its statistics
+type DifficultyChange struct {
+	QuestionID uint    `json:"question_id"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Index      float64 `json:"difficulty_index"`
+}
+
+// itemResponse is one student's response to one item
+type itemResponse struct {
+	total    float64 // Percentage score of the attempt
+	score    float64 // 0 or 1 for objective items, share of points for descriptive ones
+	answered bool
+	graded   bool
+	position uint // Position of the chosen option
+}
+
+type itemData struct {
+	question  models.Question // Latest revision served
+	responses []itemResponse
+}
+
+// AnalyzeTest computes difficulty, discrimination and distractor statistics
+// for every question of a test, and the test's KR-20 reliability, from its
+// submitted attempts.
+func (s *ItemAnalysisService) AnalyzeTest(testID uint) (*ItemAnalysis, error) {
+	analysis := &ItemAnalysis{TestID: testID, Items: []ItemStatistics{}}
+
+	var test models.Test
+	if err := s.DB.First(&test, testID).Error; err != nil {
+		return nil, err
+	}
+	var attempts []models.StudentTest
+	if err := s.DB.Where("test_id = ? AND status = ?", testID, AttemptSubmitted).Order("id").Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+
+	var results []models.Result
+	if err := s.DB.Where("test_id = ?", testID).Find(&results).Error; err != nil {
+		return nil, err
+	}
+	totals := make(map[uint]float64, len(results))
+	for _, r := range results {
+		totals[r.UserID] = percentage(r.Score, r.MaxScore)
+	}
+
+	var answers []models.StudentAnswer
+	if err := s.DB.Where("test_id = ?", testID).Find(&answers).Error; err != nil {
+		return nil, err
+	}
+	type answerKey struct{ StudentID, QuestionID uint }
+	answerOf := make(map[answerKey]models.StudentAnswer, len(answers))
+	for _, ans := range answers {
+		answerOf[answerKey{ans.StudentID, ans.QuestionID}] = ans
+	}
+
+	items := make(map[uint]*itemData)
+	var order []uint
+	maxPoints := make(map[uint]float64)
+	// Objective items of every attempt, for KR-20
+	var objectiveSets []string
+	var objectiveScores []map[uint]float64
+
+	for i := range attempts {
+		attempt := &attempts[i]
+		total, ok := totals[attempt.StudentID]
+		if !ok {
+			continue
+		}
+		questions, err := s.Attempts.attemptQuestions(attempt)
+		if err != nil {
+			return nil, err
+		}
+		analysis.Attempts++
+		analysis.MeanScore += total
+
+		objective := make(map[uint]float64)
+		var objectiveIDs []string
+		for _, q := range questions {
+			item, ok := items[q.ID]
+			if !ok {
+				item = &itemData{}
+				items[q.ID] = item
+				order = append(order, q.ID)
+			}
+			item.question = q
+
+			response := itemResponse{total: total}
+			ans, answered := answerOf[answerKey{attempt.StudentID, q.ID}]
+			if q.QuestionType == "DESCRIPTIVE" {
+				response.answered = answered && strings.TrimSpace(ans.Selected) != ""
+				if response.answered && ans.Points != nil {
+					outOf := ans.MaxPoints
+					if outOf == nil {
+						if _, ok := maxPoints[q.ID]; !ok {
+							_, points, err := loadRubric(s.DB, q.ID)
+							if err != nil {
+								return nil, err
+							}
+							maxPoints[q.ID] = points
+						}
+						points := maxPoints[q.ID]
+						outOf = &points
+					}
+					if *outOf > 0 {
+						response.score = math.Min(*ans.Points / *outOf, 1)
+					}
+					response.graded = true
+				}
+				if !response.answered {
+					response.graded = true
+				}
+			} else {
+				response.graded = true
+				if answered {
+					if option, ok := selectedOption(q, ans, !test.ShuffleOptions); ok {
+						response.answered = true
+						response.position = option.OptionID
+						if option.IsCorrect {
+							response.score = 1
+						}
+					}
+				}
+				objective[q.ID] = response.score
+				objectiveIDs = append(objectiveIDs, strconv.FormatUint(uint64(q.ID), 10))
+			}
+			item.responses = append(item.responses, response)
+		}
+		sort.Strings(objectiveIDs)
+		objectiveSets = append(objectiveSets, strings.Join(objectiveIDs, ","))
+		objectiveScores = append(objectiveScores, objective)
+	}
+	if analysis.Attempts > 0 {
+		analysis.MeanScore /= float64(analysis.Attempts)
+	}
+
+	for _, id := range order {
+		analysis.Items = append(analysis.Items, itemStatistics(items[id]))
+	}
+	analysis.KR20 = kr20(objectiveSets, objectiveScores, analysis.Items)
+	return analysis, nil
+}
+
+func percentage(score, maxScore float64) float64 {
+	if maxScore <= 0 {
+		return 0
+	}
+	return 100 * score / maxScore
+}
+
+func itemStatistics(item *itemData) ItemStatistics {
+	q := item.question
+	stats := ItemStatistics{
+		QuestionID:   q.ID,
+		QuestionText: q.QuestionText,
+		QuestionType: q.QuestionType,
+		Difficulty:   q.Difficulty,
+		Served:       len(item.responses),
+		Flags:        []string{},
+	}
+
+	var scores, totals []float64
+	for _, r := range item.responses {
+		if r.answered {
+			stats.Answered++
+		} else {
+			stats.Omitted++
+		}
+		if r.graded {
+			scores = append(scores, r.score)
+			totals = append(totals, r.total)
+		}
+	}
+
+	if len(scores) > 0 {
+		p := mean(scores)
+		stats.DifficultyIndex = &p
+		stats.SuggestedDifficulty = suggestedDifficulty(p)
+		stats.Discrimination = pointBiserial(scores, totals)
+
+		switch {
+		case p < 0.2:
+			stats.Flags = append(stats.Flags, "very_hard")
+		case p > 0.9:
+			stats.Flags = append(stats.Flags, "very_easy")
+		}
+		if stats.Discrimination != nil {
+			switch {
+			case *stats.Discrimination < 0:
+				stats.Flags = append(stats.Flags, "negative_discrimination")
+			case *stats.Discrimination < lowDiscrimination:
+				stats.Flags = append(stats.Flags, "low_discrimination")
+			}
+		}
+	}
+	if len(item.responses) > 0 && len(scores) < len(item.responses) {
+		stats.Flags = append(stats.Flags, "grading_pending")
+	}
+
+	if q.QuestionType == "DESCRIPTIVE" {
+		return stats
+	}
+	for _, opt := range q.Options {
+		option := DistractorStatistics{OptionID: opt.OptionID, OptionText: opt.OptionText, IsCorrect: opt.IsCorrect}
+		var chooserTotals []float64
+		for _, r := range item.responses {
+			if r.answered && r.position == opt.OptionID {
+				chooserTotals = append(chooserTotals, r.total)
+			}
+		}
+		option.Chosen = len(chooserTotals)
+		if stats.Served > 0 {
+			option.Proportion = float64(option.Chosen) / float64(stats.Served)
+		}
+		if len(chooserTotals) > 0 {
+			m := mean(chooserTotals)
+			option.MeanScore = &m
+		}
+		stats.Options = append(stats.Options, option)
+
+		if !opt.IsCorrect && stats.Served > 0 && option.Proportion < nonFunctioningDistract {
+			stats.Flags = append(stats.Flags, "non_functioning_distractor")
+		}
+		if !opt.IsCorrect && stats.DifficultyIndex != nil && option.Proportion > *stats.DifficultyIndex {
+			stats.Flags = append(stats.Flags, "distractor_beats_key")
+		}
+	}
+	stats.Flags = dedupe(stats.Flags)
+	return stats
+}
+
+func suggestedDifficulty(p float64) string {
+	switch {
+	case p >= easyItemIndex:
+		return "easy"
+	case p < hardItemIndex:
+		return "hard"
+	default:
+		return "medium"
+	}
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance is the population variance
+func variance(values []float64) float64 {
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values))
+}
+
+// pointBiserial correlates item scores with total scores. It is nil when
+// either does not vary.
+func pointBiserial(scores, totals []float64) *float64 {
+	if len(scores) < 2 {
+		return nil
+	}
+	sx, sy := math.Sqrt(variance(scores)), math.Sqrt(variance(totals))
+	if sx == 0 || sy == 0 {
+		return nil
+	}
+	mx, my := mean(scores), mean(totals)
+	cov := 0.0
+	for i := range scores {
+		cov += (scores[i] - mx) * (totals[i] - my)
+	}
+	r := cov / float64(len(scores)) / (sx * sy)
+	return &r
+}
+
+// kr20 is the Kuder-Richardson 20 reliability of the objective items:
+// k/(k-1) * (1 - sum(p*q) / variance of the number correct)
+func kr20(sets []string, scores []map[uint]float64, items []ItemStatistics) *float64 {
+	if len(sets) < 2 {
+		return nil
+	}
+	for _, set := range sets[1:] {
+		if set != sets[0] {
+			return nil
+		}
+	}
+
+	var k int
+	sumPQ := 0.0
+	for _, item := range items {
+		if item.QuestionType == "DESCRIPTIVE" || item.DifficultyIndex == nil {
+			continue
+		}
+		p := *item.DifficultyIndex
+		sumPQ += p * (1 - p)
+		k++
+	}
+	if k < 2 {
+		return nil
+	}
+
+	totals := make([]float64, len(scores))
+	for i, attempt := range scores {
+		for _, score := range attempt {
+			totals[i] += score
+		}
+	}
+	v := variance(totals)
+	if v == 0 {
+		return nil
+	}
+	r := float64(k) / float64(k-1) * (1 - sumPQ/v)
+	return &r
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ApplySuggestedDifficulty sets the difficulty of every question of the test
+// that was served to at least minServed students to the one its difficulty
+// index suggests. Each change is recorded as a new question revision.
+func (s *ItemAnalysisService) ApplySuggestedDifficulty(testID uint, minServed int, editorID *uint) ([]DifficultyChange, error) {
+	analysis, err := s.AnalyzeTest(testID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []DifficultyChange{}
+	for _, item := range analysis.Items {
+		if item.Served < minServed || item.DifficultyIndex == nil || item.SuggestedDifficulty == "" {
+			continue
+		}
+		var question models.Question
+		if err := s.DB.First(&question, item.QuestionID).Error; err != nil {
+			continue // Deleted since it was served
+		}
+		if strings.EqualFold(question.Difficulty, item.SuggestedDifficulty) {
+			continue
+		}
+
+		if _, err := EnsureQuestionRevision(s.DB, question.ID); err != nil {
+			return nil, err
+		}
+		if err := s.DB.Model(&question).Update("difficulty", item.SuggestedDifficulty).Error; err != nil {
+			return nil, err
+		}
+		if _, err := RecordQuestionRevision(s.DB, question.ID, editorID); err != nil {
+			return nil, err
+		}
+		changes = append(changes, DifficultyChange{
+			QuestionID: question.ID,
+			From:       question.Difficulty,
+			To:         item.SuggestedDifficulty,
+			Index:      *item.DifficultyIndex,
+		})
+	}
+	return changes, nil
+}
@@ -0,0 +1,11 @@
+package services
+
+import "context"
+
+type ItemAnalysisServiceInterface interface {
+	WithContext(ctx context.Context) ItemAnalysisServiceInterface
+	AnalyzeTest(testID uint) (*ItemAnalysis, error)
+	ApplySuggestedDifficulty(testID uint, minServed int, editorID *uint) ([]DifficultyChange, error)
+}
+
+var _ ItemAnalysisServiceInterface = &ItemAnalysisService{}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/config"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	loginAttemptsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_attempts_total",
+			Help: "Password logins by result: success, failure, throttled or locked",
+		},
+		[]string{"result"},
+	)
+
+	loginLockoutsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_lockouts_total",
+			Help: "Accounts and IPs locked after too many failed logins",
+		},
+		[]string{"scope"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(loginAttemptsTotal, loginLockoutsTotal)
+}
+
+// LockScope is what failed logins are counted against
+type LockScope string
+
+const (
+	LockAccount LockScope = "account"
+	LockIP      LockScope = "ip"
+	LockReset   LockScope = "reset" // Password reset requests of an account
+)
+
+// ThrottledError refuses a login attempt that comes too soon after failures
+type ThrottledError struct {
+	Scope      LockScope
+	Locked     bool // Locked out, rather than waiting out a delay
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Scope == LockReset {
+		return fmt.Sprintf("too many password reset requests; try again in %s", e.RetryAfter.Round(time.Second))
+	}
+	if e.Locked {
+		return fmt.Sprintf("too many failed logins; locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins; try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuardService slows down and then locks out repeated failed logins for an
+// account and for an IP. An attempt is counted as failed when it starts and
+// only uncounted when it succeeds, so parallel attempts cannot all slip in
+// before the first failure is recorded. A throttled or locked IP holds back
+// every attempt from it, so guessing one password for many accounts is
+// stopped too; logins that succeed take their own failures off the IP, so
+// the users of a campus NAT do not add up to a lockout.
+//
+// Keys, for each scope and id (normalized email, IP, or IP and email):
+//
+//	login_failures:<scope>:<id> failures in the current window
+//	login_wait:<scope>:<id>     present while the next attempt must wait
+//	login_lock:<scope>:<id>     present while locked out
+//
+// Password reset requests are counted per account under the reset scope.
+type LoginGuardService struct {
+	Redis  *redis.Client
+	Config config.LoginGuardConfig
+}
+
+func NewLoginGuardService(rdb *redis.Client, cfg config.LoginGuardConfig) *LoginGuardService {
+	return &LoginGuardService{Redis: rdb, Config: cfg}
+}
+
+// lockPair counts the failures of one account from one IP
+const lockPair LockScope = "pair"
+
+func guardKey(kind string, scope LockScope, id string) string {
+	return "login_" + kind + ":" + string(scope) + ":" + id
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// guardKeys are the keys of an attempt, in the order the scripts use them
+func guardKeys(email, ip string) []string {
+	account := normalizeEmail(email)
+	return []string{
+		guardKey("failures", LockAccount, account),
+		guardKey("wait", LockAccount, account),
+		guardKey("lock", LockAccount, account),
+		guardKey("failures", LockIP, ip),
+		guardKey("wait", LockIP, ip),
+		guardKey("lock", LockIP, ip),
+		guardKey("failures", lockPair, ip+":"+account),
+	}
+}
+
+// attemptScript refuses an attempt while the account or the IP must wait or
+// is locked, returning the PTTLs of the account lock and wait and the IP
+// lock and wait. Otherwise it counts the attempt as failed against both and
+// the pair, sets the delays or lockouts that follow, and returns whether the
+// account and the IP were locked.
+var attemptScript = redis.NewScript(`
+local refused = {redis.call('PTTL', KEYS[3]), redis.call('PTTL', KEYS[2]), redis.call('PTTL', KEYS[6]), redis.call('PTTL', KEYS[5])}
+for _, ttl in ipairs(refused) do
+	if ttl > 0 then
+		return refused
+	end
+end
+
+local window, maxDelay, lockout = tonumber(ARGV[1]), tonumber(ARGV[6]), tonumber(ARGV[7])
+-- The window starts at the first failure; INCR keeps the expiry
+local function count(failures, wait, lock, free, lockoutAt)
+	redis.call('SET', failures, 0, 'PX', window, 'NX')
+	local n = redis.call('INCR', failures)
+	if n >= lockoutAt then
+		redis.call('SET', lock, n, 'PX', lockout)
+		return 1
+	end
+	if n >= free then
+		-- The delay doubles from one second with each failure past the free ones
+		redis.call('SET', wait, n, 'PX', math.min(1000 * 2 ^ (n - free), maxDelay))
+	end
+	return 0
+end
+local accountLocked = count(KEYS[1], KEYS[2], KEYS[3], tonumber(ARGV[2]), tonumber(ARGV[3]))
+local ipLocked = count(KEYS[4], KEYS[5], KEYS[6], tonumber(ARGV[4]), tonumber(ARGV[5]))
+redis.call('SET', KEYS[7], 0, 'PX', window, 'NX')
+redis.call('INCR', KEYS[7])
+return {accountLocked, ipLocked}
+`)
+
+// releaseScript takes the failures of the pair off the IP. With ARGV[1] set
+// only the latest attempt is released and the account keeps its count;
+// otherwise every failure of the account is forgotten.
+var releaseScript = redis.NewScript(`
+local release = tonumber(redis.call('GET', KEYS[7]) or '0')
+if ARGV[1] == '1' then
+	release = math.min(release, 1)
+	if release > 0 then
+		redis.call('DECR', KEYS[7])
+	end
+else
+	redis.call('DEL', KEYS[1], KEYS[7])
+end
+redis.call('DEL', KEYS[2], KEYS[3])
+local ip = tonumber(redis.call('GET', KEYS[4]) or '0')
+if release > 0 and ip > 0 then
+	redis.call('DECRBY', KEYS[4], math.min(release, ip))
+end
+return release
+`)
+
+// Attempt starts a login attempt, counting it as failed until Succeeded or
+// Passed says otherwise. An account or IP that is locked or still has to
+// wait is refused with a *ThrottledError. Unknown emails are throttled like
+// real ones, so throttling does not tell which accounts exist.
+func (g *LoginGuardService) Attempt(ctx context.Context, email, ip string) error {
+	result, err := attemptScript.Run(ctx, g.Redis, guardKeys(email, ip),
+		g.Config.Window.Milliseconds(),
+		g.Config.AccountFree, g.Config.AccountLockout,
+		g.Config.IPFree, g.Config.IPLockout,
+		g.Config.MaxDelay.Milliseconds(), g.Config.LockoutDuration.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return err
+	}
+
+	// A started attempt gets whether it locked the account and the IP back;
+	// a refused one the four PTTLs
+	if len(result) == 2 {
+		if result[0] == 1 {
+			loginLockoutsTotal.WithLabelValues(string(LockAccount)).Inc()
+		}
+		if result[1] == 1 {
+			loginLockoutsTotal.WithLabelValues(string(LockIP)).Inc()
+		}
+		return nil
+	}
+
+	var refused *ThrottledError
+	candidates := []*ThrottledError{
+		{Scope: LockAccount, Locked: true, RetryAfter: time.Duration(result[0]) * time.Millisecond},
+		{Scope: LockAccount, RetryAfter: time.Duration(result[1]) * time.Millisecond},
+		{Scope: LockIP, Locked: true, RetryAfter: time.Duration(result[2]) * time.Millisecond},
+		{Scope: LockIP, RetryAfter: time.Duration(result[3]) * time.Millisecond},
+	}
+	for _, candidate := range candidates {
+		// A lockout outranks a delay; otherwise the longer wait wins
+		if candidate.RetryAfter > 0 && (refused == nil || candidate.Locked && !refused.Locked ||
+			candidate.Locked == refused.Locked && candidate.RetryAfter > refused.RetryAfter) {
+			refused = candidate
+		}
+	}
+	outcome := "throttled"
+	if refused.Locked {
+		outcome = "locked"
+	}
+	loginAttemptsTotal.WithLabelValues(outcome).Inc()
+	return refused
+}
+
+// Failed records that an attempt was wrong. It was counted when it started,
+// so only the metrics change.
+func (g *LoginGuardService) Failed() {
+	loginAttemptsTotal.WithLabelValues("failure").Inc()
+}
+
+// Passed lifts the delay or lockout an attempt with the right password set,
+// while a second factor is still due. The failure stays counted against the
+// account, so wrong codes keep adding to the failed passwords before them.
+func (g *LoginGuardService) Passed(ctx context.Context, email, ip string) error {
+	return releaseScript.Run(ctx, g.Redis, guardKeys(email, ip), 1).Err()
+}
+
+// Succeeded forgets the account's failures once it has logged in, and takes
+// its failures from this IP off the IP's count. The IP's other failures
+// stay: one good login must not clear a stuffing attack.
+func (g *LoginGuardService) Succeeded(ctx context.Context, email, ip string) error {
+	loginAttemptsTotal.WithLabelValues("success").Inc()
+	return releaseScript.Run(ctx, g.Redis, guardKeys(email, ip), 0).Err()
+}
+
+// resetScript counts a reset request of KEYS[1] in a window of ARGV[1]
+// milliseconds, returning 0 while at most ARGV[2] were made and otherwise
+// the PTTL of the window
+var resetScript = redis.NewScript(`
+redis.call('SET', KEYS[1], 0, 'PX', ARGV[1], 'NX')
+if redis.call('INCR', KEYS[1]) <= tonumber(ARGV[2]) then
+	return 0
+end
+return redis.call('PTTL', KEYS[1])
+`)
+
+// ResetRequested counts a password reset request for an account, refusing it
+// with a *ThrottledError past ResetsPerAccount in the window. Unknown emails
+// are counted like real ones.
+func (g *LoginGuardService) ResetRequested(ctx context.Context, email string) error {
+	wait, err := resetScript.Run(ctx, g.Redis, []string{guardKey("failures", LockReset, normalizeEmail(email))},
+		g.Config.Window.Milliseconds(), g.Config.ResetsPerAccount,
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &ThrottledError{Scope: LockReset, RetryAfter: time.Duration(wait) * time.Millisecond}
+	}
+	return nil
+}
+
+// Unlock clears the failures, delay and lockout of an account (by email) or
+// an IP
+func (g *LoginGuardService) Unlock(ctx context.Context, scope LockScope, id string) error {
+	if scope == LockAccount {
+		id = normalizeEmail(id)
+	} else if scope != LockIP {
+		return errors.New("unknown lock scope")
+	}
+	return g.Redis.Del(ctx,
+		guardKey("failures", scope, id),
+		guardKey("wait", scope, id),
+		guardKey("lock", scope, id),
+	).Err()
+}
@@ -0,0 +1,14 @@
+package services
+
+import "context"
+
+type LoginGuardServiceInterface interface {
+	Attempt(ctx context.Context, email, ip string) error
+	Failed()
+	Passed(ctx context.Context, email, ip string) error
+	Succeeded(ctx context.Context, email, ip string) error
+	ResetRequested(ctx context.Context, email string) error
+	Unlock(ctx context.Context, scope LockScope, id string) error
+}
+
+var _ LoginGuardServiceInterface = &LoginGuardService{}
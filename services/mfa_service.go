@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"pathshala/config"
+	"pathshala/models"
+	"pathshala/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMFAInvalidCode      = errors.New("invalid authentication code")
+	ErrMFANotEnrolled      = errors.New("MFA is not set up")
+	ErrMFAAlreadyEnabled   = errors.New("MFA is already enabled")
+	ErrMFARequired         = errors.New("MFA is mandatory for this role")
+	ErrMFAChallengeInvalid = errors.New("login challenge is invalid or has expired")
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes a user holds at a time
+	RecoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes end a login challenge
+	maxChallengeAttempts = 5
+)
+
+type MFAService struct {
+	DB            *gorm.DB
+	Redis         *redis.Client
+	Secrets       *utils.SecretBox
+	Issuer        string
+	RequiredRoles map[string]bool
+	ChallengeTTL  time.Duration
+	Now           func() time.Time
+}
+
+func NewMFAService(db *gorm.DB, rdb *redis.Client, cfg config.MFAConfig) (*MFAService, error) {
+	secrets, err := utils.NewSecretBox(cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	required := make(map[string]bool, len(cfg.RequiredRoles))
+	for _, role := range cfg.RequiredRoles {
+		required[role] = true
+	}
+	return &MFAService{
+		DB:            db,
+		Redis:         rdb,
+		Secrets:       secrets,
+		Issuer:        cfg.Issuer,
+		RequiredRoles: required,
+		ChallengeTTL:  cfg.ChallengeTTL,
+		Now:           time.Now,
+	}, nil
+}
+
+// MFAStatus is what a user sees of their own MFA setup
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"` // Their role cannot log in without it
+	ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// MFAEnrollment is a new secret for the user to add to an authenticator,
+// typically by scanning the provisioning URI as a QR code
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAChallenge is the result of a correct password for a user who needs a
+// second factor. The token stands in for the password in the second step.
+type MFAChallenge struct {
+	Token              string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"` // MFA is mandatory but not set up yet
+	ExpiresIn          int    `json:"expires_in"`          // Seconds
+}
+
+// Required reports whether the user's role makes MFA mandatory
+func (s *MFAService) Required(user *models.User) bool {
+	return s.RequiredRoles[user.Role]
+}
+
+func (s *MFAService) findMFA(db *gorm.DB, userID uint) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	if err := db.First(&mfa, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (s *MFAService) enabled(userID uint) (bool, error) {
+	mfa, err := s.findMFA(s.DB, userID)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mfa.Enabled, nil
+}
+
+func (s *MFAService) Status(user *models.User) (*MFAStatus, error) {
+	status := &MFAStatus{Required: s.Required(user)}
+	mfa, err := s.findMFA(s.DB, user.ID)
+	if errors.Is(err, ErrMFANotEnrolled) || (err == nil && !mfa.Enabled) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = true
+	status.ConfirmedAt = mfa.ConfirmedAt
+	if err := s.DB.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesLeft).Error; err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// BeginEnrollment gives the user a new secret. It protects logins once
+// ConfirmEnrollment sees a code from it; until then the previous state holds.
+func (s *MFAService) BeginEnrollment(user *models.User) (*MFAEnrollment, error) {
+	if enabled, err := s.enabled(user.ID); err != nil || enabled {
+		if err == nil {
+			err = ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.Secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Save(&models.UserMFA{UserID: user.ID, Secret: sealed}).Error; err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{Secret: secret, ProvisioningURI: utils.TOTPProvisioningURI(s.Issuer, user.Email, secret)}, nil
+}
+
+// ConfirmEnrollment turns MFA on with a first code from the new secret and
+// returns the recovery codes, which are shown this once
+func (s *MFAService) ConfirmEnrollment(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		mfa, err := s.findMFA(tx, userID)
+		if err != nil {
+			return err
+		}
+		if mfa.Enabled {
+			return ErrMFAAlreadyEnabled
+		}
+		if err := s.useTOTP(tx, mfa, code); err != nil {
+			return err
+		}
+		now := s.Now()
+		if err := tx.Model(mfa).Updates(map[string]interface{}{"enabled": true, "confirmed_at": now}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Verify checks a TOTP code or an unused recovery code. Each code is
+// accepted once.
+func (s *MFAService) Verify(userID uint, code string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		mfa, err := s.findMFA(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !mfa.Enabled {
+			return ErrMFANotEnrolled
+		}
+		if isTOTPCode(code) {
+			return s.useTOTP(tx, mfa, code)
+		}
+		return s.useRecoveryCode(tx, userID, code)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a code
+func (s *MFAService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := s.Verify(userID, code); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable turns MFA off after checking a code, unless the role requires it
+func (s *MFAService) Disable(user *models.User, code string) error {
+	if s.Required(user) {
+		return ErrMFARequired
+	}
+	if err := s.Verify(user.ID, code); err != nil {
+		return err
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.UserMFA{}).Error
+	})
+}
+
+// useTOTP accepts a code of the user's secret from a later time step than
+// any code accepted before
+func (s *MFAService) useTOTP(tx *gorm.DB, mfa *models.UserMFA, code string) error {
+	secret, err := s.Secrets.Open(mfa.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, s.Now())
+	if !ok || step <= mfa.LastUsedStep {
+		return ErrMFAInvalidCode
+	}
+	// The condition keeps two concurrent logins from both using the code
+	result := tx.Model(&models.UserMFA{}).Where("user_id = ? AND last_used_step < ?", mfa.UserID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAInvalidCode
+	}
+	return nil
+}
+
+func (s *MFAService) useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	result := tx.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", s.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAInvalidCode
+	}
+	return nil
+}
+
+func isTOTPCode(code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	_, err := strconv.Atoi(code)
+	return err == nil && len(code) == utils.TOTPDigits
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// replaceRecoveryCodes issues a new set of codes like "k3j9x-p2qmd"
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	rows := make([]models.MFARecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = models.MFARecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(codes[i])}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, which users retype freely
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginNeedsMFA reports whether a correct password is not enough for user
+func (s *MFAService) LoginNeedsMFA(user *models.User) (bool, error) {
+	if s.Required(user) {
+		return true, nil
+	}
+	return s.enabled(user.ID)
+}
+
+func challengeKey(token string) string {
+	return "mfa_challenge:" + token
+}
+
+// StartChallenge records a correct password in Redis and returns the token
+// the second login step presents
+func (s *MFAService) StartChallenge(ctx context.Context, user *models.User) (*MFAChallenge, error) {
+	enabled, err := s.enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(raw)
+
+	key := challengeKey(token)
+	if _, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", user.ID, "attempts", 0)
+		pipe.Expire(ctx, key, s.ChallengeTTL)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{Token: token, EnrollmentRequired: !enabled, ExpiresIn: int(s.ChallengeTTL / time.Second)}, nil
+}
+
+// ChallengeUser returns the user a login challenge is for
+func (s *MFAService) ChallengeUser(ctx context.Context, token string) (*models.User, error) {
+	id, err := s.Redis.HGet(ctx, challengeKey(token), "user_id").Uint64()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMFAChallengeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := s.DB.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFAChallengeInvalid
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ChallengeEnrollment starts enrollment for a user whose role requires MFA
+// but who has not set it up, on the strength of their login challenge
+func (s *MFAService) ChallengeEnrollment(ctx context.Context, token string) (*MFAEnrollment, error) {
+	user, err := s.ChallengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginEnrollment(user)
+}
+
+// CompleteChallenge checks the code of the second login step and returns
+// the user to issue tokens for. When the challenge was finishing enrollment
+// the new recovery codes are returned too. Wrong codes count against the
+// challenge, which ends after maxChallengeAttempts.
+func (s *MFAService) CompleteChallenge(ctx context.Context, token, code string) (*models.User, []string, error) {
+	user, err := s.ChallengeUser(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recoveryCodes []string
+	enabled, err := s.enabled(user.ID)
+	if err == nil && enabled {
+		err = s.Verify(user.ID, code)
+	} else if err == nil {
+		recoveryCodes, err = s.ConfirmEnrollment(user.ID, code)
+	}
+
+	key := challengeKey(token)
+	if errors.Is(err, ErrMFAInvalidCode) {
+		attempts, incrErr := s.Redis.HIncrBy(ctx, key, "attempts", 1).Result()
+		if incrErr == nil && attempts >= maxChallengeAttempts {
+			s.Redis.Del(ctx, key)
+		}
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A challenge logs in once; deleting it is what makes that so
+	deleted, err := s.Redis.Del(ctx, key).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	if deleted == 0 {
+		return nil, nil, ErrMFAChallengeInvalid
+	}
+	return user, recoveryCodes, nil
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type MFAServiceInterface interface {
+	Required(user *models.User) bool
+	Status(user *models.User) (*MFAStatus, error)
+	BeginEnrollment(user *models.User) (*MFAEnrollment, error)
+	ConfirmEnrollment(userID uint, code string) ([]string, error)
+	Verify(userID uint, code string) error
+	RegenerateRecoveryCodes(userID uint, code string) ([]string, error)
+	Disable(user *models.User, code string) error
+	LoginNeedsMFA(user *models.User) (bool, error)
+	StartChallenge(ctx context.Context, user *models.User) (*MFAChallenge, error)
+	ChallengeUser(ctx context.Context, token string) (*models.User, error)
+	ChallengeEnrollment(ctx context.Context, token string) (*MFAEnrollment, error)
+	CompleteChallenge(ctx context.Context, token, code string) (*models.User, []string, error)
+}
+
+var _ MFAServiceInterface = &MFAService{}
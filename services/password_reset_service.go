@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"pathshala/models"
+	"pathshala/utils"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrResetUnknownEmail = errors.New("no account uses this email")
+	ErrResetTokenInvalid = errors.New("reset link is invalid or has expired")
+)
+
+// PasswordResetService issues the single-use tokens of password reset
+// links. Only a hash of each token is kept in Redis, so reading Redis does
+// not give out working links; a user has at most one working link.
+//
+// Keys:
+//
+//	password_reset:<sha256 of token> user id, expiring with the link
+//	password_reset_user:<userID>     hash of the user's current link
+type PasswordResetService struct {
+	DB       *gorm.DB
+	Redis    *redis.Client
+	Sessions SessionServiceInterface
+	TTL      time.Duration
+}
+
+func NewPasswordResetService(db *gorm.DB, rdb *redis.Client, sessions SessionServiceInterface, ttl time.Duration) *PasswordResetService {
+	return &PasswordResetService{DB: db, Redis: rdb, Sessions: sessions, TTL: ttl}
+}
+
+// replaceResetScript makes KEYS[2] the user's link in one step, dropping the
+// link KEYS[1] pointed to, so that of concurrent requests only the link set
+// last works. ARGV: user id, TTL in milliseconds, hash of the new link and
+// the prefix of link keys.
+var replaceResetScript = redis.NewScript(`
+local previous = redis.call('GET', KEYS[1])
+if previous then
+	redis.call('DEL', ARGV[4] .. previous)
+end
+redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[2])
+redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[2])
+return 1
+`)
+
+func resetKey(hash string) string {
+	return "password_reset:" + hash
+}
+
+func resetUserKey(userID uint) string {
+	return "password_reset_user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken returns a reset token for the account with email, replacing
+// any earlier one. Callers must answer ErrResetUnknownEmail the same way as
+// success, or the endpoint tells who has an account.
+func (s *PasswordResetService) CreateToken(ctx context.Context, email string) (*models.User, string, error) {
+	var user models.User
+	if err := s.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrResetUnknownEmail
+		}
+		return nil, "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	hash := hashResetToken(token)
+
+	err := replaceResetScript.Run(ctx, s.Redis, []string{resetUserKey(user.ID), resetKey(hash)},
+		user.ID, s.TTL.Milliseconds(), hash, resetKey(""),
+	).Err()
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, token, nil
+}
+
+// Reset sets a new password with a reset token, which is used up whether or
+// not the rest succeeds. Every session of the user is ended, since whoever
+// knew the old password may hold one. Invited users become active.
+func (s *PasswordResetService) Reset(ctx context.Context, token, password string) error {
+	hash := hashResetToken(token)
+	id, err := s.Redis.GetDel(ctx, resetKey(hash)).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	userID := uint(id)
+
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	var user models.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResetTokenInvalid
+		}
+		return err
+	}
+	updates := map[string]interface{}{"password": hashed}
+	if user.Status == utils.StatusInvited {
+		// Setting a first password is how invited users accept
+		updates["status"] = utils.StatusActive
+	}
+	if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := utils.InvalidateUserCache(ctx, s.Redis, userID); err != nil {
+		return err
+	}
+
+	if err := s.Redis.Del(ctx, resetUserKey(userID)).Err(); err != nil {
+		return err
+	}
+	return s.Sessions.RevokeAll(ctx, userID)
+}
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type PasswordResetServiceInterface interface {
+	CreateToken(ctx context.Context, email string) (*models.User, string, error)
+	Reset(ctx context.Context, token, password string) error
+}
+
+var _ PasswordResetServiceInterface = &PasswordResetService{}
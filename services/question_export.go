@@ -0,0 +1,474 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"pathshala/models"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ExportQTI    = "qti"
+	ExportMoodle = "moodle"
+	ExportGIFT   = "gift"
+)
+
+var (
+	ErrExportScope = errors.New("one of category_id, macro_category_id or test_id is required")
+	ErrExportImage = errors.New("question image could not be read")
+)
+
+// ExportScope selects the questions of a category, a macro-category or a test
+type ExportScope struct {
+	CategoryID      uint
+	MacroCategoryID uint
+	TestID          uint
+}
+
+// ImageReader reads a stored question image by its storage key
+type ImageReader func(key string) ([]byte, error)
+
+// ReadQuestionImage reads an image of a question for an export. An image that
+// cannot be read fails the export rather than leaving it pointing at nothing.
+func ReadQuestionImage(readImage ImageReader, q models.Question, key string) ([]byte, error) {
+	data, err := readImage(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s of question %d: %v", ErrExportImage, key, q.ID, err)
+	}
+	return data, nil
+}
+
+// LoadExportQuestions loads the questions of a scope with their options and category
+func LoadExportQuestions(db *gorm.DB, scope ExportScope) ([]models.Question, error) {
+	query := db.Preload("Category").Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("option_id")
+	})
+
+	switch {
+	case scope.TestID != 0:
+		query = query.Joins("JOIN test_questions ON test_questions.question_id = questions.id").
+			Where("test_questions.test_id = ?", scope.TestID).
+			Order("test_questions.id")
+	case scope.MacroCategoryID != 0:
+		query = query.Joins("JOIN categories ON categories.id = questions.category_id").
+			Where("categories.macro_category_id = ?", scope.MacroCategoryID).
+			Order("questions.category_id, questions.id")
+	case scope.CategoryID != 0:
+		query = query.Where("questions.category_id = ?", scope.CategoryID).Order("questions.id")
+	default:
+		return nil, ErrExportScope
+	}
+
+	var questions []models.Question
+	err := query.Find(&questions).Error
+	return questions, err
+}
+
+// correctPosition is the 1-based position of the correct option of an
+// objective question, or 0 when none is marked
+func correctPosition(q models.Question) int {
+	for i, opt := range q.Options {
+		if opt.IsCorrect {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// modelAnswer is the text of the only option of a descriptive question
+func modelAnswer(q models.Question) string {
+	if len(q.Options) == 0 {
+		return ""
+	}
+	return q.Options[0].OptionText
+}
+
+func questionImages(q models.Question) []string {
+	var images []string
+	for _, image := range []string{q.Image1, q.Image2} {
+		if image != "" {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// ---------------- Moodle XML ----------------
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+type moodleText struct {
+	Format string       `xml:"format,attr,omitempty"`
+	Text   string       `xml:"text"`
+	Files  []moodleFile `xml:"file,omitempty"`
+}
+
+type moodleFile struct {
+	Name     string `xml:"name,attr"`
+	Path     string `xml:"path,attr"`
+	Encoding string `xml:"encoding,attr"`
+	Data     string `xml:",chardata"`
+}
+
+type moodleAnswer struct {
+	Fraction string `xml:"fraction,attr"`
+	Format   string `xml:"format,attr,omitempty"`
+	Text     string `xml:"text"`
+}
+
+type moodleTags struct {
+	Tags []moodleText `xml:"tag"`
+}
+
+type moodleQuestion struct {
+	Type            string         `xml:"type,attr"`
+	Category        *moodleText    `xml:"category,omitempty"`
+	Name            *moodleText    `xml:"name,omitempty"`
+	QuestionText    *moodleText    `xml:"questiontext,omitempty"`
+	GeneralFeedback *moodleText    `xml:"generalfeedback,omitempty"`
+	DefaultGrade    string         `xml:"defaultgrade,omitempty"`
+	Single          string         `xml:"single,omitempty"`
+	ShuffleAnswers  string         `xml:"shuffleanswers,omitempty"`
+	AnswerNumbering string         `xml:"answernumbering,omitempty"`
+	ResponseFormat  string         `xml:"responseformat,omitempty"`
+	GraderInfo      *moodleText    `xml:"graderinfo,omitempty"`
+	Answers         []moodleAnswer `xml:"answer"`
+	Tags            *moodleTags    `xml:"tags,omitempty"`
+}
+
+// WriteMoodleXML exports questions as a Moodle XML quiz. Images are embedded
+// in the question text; Pathshala fields Moodle has no place for are tags.
+func WriteMoodleXML(w io.Writer, questions []models.Question, readImage ImageReader) error {
+	var quiz moodleQuiz
+	lastCategory := uint(0)
+	for _, q := range questions {
+		if q.CategoryID != lastCategory {
+			lastCategory = q.CategoryID
+			quiz.Questions = append(quiz.Questions, moodleQuestion{
+				Type:     "category",
+				Category: &moodleText{Text: "$course$/top/" + q.Category.Name},
+			})
+		}
+
+		text := &moodleText{Format: "html", Text: "<p>" + html.EscapeString(q.QuestionText) + "</p>"}
+		for _, image := range questionImages(q) {
+			data, err := ReadQuestionImage(readImage, q, image)
+			if err != nil {
+				return err
+			}
+			name := path.Base(image)
+			text.Text += `<p><img src="@@PLUGINFILE@@/` + html.EscapeString(name) + `" alt=""></p>`
+			text.Files = append(text.Files, moodleFile{Name: name, Path: "/", Encoding: "base64", Data: base64.StdEncoding.EncodeToString(data)})
+		}
+
+		mq := moodleQuestion{
+			Name:            &moodleText{Text: fmt.Sprintf("Q%d", q.ID)},
+			QuestionText:    text,
+			GeneralFeedback: &moodleText{Format: "html", Text: html.EscapeString(q.Comment)},
+			DefaultGrade:    "1",
+			Tags:            &moodleTags{},
+		}
+		switch q.QuestionType {
+		case "MCQ":
+			mq.Type = "multichoice"
+			mq.Single = "true"
+			mq.ShuffleAnswers = "true"
+			mq.AnswerNumbering = "abc"
+			correct := correctPosition(q)
+			for i, opt := range q.Options {
+				fraction := "0"
+				if i+1 == correct {
+					fraction = "100"
+				}
+				mq.Answers = append(mq.Answers, moodleAnswer{Fraction: fraction, Format: "html", Text: html.EscapeString(opt.OptionText)})
+			}
+		case "TRUE_FALSE":
+			mq.Type = "truefalse"
+			trueFraction, falseFraction := "100", "0"
+			if correctPosition(q) == 2 {
+				trueFraction, falseFraction = "0", "100"
+			}
+			mq.Answers = []moodleAnswer{{Fraction: trueFraction, Text: "true"}, {Fraction: falseFraction, Text: "false"}}
+		case "DESCRIPTIVE":
+			mq.Type = "essay"
+			mq.ResponseFormat = "editor"
+			mq.GraderInfo = &moodleText{Format: "html", Text: html.EscapeString(modelAnswer(q))}
+		default:
+			continue
+		}
+
+		for _, tag := range exportTags(q) {
+			mq.Tags.Tags = append(mq.Tags.Tags, moodleText{Text: tag})
+		}
+		quiz.Questions = append(quiz.Questions, mq)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(quiz)
+}
+
+// exportTags carries the Pathshala fields other formats have no place for as key:value pairs
+func exportTags(q models.Question) []string {
+	tags := []string{
+		"difficulty:" + strings.ToLower(q.Difficulty),
+		fmt.Sprintf("category_id:%d", q.CategoryID),
+	}
+	if q.Image1 != "" && q.Image1DisplayTime != nil {
+		tags = append(tags, fmt.Sprintf("image1_display_time:%d", *q.Image1DisplayTime))
+	}
+	if q.Image2 != "" && q.Image2DisplayTime != nil {
+		tags = append(tags, fmt.Sprintf("image2_display_time:%d", *q.Image2DisplayTime))
+	}
+	if q.CommentDisplayTime != nil {
+		tags = append(tags, fmt.Sprintf("comment_display_time:%d", *q.CommentDisplayTime))
+	}
+	return tags
+}
+
+// ---------------- GIFT ----------------
+
+// WriteGIFT exports questions in Moodle's GIFT text format. GIFT cannot hold
+// images, so they are named in metadata comments and travel in a zip.
+func WriteGIFT(w io.Writer, questions []models.Question) error {
+	var b strings.Builder
+	lastCategory := uint(0)
+	for _, q := range questions {
+		if q.CategoryID != lastCategory {
+			lastCategory = q.CategoryID
+			fmt.Fprintf(&b, "$CATEGORY: $course$/top/%s\n\n", q.Category.Name)
+		}
+
+		for _, tag := range exportTags(q) {
+			key, value, _ := strings.Cut(tag, ":")
+			fmt.Fprintf(&b, "// %s: %s\n", key, value)
+		}
+		if q.Image1 != "" {
+			fmt.Fprintf(&b, "// image1: %s\n", path.Base(q.Image1))
+		}
+		if q.Image2 != "" {
+			fmt.Fprintf(&b, "// image2: %s\n", path.Base(q.Image2))
+		}
+
+		var answers string
+		switch q.QuestionType {
+		case "MCQ":
+			correct := correctPosition(q)
+			var lines []string
+			for i, opt := range q.Options {
+				mark := "~"
+				if i+1 == correct {
+					mark = "="
+				}
+				lines = append(lines, mark+escapeGIFT(opt.OptionText))
+			}
+			answers = "\n" + strings.Join(lines, "\n") + "\n"
+		case "TRUE_FALSE":
+			answers = "TRUE"
+			if correctPosition(q) == 2 {
+				answers = "FALSE"
+			}
+		case "DESCRIPTIVE":
+			fmt.Fprintf(&b, "// descriptive_answer: %s\n", escapeGIFT(modelAnswer(q)))
+		default:
+			continue
+		}
+		if q.Comment != "" {
+			answers += "####" + escapeGIFT(q.Comment)
+		}
+
+		fmt.Fprintf(&b, "::Q%d::%s{%s}\n\n", q.ID, escapeGIFT(q.QuestionText), answers)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var giftEscaper = strings.NewReplacer(`\`, `\\`, "~", `\~`, "=", `\=`, "#", `\#`, "{", `\{`, "}", `\}`, ":", `\:`, "\n", `\n`)
+
+func escapeGIFT(s string) string {
+	return giftEscaper.Replace(s)
+}
+
+// ---------------- IMS QTI 2.1 ----------------
+
+var qtiFuncs = template.FuncMap{
+	"x":   xmlEscape,
+	"inc": func(i int) int { return i + 1 },
+}
+
+var qtiItemTemplate = template.Must(template.New("item").Funcs(qtiFuncs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="{{.Identifier}}" title="{{.Title}}" adaptive="false" timeDependent="false">
+{{- if .Descriptive}}
+  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string">
+    <correctResponse><value>{{x .ModelAnswer}}</value></correctResponse>
+  </responseDeclaration>
+{{- else}}
+  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier">
+    <correctResponse><value>choice_{{.Correct}}</value></correctResponse>
+  </responseDeclaration>
+{{- end}}
+  <outcomeDeclaration identifier="SCORE" cardinality="single" baseType="float"/>
+  <itemBody>
+    <p>{{x .Text}}</p>
+{{- range .Images}}
+    <p><img src="../images/{{x .}}" alt=""/></p>
+{{- end}}
+{{- if .Descriptive}}
+    <extendedTextInteraction responseIdentifier="RESPONSE"/>
+{{- else}}
+    <choiceInteraction responseIdentifier="RESPONSE" shuffle="false" maxChoices="1">
+{{- range $i, $choice := .Choices}}
+      <simpleChoice identifier="choice_{{inc $i}}">{{x $choice}}</simpleChoice>
+{{- end}}
+    </choiceInteraction>
+{{- end}}
+{{- if .Comment}}
+    <rubricBlock view="candidate"><p>{{x .Comment}}</p></rubricBlock>
+{{- end}}
+  </itemBody>
+{{- if not .Descriptive}}
+  <responseProcessing template="http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"/>
+{{- end}}
+</assessmentItem>
+`))
+
+var qtiManifestTemplate = template.Must(template.New("manifest").Funcs(qtiFuncs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1" xmlns:imsmd="http://ltsc.ieee.org/xsd/LOM" identifier="pathshala_export">
+  <metadata>
+    <schema>QTIv2.1 Package</schema>
+    <schemaversion>1.0.0</schemaversion>
+  </metadata>
+  <organizations/>
+  <resources>
+{{- range .}}
+    <resource identifier="{{.Identifier}}" type="imsqti_item_xmlv2p1" href="{{.Href}}">
+      <metadata>
+        <imsmd:lom>
+          <imsmd:educational>
+            <imsmd:difficulty><imsmd:source>LOMv1.0</imsmd:source><imsmd:value>{{.Difficulty}}</imsmd:value></imsmd:difficulty>
+          </imsmd:educational>
+        </imsmd:lom>
+      </metadata>
+      <file href="{{.Href}}"/>
+{{- range .Images}}
+      <file href="images/{{x .}}"/>
+{{- end}}
+    </resource>
+{{- end}}
+  </resources>
+</manifest>
+`))
+
+type qtiItem struct {
+	Identifier  string
+	Title       string
+	Href        string
+	Difficulty  string // LOM vocabulary: easy, medium, difficult
+	Text        string
+	Images      []string
+	Descriptive bool
+	ModelAnswer string
+	Choices     []string
+	Correct     int
+	Comment     string
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteQTIPackage exports questions as an IMS QTI 2.1 content package: a zip
+// with a manifest, one item per question and the question images.
+func WriteQTIPackage(w io.Writer, questions []models.Question, readImage ImageReader) error {
+	archive := zip.NewWriter(w)
+
+	var items []qtiItem
+	for _, q := range questions {
+		item := qtiItem{
+			Identifier: fmt.Sprintf("item_%d", q.ID),
+			Title:      fmt.Sprintf("Q%d", q.ID),
+			Difficulty: lomDifficulty(q.Difficulty),
+			Text:       q.QuestionText,
+			Comment:    q.Comment,
+		}
+		item.Href = "items/" + item.Identifier + ".xml"
+
+		switch q.QuestionType {
+		case "MCQ", "TRUE_FALSE":
+			for _, opt := range q.Options {
+				item.Choices = append(item.Choices, opt.OptionText)
+			}
+			item.Correct = correctPosition(q)
+		case "DESCRIPTIVE":
+			item.Descriptive = true
+			item.ModelAnswer = modelAnswer(q)
+		default:
+			continue
+		}
+
+		for _, image := range questionImages(q) {
+			data, err := ReadQuestionImage(readImage, q, image)
+			if err != nil {
+				return err
+			}
+			name := path.Base(image)
+			f, err := archive.Create("images/" + name)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+			item.Images = append(item.Images, name)
+		}
+
+		f, err := archive.Create(item.Href)
+		if err != nil {
+			return err
+		}
+		if err := qtiItemTemplate.Execute(f, item); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	f, err := archive.Create("imsmanifest.xml")
+	if err != nil {
+		return err
+	}
+	if err := qtiManifestTemplate.Execute(f, items); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func lomDifficulty(difficulty string) string {
+	switch strings.ToLower(difficulty) {
+	case "easy":
+		return "easy"
+	case "hard":
+		return "difficult"
+	default:
+		return "medium"
+	}
+}
@@ -0,0 +1,560 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"pathshala/models"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidImportFile = errors.New("invalid import file")
+
+// QuestionImportRow is one question of a CSV or JSON import. Images name
+// entries of the zip archive sent along with the file.
+type QuestionImportRow struct {
+	QuestionType      string   `json:"question_type"`
+	QuestionText      string   `json:"question_text"`
+	Difficulty        string   `json:"difficulty"`
+	CategoryID        uint     `json:"category_id"`
+	Options           []string `json:"options"` // MCQ options 1 to 5
+	CorrectOptionID   uint     `json:"correct_option_id"`
+	DescriptiveAnswer string   `json:"descriptive_answer"`
+	Image1            string   `json:"image1"`
+	Image1Time        *int     `json:"image1_display_time"`
+	Image2            string   `json:"image2"`
+	Image2Time        *int     `json:"image2_display_time"`
+	Comment           string   `json:"comment"`
+	CommentTime       *int     `json:"comment_display_time"`
+}
+
+// ImportRowResult is the outcome of one row. Rows are numbered from 1 in the
+// order of the file, not counting the CSV header.
+type ImportRowResult struct {
+	Row        int      `json:"row"`
+	Status     string   `json:"status"` // created, valid (dry run) or error
+	QuestionID uint     `json:"question_id,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Valid   int               `json:"valid"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+const (
+	ImportCreated = "created"
+	ImportValid   = "valid"
+	ImportError   = "error"
+)
+
+// Add counts the outcome of a row into the report
+func (r *ImportReport) Add(result ImportRowResult) {
+	r.Total++
+	switch result.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportValid:
+		r.Valid++
+	default:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+func ParseQuestionJSON(r io.Reader) ([]QuestionImportRow, error) {
+	var rows []QuestionImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	return rows, nil
+}
+
+// ParseQuestionCSV reads questions from a CSV file whose header names the
+// columns, e.g. question_type, question_text, difficulty, category_id,
+// option_1 to option_5, correct_option_id, descriptive_answer, image1,
+// image1_display_time, image2, image2_display_time, comment and
+// comment_display_time. Cells that are not numbers where one is expected are
+// reported as a row error rather than failing the file.
+func ParseQuestionCSV(r io.Reader) ([]QuestionImportRow, [][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: missing header: %v", ErrInvalidImportFile, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	var rows []QuestionImportRow
+	var rowErrors [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+
+		var errs []string
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) *int {
+			value := cell(name)
+			if value == "" {
+				return nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be a number", name))
+				return nil
+			}
+			return &n
+		}
+
+		row := QuestionImportRow{
+			QuestionType:      cell("question_type"),
+			QuestionText:      cell("question_text"),
+			Difficulty:        cell("difficulty"),
+			DescriptiveAnswer: cell("descriptive_answer"),
+			Image1:            cell("image1"),
+			Image1Time:        number("image1_display_time"),
+			Image2:            cell("image2"),
+			Image2Time:        number("image2_display_time"),
+			Comment:           cell("comment"),
+			CommentTime:       number("comment_display_time"),
+		}
+		if n := number("category_id"); n != nil && *n > 0 {
+			row.CategoryID = uint(*n)
+		}
+		if n := number("correct_option_id"); n != nil && *n > 0 {
+			row.CorrectOptionID = uint(*n)
+		}
+		for i := 1; i <= 5; i++ {
+			row.Options = append(row.Options, cell(fmt.Sprintf("option_%d", i)))
+		}
+
+		rows = append(rows, row)
+		rowErrors = append(rowErrors, errs)
+	}
+	return rows, rowErrors, nil
+}
+
+// ImportImage is an image a row refers to, from a zip archive or embedded in the file
+type ImportImage struct {
+	Name string
+	Size uint64
+	open func() (io.ReadCloser, error)
+}
+
+func (i *ImportImage) Open() (io.ReadCloser, error) {
+	return i.open()
+}
+
+// ImageArchive holds the images of an import, by file name
+type ImageArchive map[string]*ImportImage
+
+func ReadImageArchive(r io.ReaderAt, size int64) (ImageArchive, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	images := make(ImageArchive, len(archive.File))
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		images[path.Base(f.Name)] = &ImportImage{Name: path.Base(f.Name), Size: f.UncompressedSize64, open: f.Open}
+	}
+	return images, nil
+}
+
+// AddBytes adds an image whose contents came with the import file itself
+func (a ImageArchive) AddBytes(name string, data []byte) {
+	a[path.Base(name)] = &ImportImage{
+		Name: path.Base(name),
+		Size: uint64(len(data)),
+		open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+	}
+}
+
+// Lookup finds an image by the name a row refers to it with
+func (a ImageArchive) Lookup(name string) (*ImportImage, bool) {
+	f, ok := a[path.Base(strings.TrimSpace(name))]
+	return f, ok
+}
+
+// SaveImportedQuestion stores a validated question with its options
+func SaveImportedQuestion(db *gorm.DB, question *models.Question, options []models.QuestionOption) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(question).Error; err != nil {
+			return err
+		}
+		if len(options) == 0 {
+			return nil
+		}
+		for i := range options {
+			options[i].QuestionID = question.ID
+		}
+		return tx.Create(&options).Error
+	})
+}
+
+// ParseMoodleXML reads the multichoice, truefalse and essay questions of a
+// Moodle XML quiz. Images embedded in the question text are added to images;
+// Pathshala fields are read back from the tags WriteMoodleXML adds.
+func ParseMoodleXML(r io.Reader, images ImageArchive) ([]QuestionImportRow, [][]string, error) {
+	var quiz moodleQuiz
+	if err := xml.NewDecoder(r).Decode(&quiz); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	var rows []QuestionImportRow
+	var rowErrors [][]string
+	for _, mq := range quiz.Questions {
+		if mq.Type == "category" {
+			continue
+		}
+
+		var errs []string
+		row := QuestionImportRow{QuestionType: strings.ToUpper(mq.Type)}
+		if mq.QuestionText != nil {
+			row.QuestionText = htmlToText(mq.QuestionText.Text)
+			for _, f := range mq.QuestionText.Files {
+				data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(f.Data))
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("image %s is not valid base64", f.Name))
+					continue
+				}
+				images.AddBytes(f.Name, data)
+			}
+			imageNames := htmlImages(mq.QuestionText.Text)
+			if len(imageNames) > 0 {
+				row.Image1 = imageNames[0]
+			}
+			if len(imageNames) > 1 {
+				row.Image2 = imageNames[1]
+			}
+		}
+		if mq.GeneralFeedback != nil {
+			row.Comment = htmlToText(mq.GeneralFeedback.Text)
+		}
+
+		switch mq.Type {
+		case "multichoice":
+			row.QuestionType = "MCQ"
+			best := 0.0
+			for i, answer := range mq.Answers {
+				row.Options = append(row.Options, htmlToText(answer.Text))
+				if fraction, _ := strconv.ParseFloat(answer.Fraction, 64); fraction > best {
+					best = fraction
+					row.CorrectOptionID = uint(i + 1)
+				}
+			}
+			if len(row.Options) > 5 {
+				errs = append(errs, "a question can have at most 5 options")
+			}
+		case "truefalse":
+			row.QuestionType = "TRUE_FALSE"
+			for _, answer := range mq.Answers {
+				if fraction, _ := strconv.ParseFloat(answer.Fraction, 64); fraction <= 0 {
+					continue
+				}
+				if strings.EqualFold(htmlToText(answer.Text), "false") {
+					row.CorrectOptionID = 2
+				} else {
+					row.CorrectOptionID = 1
+				}
+			}
+		case "essay":
+			row.QuestionType = "DESCRIPTIVE"
+			if mq.GraderInfo != nil {
+				row.DescriptiveAnswer = htmlToText(mq.GraderInfo.Text)
+			}
+		}
+
+		if mq.Tags != nil {
+			for _, tag := range mq.Tags.Tags {
+				key, value, ok := strings.Cut(tag.Text, ":")
+				if ok {
+					errs = append(errs, row.setField(strings.TrimSpace(key), strings.TrimSpace(value))...)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+		rowErrors = append(rowErrors, errs)
+	}
+	return rows, rowErrors, nil
+}
+
+// setField sets a field named like a CSV column from its text value, for the
+// metadata that Moodle tags and GIFT comments carry. Unknown keys are ignored.
+func (row *QuestionImportRow) setField(key, value string) []string {
+	number := func() *int {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+
+	var target **int
+	switch key {
+	case "difficulty":
+		row.Difficulty = value
+		return nil
+	case "descriptive_answer":
+		row.DescriptiveAnswer = value
+		return nil
+	case "image1":
+		row.Image1 = value
+		return nil
+	case "image2":
+		row.Image2 = value
+		return nil
+	case "category_id":
+		n := number()
+		if n == nil || *n <= 0 {
+			return []string{"category_id must be a number"}
+		}
+		row.CategoryID = uint(*n)
+		return nil
+	case "image1_display_time":
+		target = &row.Image1Time
+	case "image2_display_time":
+		target = &row.Image2Time
+	case "comment_display_time":
+		target = &row.CommentTime
+	default:
+		return nil
+	}
+	if *target = number(); *target == nil {
+		return []string{fmt.Sprintf("%s must be a number", key)}
+	}
+	return nil
+}
+
+var (
+	htmlImageSrc   = regexp.MustCompile(`(?i)<img[^>]*\ssrc="([^"]*)"`)
+	htmlLineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*<p[^>]*>`)
+	htmlTags       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlImages lists the file names of the images an HTML text shows
+func htmlImages(text string) []string {
+	var names []string
+	for _, match := range htmlImageSrc.FindAllStringSubmatch(text, -1) {
+		src := html.UnescapeString(match[1])
+		src = strings.TrimPrefix(src, "@@PLUGINFILE@@/")
+		names = append(names, path.Base(src))
+	}
+	return names
+}
+
+// htmlToText reduces an HTML text to the plain text questions are stored as
+func htmlToText(text string) string {
+	text = htmlLineBreaks.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// ParseGIFT reads multiple choice, true/false and essay questions in Moodle's
+// GIFT format. Questions are separated by blank lines; "// key: value"
+// comments before a question carry the Pathshala fields GIFT has no syntax for.
+func ParseGIFT(r io.Reader) ([]QuestionImportRow, [][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	var rows []QuestionImportRow
+	var rowErrors [][]string
+	var metadata [][2]string
+	var source []string
+	flush := func() {
+		defer func() { metadata, source = nil, nil }()
+		if len(source) == 0 {
+			return
+		}
+		row, errs := parseGIFTQuestion(strings.Join(source, "\n"))
+		for _, field := range metadata {
+			errs = append(errs, row.setField(field[0], field[1])...)
+		}
+		if row.DescriptiveAnswer != "" {
+			row.DescriptiveAnswer = unescapeGIFT(row.DescriptiveAnswer)
+		}
+		rows = append(rows, row)
+		rowErrors = append(rowErrors, errs)
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			if key, value, ok := strings.Cut(strings.TrimPrefix(trimmed, "//"), ":"); ok {
+				metadata = append(metadata, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			continue
+		default:
+			source = append(source, line)
+		}
+	}
+	flush()
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("%w: no questions found", ErrInvalidImportFile)
+	}
+	return rows, rowErrors, nil
+}
+
+// parseGIFTQuestion reads one "::title::text{answers}" question
+func parseGIFTQuestion(source string) (QuestionImportRow, []string) {
+	var row QuestionImportRow
+	source = strings.TrimSpace(source)
+
+	if strings.HasPrefix(source, "::") {
+		if end := indexUnescaped(source, "::", 2); end >= 0 {
+			source = strings.TrimSpace(source[end+2:])
+		}
+	}
+	if strings.HasPrefix(source, "[") {
+		if end := strings.Index(source, "]"); end >= 0 {
+			source = source[end+1:]
+		}
+	}
+
+	open := indexUnescaped(source, "{", 0)
+	if open < 0 {
+		return row, []string{"question has no answer block"}
+	}
+	end := indexUnescaped(source, "}", open+1)
+	if end < 0 {
+		return row, []string{"answer block is not closed"}
+	}
+	row.QuestionText = unescapeGIFT(strings.TrimSpace(source[:open]))
+
+	answers := source[open+1 : end]
+	if i := indexUnescaped(answers, "####", 0); i >= 0 {
+		row.Comment = unescapeGIFT(strings.TrimSpace(answers[i+4:]))
+		answers = answers[:i]
+	}
+	answers = strings.TrimSpace(answers)
+
+	keyword := answers
+	if i := indexUnescaped(keyword, "#", 0); i >= 0 {
+		keyword = strings.TrimSpace(keyword[:i])
+	}
+	switch strings.ToUpper(keyword) {
+	case "":
+		row.QuestionType = "DESCRIPTIVE"
+		return row, nil
+	case "T", "TRUE":
+		row.QuestionType = "TRUE_FALSE"
+		row.CorrectOptionID = 1
+		return row, nil
+	case "F", "FALSE":
+		row.QuestionType = "TRUE_FALSE"
+		row.CorrectOptionID = 2
+		return row, nil
+	}
+
+	row.QuestionType = "MCQ"
+	start := -1
+	correct := false
+	addOption := func(text string) {
+		if i := indexUnescaped(text, "#", 0); i >= 0 {
+			text = text[:i] // answer feedback is not kept
+		}
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "%") {
+			if i := strings.Index(text[1:], "%"); i >= 0 {
+				text = strings.TrimSpace(text[i+2:])
+			}
+		}
+		row.Options = append(row.Options, unescapeGIFT(text))
+		if correct {
+			row.CorrectOptionID = uint(len(row.Options))
+		}
+	}
+	for i := 0; i < len(answers); i++ {
+		switch answers[i] {
+		case '\\':
+			i++
+		case '=', '~':
+			if start >= 0 {
+				addOption(answers[start:i])
+			}
+			correct = answers[i] == '='
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return row, []string{"answer block has no options"}
+	}
+	addOption(answers[start:])
+
+	if len(row.Options) > 5 {
+		return row, []string{"a question can have at most 5 options"}
+	}
+	return row, nil
+}
+
+// indexUnescaped finds sub in s from an offset, skipping backslash escapes
+func indexUnescaped(s, sub string, from int) int {
+	for i := from; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeGIFT(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
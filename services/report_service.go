@@ -1,11 +1,45 @@
 package services
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"pathshala/models"
+	"pathshala/utils"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const (
+	ReportScoreDistribution    = "score_distribution"
+	ReportPercentileRanks      = "percentile_ranks"
+	ReportCollegeComparison    = "college_comparison"
+	ReportStateComparison      = "state_comparison"
+	ReportParticipationRanking = "participation_ranking"
+)
+
+var (
+	ErrUnknownReport   = errors.New("unknown report type")
+	ErrReportNeedsTest = errors.New("this report needs a test_id")
+)
+
+// DefaultReportTypes are the reports the service can generate
+var DefaultReportTypes = []models.ReportType{
+	{Type: ReportScoreDistribution, Title: "Score distribution", Description: "How many students scored in each 10% band of a test", PerTest: true},
+	{Type: ReportPercentileRanks, Title: "Percentile ranks", Description: "Rank and percentile rank of every student of a test", PerTest: true},
+	{Type: ReportCollegeComparison, Title: "College comparison", Description: "Scores of a test compared across colleges", PerTest: true},
+	{Type: ReportStateComparison, Title: "State comparison", Description: "Scores of a test compared across states", PerTest: true},
+	{Type: ReportParticipationRanking, Title: "Participation ranking", Description: "Students ranked by the number of tests they completed"},
+}
+
 type ReportService struct {
 	DB *gorm.DB
 }
@@ -14,32 +48,525 @@ func NewReportService(db *gorm.DB) *ReportService {
 	return &ReportService{DB: db}
 }
 
+// WithContext returns the service running its queries with ctx
+func (s *ReportService) WithContext(ctx context.Context) ReportServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
+}
+
+// ReportColumn is a column of a report: Key names it in JSON rows, Label heads it in CSV and PDF
+type ReportColumn struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// Report is a generated report, a table with an optional summary
+type Report struct {
+	Type        string                   `json:"type"`
+	Title       string                   `json:"title"`
+	TestID      *uint                    `json:"test_id,omitempty"`
+	GeneratedAt time.Time                `json:"generated_at"`
+	Summary     map[string]interface{}   `json:"summary,omitempty"`
+	Columns     []ReportColumn           `json:"columns"`
+	Rows        []map[string]interface{} `json:"rows"`
+}
+
+// ReportParams selects what a report covers
+type ReportParams struct {
+	TestID uint
+	Limit  int // Rows of rankings, 0 for all
+}
+
+// SeedReportTypes makes sure every report the service generates is listed
+func SeedReportTypes(db *gorm.DB) error {
+	types := append([]models.ReportType(nil), DefaultReportTypes...)
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "per_test"}),
+	}).Create(&types).Error
+}
+
 func (rs *ReportService) GetAllReportTypes() ([]models.ReportType, error) {
 	var types []models.ReportType
-	err := rs.DB.Find(&types).Error
+	err := rs.DB.Order("id").Find(&types).Error
 	return types, err
 }
 
-func (rs *ReportService) GetTestWithStudentScores(testID string) ([]map[string]interface{}, error) {
-	var data []map[string]interface{}
-	query := `
-		SELECT s.name AS student_name, r.score
-		FROM results r
-		JOIN students s ON r.student_id = s.id
-		WHERE r.test_id = ?
-		ORDER BY r.score DESC`
-	err := rs.DB.Raw(query, testID).Scan(&data).Error
-	return data, err
-}
-
-func (rs *ReportService) GetStudentParticipationRanking() ([]map[string]interface{}, error) {
-	var data []map[string]interface{}
-	query := `
-		SELECT s.name AS student_name, COUNT(st.test_id) AS test_count
-		FROM student_tests st
-		JOIN students s ON st.student_id = s.id
-		GROUP BY s.name
-		ORDER BY test_count DESC`
-	err := rs.DB.Raw(query).Scan(&data).Error
-	return data, err
+// GenerateReport builds a report listed in the report types
+func (rs *ReportService) GenerateReport(reportType string, params ReportParams) (*Report, error) {
+	var listed models.ReportType
+	err := rs.DB.Where("type = ?", reportType).First(&listed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownReport
+	}
+	if err != nil {
+		return nil, err
+	}
+	if listed.PerTest && params.TestID == 0 {
+		return nil, ErrReportNeedsTest
+	}
+
+	var report *Report
+	switch reportType {
+	case ReportScoreDistribution:
+		report, err = rs.ScoreDistribution(params.TestID)
+	case ReportPercentileRanks:
+		report, err = rs.PercentileRanks(params.TestID)
+	case ReportCollegeComparison:
+		report, err = rs.CollegeComparison(params.TestID)
+	case ReportStateComparison:
+		report, err = rs.StateComparison(params.TestID)
+	case ReportParticipationRanking:
+		report, err = rs.ParticipationRanking(params.Limit)
+	default:
+		return nil, ErrUnknownReport
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Title = listed.Title
+	return report, nil
+}
+
+// studentScore is a student's result in a test, with where they study
+type studentScore struct {
+	UserID      uint
+	Name        string
+	CollegeName *string
+	State       *string
+	Score       float64
+	MaxScore    float64
+}
+
+func (s studentScore) percentage() float64 {
+	return percentage(s.Score, s.MaxScore)
+}
+
+func (rs *ReportService) testScores(testID uint) ([]studentScore, error) {
+	var scores []studentScore
+	err := rs.DB.Table("results").
+		Select("results.user_id, users.name, colleges.name AS college_name, colleges.state, results.score, results.max_score").
+		Joins("JOIN users ON users.id = results.user_id").
+		Joins("LEFT JOIN colleges ON colleges.id = users.college_id").
+		Where("results.test_id = ? AND results.deleted_at IS NULL", testID).
+		Scopes(utils.ScopeJoined("users")).
+		Order("results.score DESC, users.name").
+		Scan(&scores).Error
+	return scores, err
+}
+
+func newReport(reportType string, testID uint, columns ...ReportColumn) *Report {
+	report := &Report{
+		Type:        reportType,
+		GeneratedAt: time.Now(),
+		Columns:     columns,
+		Rows:        []map[string]interface{}{},
+	}
+	if testID != 0 {
+		report.TestID = &testID
+	}
+	return report
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ScoreDistribution counts the students of a test in each 10% band of the
+// percentage score. A perfect score falls in the top band.
+func (rs *ReportService) ScoreDistribution(testID uint) (*Report, error) {
+	scores, err := rs.testScores(testID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := newReport(ReportScoreDistribution, testID,
+		ReportColumn{"band", "Band (%)"},
+		ReportColumn{"students", "Students"},
+		ReportColumn{"share", "Share (%)"},
+	)
+
+	counts := make([]int, 10)
+	percentages := make([]float64, len(scores))
+	for i, s := range scores {
+		p := s.percentage()
+		percentages[i] = p
+		band := int(p / 10)
+		if band > 9 {
+			band = 9
+		}
+		if band < 0 {
+			band = 0
+		}
+		counts[band]++
+	}
+	for band, count := range counts {
+		share := 0.0
+		if len(scores) > 0 {
+			share = round2(100 * float64(count) / float64(len(scores)))
+		}
+		report.Rows = append(report.Rows, map[string]interface{}{
+			"band":     fmt.Sprintf("%d-%d", band*10, band*10+10),
+			"students": count,
+			"share":    share,
+		})
+	}
+
+	report.Summary = map[string]interface{}{"students": len(scores)}
+	if len(scores) > 0 {
+		sort.Float64s(percentages)
+		median := percentages[len(percentages)/2]
+		if len(percentages)%2 == 0 {
+			median = (percentages[len(percentages)/2-1] + median) / 2
+		}
+		report.Summary["mean"] = round2(mean(percentages))
+		report.Summary["median"] = round2(median)
+		report.Summary["std_dev"] = round2(math.Sqrt(variance(percentages)))
+		report.Summary["min"] = round2(percentages[0])
+		report.Summary["max"] = round2(percentages[len(percentages)-1])
+	}
+	return report, nil
+}
+
+// PercentileRanks ranks the students of a test. The percentile rank is the
+// share of students scoring below, counting ties as half.
+func (rs *ReportService) PercentileRanks(testID uint) (*Report, error) {
+	scores, err := rs.testScores(testID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := newReport(ReportPercentileRanks, testID,
+		ReportColumn{"rank", "Rank"},
+		ReportColumn{"student_name", "Student"},
+		ReportColumn{"college", "College"},
+		ReportColumn{"score", "Score"},
+		ReportColumn{"max_score", "Max"},
+		ReportColumn{"percentage", "%"},
+		ReportColumn{"percentile_rank", "Percentile"},
+	)
+
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].percentage() > scores[j].percentage() })
+	n := float64(len(scores))
+	for i, s := range scores {
+		below, equal := 0, 0
+		for _, other := range scores {
+			switch {
+			case other.percentage() < s.percentage():
+				below++
+			case other.percentage() == s.percentage():
+				equal++
+			}
+		}
+		// Tied students share the best rank
+		rank := i + 1
+		for rank > 1 && scores[rank-2].percentage() == s.percentage() {
+			rank--
+		}
+		report.Rows = append(report.Rows, map[string]interface{}{
+			"rank":            rank,
+			"student_name":    s.Name,
+			"college":         collegeName(s.CollegeName),
+			"score":           round2(s.Score),
+			"max_score":       round2(s.MaxScore),
+			"percentage":      round2(s.percentage()),
+			"percentile_rank": round2(100 * (float64(below) + 0.5*float64(equal)) / n),
+		})
+	}
+	return report, nil
+}
+
+func collegeName(name *string) string {
+	if name == nil || *name == "" {
+		return "No college"
+	}
+	return *name
+}
+
+// groupComparison compares the percentage scores of groups of students
+func groupComparison(report *Report, scores []studentScore, group func(studentScore) string) {
+	type stats struct {
+		name        string
+		percentages []float64
+	}
+	groups := make(map[string]*stats)
+	var names []string
+	for _, s := range scores {
+		name := group(s)
+		g, ok := groups[name]
+		if !ok {
+			g = &stats{name: name}
+			groups[name] = g
+			names = append(names, name)
+		}
+		g.percentages = append(g.percentages, s.percentage())
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		mi, mj := mean(groups[names[i]].percentages), mean(groups[names[j]].percentages)
+		if mi != mj {
+			return mi > mj
+		}
+		return names[i] < names[j]
+	})
+
+	for i, name := range names {
+		p := groups[name].percentages
+		sort.Float64s(p)
+		report.Rows = append(report.Rows, map[string]interface{}{
+			"rank":     i + 1,
+			"group":    name,
+			"students": len(p),
+			"mean":     round2(mean(p)),
+			"min":      round2(p[0]),
+			"max":      round2(p[len(p)-1]),
+		})
+	}
+
+	report.Summary = map[string]interface{}{"groups": len(names), "students": len(scores)}
+	if len(scores) > 0 {
+		all := make([]float64, len(scores))
+		for i, s := range scores {
+			all[i] = s.percentage()
+		}
+		report.Summary["overall_mean"] = round2(mean(all))
+	}
+}
+
+func comparisonColumns(group string) []ReportColumn {
+	return []ReportColumn{
+		{"rank", "Rank"},
+		{"group", group},
+		{"students", "Students"},
+		{"mean", "Mean %"},
+		{"min", "Min %"},
+		{"max", "Max %"},
+	}
+}
+
+// CollegeComparison compares the scores of a test across colleges
+func (rs *ReportService) CollegeComparison(testID uint) (*Report, error) {
+	scores, err := rs.testScores(testID)
+	if err != nil {
+		return nil, err
+	}
+	report := newReport(ReportCollegeComparison, testID, comparisonColumns("College")...)
+	groupComparison(report, scores, func(s studentScore) string { return collegeName(s.CollegeName) })
+	return report, nil
+}
+
+// StateComparison compares the scores of a test across the states of the students' colleges
+func (rs *ReportService) StateComparison(testID uint) (*Report, error) {
+	scores, err := rs.testScores(testID)
+	if err != nil {
+		return nil, err
+	}
+	report := newReport(ReportStateComparison, testID, comparisonColumns("State")...)
+	groupComparison(report, scores, func(s studentScore) string {
+		if s.State == nil || *s.State == "" {
+			return "Unknown"
+		}
+		return *s.State
+	})
+	return report, nil
+}
+
+// ParticipationRanking ranks students by the tests they completed, then by
+// their mean percentage score
+func (rs *ReportService) ParticipationRanking(limit int) (*Report, error) {
+	var rows []struct {
+		UserID      uint
+		Name        string
+		CollegeName *string
+		Assigned    int
+		Completed   int
+	}
+	err := rs.DB.Table("student_tests").
+		Select("student_tests.student_id AS user_id, users.name, colleges.name AS college_name, "+
+			"COUNT(student_tests.id) AS assigned, "+
+			"SUM(CASE WHEN student_tests.status = ? THEN 1 ELSE 0 END) AS completed", AttemptSubmitted).
+		Joins("JOIN users ON users.id = student_tests.student_id").
+		Joins("LEFT JOIN colleges ON colleges.id = users.college_id").
+		Scopes(utils.ScopeJoined("users")).
+		Group("student_tests.student_id, users.name, colleges.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Result
+	err = rs.DB.Joins("JOIN users ON users.id = results.user_id").
+		Scopes(utils.ScopeJoined("users")).
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	percentages := make(map[uint][]float64)
+	for _, r := range results {
+		percentages[r.UserID] = append(percentages[r.UserID], percentage(r.Score, r.MaxScore))
+	}
+	meanOf := func(userID uint) float64 {
+		if p := percentages[userID]; len(p) > 0 {
+			return mean(p)
+		}
+		return 0
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Completed != rows[j].Completed {
+			return rows[i].Completed > rows[j].Completed
+		}
+		if mi, mj := meanOf(rows[i].UserID), meanOf(rows[j].UserID); mi != mj {
+			return mi > mj
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	report := newReport(ReportParticipationRanking, 0,
+		ReportColumn{"rank", "Rank"},
+		ReportColumn{"student_name", "Student"},
+		ReportColumn{"college", "College"},
+		ReportColumn{"assigned", "Assigned"},
+		ReportColumn{"completed", "Completed"},
+		ReportColumn{"participation", "Participation %"},
+		ReportColumn{"mean_score", "Mean %"},
+	)
+	for i, row := range rows {
+		participation := 0.0
+		if row.Assigned > 0 {
+			participation = round2(100 * float64(row.Completed) / float64(row.Assigned))
+		}
+		report.Rows = append(report.Rows, map[string]interface{}{
+			"rank":          i + 1,
+			"student_name":  row.Name,
+			"college":       collegeName(row.CollegeName),
+			"assigned":      row.Assigned,
+			"completed":     row.Completed,
+			"participation": participation,
+			"mean_score":    round2(meanOf(row.UserID)),
+		})
+	}
+	return report, nil
+}
+
+// reportCell formats a value of a report row for CSV and PDF
+func reportCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteReportCSV writes the rows of a report under a header of its column labels
+func WriteReportCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(report.Columns))
+	for i, column := range report.Columns {
+		header[i] = column.Label
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		record := make([]string, len(report.Columns))
+		for i, column := range report.Columns {
+			record[i] = utils.CSVCell(reportCell(row[column.Key]))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteReportPDF lays a report out as a printable table
+func WriteReportPDF(w io.Writer, report *Report) error {
+	lines := []string{report.Title, ""}
+	if report.TestID != nil {
+		lines = append(lines, fmt.Sprintf("Test: %d", *report.TestID))
+	}
+	lines = append(lines, "Generated: "+report.GeneratedAt.Format("2006-01-02 15:04 MST"))
+
+	if len(report.Summary) > 0 {
+		keys := make([]string, 0, len(report.Summary))
+		for key := range report.Summary {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("%s: %s", strings.ReplaceAll(key, "_", " "), reportCell(report.Summary[key])))
+		}
+	}
+	lines = append(lines, "")
+
+	// Columns are as wide as their widest cell, text columns shrinking first when the line is full
+	widths := make([]int, len(report.Columns))
+	cells := make([][]string, len(report.Rows))
+	for i, column := range report.Columns {
+		widths[i] = utf8.RuneCountInString(column.Label)
+	}
+	for r, row := range report.Rows {
+		cells[r] = make([]string, len(report.Columns))
+		for i, column := range report.Columns {
+			cells[r][i] = reportCell(row[column.Key])
+			if n := utf8.RuneCountInString(cells[r][i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for total(widths)+2*(len(widths)-1) > utils.PDFLineChars {
+		widest := 0
+		for i := range widths {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= 8 {
+			break
+		}
+		widths[widest]--
+	}
+
+	format := func(values []string) string {
+		parts := make([]string, len(values))
+		for i, value := range values {
+			runes := []rune(value)
+			if len(runes) > widths[i] {
+				runes = append(runes[:widths[i]-1], '~')
+			}
+			parts[i] = string(runes) + strings.Repeat(" ", widths[i]-len(runes))
+		}
+		return strings.TrimRight(strings.Join(parts, "  "), " ")
+	}
+
+	header := make([]string, len(report.Columns))
+	for i, column := range report.Columns {
+		header[i] = column.Label
+	}
+	lines = append(lines, format(header))
+	lines = append(lines, strings.Repeat("-", utf8.RuneCountInString(format(header))))
+	for _, row := range cells {
+		lines = append(lines, format(row))
+	}
+	if len(report.Rows) == 0 {
+		lines = append(lines, "No data")
+	}
+	return utils.WriteTextPDF(w, lines)
+}
+
+func total(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
 }
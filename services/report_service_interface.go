@@ -1,11 +1,19 @@
 package services
 
-import "pathshala/models"
+import (
+	"context"
+	"pathshala/models"
+)
 
 type ReportServiceInterface interface {
+	WithContext(ctx context.Context) ReportServiceInterface
 	GetAllReportTypes() ([]models.ReportType, error)
-	GetTestWithStudentScores(testID string) ([]map[string]interface{}, error)
-	GetStudentParticipationRanking() ([]map[string]interface{}, error)
+	GenerateReport(reportType string, params ReportParams) (*Report, error)
+	ScoreDistribution(testID uint) (*Report, error)
+	PercentileRanks(testID uint) (*Report, error)
+	CollegeComparison(testID uint) (*Report, error)
+	StateComparison(testID uint) (*Report, error)
+	ParticipationRanking(limit int) (*Report, error)
 }
 
 var _ ReportServiceInterface = &ReportService{}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/models"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("question revision not found")
+
+type RevisionService struct {
+	DB       *gorm.DB
+	Attempts *AttemptService
+}
+
+func NewRevisionService(db *gorm.DB, attempts *AttemptService) *RevisionService {
+	return &RevisionService{DB: db, Attempts: attempts}
+}
+
+// WithContext is like AttemptService.WithContext
+func (s *RevisionService) WithContext(ctx context.Context) RevisionServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	if s.Attempts != nil {
+		scoped.Attempts = s.Attempts.withContext(ctx)
+	}
+	return &scoped
+}
+
+// FieldChange is a field that differs between a revision and the one before it
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionHistoryEntry is a revision with what changed since the previous one
+type RevisionHistoryEntry struct {
+	models.QuestionRevision
+	Changes []FieldChange `json:"changes"`
+}
+
+// RegradeSummary counts the submitted attempts moved to a revision
+type RegradeSummary struct {
+	QuestionID uint   `json:"question_id"`
+	Revision   int    `json:"revision"`
+	Tests      []uint `json:"tests"` // Tests whose attempts were regraded
+	Attempts   int    `json:"attempts"`
+	Rescored   int    `json:"rescored"`
+}
+
+// snapshotQuestion reads the current state of a question as an unsaved revision
+func snapshotQuestion(db *gorm.DB, questionID uint) (*models.QuestionRevision, error) {
+	var question models.Question
+	err := db.Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("option_id")
+	}).First(&question, questionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrQuestionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &models.QuestionRevision{
+		QuestionID:         question.ID,
+		QuestionType:       question.QuestionType,
+		QuestionText:       question.QuestionText,
+		CorrectOptionID:    question.CorrectOptionID,
+		Difficulty:         question.Difficulty,
+		CategoryID:         question.CategoryID,
+		Image1:             question.Image1,
+		Image1DisplayTime:  question.Image1DisplayTime,
+		Image2:             question.Image2,
+		Image2DisplayTime:  question.Image2DisplayTime,
+		Comment:            question.Comment,
+		CommentDisplayTime: question.CommentDisplayTime,
+		Options:            []models.RevisionOption{},
+	}
+	for _, opt := range question.Options {
+		revision.Options = append(revision.Options, models.RevisionOption{
+			ID:         opt.ID,
+			OptionID:   opt.OptionID,
+			OptionText: opt.OptionText,
+			IsCorrect:  opt.IsCorrect,
+		})
+	}
+	return revision, nil
+}
+
+func latestRevision(db *gorm.DB, questionID uint) (*models.QuestionRevision, error) {
+	var revision models.QuestionRevision
+	err := db.Where("question_id = ?", questionID).Order("revision DESC").First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// RecordQuestionRevision stores the current state of a question as a new
+// revision, unless it is unchanged since the latest one.
+func RecordQuestionRevision(db *gorm.DB, questionID uint, editorID *uint) (*models.QuestionRevision, error) {
+	snapshot, err := snapshotQuestion(db, questionID)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := latestRevision(db, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest == nil {
+		snapshot.Revision = 1
+	} else {
+		if len(diffRevisions(*latest, *snapshot)) == 0 {
+			return latest, nil
+		}
+		snapshot.Revision = latest.Revision + 1
+	}
+	snapshot.EditedBy = editorID
+	if err := db.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// EnsureQuestionRevision returns the latest revision of a question, recording
+// the first one when there is none. Attempts and answers given to the question
+// before revisions were kept are pinned to that first revision.
+func EnsureQuestionRevision(db *gorm.DB, questionID uint) (*models.QuestionRevision, error) {
+	latest, err := latestRevision(db, questionID)
+	if err != nil || latest != nil {
+		return latest, err
+	}
+
+	var revision *models.QuestionRevision
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if revision, err = RecordQuestionRevision(tx, questionID, nil); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.StudentTestQuestion{}).
+			Where("question_id = ? AND revision_id IS NULL", questionID).
+			Update("revision_id", revision.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.StudentAnswer{}).
+			Where("question_id = ? AND revision_id IS NULL", questionID).
+			Update("revision_id", revision.ID).Error
+	})
+	return revision, err
+}
+
+// diffRevisions lists the fields that differ between two revisions. Options
+// are compared by their position, e.g. option_2.
+func diffRevisions(from, to models.QuestionRevision) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, a, b interface{}) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+	uintValue := func(v *uint) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	intValue := func(v *int) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+
+	add("question_type", from.QuestionType, to.QuestionType)
+	add("question_text", from.QuestionText, to.QuestionText)
+	add("difficulty", from.Difficulty, to.Difficulty)
+	add("category_id", from.CategoryID, to.CategoryID)
+	add("correct_option_id", uintValue(from.CorrectOptionID), uintValue(to.CorrectOptionID))
+	add("image1", from.Image1, to.Image1)
+	add("image1_display_time", intValue(from.Image1DisplayTime), intValue(to.Image1DisplayTime))
+	add("image2", from.Image2, to.Image2)
+	add("image2_display_time", intValue(from.Image2DisplayTime), intValue(to.Image2DisplayTime))
+	add("comment", from.Comment, to.Comment)
+	add("comment_display_time", intValue(from.CommentDisplayTime), intValue(to.CommentDisplayTime))
+
+	optionText := func(options []models.RevisionOption) map[uint]string {
+		texts := make(map[uint]string, len(options))
+		for _, opt := range options {
+			texts[opt.OptionID] = opt.OptionText
+		}
+		return texts
+	}
+	fromOptions, toOptions := optionText(from.Options), optionText(to.Options)
+	var positions []uint
+	for position := range fromOptions {
+		positions = append(positions, position)
+	}
+	for position := range toOptions {
+		if _, ok := fromOptions[position]; !ok {
+			positions = append(positions, position)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	for _, position := range positions {
+		var a, b interface{}
+		if text, ok := fromOptions[position]; ok {
+			a = text
+		}
+		if text, ok := toOptions[position]; ok {
+			b = text
+		}
+		add(fmt.Sprintf("option_%d", position), a, b)
+	}
+	return changes
+}
+
+// GetHistory lists the revisions of a question, newest first, each with the
+// changes it made to the one before.
+// findQuestion fails with ErrQuestionNotFound unless the question, deleted or
+// not, can be read with the service's context, i.e. by the caller's tenant
+func (s *RevisionService) findQuestion(questionID uint) error {
+	var count int64
+	if err := s.DB.Unscoped().Model(&models.Question{}).Where("id = ?", questionID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrQuestionNotFound
+	}
+	return nil
+}
+
+func (s *RevisionService) GetHistory(questionID uint) ([]RevisionHistoryEntry, error) {
+	if err := s.findQuestion(questionID); err != nil {
+		return nil, err
+	}
+	if _, err := EnsureQuestionRevision(s.DB, questionID); err != nil {
+		return nil, err
+	}
+
+	var revisions []models.QuestionRevision
+	if err := s.DB.Where("question_id = ?", questionID).Order("revision").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	history := make([]RevisionHistoryEntry, len(revisions))
+	for i, revision := range revisions {
+		entry := RevisionHistoryEntry{QuestionRevision: revision, Changes: []FieldChange{}}
+		if i > 0 {
+			entry.Changes = append(entry.Changes, diffRevisions(revisions[i-1], revision)...)
+		}
+		history[len(revisions)-1-i] = entry
+	}
+	return history, nil
+}
+
+func (s *RevisionService) GetRevision(questionID uint, revision int) (*models.QuestionRevision, error) {
+	if err := s.findQuestion(questionID); err != nil {
+		return nil, err
+	}
+	var found models.QuestionRevision
+	err := s.DB.Where("question_id = ? AND revision = ?", questionID, revision).First(&found).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// RegradeTests lists the tests with submitted attempts that were served the
+// question, i.e. the tests a regrade of the question would change
+func (s *RevisionService) RegradeTests(questionID uint) ([]uint, error) {
+	var testIDs []uint
+	err := s.DB.Model(&models.StudentTest{}).
+		Joins("JOIN student_test_questions ON student_test_questions.student_test_id = student_tests.id").
+		Where("student_test_questions.question_id = ? AND student_tests.status = ?", questionID, AttemptSubmitted).
+		Distinct().Order("student_tests.test_id").
+		Pluck("student_tests.test_id", &testIDs).Error
+	return testIDs, err
+}
+
+// RegradeWithRevision moves the submitted attempts of the given tests that
+// were served the question to the given revision and recomputes their
+// results. Chosen options carry over by position, so an answer of option 2
+// stays option 2.
+func (s *RevisionService) RegradeWithRevision(questionID uint, revision int, testIDs []uint) (*RegradeSummary, error) {
+	target, err := s.GetRevision(questionID, revision)
+	if err != nil {
+		return nil, err
+	}
+	summary := &RegradeSummary{QuestionID: questionID, Revision: revision, Tests: testIDs}
+	if len(testIDs) == 0 {
+		summary.Tests = []uint{}
+		return summary, nil
+	}
+
+	var served []models.StudentTestQuestion
+	err = s.DB.Joins("JOIN student_tests ON student_tests.id = student_test_questions.student_test_id").
+		Where("student_test_questions.question_id = ? AND student_tests.status = ? AND student_tests.test_id IN ?",
+			questionID, AttemptSubmitted, testIDs).
+		Find(&served).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Answers may hold an option of any earlier revision
+	positions := make(map[uint]uint) // option row ID -> position
+	var revisions []models.QuestionRevision
+	if err := s.DB.Where("question_id = ?", questionID).Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range revisions {
+		for _, opt := range r.Options {
+			positions[opt.ID] = opt.OptionID
+		}
+	}
+	targetOptions := make(map[uint]uint, len(target.Options)) // position -> option row ID
+	for _, opt := range target.Options {
+		targetOptions[opt.OptionID] = opt.ID
+	}
+
+	for _, row := range served {
+		var studentTest models.StudentTest
+		if err := s.DB.First(&studentTest, row.StudentTestID).Error; err != nil {
+			return nil, err
+		}
+
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.StudentTestQuestion{}).Where("id = ?", row.ID).
+				Update("revision_id", target.ID).Error; err != nil {
+				return err
+			}
+
+			var answer models.StudentAnswer
+			err := tx.Where("test_id = ? AND student_id = ? AND question_id = ?", studentTest.TestID, studentTest.StudentID, questionID).
+				First(&answer).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			updates := map[string]interface{}{"revision_id": target.ID}
+			if answer.SelectedOptionID != nil {
+				if position, ok := positions[*answer.SelectedOptionID]; ok {
+					if optionID, ok := targetOptions[position]; ok {
+						updates["selected_option_id"] = optionID
+					} else {
+						updates["selected_option_id"] = nil
+					}
+				}
+			}
+			return tx.Model(&answer).Updates(updates).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		summary.Attempts++
+
+		if _, err := s.Attempts.RescoreAttempt(studentTest.TestID, studentTest.StudentID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // No stored result to update
+			}
+			return nil, err
+		}
+		summary.Rescored++
+	}
+	return summary, nil
+}
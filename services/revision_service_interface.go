@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type RevisionServiceInterface interface {
+	WithContext(ctx context.Context) RevisionServiceInterface
+	GetHistory(questionID uint) ([]RevisionHistoryEntry, error)
+	GetRevision(questionID uint, revision int) (*models.QuestionRevision, error)
+	RegradeTests(questionID uint) ([]uint, error)
+	RegradeWithRevision(questionID uint, revision int, testIDs []uint) (*RegradeSummary, error)
+}
+
+var _ RevisionServiceInterface = &RevisionService{}
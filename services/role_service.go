@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/models"
+	"pathshala/utils"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownRole            = errors.New("unknown role")
+	ErrInvalidRoleAssignment  = errors.New("invalid role assignment")
+	ErrRoleAssignmentNotFound = errors.New("role assignment not found")
+	ErrUserNotFound           = errors.New("user not found")
+)
+
+type RoleService struct {
+	DB *gorm.DB
+}
+
+func NewRoleService(db *gorm.DB) *RoleService {
+	return &RoleService{DB: db}
+}
+
+// WithContext returns the service running its queries with ctx
+func (s *RoleService) WithContext(ctx context.Context) RoleServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
+}
+
+// RoleDefinition is a role with the permissions it grants
+type RoleDefinition struct {
+	Role        string                  `json:"role"`
+	Assignable  bool                    `json:"assignable"` // Given with a RoleAssignment rather than as the user's role
+	Permissions []models.RolePermission `json:"permissions"`
+}
+
+// RoleAssignmentInput scopes an extra role to a college or to a state
+type RoleAssignmentInput struct {
+	Role      string `json:"role" binding:"required"`
+	CollegeID *uint  `json:"college_id"`
+	State     string `json:"state"`
+}
+
+// baseRoles are held as User.Role and cannot be assigned on top of it
+var baseRoles = map[string]bool{utils.RoleAdmin: true, utils.RoleTeacher: true, utils.RoleStudent: true}
+
+func (s *RoleService) ListRoles() ([]RoleDefinition, error) {
+	var permissions []models.RolePermission
+	if err := s.DB.Order("role, permission").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	byRole := make(map[string]*RoleDefinition)
+	var roles []string
+	for _, p := range permissions {
+		definition, ok := byRole[p.Role]
+		if !ok {
+			definition = &RoleDefinition{Role: p.Role, Assignable: !baseRoles[p.Role]}
+			byRole[p.Role] = definition
+			roles = append(roles, p.Role)
+		}
+		definition.Permissions = append(definition.Permissions, p)
+	}
+	sort.Strings(roles)
+
+	definitions := make([]RoleDefinition, 0, len(roles))
+	for _, role := range roles {
+		definitions = append(definitions, *byRole[role])
+	}
+	return definitions, nil
+}
+
+func (s *RoleService) GetAssignments(userID uint) ([]models.RoleAssignment, error) {
+	if err := s.DB.First(&models.User{}, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	assignments := []models.RoleAssignment{}
+	err := s.DB.Where("user_id = ?", userID).Order("id").Find(&assignments).Error
+	return assignments, err
+}
+
+// AssignmentResource is the college or state a role assignment gives access
+// to, which whoever assigns it must hold role:manage over
+func (s *RoleService) AssignmentResource(input RoleAssignmentInput) (utils.Resource, error) {
+	if input.CollegeID != nil {
+		res, err := utils.CollegeResource(s.DB, *input.CollegeID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Resource{}, fmt.Errorf("%w: college %d not found", ErrInvalidRoleAssignment, *input.CollegeID)
+		}
+		return res, err
+	}
+	return utils.Resource{State: strings.TrimSpace(input.State)}, nil
+}
+
+// AssignRole gives a user an extra role, limited to exactly one college or state
+func (s *RoleService) AssignRole(userID uint, input RoleAssignmentInput, grantedBy uint) (*models.RoleAssignment, error) {
+	if err := s.DB.First(&models.User{}, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if baseRoles[input.Role] {
+		return nil, fmt.Errorf("%w: %s is a user role, not an assignable one", ErrInvalidRoleAssignment, input.Role)
+	}
+	var count int64
+	if err := s.DB.Model(&models.RolePermission{}).Where("role = ?", input.Role).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrUnknownRole
+	}
+
+	state := strings.TrimSpace(input.State)
+	if (input.CollegeID == nil) == (state == "") {
+		return nil, fmt.Errorf("%w: give either college_id or state", ErrInvalidRoleAssignment)
+	}
+	if input.CollegeID != nil {
+		if _, err := s.AssignmentResource(input); err != nil {
+			return nil, err
+		}
+	}
+
+	assignment := &models.RoleAssignment{
+		UserID:    userID,
+		Role:      input.Role,
+		CollegeID: input.CollegeID,
+		State:     state,
+		GrantedBy: &grantedBy,
+	}
+	if err := s.DB.Create(assignment).Error; err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+func (s *RoleService) RevokeRole(userID, assignmentID uint) error {
+	result := s.DB.Where("id = ? AND user_id = ?", assignmentID, userID).Delete(&models.RoleAssignment{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleAssignmentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+	"pathshala/utils"
+)
+
+type RoleServiceInterface interface {
+	WithContext(ctx context.Context) RoleServiceInterface
+	ListRoles() ([]RoleDefinition, error)
+	GetAssignments(userID uint) ([]models.RoleAssignment, error)
+	AssignmentResource(input RoleAssignmentInput) (utils.Resource, error)
+	AssignRole(userID uint, input RoleAssignmentInput, grantedBy uint) (*models.RoleAssignment, error)
+	RevokeRole(userID, assignmentID uint) error
+}
+
+var _ RoleServiceInterface = &RoleService{}
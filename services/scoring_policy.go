@@ -0,0 +1,82 @@
+package services
+
+import (
+	"pathshala/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ScoringPolicy decides what each question of a test is worth. It is shared by
+// grading at submission time and by re-scoring after the policy changes.
+type ScoringPolicy struct {
+	// Fraction of a question's marks deducted for a wrong objective answer
+	NegativeMarking float64
+	// Marks of a question without a per-question override, by difficulty
+	DifficultyMarks map[string]float64
+	// Per-question overrides taken from TestQuestion.Marks
+	QuestionMarks map[uint]float64
+	// Award rubric points proportionally instead of all-or-nothing
+	PartialCredit bool
+}
+
+// LoadScoringPolicy builds the policy configured on a test
+func LoadScoringPolicy(db *gorm.DB, testID uint) (*ScoringPolicy, error) {
+	var test models.Test
+	if err := db.First(&test, testID).Error; err != nil {
+		return nil, err
+	}
+
+	var testQuestions []models.TestQuestion
+	if err := db.Where("test_id = ? AND marks IS NOT NULL", testID).Find(&testQuestions).Error; err != nil {
+		return nil, err
+	}
+
+	policy := &ScoringPolicy{
+		NegativeMarking: test.NegativeMarking,
+		DifficultyMarks: map[string]float64{
+			"easy":   test.EasyMarks,
+			"medium": test.MediumMarks,
+			"hard":   test.HardMarks,
+		},
+		QuestionMarks: make(map[uint]float64, len(testQuestions)),
+		PartialCredit: !test.AllOrNothing,
+	}
+	for _, tq := range testQuestions {
+		policy.QuestionMarks[tq.QuestionID] = *tq.Marks
+	}
+	return policy, nil
+}
+
+// Marks is what a fully correct answer to the question is worth
+func (p *ScoringPolicy) Marks(question models.Question) float64 {
+	if marks, ok := p.QuestionMarks[question.ID]; ok {
+		return marks
+	}
+	if marks, ok := p.DifficultyMarks[strings.ToLower(question.Difficulty)]; ok && marks > 0 {
+		return marks
+	}
+	return 1
+}
+
+// ScoreObjective scores an answered MCQ or true/false question
+func (p *ScoringPolicy) ScoreObjective(question models.Question, correct bool) float64 {
+	if correct {
+		return p.Marks(question)
+	}
+	return -p.NegativeMarking * p.Marks(question)
+}
+
+// ScoreDescriptive converts rubric points into marks
+func (p *ScoringPolicy) ScoreDescriptive(question models.Question, points, maxPoints float64) float64 {
+	if maxPoints <= 0 {
+		return 0
+	}
+	if !p.PartialCredit {
+		if points >= maxPoints {
+			return p.Marks(question)
+		}
+		return 0
+	}
+	return p.Marks(question) * points / maxPoints
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"pathshala/models"
+	"pathshala/utils"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrSessionInvalid     = errors.New("session expired or was revoked")
+	ErrRefreshTokenReused = errors.New("refresh token was already used; the session has been revoked")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// SessionService keeps one Redis record per login, so a user can be logged
+// in on several devices at once. Each session holds the id of its one valid
+// refresh token. Refreshing replaces it; presenting a replaced token means it
+// leaked, and the whole session is revoked.
+//
+// Keys:
+//
+//	session:<sid>          hash of the session, expiring with its refresh token
+//	user_sessions:<userID> set of the user's session ids
+//	access_token:<token>   whitelisted access token, holding its session id
+type SessionService struct {
+	Redis  *redis.Client
+	Tokens *utils.Tokens
+	Now    func() time.Time
+}
+
+func NewSessionService(rdb *redis.Client, tokens *utils.Tokens) *SessionService {
+	return &SessionService{Redis: rdb, Tokens: tokens, Now: time.Now}
+}
+
+// Device describes where a session is used from
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// TokenPair is what a login or refresh hands to the client
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session is a login as the session API lists it
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"` // The session of the request's access token
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID uint) string {
+	return "user_sessions:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func accessTokenKey(token string) string {
+	return "access_token:" + token
+}
+
+func randomID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Create starts a session for a user who has just logged in
+func (s *SessionService) Create(ctx context.Context, user *models.User, device Device) (*TokenPair, error) {
+	sessionID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	refreshID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	access, refresh, err := s.Tokens.GenerateSessionTokens(user.Email, user.ID, sessionID, refreshID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Now().Unix()
+	key, userKey := sessionKey(sessionID), userSessionsKey(user.ID)
+	if _, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"user_id", user.ID,
+			"refresh_id", refreshID,
+			"access_token", access,
+			"user_agent", device.UserAgent,
+			"ip", device.IP,
+			"created_at", now,
+			"last_used_at", now,
+		)
+		pipe.Expire(ctx, key, utils.RefreshTokenTTL)
+		pipe.Set(ctx, accessTokenKey(access), sessionID, utils.AccessTokenTTL)
+		pipe.SAdd(ctx, userKey, sessionID)
+		pipe.Expire(ctx, userKey, utils.RefreshTokenTTL)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+// Refresh exchanges a session's current refresh token for a new pair. The
+// old refresh token and access token stop working.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, device Device) (*TokenPair, error) {
+	claims, err := s.Tokens.ValidateToken(ctx, refreshToken, true)
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+	sessionID, _ := claims["sid"].(string)
+	refreshID, _ := claims["jti"].(string)
+	email, _ := claims["email"].(string)
+	if sessionID == "" || refreshID == "" {
+		return nil, ErrSessionInvalid
+	}
+
+	var pair *TokenPair
+	var userID uint
+	reused := false
+	key := sessionKey(sessionID)
+	err = s.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		id, err := strconv.ParseUint(fields["user_id"], 10, 64)
+		if claimed, _ := claims["user_id"].(float64); err != nil || uint64(claimed) != id {
+			return ErrSessionInvalid
+		}
+		userID = uint(id)
+		if fields["refresh_id"] != refreshID {
+			// Only this service issues refresh ids for the session, so this is
+			// one it already replaced
+			reused = true
+			return nil
+		}
+
+		newRefreshID, err := randomID()
+		if err != nil {
+			return err
+		}
+		access, refresh, err := s.Tokens.GenerateSessionTokens(email, userID, sessionID, newRefreshID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key,
+				"refresh_id", newRefreshID,
+				"access_token", access,
+				"user_agent", device.UserAgent,
+				"ip", device.IP,
+				"last_used_at", s.Now().Unix(),
+			)
+			pipe.Expire(ctx, key, utils.RefreshTokenTTL)
+			pipe.Del(ctx, accessTokenKey(fields["access_token"]))
+			pipe.Set(ctx, accessTokenKey(access), sessionID, utils.AccessTokenTTL)
+			pipe.Expire(ctx, userSessionsKey(userID), utils.RefreshTokenTTL)
+			return nil
+		})
+		pair = &TokenPair{AccessToken: access, RefreshToken: refresh}
+		return err
+	}, key)
+
+	if errors.Is(err, redis.TxFailedErr) {
+		// Another refresh of the same token won the race; it holds the new pair
+		return nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		if err := s.Revoke(ctx, userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// List returns the user's sessions, most recently used first.
+// currentID marks the session the caller is using.
+func (s *SessionService) List(ctx context.Context, userID uint, currentID string) ([]Session, error) {
+	userKey := userSessionsKey(userID)
+	ids, err := s.Redis.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, id := range ids {
+		fields, err := s.Redis.HGetAll(ctx, sessionKey(id)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			// The session expired; forget it
+			s.Redis.SRem(ctx, userKey, id)
+			continue
+		}
+		created, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+		lastUsed, _ := strconv.ParseInt(fields["last_used_at"], 10, 64)
+		sessions = append(sessions, Session{
+			ID:         id,
+			UserAgent:  fields["user_agent"],
+			IP:         fields["ip"],
+			CreatedAt:  time.Unix(created, 0),
+			LastUsedAt: time.Unix(lastUsed, 0),
+			Current:    id == currentID,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// Revoke ends one of the user's sessions: its refresh token and current
+// access token stop working
+func (s *SessionService) Revoke(ctx context.Context, userID uint, sessionID string) error {
+	key := sessionKey(sessionID)
+	fields, err := s.Redis.HMGet(ctx, key, "user_id", "access_token").Result()
+	if err != nil {
+		return err
+	}
+	owner, _ := fields[0].(string)
+	if owner != strconv.FormatUint(uint64(userID), 10) {
+		return ErrSessionNotFound
+	}
+
+	_, err = s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if access, _ := fields[1].(string); access != "" {
+			pipe.Del(ctx, accessTokenKey(access))
+		}
+		pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+		return nil
+	})
+	return err
+}
+
+// RevokeAll ends every session of the user
+func (s *SessionService) RevokeAll(ctx context.Context, userID uint) error {
+	ids, err := s.Redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.Revoke(ctx, userID, id); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return s.Redis.Del(ctx, userSessionsKey(userID)).Err()
+}
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type SessionServiceInterface interface {
+	Create(ctx context.Context, user *models.User, device Device) (*TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string, device Device) (*TokenPair, error)
+	List(ctx context.Context, userID uint, currentID string) ([]Session, error)
+	Revoke(ctx context.Context, userID uint, sessionID string) error
+	RevokeAll(ctx context.Context, userID uint) error
+}
+
+var _ SessionServiceInterface = &SessionService{}
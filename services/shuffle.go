@@ -0,0 +1,80 @@
+package services
+
+import (
+	"math/rand"
+	"pathshala/models"
+	"strconv"
+	"strings"
+)
+
+// newShuffleSeed picks the seed of a student's question and option order
+func newShuffleSeed() int64 {
+	return rand.Int63()
+}
+
+// shuffledQuestionOrder permutes the question IDs of a test with the attempt's seed
+func shuffledQuestionOrder(questionIDs []uint, seed int64) []uint {
+	order := append([]uint(nil), questionIDs...)
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	return order
+}
+
+// shuffleOptions permutes the options of one question. The seed is combined
+// with the question ID so that every question gets its own order.
+func shuffleOptions(options []models.QuestionOption, seed int64, questionID uint) {
+	rng := rand.New(rand.NewSource(seed ^ int64(questionID)))
+	rng.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+}
+
+// orderQuestions sorts questions by a stored order. Questions missing from the
+// order, e.g. added after the attempt started, keep their place at the end.
+func orderQuestions(questions []models.Question, order []uint) []models.Question {
+	if len(order) == 0 {
+		return questions
+	}
+	position := make(map[uint]int, len(order))
+	for i, id := range order {
+		position[id] = i
+	}
+
+	ordered := make([]models.Question, 0, len(questions))
+	var rest []models.Question
+	byID := make(map[uint]models.Question, len(questions))
+	for _, q := range questions {
+		if _, ok := position[q.ID]; ok {
+			byID[q.ID] = q
+		} else {
+			rest = append(rest, q)
+		}
+	}
+	for _, id := range order {
+		if q, ok := byID[id]; ok {
+			ordered = append(ordered, q)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+func encodeQuestionOrder(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeQuestionOrder(order string) []uint {
+	if order == "" {
+		return nil
+	}
+	var ids []uint
+	for _, part := range strings.Split(order, ",") {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
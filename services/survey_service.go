@@ -1,14 +1,38 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"pathshala/models"
+	"pathshala/utils"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Status of a survey assignment
+const (
+	SurveyAssigned  = "assigned"
+	SurveyCompleted = "completed"
+)
+
+const defaultLikertScale = 5
+
+var (
+	ErrSurveyNotFound      = errors.New("survey not found")
+	ErrInvalidSurvey       = errors.New("invalid survey")
+	ErrInvalidSurveyAnswer = errors.New("invalid survey answer")
+	ErrSurveyHasResponses  = errors.New("survey already has responses")
+	ErrSurveyNotAssigned   = errors.New("survey is not assigned to this student")
+	ErrSurveyCompleted     = errors.New("survey has already been answered")
+	ErrSurveyNotCompleted  = errors.New("survey has not been answered yet")
+	ErrSurveyResultsHidden = errors.New("survey results are not shared")
+)
+
 type SurveyService struct {
 	DB *gorm.DB
 }
@@ -17,92 +41,648 @@ func NewSurveyService(db *gorm.DB) *SurveyService {
 	return &SurveyService{DB: db}
 }
 
-func (s *SurveyService) CreateSurvey(survey models.Survey) error {
-	return s.DB.Create(survey).Error
+// WithContext returns the service running its queries with ctx
+func (s *SurveyService) WithContext(ctx context.Context) SurveyServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
 }
 
-func (s *SurveyService) GetAllSurveys() ([]models.Survey, error) {
-	var surveys []models.Survey
-	err := s.DB.Order("created_at desc").Find(&surveys).Error
-	return surveys, err
+// SurveyQuestionInput is a question as sent by the teacher
+type SurveyQuestionInput struct {
+	QuestionType string   `json:"question_type" binding:"required,oneof=likert multiple_choice text"`
+	QuestionText string   `json:"question_text" binding:"required"`
+	Options      []string `json:"options"` // multiple_choice only
+	Scale        int      `json:"scale"`   // likert only, defaults to 5
+	Required     bool     `json:"required"`
+}
+
+// SurveyAssignInput selects the students a survey is sent to: every student
+// of a college, the listed students, or both
+type SurveyAssignInput struct {
+	CollegeID  *uint  `json:"college_id"`
+	StudentIDs []uint `json:"student_ids"`
+}
+
+// SurveyAnswerInput answers one question; only the field of its type is read
+type SurveyAnswerInput struct {
+	QuestionID  uint   `json:"question_id" binding:"required"`
+	LikertValue *int   `json:"likert_value"`
+	OptionIndex *int   `json:"option_index"`
+	Text        string `json:"text"`
+}
+
+// AssignedSurvey is a survey as listed to a student it was sent to
+type AssignedSurvey struct {
+	SurveyID     uuid.UUID  `json:"survey_id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Anonymous    bool       `json:"anonymous"`
+	ShowResults  bool       `json:"show_results"`
+	NumQuestions int        `json:"num_questions"`
+	Status       string     `json:"status"`
+	AssignedAt   time.Time  `json:"assigned_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
+
+// SurveyChoiceCount is how often a Likert value or an option was chosen
+type SurveyChoiceCount struct {
+	Label      string  `json:"label"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+}
+
+// SurveyQuestionResult aggregates the answers to one question
+type SurveyQuestionResult struct {
+	QuestionID   uint                `json:"question_id"`
+	Position     int                 `json:"position"`
+	QuestionType string              `json:"question_type"`
+	QuestionText string              `json:"question_text"`
+	Answered     int                 `json:"answered"`
+	Mean         *float64            `json:"mean,omitempty"`         // likert only
+	Distribution []SurveyChoiceCount `json:"distribution,omitempty"` // likert and multiple_choice
+	Texts        []string            `json:"texts,omitempty"`        // text only, never shown to students
+}
+
+// SurveyResults aggregates the responses to a survey
+type SurveyResults struct {
+	SurveyID  uuid.UUID              `json:"survey_id"`
+	Name      string                 `json:"name"`
+	Anonymous bool                   `json:"anonymous"`
+	Assigned  int64                  `json:"assigned"`
+	Responses int64                  `json:"responses"`
+	Questions []SurveyQuestionResult `json:"questions"`
+}
+
+func (s *SurveyService) CreateSurvey(survey *models.Survey) (*models.Survey, error) {
+	if strings.TrimSpace(survey.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSurvey)
+	}
+	for i := range survey.Questions {
+		if err := normalizeSurveyQuestion(&survey.Questions[i], i+1); err != nil {
+			return nil, err
+		}
+	}
+	survey.ID = uuid.Nil
+	survey.NumQuestions = len(survey.Questions)
+
+	if err := s.DB.Create(survey).Error; err != nil {
+		return nil, err
+	}
+	return survey, nil
 }
 
-func (s *SurveyService) GetSurveyByID(id string) (models.Survey, error) {
+func (s *SurveyService) GetSurveyByID(id uuid.UUID) (*models.Survey, error) {
 	var survey models.Survey
-	err := s.DB.First(&survey, "id = ?", id).Error
-	return survey, err
+	err := s.DB.Preload("Questions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).First(&survey, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSurveyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &survey, nil
 }
 
-func (s *SurveyService) UpdateSurvey(id string, updatedData map[string]interface{}) error {
-	// Check if survey exists
+// SurveyResource is a survey as a resource for permission checks: owned by
+// its creator, in their college
+func (s *SurveyService) SurveyResource(id uuid.UUID) (utils.Resource, error) {
 	var survey models.Survey
-	if err := s.DB.First(&survey, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("survey with ID %s not found: %w", id, err)
+	err := s.DB.Select("id", "created_by").First(&survey, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.Resource{}, ErrSurveyNotFound
+	}
+	if err != nil {
+		return utils.Resource{}, err
+	}
+	return utils.OwnedResource(s.DB, survey.CreatedBy)
+}
+
+// surveyUpdatableFields are the fields UpdateSurvey may change; questions are
+// replaced through SetQuestions
+var surveyUpdatableFields = map[string]bool{
+	"name": true, "description": true, "category": true, "survey_type": true, "show_results": true, "anonymous": true,
+}
+
+func (s *SurveyService) UpdateSurvey(id uuid.UUID, updatedData map[string]interface{}) (*models.Survey, error) {
+	survey, err := s.GetSurveyByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	for field, value := range updatedData {
+		if !surveyUpdatableFields[field] {
+			return nil, fmt.Errorf("%w: %s cannot be updated", ErrInvalidSurvey, field)
+		}
+		updates[field] = value
+	}
+	if name, ok := updates["name"].(string); ok && strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSurvey)
+	}
+	if _, ok := updates["anonymous"]; ok {
+		// Responses already stored keep the attribution they were given with
+		responses, err := s.countResponses(id)
+		if err != nil {
+			return nil, err
+		}
+		if responses > 0 {
+			return nil, ErrSurveyHasResponses
 		}
-		return fmt.Errorf("error finding survey: %w", err)
 	}
 
-	// Perform the update
-	result := s.DB.Model(&survey).Updates(updatedData)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update survey : %w", result.Error)
+	if len(updates) > 0 {
+		if err := s.DB.Model(survey).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update survey : %w", err)
+		}
 	}
+	return s.GetSurveyByID(id)
+}
 
-	// Optional: check if any row was affected
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("no changes were made to survey with ID %s", id)
+func (s *SurveyService) DeleteSurvey(id uuid.UUID) error {
+	if _, err := s.GetSurveyByID(id); err != nil {
+		return err
 	}
-	return nil
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		responses := tx.Model(&models.SurveyResponse{}).Select("id").Where("survey_id = ?", id)
+		if err := tx.Where("response_id IN (?)", responses).Delete(&models.SurveyAnswer{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.SurveyResponse{}, &models.SurveyAssignment{}, &models.SurveyQuestion{}} {
+			if err := tx.Where("survey_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Survey{}, "id = ?", id).Error
+	})
+}
+
+func pageOffset(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	return pageSize, (page - 1) * pageSize
+}
+
+func (s *SurveyService) GetPaginatedSurveys(page int, pageSize int) ([]models.Survey, int64, error) {
+	var surveys []models.Survey
+	var total int64
+
+	limit, offset := pageOffset(page, pageSize)
+	if err := s.DB.Limit(limit).Offset(offset).Order("created_at DESC").Find(&surveys).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := s.DB.Model(&models.Survey{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	return surveys, total, nil
 }
 
 // function for search survey
 
-func (s *SurveyService) SearchSurveys(query string) ([]models.Survey, error) {
+func (s *SurveyService) SearchSurveys(query string, page int, pageSize int) ([]models.Survey, int64, error) {
 	var surveys []models.Survey
+	var total int64
+
+	pattern := "%" + strings.ToLower(query) + "%"
+	search := func() *gorm.DB {
+		return s.DB.Model(&models.Survey{}).Where(
+			"LOWER(name) LIKE ? OR LOWER(description) LIKE ? OR LOWER(survey_type) LIKE ?",
+			pattern, pattern, pattern,
+		)
+	}
+
+	limit, offset := pageOffset(page, pageSize)
+	if err := search().Limit(limit).Offset(offset).Order("created_at DESC").Find(&surveys).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search surveys: %w", err)
+	}
+	if err := search().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search surveys: %w", err)
+	}
+	return surveys, total, nil
+}
+
+// normalizeSurveyQuestion validates a question and fills in its defaults
+func normalizeSurveyQuestion(q *models.SurveyQuestion, position int) error {
+	q.ID = 0
+	q.Position = position
+	q.QuestionText = strings.TrimSpace(q.QuestionText)
+	if q.QuestionText == "" {
+		return fmt.Errorf("%w: question %d has no text", ErrInvalidSurvey, position)
+	}
+
+	switch q.QuestionType {
+	case models.SurveyLikert:
+		if q.Scale == 0 {
+			q.Scale = defaultLikertScale
+		}
+		if q.Scale < 2 || q.Scale > 10 {
+			return fmt.Errorf("%w: question %d must have a scale of 2 to 10", ErrInvalidSurvey, position)
+		}
+		q.Options = nil
+	case models.SurveyMultipleChoice:
+		if len(q.Options) < 2 {
+			return fmt.Errorf("%w: question %d needs at least two options", ErrInvalidSurvey, position)
+		}
+		for i, option := range q.Options {
+			q.Options[i] = strings.TrimSpace(option)
+			if q.Options[i] == "" {
+				return fmt.Errorf("%w: question %d has an empty option", ErrInvalidSurvey, position)
+			}
+		}
+		q.Scale = 0
+	case models.SurveyText:
+		q.Options = nil
+		q.Scale = 0
+	default:
+		return fmt.Errorf("%w: question %d has unknown type %q", ErrInvalidSurvey, position, q.QuestionType)
+	}
+	return nil
+}
+
+func (s *SurveyService) countResponses(id uuid.UUID) (int64, error) {
+	var count int64
+	err := s.DB.Model(&models.SurveyResponse{}).Where("survey_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// SetQuestions replaces the questions of a survey. Surveys that already have
+// responses keep their questions, so the answers stay readable.
+func (s *SurveyService) SetQuestions(id uuid.UUID, input []SurveyQuestionInput) ([]models.SurveyQuestion, error) {
+	if _, err := s.GetSurveyByID(id); err != nil {
+		return nil, err
+	}
+	responses, err := s.countResponses(id)
+	if err != nil {
+		return nil, err
+	}
+	if responses > 0 {
+		return nil, ErrSurveyHasResponses
+	}
+
+	questions := make([]models.SurveyQuestion, len(input))
+	for i, in := range input {
+		questions[i] = models.SurveyQuestion{
+			SurveyID:     id,
+			QuestionType: in.QuestionType,
+			QuestionText: in.QuestionText,
+			Options:      in.Options,
+			Scale:        in.Scale,
+			Required:     in.Required,
+		}
+		if err := normalizeSurveyQuestion(&questions[i], i+1); err != nil {
+			return nil, err
+		}
+	}
 
-	err := s.DB.Where(
-		"LOWER(name) LIKE ? OR LOWER(description) LIKE ? OR LOWER(survey_type) LIKE ?",
-		"%"+query+"%",
-		"%"+query+"%",
-		"%"+query+"%",
-	).Find(&surveys).Error
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("survey_id = ?", id).Delete(&models.SurveyQuestion{}).Error; err != nil {
+			return err
+		}
+		if len(questions) > 0 {
+			if err := tx.Create(&questions).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Survey{}).Where("id = ?", id).Update("num_questions", len(questions)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
 
+// AssignSurvey sends a survey to active students, the way SendTest sends a
+// test. Students who already have the survey are skipped; the number of
+// newly assigned students is returned.
+func (s *SurveyService) AssignSurvey(id uuid.UUID, input SurveyAssignInput) (int, error) {
+	survey, err := s.GetSurveyByID(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search surveys: %w", err)
+		return 0, err
+	}
+	if len(survey.Questions) == 0 {
+		return 0, fmt.Errorf("%w: survey has no questions", ErrInvalidSurvey)
+	}
+	if input.CollegeID == nil && len(input.StudentIDs) == 0 {
+		return 0, fmt.Errorf("%w: college_id or student_ids is required", ErrInvalidSurvey)
 	}
 
-	return surveys, nil
+	var studentIDs []uint
+	if input.CollegeID != nil {
+		var college models.College
+		if err := s.DB.First(&college, *input.CollegeID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, fmt.Errorf("%w: college %d not found", ErrInvalidSurvey, *input.CollegeID)
+			}
+			return 0, err
+		}
+		if err := s.DB.Model(&models.User{}).Where("college_id = ? AND role = ? AND status = ?", college.ID, utils.RoleStudent, utils.StatusActive).
+			Pluck("id", &studentIDs).Error; err != nil {
+			return 0, err
+		}
+	}
+	if len(input.StudentIDs) > 0 {
+		var found []uint
+		if err := s.DB.Model(&models.User{}).Where("id IN ? AND role = ? AND status = ?", input.StudentIDs, utils.RoleStudent, utils.StatusActive).
+			Pluck("id", &found).Error; err != nil {
+			return 0, err
+		}
+		known := make(map[uint]bool, len(found))
+		for _, studentID := range found {
+			known[studentID] = true
+		}
+		for _, studentID := range input.StudentIDs {
+			if !known[studentID] {
+				return 0, fmt.Errorf("%w: user %d is not an active student", ErrInvalidSurvey, studentID)
+			}
+		}
+		studentIDs = append(studentIDs, found...)
+	}
+
+	var existing []uint
+	if err := s.DB.Model(&models.SurveyAssignment{}).Where("survey_id = ?", id).Pluck("student_id", &existing).Error; err != nil {
+		return 0, err
+	}
+	assigned := make(map[uint]bool, len(existing))
+	for _, studentID := range existing {
+		assigned[studentID] = true
+	}
+
+	var assignments []models.SurveyAssignment
+	for _, studentID := range studentIDs {
+		if assigned[studentID] {
+			continue
+		}
+		assigned[studentID] = true
+		assignments = append(assignments, models.SurveyAssignment{SurveyID: id, StudentID: studentID, Status: SurveyAssigned})
+	}
+	if len(assignments) == 0 {
+		return 0, nil
+	}
+	if err := s.DB.Create(&assignments).Error; err != nil {
+		return 0, err
+	}
+	return len(assignments), nil
 }
 
-func (s *SurveyService) DeleteSurvey(id string) error {
-	return s.DB.Delete(&models.Survey{}, "id = ?", id).Error
+// GetAssignedSurveys lists the surveys sent to a student, newest first
+func (s *SurveyService) GetAssignedSurveys(studentID uint) ([]AssignedSurvey, error) {
+	surveys := []AssignedSurvey{}
+	err := s.DB.Table("survey_assignments").
+		Select("surveys.id AS survey_id, surveys.name, surveys.description, surveys.anonymous, surveys.show_results, surveys.num_questions, "+
+			"survey_assignments.status, survey_assignments.assigned_at, survey_assignments.completed_at").
+		Joins("JOIN surveys ON surveys.id = survey_assignments.survey_id").
+		Where("survey_assignments.student_id = ?", studentID).
+		Order("survey_assignments.assigned_at DESC").
+		Scan(&surveys).Error
+	return surveys, err
 }
 
-func (s *SurveyService) GetPaginatedSurveys(pageStr, limitStr string) ([]models.Survey, int64, error) {
-	var surveys []models.Survey
-	var total int64
+func (s *SurveyService) assignment(id uuid.UUID, studentID uint) (*models.SurveyAssignment, error) {
+	var assignment models.SurveyAssignment
+	err := s.DB.Where("survey_id = ? AND student_id = ?", id, studentID).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSurveyNotAssigned
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
 
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+// GetStudentSurvey returns a survey with its questions to a student it was sent to
+func (s *SurveyService) GetStudentSurvey(id uuid.UUID, studentID uint) (*models.Survey, error) {
+	if _, err := s.assignment(id, studentID); err != nil {
+		return nil, err
 	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10
+	return s.GetSurveyByID(id)
+}
+
+// surveyAnswer validates the answer to a question, returning nil when an
+// optional question was left blank
+func surveyAnswer(q models.SurveyQuestion, in SurveyAnswerInput) (*models.SurveyAnswer, error) {
+	answer := &models.SurveyAnswer{QuestionID: q.ID}
+	switch q.QuestionType {
+	case models.SurveyLikert:
+		if in.LikertValue == nil {
+			return nil, nil
+		}
+		if *in.LikertValue < 1 || *in.LikertValue > q.Scale {
+			return nil, fmt.Errorf("%w: question %d must be answered from 1 to %d", ErrInvalidSurveyAnswer, q.ID, q.Scale)
+		}
+		answer.LikertValue = in.LikertValue
+	case models.SurveyMultipleChoice:
+		if in.OptionIndex == nil {
+			return nil, nil
+		}
+		if *in.OptionIndex < 0 || *in.OptionIndex >= len(q.Options) {
+			return nil, fmt.Errorf("%w: question %d has no option %d", ErrInvalidSurveyAnswer, q.ID, *in.OptionIndex)
+		}
+		answer.OptionIndex = in.OptionIndex
+	default:
+		answer.Text = strings.TrimSpace(in.Text)
+		if answer.Text == "" {
+			return nil, nil
+		}
 	}
+	return answer, nil
+}
 
-	offset := (page - 1) * limit
+// SubmitResponse stores a student's answers and completes their assignment.
+// Responses to anonymous surveys are stored without the student.
+func (s *SurveyService) SubmitResponse(id uuid.UUID, studentID uint, input []SurveyAnswerInput) (*models.SurveyResponse, error) {
+	assignment, err := s.assignment(id, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if assignment.Status == SurveyCompleted {
+		return nil, ErrSurveyCompleted
+	}
+	survey, err := s.GetSurveyByID(id)
+	if err != nil {
+		return nil, err
+	}
 
-	// Fetch surveys with limit and offset
-	if err := s.DB.Limit(limit).Offset(offset).Order("created_at DESC").Find(&surveys).Error; err != nil {
-		return nil, 0, err
+	questions := make(map[uint]models.SurveyQuestion, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.ID] = q
+	}
+	answered := make(map[uint]bool)
+	response := &models.SurveyResponse{SurveyID: id, Answers: []models.SurveyAnswer{}}
+	for _, in := range input {
+		q, ok := questions[in.QuestionID]
+		if !ok {
+			return nil, fmt.Errorf("%w: question %d does not belong to this survey", ErrInvalidSurveyAnswer, in.QuestionID)
+		}
+		if answered[q.ID] {
+			return nil, fmt.Errorf("%w: question %d is answered twice", ErrInvalidSurveyAnswer, q.ID)
+		}
+		answer, err := surveyAnswer(q, in)
+		if err != nil {
+			return nil, err
+		}
+		if answer != nil {
+			answered[q.ID] = true
+			response.Answers = append(response.Answers, *answer)
+		}
+	}
+	for _, q := range survey.Questions {
+		if q.Required && !answered[q.ID] {
+			return nil, fmt.Errorf("%w: question %d is required", ErrInvalidSurveyAnswer, q.ID)
+		}
+	}
+	if !survey.Anonymous {
+		response.StudentID = &studentID
 	}
 
-	// Get total count for pagination
-	if err := s.DB.Model(&models.Survey{}).Count(&total).Error; err != nil {
-		return nil, 0, err
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the first of concurrent submissions completes the assignment
+		now := time.Now()
+		result := tx.Model(&models.SurveyAssignment{}).
+			Where("id = ? AND status = ?", assignment.ID, SurveyAssigned).
+			Updates(map[string]interface{}{"status": SurveyCompleted, "completed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSurveyCompleted
+		}
+		return tx.Create(response).Error
+	})
+	if err != nil {
+		return nil, err
 	}
+	return response, nil
+}
 
-	return surveys, total, nil
+// GetResponses lists the individual responses to a survey, oldest first.
+// Responses to anonymous surveys carry no student.
+func (s *SurveyService) GetResponses(id uuid.UUID) ([]models.SurveyResponse, error) {
+	if _, err := s.GetSurveyByID(id); err != nil {
+		return nil, err
+	}
+	responses := []models.SurveyResponse{}
+	err := s.DB.Preload("Answers").Where("survey_id = ?", id).Order("submitted_at, id").Find(&responses).Error
+	return responses, err
+}
+
+// GetResults aggregates the responses to a survey for its teacher
+func (s *SurveyService) GetResults(id uuid.UUID) (*SurveyResults, error) {
+	survey, err := s.GetSurveyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.aggregate(survey, true)
+}
+
+// GetStudentResults shows the aggregated results to a student who responded,
+// when the survey shares them. Free-text answers are left out.
+func (s *SurveyService) GetStudentResults(id uuid.UUID, studentID uint) (*SurveyResults, error) {
+	assignment, err := s.assignment(id, studentID)
+	if err != nil {
+		return nil, err
+	}
+	survey, err := s.GetSurveyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !survey.ShowResults {
+		return nil, ErrSurveyResultsHidden
+	}
+	if assignment.Status != SurveyCompleted {
+		return nil, ErrSurveyNotCompleted
+	}
+	return s.aggregate(survey, false)
+}
+
+func (s *SurveyService) aggregate(survey *models.Survey, withTexts bool) (*SurveyResults, error) {
+	results := &SurveyResults{
+		SurveyID:  survey.ID,
+		Name:      survey.Name,
+		Anonymous: survey.Anonymous,
+		Questions: []SurveyQuestionResult{},
+	}
+	if err := s.DB.Model(&models.SurveyAssignment{}).Where("survey_id = ?", survey.ID).Count(&results.Assigned).Error; err != nil {
+		return nil, err
+	}
+	responses, err := s.countResponses(survey.ID)
+	if err != nil {
+		return nil, err
+	}
+	results.Responses = responses
+
+	var answers []models.SurveyAnswer
+	err = s.DB.Joins("JOIN survey_responses ON survey_responses.id = survey_answers.response_id").
+		Where("survey_responses.survey_id = ?", survey.ID).
+		Order("survey_answers.id").
+		Find(&answers).Error
+	if err != nil {
+		return nil, err
+	}
+	byQuestion := make(map[uint][]models.SurveyAnswer)
+	for _, answer := range answers {
+		byQuestion[answer.QuestionID] = append(byQuestion[answer.QuestionID], answer)
+	}
+
+	for _, q := range survey.Questions {
+		qa := byQuestion[q.ID]
+		result := SurveyQuestionResult{
+			QuestionID:   q.ID,
+			Position:     q.Position,
+			QuestionType: q.QuestionType,
+			QuestionText: q.QuestionText,
+			Answered:     len(qa),
+		}
+
+		switch q.QuestionType {
+		case models.SurveyLikert:
+			counts := make([]int, q.Scale)
+			values := make([]float64, 0, len(qa))
+			for _, answer := range qa {
+				if answer.LikertValue != nil && *answer.LikertValue >= 1 && *answer.LikertValue <= q.Scale {
+					counts[*answer.LikertValue-1]++
+					values = append(values, float64(*answer.LikertValue))
+				}
+			}
+			if len(values) > 0 {
+				m := round2(mean(values))
+				result.Mean = &m
+			}
+			for i, count := range counts {
+				result.Distribution = append(result.Distribution, SurveyChoiceCount{
+					Label:      strconv.Itoa(i + 1),
+					Count:      count,
+					Percentage: round2(percentage(float64(count), float64(len(qa)))),
+				})
+			}
+		case models.SurveyMultipleChoice:
+			counts := make([]int, len(q.Options))
+			for _, answer := range qa {
+				if answer.OptionIndex != nil && *answer.OptionIndex >= 0 && *answer.OptionIndex < len(q.Options) {
+					counts[*answer.OptionIndex]++
+				}
+			}
+			for i, option := range q.Options {
+				result.Distribution = append(result.Distribution, SurveyChoiceCount{
+					Label:      option,
+					Count:      counts[i],
+					Percentage: round2(percentage(float64(counts[i]), float64(len(qa)))),
+				})
+			}
+		default:
+			if withTexts {
+				result.Texts = []string{}
+				for _, answer := range qa {
+					result.Texts = append(result.Texts, answer.Text)
+				}
+			}
+		}
+		results.Questions = append(results.Questions, result)
+	}
+	return results, nil
 }
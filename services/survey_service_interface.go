@@ -1,17 +1,32 @@
 package services
 
 import (
+	"context"
 	"pathshala/models"
+	"pathshala/utils"
 
 	"github.com/google/uuid"
 )
 
 type SurveyServiceInterface interface {
-	CreateSurvey(survey *models.Survey) (
-		models.Survey, error)
+	WithContext(ctx context.Context) SurveyServiceInterface
+	CreateSurvey(survey *models.Survey) (*models.Survey, error)
 	UpdateSurvey(id uuid.UUID, updatedData map[string]interface{}) (*models.Survey, error)
 	DeleteSurvey(id uuid.UUID) error
 	GetSurveyByID(id uuid.UUID) (*models.Survey, error)
 	GetPaginatedSurveys(page int, pageSize int) ([]models.Survey, int64, error)
 	SearchSurveys(query string, page int, pageSize int) ([]models.Survey, int64, error)
+	SurveyResource(id uuid.UUID) (utils.Resource, error)
+
+	SetQuestions(id uuid.UUID, input []SurveyQuestionInput) ([]models.SurveyQuestion, error)
+	AssignSurvey(id uuid.UUID, input SurveyAssignInput) (int, error)
+	GetResponses(id uuid.UUID) ([]models.SurveyResponse, error)
+	GetResults(id uuid.UUID) (*SurveyResults, error)
+
+	GetAssignedSurveys(studentID uint) ([]AssignedSurvey, error)
+	GetStudentSurvey(id uuid.UUID, studentID uint) (*models.Survey, error)
+	SubmitResponse(id uuid.UUID, studentID uint, input []SurveyAnswerInput) (*models.SurveyResponse, error)
+	GetStudentResults(id uuid.UUID, studentID uint) (*SurveyResults, error)
 }
+
+var _ SurveyServiceInterface = &SurveyService{}
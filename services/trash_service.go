@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/models"
+	"pathshala/storage"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownTrashType   = errors.New("unknown trash type")
+	ErrNotInTrash         = errors.New("item is not in the trash")
+	ErrTrashParentDeleted = errors.New("the item it belongs to is in the trash; restore that first")
+	ErrCollegeInUse       = errors.New("college is referenced by users or categories")
+)
+
+// DefaultTrashRetention is how long deleted items can be restored before
+// the purge job removes them and their files
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// Trash types
+const (
+	TrashTests      = "tests"
+	TrashQuestions  = "questions"
+	TrashUsers      = "users"
+	TrashColleges   = "colleges"
+	TrashCategories = "categories"
+)
+
+type TrashService struct {
+	DB        *gorm.DB
+	Storage   storage.Storage
+	Retention time.Duration
+}
+
+func NewTrashService(db *gorm.DB, store storage.Storage, retention time.Duration) *TrashService {
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+	return &TrashService{DB: db, Storage: store, Retention: retention}
+}
+
+// WithContext returns the service running its queries with ctx
+func (s *TrashService) WithContext(ctx context.Context) TrashServiceInterface {
+	scoped := *s
+	scoped.DB = s.DB.WithContext(ctx)
+	return &scoped
+}
+
+// TrashItem is a deleted item that can still be restored
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// trashDependent is a kind of row that is deleted and restored with an item.
+// Rows deleted with the item share its deleted_at, so rows deleted earlier
+// on their own stay in the trash when the item is restored.
+type trashDependent struct {
+	model func() interface{}
+	where string // Selects the rows of the item by its ID
+}
+
+type trashType struct {
+	model      func() interface{}
+	nameColumn string
+	dependents []trashDependent
+	// purge hard-deletes the item and whatever hangs off it, returning the
+	// files to remove. It returns false when the item must stay for now.
+	purge func(tx *gorm.DB, id uint) (bool, []string, error)
+}
+
+// Cascade rules:
+//   - tests take their assignments, answers and results to the trash; test
+//     questions, blueprints and served questions go when the test is purged
+//   - questions keep their options, revisions and links to tests, so restored
+//     questions are back in their tests; a question is purged only once no
+//     test or attempt uses it
+//   - users take their student or teacher profile; their attempts and
+//     results stay for reports until the user is purged
+//   - colleges cannot be deleted while users or categories, trashed or not,
+//     belong to them
+//   - categories take their questions, and are purged after them
+var trashTypes = map[string]trashType{
+	TrashTests: {
+		model:      func() interface{} { return &models.Test{} },
+		nameColumn: "test_name",
+		dependents: []trashDependent{
+			{func() interface{} { return &models.StudentTest{} }, "test_id = ?"},
+			{func() interface{} { return &models.StudentAnswer{} }, "test_id = ?"},
+			{func() interface{} { return &models.Result{} }, "test_id = ?"},
+		},
+		purge: purgeTest,
+	},
+	TrashQuestions: {
+		model:      func() interface{} { return &models.Question{} },
+		nameColumn: "question_text",
+		purge:      purgeQuestion,
+	},
+	TrashUsers: {
+		model:      func() interface{} { return &models.User{} },
+		nameColumn: "name",
+		dependents: []trashDependent{
+			{func() interface{} { return &models.Student{} }, "user_id = ?"},
+			{func() interface{} { return &models.Teacher{} }, "user_id = ?"},
+		},
+		purge: purgeUser,
+	},
+	TrashColleges: {
+		model:      func() interface{} { return &models.College{} },
+		nameColumn: "name",
+		purge: func(tx *gorm.DB, id uint) (bool, []string, error) {
+			return true, nil, tx.Unscoped().Delete(&models.College{}, id).Error
+		},
+	},
+	TrashCategories: {
+		model:      func() interface{} { return &models.Category{} },
+		nameColumn: "name",
+		dependents: []trashDependent{
+			{func() interface{} { return &models.Question{} }, "category_id = ?"},
+		},
+		purge: purgeCategory,
+	},
+}
+
+// purgeOrder purges items before what they belong to
+var purgeOrder = []string{TrashTests, TrashUsers, TrashQuestions, TrashCategories, TrashColleges}
+
+func lookupTrashType(name string) (trashType, error) {
+	t, ok := trashTypes[name]
+	if !ok {
+		return trashType{}, ErrUnknownTrashType
+	}
+	return t, nil
+}
+
+// Delete moves an item and its dependents to the trash
+func (s *TrashService) Delete(kind string, id uint) error {
+	t, err := lookupTrashType(kind)
+	if err != nil {
+		return err
+	}
+	if kind == TrashColleges {
+		if err := s.checkCollegeUnused(id); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(t.model()).Where("id = ?", id).Update("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		for _, d := range t.dependents {
+			if err := tx.Model(d.model()).Where(d.where, id).Update("deleted_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *TrashService) checkCollegeUnused(id uint) error {
+	var users, categories int64
+	if err := s.DB.Unscoped().Model(&models.User{}).Where("college_id = ?", id).Count(&users).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Unscoped().Model(&models.Category{}).Where("college_id = ?", id).Count(&categories).Error; err != nil {
+		return err
+	}
+	if users > 0 || categories > 0 {
+		return ErrCollegeInUse
+	}
+	return nil
+}
+
+// deletedAt returns when an item went to the trash
+func deletedAt(tx *gorm.DB, t trashType, id uint) (time.Time, error) {
+	var times []time.Time
+	if err := tx.Unscoped().Model(t.model()).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Pluck("deleted_at", &times).Error; err != nil {
+		return time.Time{}, err
+	}
+	if len(times) == 0 {
+		return time.Time{}, ErrNotInTrash
+	}
+	return times[0], nil
+}
+
+// Restore takes an item and the dependents deleted with it out of the trash
+func (s *TrashService) Restore(kind string, id uint) error {
+	t, err := lookupTrashType(kind)
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		at, err := deletedAt(tx, t, id)
+		if err != nil {
+			return err
+		}
+		if kind == TrashQuestions {
+			var question models.Question
+			if err := tx.Unscoped().First(&question, id).Error; err != nil {
+				return err
+			}
+			var trashed int64
+			tx.Unscoped().Model(&models.Category{}).Where("id = ? AND deleted_at IS NOT NULL", question.CategoryID).Count(&trashed)
+			if trashed > 0 {
+				return ErrTrashParentDeleted
+			}
+		}
+
+		for _, d := range t.dependents {
+			if err := tx.Unscoped().Model(d.model()).Where(d.where, id).Where("deleted_at = ?", at).
+				Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Model(t.model()).Where("id = ?", id).Update("deleted_at", nil).Error
+	})
+}
+
+// ListTrash lists deleted items of a type, most recently deleted first
+func (s *TrashService) ListTrash(kind string, page, pageSize int) ([]TrashItem, int64, error) {
+	t, err := lookupTrashType(kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := s.DB.Unscoped().Model(t.model()).Where("deleted_at IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []struct {
+		ID        uint
+		Name      string
+		DeletedAt time.Time
+	}
+	limit, offset := pageOffset(page, pageSize)
+	if err := query.Select("id, " + t.nameColumn + " AS name, deleted_at").
+		Order("deleted_at DESC, id DESC").Offset(offset).Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]TrashItem, len(rows))
+	for i, row := range rows {
+		items[i] = TrashItem{Type: kind, ID: row.ID, Name: row.Name, DeletedAt: row.DeletedAt, PurgeAt: row.DeletedAt.Add(s.Retention)}
+	}
+	return items, total, nil
+}
+
+// PurgeExpired removes items that have been in the trash longer than the
+// retention period, then their stored files. It returns how many items were
+// removed; an item that fails to purge is skipped and its error joined to
+// the returned one, so it cannot hold up the rest.
+func (s *TrashService) PurgeExpired(now time.Time) (int, error) {
+	cutoff := now.Add(-s.Retention)
+	purged := 0
+	var errs []error
+	for _, kind := range purgeOrder {
+		t := trashTypes[kind]
+		var ids []uint
+		if err := s.DB.Unscoped().Model(t.model()).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id").Pluck("id", &ids).Error; err != nil {
+			errs = append(errs, fmt.Errorf("listing expired %s: %w", kind, err))
+			continue
+		}
+		for _, id := range ids {
+			var files []string
+			var removed bool
+			err := s.DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				removed, files, err = t.purge(tx, id)
+				return err
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("purging %s %d: %w", kind, id, err))
+				continue
+			}
+			if removed {
+				purged++
+				for _, file := range files {
+					storage.Remove(context.Background(), s.Storage, file)
+				}
+			}
+		}
+	}
+	return purged, errors.Join(errs...)
+}
+
+func purgeTest(tx *gorm.DB, id uint) (bool, []string, error) {
+	attempts := tx.Unscoped().Model(&models.StudentTest{}).Select("id").Where("test_id = ?", id)
+	answers := tx.Unscoped().Model(&models.StudentAnswer{}).Select("id").Where("test_id = ?", id)
+	if err := runSteps(
+		func() *gorm.DB {
+			return tx.Unscoped().Where("student_test_id IN (?)", attempts).Delete(&models.StudentTestQuestion{})
+		},
+		func() *gorm.DB {
+			return tx.Unscoped().Where("student_answer_id IN (?)", answers).Delete(&models.AnswerCriterionScore{})
+		},
+		func() *gorm.DB { return tx.Unscoped().Where("test_id = ?", id).Delete(&models.StudentAnswer{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("test_id = ?", id).Delete(&models.Result{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("test_id = ?", id).Delete(&models.StudentTest{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("test_id = ?", id).Delete(&models.TestQuestion{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("test_id = ?", id).Delete(&models.TestBlueprint{}) },
+		func() *gorm.DB { return tx.Unscoped().Delete(&models.Test{}, id) },
+	); err != nil {
+		return false, nil, err
+	}
+	return true, nil, nil
+}
+
+func purgeQuestion(tx *gorm.DB, id uint) (bool, []string, error) {
+	var uses int64
+	if err := tx.Model(&models.TestQuestion{}).Where("question_id = ?", id).Count(&uses).Error; err != nil {
+		return false, nil, err
+	}
+	if uses == 0 {
+		if err := tx.Model(&models.StudentTestQuestion{}).Where("question_id = ?", id).Count(&uses).Error; err != nil {
+			return false, nil, err
+		}
+	}
+	if uses > 0 {
+		return false, nil, nil // Purged after the tests using it
+	}
+
+	var question models.Question
+	if err := tx.Unscoped().First(&question, id).Error; err != nil {
+		return false, nil, err
+	}
+	var revisions []models.QuestionRevision
+	if err := tx.Where("question_id = ?", id).Find(&revisions).Error; err != nil {
+		return false, nil, err
+	}
+	files := uniqueFiles(question.Image1, question.Image2)
+	for _, r := range revisions {
+		files = uniqueFiles(append(files, r.Image1, r.Image2)...)
+	}
+
+	if err := runSteps(
+		func() *gorm.DB { return tx.Where("question_id = ?", id).Delete(&models.QuestionOption{}) },
+		func() *gorm.DB { return tx.Where("question_id = ?", id).Delete(&models.RubricCriterion{}) },
+		func() *gorm.DB { return tx.Where("question_id = ?", id).Delete(&models.QuestionRevision{}) },
+		func() *gorm.DB { return tx.Unscoped().Delete(&models.Question{}, id) },
+	); err != nil {
+		return false, nil, err
+	}
+	return true, files, nil
+}
+
+func purgeUser(tx *gorm.DB, id uint) (bool, []string, error) {
+	var user models.User
+	if err := tx.Unscoped().First(&user, id).Error; err != nil {
+		return false, nil, err
+	}
+	attempts := tx.Unscoped().Model(&models.StudentTest{}).Select("id").Where("student_id = ?", id)
+	answers := tx.Unscoped().Model(&models.StudentAnswer{}).Select("id").Where("student_id = ?", id)
+	if err := runSteps(
+		func() *gorm.DB {
+			return tx.Unscoped().Where("student_test_id IN (?)", attempts).Delete(&models.StudentTestQuestion{})
+		},
+		func() *gorm.DB {
+			return tx.Unscoped().Where("student_answer_id IN (?)", answers).Delete(&models.AnswerCriterionScore{})
+		},
+		func() *gorm.DB { return tx.Unscoped().Where("student_id = ?", id).Delete(&models.StudentAnswer{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("user_id = ?", id).Delete(&models.Result{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("student_id = ?", id).Delete(&models.StudentTest{}) },
+		func() *gorm.DB { return tx.Where("user_id = ?", id).Delete(&models.RoleAssignment{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("user_id = ?", id).Delete(&models.Student{}) },
+		func() *gorm.DB { return tx.Unscoped().Where("user_id = ?", id).Delete(&models.Teacher{}) },
+		func() *gorm.DB { return tx.Unscoped().Delete(&models.User{}, id) },
+	); err != nil {
+		return false, nil, err
+	}
+	return true, uniqueFiles(user.Profile_image), nil
+}
+
+func purgeCategory(tx *gorm.DB, id uint) (bool, []string, error) {
+	var uses int64
+	if err := tx.Unscoped().Model(&models.Question{}).Where("category_id = ?", id).Count(&uses).Error; err != nil {
+		return false, nil, err
+	}
+	if uses == 0 {
+		if err := tx.Model(&models.TestBlueprint{}).Where("category_id = ?", id).Count(&uses).Error; err != nil {
+			return false, nil, err
+		}
+	}
+	if uses > 0 {
+		return false, nil, nil // Purged after its questions and the blueprints drawing from it
+	}
+
+	var category models.Category
+	if err := tx.Unscoped().First(&category, id).Error; err != nil {
+		return false, nil, err
+	}
+	if err := tx.Unscoped().Delete(&models.Category{}, id).Error; err != nil {
+		return false, nil, err
+	}
+	var files []string
+	if category.ImagePath != nil {
+		files = uniqueFiles(*category.ImagePath)
+	}
+	return true, files, nil
+}
+
+// runSteps runs deletes in order, stopping at the first that fails
+func runSteps(steps ...func() *gorm.DB) error {
+	for _, step := range steps {
+		if err := step().Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueFiles(paths ...string) []string {
+	seen := map[string]bool{}
+	var files []string
+	for _, path := range paths {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
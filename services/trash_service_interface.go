@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+type TrashServiceInterface interface {
+	WithContext(ctx context.Context) TrashServiceInterface
+	Delete(kind string, id uint) error
+	Restore(kind string, id uint) error
+	ListTrash(kind string, page, pageSize int) ([]TrashItem, int64, error)
+	PurgeExpired(now time.Time) (int, error)
+}
+
+var _ TrashServiceInterface = &TrashService{}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pathshala/models"
+	"pathshala/utils"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidUserStatus = errors.New("status must be invited, active, suspended, graduated or archived")
+	ErrStatusTransition  = errors.New("status cannot change this way")
+)
+
+// UserStatusService moves users through their lifecycle. A user who stops
+// being active is logged out everywhere at once.
+type UserStatusService struct {
+	DB       *gorm.DB
+	Redis    *redis.Client
+	Sessions SessionServiceInterface
+}
+
+func NewUserStatusService(db *gorm.DB, rdb *redis.Client, sessions SessionServiceInterface) *UserStatusService {
+	return &UserStatusService{DB: db, Redis: rdb, Sessions: sessions}
+}
+
+// ChangeStatus sets the status of user, which holds their current status
+func (s *UserStatusService) ChangeStatus(ctx context.Context, user *models.User, status string) error {
+	if !utils.ValidUserStatus(status) {
+		return ErrInvalidUserStatus
+	}
+	if !utils.CanChangeStatus(user.Status, status) {
+		return fmt.Errorf("%w: %s users cannot become %s", ErrStatusTransition, user.Status, status)
+	}
+	if status == utils.StatusGraduated && user.Role != utils.RoleStudent {
+		return fmt.Errorf("%w: only students graduate", ErrStatusTransition)
+	}
+
+	// The condition fails if someone else changed the status meanwhile
+	result := s.DB.Model(&models.User{}).Where("id = ? AND status = ?", user.ID, user.Status).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: the status was changed by someone else", ErrStatusTransition)
+	}
+	user.Status = status
+
+	if err := utils.InvalidateUserCache(ctx, s.Redis, user.ID); err != nil {
+		return err
+	}
+	if status != utils.StatusActive {
+		return s.Sessions.RevokeAll(ctx, user.ID)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package services
+
+import (
+	"context"
+	"pathshala/models"
+)
+
+type UserStatusServiceInterface interface {
+	ChangeStatus(ctx context.Context, user *models.User, status string) error
+}
+
+var _ UserStatusServiceInterface = &UserStatusService{}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"pathshala/config"
+)
+
+// CopyReport counts what Copy did with each file of the source
+type CopyReport struct {
+	Copied  int
+	Skipped int // Already in the destination with the same size
+	Deleted int // Removed from the source after copying
+}
+
+// Copy copies every file of from into to, keeping keys and content types.
+// Files already in to with the same size are skipped, so an interrupted copy
+// can be run again. With deleteSource each file is removed from from once it
+// is in to.
+func Copy(ctx context.Context, from, to Storage, deleteSource bool, out io.Writer) (CopyReport, error) {
+	var report CopyReport
+	var files []Info
+	if err := from.Walk(ctx, func(info Info) error {
+		files = append(files, info)
+		return nil
+	}); err != nil {
+		return report, fmt.Errorf("listing files: %w", err)
+	}
+
+	for _, file := range files {
+		existing, err := to.Stat(ctx, file.Key)
+		switch {
+		case err == nil && existing.Size == file.Size:
+			report.Skipped++
+		case err == nil || errors.Is(err, ErrNotFound):
+			if err := copyFile(ctx, from, to, file.Key); err != nil {
+				return report, fmt.Errorf("copying %s: %w", file.Key, err)
+			}
+			report.Copied++
+			fmt.Fprintf(out, "copied %s\n", file.Key)
+		default:
+			return report, fmt.Errorf("checking %s: %w", file.Key, err)
+		}
+
+		if deleteSource {
+			if err := from.Delete(ctx, file.Key); err != nil {
+				return report, fmt.Errorf("deleting %s: %w", file.Key, err)
+			}
+			report.Deleted++
+		}
+	}
+	return report, nil
+}
+
+func copyFile(ctx context.Context, from, to Storage, key string) error {
+	r, info, err := from.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return to.Put(ctx, key, r, info.Size, info.ContentType)
+}
+
+const commandUsage = "usage: storage copy [-delete-source] FROM TO   (backends: local, s3)"
+
+// RunCommand runs the storage subcommand given its arguments
+func RunCommand(ctx context.Context, cfg config.StorageConfig, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "copy" {
+		return errors.New(commandUsage)
+	}
+
+	flags := flag.NewFlagSet("storage copy", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	deleteSource := flags.Bool("delete-source", false, "remove each file from FROM once it is copied")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 2 || flags.Arg(0) == flags.Arg(1) {
+		return errors.New(commandUsage)
+	}
+
+	backends := make([]Storage, 2)
+	for i, name := range flags.Args() {
+		if err := cfg.Validate(name); err != nil {
+			return err
+		}
+		s, err := OpenBackend(ctx, cfg, name)
+		if err != nil {
+			return err
+		}
+		backends[i] = s
+	}
+
+	report, err := Copy(ctx, backends[0], backends[1], *deleteSource, out)
+	fmt.Fprintf(out, "%d copied, %d already present, %d deleted from %s\n", report.Copied, report.Skipped, report.Deleted, flags.Arg(0))
+	return err
+}
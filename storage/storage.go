@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"pathshala/config"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound        = errors.New("file not found")
+	ErrInvalidKey      = errors.New("invalid file key")
+	ErrUnsupportedType = errors.New("unsupported file type")
+	ErrInvalidURL      = errors.New("download link is invalid or has expired")
+)
+
+// Folders uploads are stored under; the first segment of every key
+const (
+	FolderQuestions  = "questions"
+	FolderCategories = "categories"
+	FolderProfiles   = "profiles"
+)
+
+// Backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Info describes a stored file
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
+// Storage keeps uploaded files under slash-separated keys such as
+// "questions/3f2a….png". Keys, not backend paths, are what the database
+// stores, so files can move between backends.
+type Storage interface {
+	// Put stores size bytes of r under key, replacing any existing file
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens a file; the caller closes it. Missing files are ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Stat describes a file without reading it
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete removes a file; deleting a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn for every stored file
+	Walk(ctx context.Context, fn func(Info) error) error
+	// URL returns a link that downloads the file without further
+	// authentication until expiry passes
+	URL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Open creates the backend cfg selects
+func Open(ctx context.Context, cfg config.StorageConfig) (Storage, error) {
+	return OpenBackend(ctx, cfg, cfg.Backend)
+}
+
+// OpenBackend creates a backend by name from cfg, whichever one cfg selects
+func OpenBackend(ctx context.Context, cfg config.StorageConfig, backend string) (Storage, error) {
+	switch backend {
+	case BackendLocal:
+		return NewLocal(cfg.LocalDir, []byte(cfg.URLSecret)), nil
+	case BackendS3:
+		return NewS3(ctx, cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// CheckKey rejects keys that are empty, absolute or climb out of the store
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key ||
+		key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// Image types accepted for uploads, keyed by sniffed content type, with the
+// extension stored files get
+var (
+	ImageTypes = map[string]string{
+		"image/png":  ".png",
+		"image/jpeg": ".jpg",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+		"image/bmp":  ".bmp",
+	}
+	CategoryImageTypes = map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/bmp": ".bmp"}
+	ProfileImageTypes  = map[string]string{"image/png": ".png", "image/jpeg": ".jpg"}
+)
+
+// Sniff detects the content type of r from its first bytes and returns a
+// reader that still yields the whole content
+func Sniff(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// Save stores r under folder with a random name, after checking that its
+// sniffed content type is one of allowed. Client file names are never used.
+func Save(ctx context.Context, s Storage, folder string, r io.Reader, size int64, allowed map[string]string) (string, error) {
+	contentType, content, err := Sniff(r)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := allowed[contentType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	key := path.Join(folder, uuid.NewString()+ext)
+	if err := s.Put(ctx, key, content, size, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SaveUpload stores a multipart upload like Save
+func SaveUpload(ctx context.Context, s Storage, folder string, file *multipart.FileHeader, allowed map[string]string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return Save(ctx, s, folder, src, file.Size, allowed)
+}
+
+// ReadAll returns the content of a file
+func ReadAll(ctx context.Context, s Storage, key string) ([]byte, error) {
+	r, _, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Remove deletes a file if key is set, logging failures; callers use it to
+// clean up after the change that made the file unused has been saved
+func Remove(ctx context.Context, s Storage, key string) {
+	if key == "" {
+		return
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete file %s: %v", key, err)
+	}
+}
@@ -0,0 +1,432 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ------------- Setup -------------
+
+func setupAttemptTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect to in-memory database")
+	}
+	// Every connection to :memory: is a separate database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.AutoMigrate(&models.User{}, &models.Test{}, &models.Question{}, &models.QuestionOption{}, &models.QuestionRevision{},
+		&models.TestQuestion{}, &models.TestBlueprint{}, &models.StudentTest{}, &models.StudentTestQuestion{}, &models.StudentAnswer{}, &models.Result{},
+		&models.RubricCriterion{}, &models.AnswerCriterionScore{}, &models.AnswerBatch{}, &models.Category{})
+	return db
+}
+
+// addQuestion creates a question the way teachers do, through AddQuestion,
+// and returns it with its options
+func addQuestion(db *gorm.DB, form map[string]string) models.Question {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for field, value := range form {
+		writer.WriteField(field, value)
+	}
+	writer.Close()
+
+	router := gin.New()
+	router.POST("/questions", asSubject(db, adminSubject()), func(c *gin.Context) { controllers.AddQuestion(c, db, nil) })
+	req := httptest.NewRequest(http.MethodPost, "/questions", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		panic("failed to add question: " + w.Body.String())
+	}
+
+	var question models.Question
+	db.Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("option_id") }).Last(&question)
+	return question
+}
+
+// seedAttempt creates a test with one MCQ (option 2 correct) and one descriptive
+// question, assigned to student user 2.
+func seedAttempt(db *gorm.DB) (models.Test, []models.Question) {
+	test := models.Test{TestName: "Algebra", UserID: 1, MinQuestions: 1}
+	db.Create(&test)
+	db.FirstOrCreate(&models.Category{ID: 1, Name: "Algebra"})
+
+	mcq := addQuestion(db, map[string]string{
+		"question_type": "MCQ", "question_text": "2 + 2 = ?", "difficulty": "easy", "category_id": "1",
+		"option_1": "3", "option_2": "4", "correct_option_id": "2",
+	})
+	descriptive := addQuestion(db, map[string]string{
+		"question_type": "DESCRIPTIVE", "question_text": "Define a group", "difficulty": "hard", "category_id": "1",
+		"descriptive_answer": "Model answer",
+	})
+
+	db.Create(&[]models.TestQuestion{
+		{TestID: test.ID, QuestionID: mcq.ID},
+		{TestID: test.ID, QuestionID: descriptive.ID},
+	})
+	db.Create(&models.StudentTest{StudentID: 2, TestID: test.ID, Status: services.AttemptAssigned})
+
+	return test, []models.Question{mcq, descriptive}
+}
+
+// ------------- Tests -------------
+
+func TestAttemptRequiresStart(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	_, err := service.GetAttemptQuestions(test.ID, 2)
+	assert.ErrorIs(t, err, services.ErrAttemptNotStarted)
+
+	_, err = service.StartAttempt(test.ID, 3)
+	assert.ErrorIs(t, err, services.ErrAttemptNotFound)
+
+	attempt, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, services.AttemptInProgress, attempt.Status)
+	assert.NotNil(t, attempt.StartTime)
+}
+
+func TestConcurrentStartsShareOneAttempt(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	// Every start reads the attempt as assigned before any of them saves it
+	const starts = 10
+	var reads int32
+	var read sync.WaitGroup
+	read.Add(starts)
+	db.Callback().Query().After("gorm:query").Register("test:barrier", func(tx *gorm.DB) {
+		if tx.Statement.Table == "student_tests" && atomic.AddInt32(&reads, 1) <= starts {
+			read.Done()
+			read.Wait()
+		}
+	})
+
+	attempts := make([]*models.StudentTest, starts)
+	errs := make([]error, starts)
+	var wg sync.WaitGroup
+	for i := 0; i < starts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			attempts[i], errs[i] = service.StartAttempt(test.ID, 2)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < starts; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, services.AttemptInProgress, attempts[i].Status)
+		assert.Equal(t, attempts[0].ShuffleSeed, attempts[i].ShuffleSeed, "every start serves the same attempt")
+	}
+	var questions int64
+	db.Model(&models.StudentTestQuestion{}).Where("student_test_id = ?", attempts[0].ID).Count(&questions)
+	assert.EqualValues(t, 2, questions, "the attempt is given its questions once")
+}
+
+func TestAttemptQuestionsHideAnswerKey(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	_, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	questions, err := service.GetAttemptQuestions(test.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, questions, 2)
+	assert.Len(t, questions[0].Options, 2)
+	assert.Empty(t, questions[1].Options, "descriptive model answer must not be served")
+}
+
+func TestAttemptSubmit(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	_, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	err = service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: 999, Selected: "1"}})
+	assert.ErrorIs(t, err, services.ErrQuestionNotInTest)
+
+	require.NoError(t, service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "1"}}))
+	require.NoError(t, service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "2"}}))
+
+	var answerCount int64
+	db.Model(&models.StudentAnswer{}).Where("test_id = ? AND student_id = ?", test.ID, 2).Count(&answerCount)
+	assert.EqualValues(t, 1, answerCount, "resaving an answer replaces it")
+
+	result, err := service.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Correct)
+	assert.Equal(t, 0, result.Incorrect)
+
+	_, err = service.SubmitAttempt(test.ID, 2)
+	assert.ErrorIs(t, err, services.ErrAttemptSubmitted)
+}
+
+func TestSendingATestAgainOnlyAssignsNewStudents(t *testing.T) {
+	db := seedTenants(t)
+	router := gin.New()
+	router.POST("/tests/send", asSubject(db, adminSubject()), func(c *gin.Context) { controllers.SendTest(c, db) })
+	send := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"test_id": 1, "college_id": 1, "state": "Delhi"}`)
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tests/send", body))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	assert.EqualValues(t, 1, send()["students"])
+	iit := uint(1)
+	db.Create(&models.User{ID: 5, Name: "Kiran", Email: "kiran@example.com", Password: "x", Role: "student", CollegeID: &iit})
+	response := send()
+	assert.EqualValues(t, 1, response["students"], "only the new student is assigned")
+	assert.EqualValues(t, 1, response["already_assigned"])
+
+	var assigned []uint
+	db.Model(&models.StudentTest{}).Where("test_id = ?", 1).Order("student_id").Pluck("student_id", &assigned)
+	assert.Equal(t, []uint{2, 5}, assigned)
+
+	err := db.Create(&models.StudentTest{TestID: 1, StudentID: 2, Status: services.AttemptAssigned}).Error
+	assert.Error(t, err, "a test is assigned to a student once")
+	require.NoError(t, db.Create(&models.Result{TestID: 1, UserID: 2}).Error)
+	assert.Error(t, db.Create(&models.Result{TestID: 1, UserID: 2}).Error, "a student has one result per test")
+}
+
+func TestAttemptAvailabilityWindow(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	future := time.Now().Add(time.Hour)
+	db.Model(&test).Update("opens_at", future)
+	_, err := service.StartAttempt(test.ID, 2)
+	assert.ErrorIs(t, err, services.ErrTestNotOpen)
+
+	past := time.Now().Add(-time.Hour)
+	db.Model(&test).Updates(map[string]interface{}{"opens_at": nil, "closes_at": past})
+	_, err = service.StartAttempt(test.ID, 2)
+	assert.ErrorIs(t, err, services.ErrTestClosed)
+}
+
+func TestExpiredAttemptsAreAutoSubmitted(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	db.Model(&test).Update("duration_minutes", 30)
+	attempt, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	require.NotNil(t, attempt.Deadline)
+	assert.WithinDuration(t, attempt.StartTime.Add(30*time.Minute), *attempt.Deadline, time.Second)
+
+	require.NoError(t, service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "2"}}))
+
+	// Move the attempt back in time so that its deadline has passed
+	started := time.Now().Add(-time.Hour)
+	deadline := started.Add(30 * time.Minute)
+	db.Model(attempt).Updates(map[string]interface{}{"start_time": started, "deadline": deadline})
+
+	err = service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "1"}})
+	assert.ErrorIs(t, err, services.ErrAttemptExpired)
+
+	finalized, err := service.FinalizeExpiredAttempts(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, finalized)
+
+	var result models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&result).Error)
+	assert.True(t, result.AutoSubmitted)
+	assert.Equal(t, 1, result.Correct)
+	assert.EqualValues(t, 30*60, result.TimeTakenSeconds, "time taken is capped at the deadline")
+
+	finalized, err = service.FinalizeExpiredAttempts(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, finalized)
+}
+
+func TestExpiryOutlivesFailingAttempts(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	// An attempt of a test that no longer exists cannot be graded
+	past := time.Now().Add(-time.Hour)
+	db.Create(&models.StudentTest{StudentID: 3, TestID: 999, Status: services.AttemptInProgress, Deadline: &past})
+	db.Model(&test).Update("closes_at", past)
+
+	finalized, err := service.FinalizeExpiredAttempts(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, finalized, "the attempt never started is closed with the test")
+
+	attempt, err := service.FindAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, services.AttemptSubmitted, attempt.Status)
+	var result models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&result).Error)
+	assert.True(t, result.AutoSubmitted)
+	assert.Zero(t, result.Score)
+}
+
+func TestSaveAnswersIsIdempotent(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	_, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	replayed, err := service.SaveAnswersIdempotent(test.ID, 2, "batch-1", []services.AnswerInput{
+		{QuestionID: questions[0].ID, Selected: "1"},
+		{QuestionID: questions[0].ID, Selected: "2"},
+	})
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	replayed, err = service.SaveAnswersIdempotent(test.ID, 2, "batch-2", []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "1"}})
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	// A late retry of the first batch must not overwrite the newer answer
+	replayed, err = service.SaveAnswersIdempotent(test.ID, 2, "batch-1", []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "2"}})
+	require.NoError(t, err)
+	assert.True(t, replayed)
+
+	var answers []models.StudentAnswer
+	db.Where("test_id = ? AND student_id = ?", test.ID, 2).Find(&answers)
+	require.Len(t, answers, 1)
+	assert.Equal(t, "1", answers[0].Selected)
+
+	// A batch with an invalid question saves nothing
+	_, err = service.SaveAnswersIdempotent(test.ID, 2, "batch-3", []services.AnswerInput{
+		{QuestionID: questions[1].ID, Selected: "Partial"},
+		{QuestionID: 999, Selected: "1"},
+	})
+	assert.ErrorIs(t, err, services.ErrQuestionNotInTest)
+	var count int64
+	db.Model(&models.StudentAnswer{}).Where("test_id = ? AND student_id = ?", test.ID, 2).Count(&count)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestIdempotencyKeysBelongToTheAttempt(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	other, otherQuestions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+	for _, id := range []uint{test.ID, other.ID} {
+		_, err := service.StartAttempt(id, 2)
+		require.NoError(t, err)
+	}
+
+	_, err := service.SaveAnswersIdempotent(test.ID, 2, "batch-1", []services.AnswerInput{{QuestionID: questions[1].ID, Selected: "Closure"}})
+	require.NoError(t, err)
+	_, err = service.SaveAnswersIdempotent(test.ID, 2, "batch-1", []services.AnswerInput{{QuestionID: questions[1].ID, Selected: "Inverses"}})
+	assert.ErrorIs(t, err, services.ErrIdempotencyKeyReused)
+
+	replayed, err := service.SaveAnswersIdempotent(other.ID, 2, "batch-1", []services.AnswerInput{{QuestionID: otherQuestions[1].ID, Selected: "Closure"}})
+	require.NoError(t, err)
+	assert.False(t, replayed, "keys of another attempt do not collide")
+}
+
+func TestResavingAnUnchangedAnswerKeepsItsGrade(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+	_, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	answer := []services.AnswerInput{{QuestionID: questions[1].ID, Selected: "Closure"}}
+	require.NoError(t, service.SaveAnswers(test.ID, 2, answer))
+	db.Model(&models.StudentAnswer{}).Where("question_id = ?", questions[1].ID).
+		Updates(map[string]interface{}{"points": 2, "feedback": "Good", "graded_by": 1})
+
+	require.NoError(t, service.SaveAnswers(test.ID, 2, answer))
+	var stored models.StudentAnswer
+	require.NoError(t, db.Where("question_id = ?", questions[1].ID).First(&stored).Error)
+	require.NotNil(t, stored.Points)
+	assert.Equal(t, 2.0, *stored.Points)
+	assert.Equal(t, "Good", stored.Feedback)
+
+	require.NoError(t, service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[1].ID, Selected: "Closure and identity"}}))
+	require.NoError(t, db.Where("question_id = ?", questions[1].ID).First(&stored).Error)
+	assert.Nil(t, stored.Points, "a changed answer is graded again")
+	assert.Empty(t, stored.Feedback)
+	assert.Nil(t, stored.GradedBy)
+}
+
+func TestShuffledAttemptIsStableAndGradedByOptionID(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	service := services.NewAttemptService(db)
+
+	var filler models.Question
+	for i := 0; i < 6; i++ {
+		q := models.Question{QuestionType: "MCQ", QuestionText: "Filler", Difficulty: "easy", CategoryID: 1}
+		db.Create(&q)
+		db.Create(&[]models.QuestionOption{
+			{QuestionID: q.ID, OptionID: 1, OptionText: "a", IsCorrect: true},
+			{QuestionID: q.ID, OptionID: 2, OptionText: "b"},
+			{QuestionID: q.ID, OptionID: 3, OptionText: "c"},
+		})
+		db.Create(&models.TestQuestion{TestID: test.ID, QuestionID: q.ID})
+		filler = q
+	}
+	db.Model(&test).Updates(map[string]interface{}{"shuffle_questions": true, "shuffle_options": true})
+
+	attempt, err := service.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, attempt.QuestionOrder)
+
+	first, err := service.GetAttemptQuestions(test.ID, 2)
+	require.NoError(t, err)
+	again, err := service.GetAttemptQuestions(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "a student always sees the same order")
+	assert.Len(t, first, 8)
+
+	// Answer the MCQ by the ID of its correct option, wherever it was shown
+	correctOption, wrongOption := questions[0].Options[1].ID, questions[0].Options[0].ID
+	require.True(t, questions[0].Options[1].IsCorrect)
+	require.NoError(t, service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, OptionID: &correctOption}}))
+
+	err = service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[1].ID, OptionID: &wrongOption}})
+	assert.ErrorIs(t, err, services.ErrOptionNotInQuestion)
+	err = service.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "2"}})
+	assert.ErrorIs(t, err, services.ErrOptionIDRequired, "a position does not identify a shuffled option")
+
+	// A positional answer stored before the check is not graded
+	db.Create(&models.StudentAnswer{TestID: test.ID, StudentID: 2, QuestionID: filler.ID, Selected: "1"})
+
+	result, err := service.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Correct)
+	assert.Equal(t, 1, result.Ignored)
+	assert.Equal(t, 1.0, result.Score)
+}
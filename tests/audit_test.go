@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/middlewares"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuditTest(t *testing.T) (*services.AuditService, *gin.Engine) {
+	db := setupAttemptTestDB()
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	service := services.NewAuditService(db)
+
+	router := gin.New()
+	router.Use(middlewares.AuditMiddleware(service))
+	login := func(c *gin.Context) {
+		if role := c.GetHeader("X-Role"); role != "" {
+			c.Set("user_id", float64(7))
+			c.Set("role", role)
+		}
+	}
+	router.PUT("/api/colleges/:id", login, func(c *gin.Context) {
+		utils.Audit(c, "update", "colleges", c.Param("id"), gin.H{"name": "IIT"}, gin.H{"name": "IIT Delhi"})
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.DELETE("/api/tests/:id", login, func(c *gin.Context) { c.JSON(http.StatusForbidden, gin.H{}) })
+	router.POST("/api/student/tests/:id/answers", login, func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+	router.GET("/api/tests/:id", login, func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+	return service, router
+}
+
+func auditRequest(router *gin.Engine, method, path, role string) {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Role", role)
+	req.Header.Set("User-Agent", "audit-test")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAuditMiddlewareRecordsMutatingRequests(t *testing.T) {
+	service, router := setupAuditTest(t)
+
+	auditRequest(router, http.MethodPut, "/api/colleges/3", utils.RoleAdmin)
+	auditRequest(router, http.MethodDelete, "/api/tests/9", utils.RoleTeacher)
+	auditRequest(router, http.MethodPost, "/api/student/tests/9/answers", utils.RoleStudent)
+	auditRequest(router, http.MethodGet, "/api/tests/9", utils.RoleTeacher)
+
+	entries, total, err := service.ListAuditLogs(services.AuditFilter{}, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total, "reads and undescribed student requests are not recorded")
+
+	denied := entries[0]
+	assert.Equal(t, "delete", denied.Action, "the action follows the method when the handler does not describe it")
+	assert.Equal(t, "tests", denied.EntityType)
+	assert.Equal(t, "9", denied.EntityID)
+	assert.Equal(t, http.StatusForbidden, denied.StatusCode)
+	assert.Equal(t, "/api/tests/:id", denied.Route)
+
+	update := entries[1]
+	require.NotNil(t, update.ActorID)
+	assert.Equal(t, uint(7), *update.ActorID)
+	assert.Equal(t, utils.RoleAdmin, update.ActorRole)
+	assert.Equal(t, "colleges", update.EntityType)
+	assert.Equal(t, "3", update.EntityID)
+	assert.Equal(t, map[string]interface{}{"name": "IIT"}, update.Before)
+	assert.Equal(t, map[string]interface{}{"name": "IIT Delhi"}, update.After)
+	assert.Equal(t, "audit-test", update.UserAgent)
+
+	assert.ErrorIs(t, service.DB.Model(&update).Update("action", "read").Error, models.ErrAuditAppendOnly)
+	assert.ErrorIs(t, service.DB.Delete(&update).Error, models.ErrAuditAppendOnly)
+}
+
+func TestAuditFiltersAndCSVExport(t *testing.T) {
+	service, router := setupAuditTest(t)
+	auditRequest(router, http.MethodPut, "/api/colleges/3", utils.RoleAdmin)
+	auditRequest(router, http.MethodDelete, "/api/tests/9", utils.RoleTeacher)
+	require.NoError(t, service.DB.Create(&models.AuditLog{Action: "update", EntityType: "users", EntityID: "-5",
+		UserAgent: `=HYPERLINK("http://evil.example")`}).Error)
+
+	entries, total, err := service.ListAuditLogs(services.AuditFilter{EntityType: "colleges"}, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, "update", entries[0].Action)
+
+	var buf bytes.Buffer
+	require.NoError(t, service.ExportAuditCSV(&buf, services.AuditFilter{Action: "update"}))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "before", records[0][7])
+	assert.Equal(t, `{"name":"IIT"}`, records[1][7])
+	assert.Equal(t, `{"name":"IIT Delhi"}`, records[1][8])
+	assert.Equal(t, "-5", records[2][6], "numbers are not escaped")
+	assert.Equal(t, `'=HYPERLINK("http://evil.example")`, records[2][13], "cells a spreadsheet would run are escaped")
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedPool adds n questions of a difficulty to a category
+func seedPool(db *gorm.DB, categoryID uint, difficulty string, n int) {
+	db.FirstOrCreate(&models.Category{ID: categoryID, Name: "Pool"})
+	for i := 0; i < n; i++ {
+		correct := uint(1) // A position, as AddQuestion stores it
+		q := models.Question{QuestionType: "MCQ", QuestionText: "Pool question", Difficulty: difficulty, CategoryID: categoryID, CorrectOptionID: &correct}
+		db.Create(&q)
+		db.Create(&models.QuestionOption{QuestionID: q.ID, OptionID: 1, OptionText: "a", IsCorrect: true})
+	}
+}
+
+func TestBlueprintPoolsAreChecked(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, _ := seedAttempt(db)
+	blueprints := services.NewBlueprintService(db)
+
+	seedPool(db, 3, "EASY", 4)
+	seedPool(db, 7, "hard", 2)
+
+	_, err := blueprints.SetBlueprint(test.ID, []services.BlueprintRuleInput{{CategoryID: 3, Difficulty: "trivial", Count: 1}})
+	assert.ErrorIs(t, err, services.ErrInvalidBlueprint)
+	_, err = blueprints.SetBlueprint(test.ID, []services.BlueprintRuleInput{{CategoryID: 42, Difficulty: "easy", Count: 1}})
+	assert.ErrorIs(t, err, services.ErrInvalidBlueprint, "the category must exist")
+
+	_, err = blueprints.SetBlueprint(test.ID, []services.BlueprintRuleInput{
+		{CategoryID: 3, Difficulty: "easy", Count: 3},
+		{CategoryID: 7, Difficulty: "HARD", Count: 2},
+		{CategoryID: 7, Difficulty: "HARD", Count: 1},
+	})
+	var shortage *services.PoolShortageError
+	require.ErrorAs(t, err, &shortage)
+	assert.ErrorIs(t, err, services.ErrPoolTooSmall)
+	assert.Equal(t, []services.PoolShortage{{CategoryID: 7, Difficulty: "HARD", Required: 3, Available: 2}}, shortage.Shortages)
+	rules, err := blueprints.GetBlueprint(test.ID)
+	require.NoError(t, err)
+	assert.Empty(t, rules, "a refused blueprint is not saved")
+
+	_, err = blueprints.SetBlueprint(test.ID, []services.BlueprintRuleInput{
+		{CategoryID: 3, Difficulty: "easy", Count: 3},
+		{CategoryID: 7, Difficulty: "HARD", Count: 2},
+	})
+	require.NoError(t, err)
+	size, err := blueprints.BlueprintSize(test.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, size)
+
+	// The pool can still shrink after the blueprint is saved
+	var hard models.Question
+	require.NoError(t, db.Where("category_id = ?", 7).First(&hard).Error)
+	db.Delete(&hard)
+	shortages, err := blueprints.CheckPools(test.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []services.PoolShortage{{CategoryID: 7, Difficulty: "HARD", Required: 2, Available: 1}}, shortages)
+
+	router := gin.New()
+	router.POST("/tests/:test_id/start", func(c *gin.Context) { c.Set("user_id", float64(2)) },
+		controllers.NewStudentTestController(services.NewAttemptService(db)).StartTest)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tests/%d/start", test.ID), nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "category 7 has 1 HARD questions, 2 needed")
+}
+
+func TestAttemptDrawsFromBlueprint(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	attempts := services.NewAttemptService(db)
+	blueprints := services.NewBlueprintService(db)
+
+	seedPool(db, 3, "EASY", 5)
+	_, err := blueprints.SetBlueprint(test.ID, []services.BlueprintRuleInput{{CategoryID: 3, Difficulty: "EASY", Count: 2}})
+	require.NoError(t, err)
+
+	_, err = attempts.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	served, err := attempts.GetAttemptQuestions(test.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, served, 4, "two fixed questions and two drawn ones")
+	assert.Equal(t, questions[0].ID, served[0].ID)
+	assert.Equal(t, questions[1].ID, served[1].ID)
+
+	// A question of the pool that was not drawn cannot be answered
+	var notDrawn models.Question
+	require.NoError(t, db.Where("category_id = ? AND id NOT IN ?", 3, []uint{served[2].ID, served[3].ID}).First(&notDrawn).Error)
+	err = attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: notDrawn.ID, Selected: "1"}})
+	assert.ErrorIs(t, err, services.ErrQuestionNotInTest)
+
+	require.NoError(t, attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: served[2].ID, Selected: "1"}}))
+	result, err := attempts.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Correct)
+	assert.Equal(t, 6.0, result.MaxScore, "an easy and a hard fixed question, two easy drawn ones")
+
+	attemptResult, err := attempts.GetAttemptResult(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{questions[0].ID, questions[1].ID, served[2].ID, served[3].ID}, attemptResult.QuestionIDs)
+}
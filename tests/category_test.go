@@ -126,8 +126,8 @@ func TestAddCategory(t *testing.T) {
 	category := models.Category{
 		Name:            "Test Category",
 		MacroCategoryID: ptrUint(1),
-		CollegeName:     String("Test College"),
-		State:           String("Test State"),
+		CollegeID:       ptrUint(1),
+		Shared:          true,
 		CreatorName:     "Test Creator",
 		Description:     String("This is a description"),
 		ImagePath:       String("path/to/image.png"),
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"pathshala/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEnvFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "test.env")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigFlagsOverrideEnvOverrideFile(t *testing.T) {
+	envFile := writeEnvFile(t, "DB_HOST=db.internal\nDB_NAME=pathshala\nADDR=:7000\nREDIS_ADDR=redis:6379\n")
+	t.Setenv("ADDR", ":9000")
+	t.Setenv("DB_NAME", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+
+	cfg, args, err := config.Load([]string{"-env-file", envFile, "-addr", ":9999", "migrate", "status"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "status"}, args)
+
+	assert.Equal(t, ":9999", cfg.Addr, "flags win over the environment")
+	assert.Equal(t, 10*time.Second, cfg.ShutdownTimeout, "the environment wins over defaults")
+	assert.Equal(t, "db.internal", cfg.Database.Host)
+	assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+	assert.Equal(t, 5432, cfg.Database.Port, "defaults fill what is not set")
+	assert.Equal(t, 30*24*time.Hour, cfg.TrashRetention)
+	assert.Empty(t, cfg.TrustedProxies, "no proxy is trusted unless configured")
+	assert.Equal(t, 3, cfg.Login.ResetsPerAccount)
+}
+
+func TestConfigReportsBadAndMissingSettings(t *testing.T) {
+	t.Setenv("DB_PORT", "five")
+	_, _, err := config.Load([]string{"-env-file", writeEnvFile(t, "")})
+	assert.ErrorContains(t, err, "DB_PORT must be a number")
+
+	_, _, err = config.Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	assert.Error(t, err, "an env file named on the command line must exist")
+
+	cfg := &config.Config{
+		Addr:            ":8080",
+		ShutdownTimeout: time.Second,
+		TrashRetention:  time.Hour,
+		PasswordReset:   time.Minute,
+		Database:        config.DatabaseConfig{Host: "localhost", Port: 5432},
+		Redis:           config.RedisConfig{Addr: "localhost:6379"},
+		JWT:             config.JWTConfig{Secret: "same", RefreshSecret: "same"},
+		Storage:         config.StorageConfig{Backend: "local", LocalDir: "uploads", URLExpiry: time.Minute},
+		MFA:             config.MFAConfig{Issuer: "Pathshala", EncryptionKey: "short", ChallengeTTL: time.Minute},
+		TrustedProxies:  []string{"10.0.0.0/8", "proxy.internal"},
+		Login: config.LoginGuardConfig{
+			Window: time.Minute, MaxDelay: time.Second, LockoutDuration: time.Minute,
+			AccountFree: 5, AccountLockout: 5, IPFree: 10, IPLockout: 100,
+		},
+	}
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "DB_USER is required")
+	assert.ErrorContains(t, err, "DB_NAME is required")
+	assert.ErrorContains(t, err, "JWT_SECRET and JWT_REFRESH_SECRET must differ")
+	assert.ErrorContains(t, err, "STORAGE_URL_SECRET is required")
+	assert.ErrorContains(t, err, "MFA_ENCRYPTION_KEY must be at least 32 characters")
+	assert.ErrorContains(t, err, "LOGIN_ACCOUNT_FREE_ATTEMPTS must be positive and below LOGIN_ACCOUNT_LOCKOUT_ATTEMPTS")
+	assert.ErrorContains(t, err, "PASSWORD_RESETS_PER_ACCOUNT must be positive")
+	assert.ErrorContains(t, err, `TRUSTED_PROXIES entry "proxy.internal" is not an IP or CIDR`)
+
+	cfg.Database.User, cfg.Database.Name = "pathshala", "pathshala"
+	cfg.JWT.RefreshSecret = "other"
+	cfg.Storage.URLSecret = "signing-key"
+	cfg.MFA.EncryptionKey = "0123456789abcdef0123456789abcdef"
+	cfg.Login.AccountLockout = 10
+	cfg.Login.ResetsPerAccount = 3
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.7"}
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptiveGradingRecomputesResult(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	db.Create(&models.User{ID: 2, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "student"})
+
+	attempts := services.NewAttemptService(db)
+	grading := services.NewGradingService(db, attempts)
+
+	_, err := attempts.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	require.NoError(t, attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{
+		{QuestionID: questions[0].ID, Selected: "2"},
+		{QuestionID: questions[1].ID, Selected: "A set with an associative operation"},
+	}))
+
+	result, err := attempts.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, result.Score)
+	assert.Equal(t, 1, result.PendingGrading)
+
+	rubric, err := grading.SetRubric(questions[1].ID, []services.RubricInput{
+		{Description: "Closure and associativity", MaxPoints: 2},
+		{Description: "Identity and inverses", MaxPoints: 3},
+	})
+	require.NoError(t, err)
+
+	_, err = grading.SetRubric(questions[0].ID, []services.RubricInput{{Description: "n/a", MaxPoints: 1}})
+	assert.ErrorIs(t, err, services.ErrNotDescriptive)
+
+	queue, err := grading.GradingQueue(test.ID)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, "Asha", queue[0].StudentName)
+	assert.Equal(t, 5.0, queue[0].MaxPoints)
+
+	_, err = grading.GradeAnswer(queue[0].AnswerID, 1, services.GradeInput{
+		Criteria: []services.CriterionPoints{{CriterionID: rubric[0].ID, Points: 2}, {CriterionID: rubric[1].ID, Points: 4}},
+	})
+	assert.ErrorIs(t, err, services.ErrInvalidGrade, "points above the criterion maximum are rejected")
+
+	graded, err := grading.GradeAnswer(queue[0].AnswerID, 1, services.GradeInput{
+		Criteria: []services.CriterionPoints{{CriterionID: rubric[0].ID, Points: 2}, {CriterionID: rubric[1].ID, Points: 1.5}},
+		Feedback: "Inverses are missing",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3.5, *graded.Points)
+
+	var stored models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&stored).Error)
+	assert.InDelta(t, 1+3*3.5/5, stored.Score, 1e-9, "rubric points scale the marks of the hard question")
+	assert.Equal(t, 0, stored.PendingGrading)
+
+	queue, err = grading.GradingQueue(test.ID)
+	require.NoError(t, err)
+	assert.Empty(t, queue)
+}
+
+func TestRubricEditsDoNotRescoreGradedAnswers(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	db.Create(&models.User{ID: 2, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "student"})
+
+	attempts := services.NewAttemptService(db)
+	grading := services.NewGradingService(db, attempts)
+
+	_, err := attempts.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	require.NoError(t, attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{
+		{QuestionID: questions[0].ID, Selected: "2"},
+		{QuestionID: questions[1].ID, Selected: "A set with an associative operation"},
+	}))
+	_, err = attempts.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+
+	rubric, err := grading.SetRubric(questions[1].ID, []services.RubricInput{
+		{Description: "Closure and associativity", MaxPoints: 2},
+		{Description: "Identity and inverses", MaxPoints: 3},
+	})
+	require.NoError(t, err)
+	queue, err := grading.GradingQueue(test.ID)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	graded, err := grading.GradeAnswer(queue[0].AnswerID, 1, services.GradeInput{
+		Criteria: []services.CriterionPoints{{CriterionID: rubric[0].ID, Points: 2}, {CriterionID: rubric[1].ID, Points: 1.5}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, graded.MaxPoints)
+	assert.Equal(t, 5.0, *graded.MaxPoints)
+
+	_, err = grading.SetRubric(questions[1].ID, []services.RubricInput{
+		{Description: "Closure and associativity", MaxPoints: 10},
+	})
+	require.NoError(t, err)
+	_, err = grading.RescoreTest(test.ID)
+	require.NoError(t, err)
+
+	var stored models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&stored).Error)
+	assert.InDelta(t, 1+3*3.5/5, stored.Score, 1e-9, "the answer stays scored against the rubric it was graded with")
+}
+
+func TestRubricsNeedGradingRights(t *testing.T) {
+	db := seedTenants(t)
+	db.Model(&models.Question{}).Where("id IN ?", []uint{2, 3, 4}).Update("question_type", "DESCRIPTIVE")
+	// NIT's test uses its private and shared questions and the platform one, IIT's only the platform one
+	db.Create(&[]models.TestQuestion{{TestID: 2, QuestionID: 2}, {TestID: 2, QuestionID: 3}, {TestID: 2, QuestionID: 4}, {TestID: 1, QuestionID: 4}})
+
+	grader := func(userID, collegeID uint) *utils.Subject {
+		subject := teacherSubject(userID, collegeID)
+		subject.Grants = append(subject.Grants,
+			utils.Grant{Role: utils.RoleTeacher, Permission: utils.PermTestGrade, Scope: utils.ScopeOwn},
+			utils.Grant{Role: utils.RoleTeacher, Permission: utils.PermQuestionEdit, Scope: utils.ScopeGlobal})
+		return subject
+	}
+	gradingController := controllers.NewGradingController(db, services.NewGradingService(db, services.NewAttemptService(db)))
+	rubric := func(subject *utils.Subject, method string, questionID string) int {
+		router := gin.New()
+		router.Use(asSubject(db, subject))
+		router.GET("/questions/:question_id/rubric", gradingController.GetRubric)
+		router.PUT("/questions/:question_id/rubric", gradingController.SetRubric)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{"criteria": [{"description": "Accuracy", "max_points": 2}]}`)
+		router.ServeHTTP(w, httptest.NewRequest(method, "/questions/"+questionID+"/rubric", body))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, rubric(grader(1, 1), http.MethodGet, "2"), "NIT's private question is hidden from IIT")
+	assert.Equal(t, http.StatusNotFound, rubric(grader(1, 1), http.MethodPut, "2"))
+	assert.Equal(t, http.StatusOK, rubric(grader(3, 2), http.MethodPut, "2"))
+	assert.Equal(t, http.StatusForbidden, rubric(grader(1, 1), http.MethodGet, "3"), "IIT sees the shared question but does not grade NIT's test")
+
+	assert.Equal(t, http.StatusOK, rubric(grader(1, 1), http.MethodGet, "4"))
+	assert.Equal(t, http.StatusForbidden, rubric(grader(1, 1), http.MethodPut, "4"), "the rubric would change NIT's grades too")
+	assert.Equal(t, http.StatusOK, rubric(adminSubject(), http.MethodPut, "4"))
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"pathshala/models"
+	"pathshala/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedItemAnalysis creates a test of three easy MCQs, option 1 correct, and
+// submits an attempt for students 2 to 5. choices holds the option position
+// each student chose per question, 0 for none.
+func seedItemAnalysis(t *testing.T, db *gorm.DB, choices map[uint][]uint) (models.Test, []models.Question) {
+	test := models.Test{TestName: "Items", UserID: 1, MinQuestions: 1}
+	db.Create(&test)
+
+	var questions []models.Question
+	for i := 0; i < 3; i++ {
+		q := models.Question{QuestionType: "MCQ", QuestionText: "Item", Difficulty: "easy", CategoryID: 1}
+		db.Create(&q)
+		db.Create(&[]models.QuestionOption{
+			{QuestionID: q.ID, OptionID: 1, OptionText: "A", IsCorrect: true},
+			{QuestionID: q.ID, OptionID: 2, OptionText: "B"},
+			{QuestionID: q.ID, OptionID: 3, OptionText: "C"},
+		})
+		db.Create(&models.TestQuestion{TestID: test.ID, QuestionID: q.ID})
+		questions = append(questions, q)
+	}
+
+	attempts := services.NewAttemptService(db)
+	for studentID, chosen := range choices {
+		db.Create(&models.StudentTest{StudentID: studentID, TestID: test.ID, Status: services.AttemptAssigned})
+		_, err := attempts.StartAttempt(test.ID, studentID)
+		require.NoError(t, err)
+
+		var answers []services.AnswerInput
+		for i, position := range chosen {
+			if position == 0 {
+				continue
+			}
+			var option models.QuestionOption
+			db.Where("question_id = ? AND option_id = ?", questions[i].ID, position).First(&option)
+			answers = append(answers, services.AnswerInput{QuestionID: questions[i].ID, OptionID: &option.ID})
+		}
+		require.NoError(t, attempts.SaveAnswers(test.ID, studentID, answers))
+		_, err = attempts.SubmitAttempt(test.ID, studentID)
+		require.NoError(t, err)
+	}
+	return test, questions
+}
+
+func TestItemAnalysisStatistics(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedItemAnalysis(t, db, map[uint][]uint{
+		2: {1, 1, 1},
+		3: {1, 1, 2},
+		4: {1, 2, 0},
+		5: {2, 3, 2},
+	})
+	service := services.NewItemAnalysisService(db, services.NewAttemptService(db))
+
+	analysis, err := service.AnalyzeTest(test.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, analysis.Attempts)
+	assert.InDelta(t, 50, analysis.MeanScore, 0.01)
+	require.NotNil(t, analysis.KR20)
+	assert.InDelta(t, 0.75, *analysis.KR20, 0.001)
+
+	require.Len(t, analysis.Items, 3)
+	first, third := analysis.Items[0], analysis.Items[2]
+	assert.Equal(t, questions[0].ID, first.QuestionID)
+	assert.InDelta(t, 0.75, *first.DifficultyIndex, 0.001)
+	assert.Equal(t, "easy", first.SuggestedDifficulty)
+	require.NotNil(t, first.Discrimination)
+	assert.Greater(t, *first.Discrimination, 0.5)
+
+	assert.InDelta(t, 0.25, *third.DifficultyIndex, 0.001)
+	assert.Equal(t, 1, third.Omitted)
+	require.Len(t, third.Options, 3)
+	assert.Equal(t, 1, third.Options[0].Chosen)
+	assert.Equal(t, 2, third.Options[1].Chosen)
+	assert.Equal(t, 0, third.Options[2].Chosen)
+	assert.Contains(t, third.Flags, "distractor_beats_key")
+	assert.Contains(t, third.Flags, "non_functioning_distractor")
+
+	editor := uint(1)
+	changes, err := service.ApplySuggestedDifficulty(test.ID, 4, &editor)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "medium", changes[0].To)
+	assert.Equal(t, "hard", changes[1].To)
+
+	var updated models.Question
+	db.First(&updated, questions[2].ID)
+	assert.Equal(t, "hard", updated.Difficulty)
+	var revisions int64
+	db.Model(&models.QuestionRevision{}).Where("question_id = ?", questions[2].ID).Count(&revisions)
+	assert.EqualValues(t, 2, revisions)
+
+	changes, err = service.ApplySuggestedDifficulty(test.ID, 5, &editor)
+	require.NoError(t, err)
+	assert.Empty(t, changes, "too few students saw the questions")
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/config"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLoginGuard(rdb *redis.Client) *services.LoginGuardService {
+	return services.NewLoginGuardService(rdb, config.LoginGuardConfig{
+		Window:           15 * time.Minute,
+		AccountFree:      3,
+		AccountLockout:   5,
+		IPFree:           20,
+		IPLockout:        50,
+		MaxDelay:         30 * time.Second,
+		LockoutDuration:  15 * time.Minute,
+		ResetsPerAccount: 3,
+	})
+}
+
+func TestLoginGuardDelaysThenLocksAnAccount(t *testing.T) {
+	mr := miniredis.RunT(t)
+	guard := newTestLoginGuard(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, guard.Attempt(ctx, "ana@example.com", "10.0.0.1"), "the first attempts are free")
+		guard.Failed()
+	}
+
+	var throttled *services.ThrottledError
+	require.True(t, errors.As(guard.Attempt(ctx, "Ana@Example.com", "10.0.0.2"), &throttled), "the account is throttled from any IP")
+	assert.False(t, throttled.Locked)
+	assert.Equal(t, services.LockAccount, throttled.Scope)
+	assert.Equal(t, time.Second, throttled.RetryAfter)
+	assert.NoError(t, guard.Attempt(ctx, "ben@example.com", "10.0.0.1"), "others on the same IP are not")
+
+	mr.FastForward(time.Second)
+	require.NoError(t, guard.Attempt(ctx, "ana@example.com", "10.0.0.1"))
+	require.True(t, errors.As(guard.Attempt(ctx, "ana@example.com", "10.0.0.1"), &throttled))
+	assert.Equal(t, 2*time.Second, throttled.RetryAfter, "each failure doubles the delay")
+
+	mr.FastForward(2 * time.Second)
+	require.NoError(t, guard.Attempt(ctx, "ana@example.com", "10.0.0.1"))
+	require.True(t, errors.As(guard.Attempt(ctx, "ana@example.com", "10.0.0.1"), &throttled))
+	assert.True(t, throttled.Locked)
+	assert.Equal(t, 15*time.Minute, throttled.RetryAfter)
+
+	require.NoError(t, guard.Unlock(ctx, services.LockAccount, "ANA@example.com"))
+	assert.NoError(t, guard.Attempt(ctx, "ana@example.com", "10.0.0.1"))
+}
+
+func TestLoginGuardCountsParallelAttempts(t *testing.T) {
+	guard := newTestLoginGuard(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}))
+
+	var started atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if guard.Attempt(context.Background(), "ana@example.com", "10.0.0.1") == nil {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), started.Load(), "only the free attempts start before any of them has failed")
+}
+
+func TestLoginGuardIPLimitHoldsBackEveryAccount(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	guard := services.NewLoginGuardService(rdb, config.LoginGuardConfig{
+		Window:          15 * time.Minute,
+		AccountFree:     3,
+		AccountLockout:  5,
+		IPFree:          2,
+		IPLockout:       4,
+		MaxDelay:        30 * time.Second,
+		LockoutDuration: 15 * time.Minute,
+	})
+	ctx := context.Background()
+
+	// Successful logins take their attempts off the IP, so a campus does not add up
+	for i := 0; i < 6; i++ {
+		email := fmt.Sprintf("student%d@example.com", i)
+		require.NoError(t, guard.Attempt(ctx, email, "10.0.0.1"))
+		require.NoError(t, guard.Succeeded(ctx, email, "10.0.0.1"))
+	}
+
+	// One guess for each of many accounts still trips the IP
+	for i := 0; i < 2; i++ {
+		require.NoError(t, guard.Attempt(ctx, fmt.Sprintf("guess%d@example.com", i), "10.0.0.1"))
+		guard.Failed()
+	}
+	var throttled *services.ThrottledError
+	require.True(t, errors.As(guard.Attempt(ctx, "fresh@example.com", "10.0.0.1"), &throttled),
+		"accounts that have not failed from the IP are held back too")
+	assert.Equal(t, services.LockIP, throttled.Scope)
+	assert.False(t, throttled.Locked)
+	assert.NoError(t, guard.Attempt(ctx, "guess0@example.com", "10.0.0.2"), "the accounts themselves are not locked")
+}
+
+func TestPasswordResetsAreLimitedPerAccount(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	guard := newTestLoginGuard(rdb)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, guard.ResetRequested(ctx, "ana@example.com"))
+	}
+	var throttled *services.ThrottledError
+	require.True(t, errors.As(guard.ResetRequested(ctx, " Ana@Example.com"), &throttled))
+	assert.Equal(t, services.LockReset, throttled.Scope)
+	assert.Greater(t, throttled.RetryAfter, 14*time.Minute)
+	assert.NoError(t, guard.ResetRequested(ctx, "ravi@example.com"), "other accounts are not held back")
+}
+
+func TestLoginIsThrottledAndAdminsCanUnlock(t *testing.T) {
+	db := seedTenants(t)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	guard := newTestLoginGuard(rdb)
+	auth := controllers.NewAuthController(db, rdb, nil, nil, "", nil, nil, nil, guard, nil)
+
+	password, _ := utils.HashPassword("secret")
+	student := models.User{Name: "Ana", Email: "ana@example.com", Password: password, Role: utils.RoleStudent}
+	db.Create(&student)
+
+	router := gin.New()
+	router.POST("/login", auth.Login)
+	login := func(password string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(gin.H{"email": "ana@example.com", "password": password})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	}
+	w := login("secret")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "even the right password waits out the delay")
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	unlock := gin.New()
+	unlock.POST("/api/users/:id/unlock", asSubject(db, adminSubject()), controllers.NewLoginGuardController(db, guard).UnlockUser)
+	w = httptest.NewRecorder()
+	unlock.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/users/%d/unlock", student.ID), nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, guard.Attempt(context.Background(), "ana@example.com", "192.0.2.1"))
+}
+
+func TestRateLimitSlidesOverTheWindow(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	router := gin.New()
+	router.GET("/", middlewares.RateLimitMiddleware(rdb, "test", 2, time.Minute), func(c *gin.Context) { c.Status(http.StatusOK) })
+	other := gin.New()
+	other.GET("/", middlewares.RateLimitMiddleware(rdb, "other", 2, time.Minute), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(r *gin.Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, get(router).Code)
+	assert.Equal(t, http.StatusOK, get(router).Code)
+	w := get(router)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get(other).Code, "route groups are counted apart")
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pathshala/config"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTOTPMatchesRFC6238(t *testing.T) {
+	// The RFC's SHA-1 secret "12345678901234567890", base32-encoded
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "T=%d", unix)
+	}
+
+	now := time.Unix(1111111109, 0)
+	_, ok := utils.ValidateTOTP(secret, "081804", now.Add(utils.TOTPPeriod))
+	assert.True(t, ok, "a code from the previous step is accepted")
+	_, ok = utils.ValidateTOTP(secret, "081804", now.Add(3*utils.TOTPPeriod))
+	assert.False(t, ok, "old codes are not")
+
+	uri, err := url.Parse(utils.TOTPProvisioningURI("Pathshala", "ana@example.com", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Pathshala", uri.Query().Get("issuer"))
+}
+
+type mfaFixture struct {
+	db      *gorm.DB
+	redis   *miniredis.Miniredis
+	mfa     *services.MFAService
+	guard   *services.LoginGuardService
+	now     time.Time
+	router  *gin.Engine
+	teacher models.User
+	student models.User
+}
+
+func setupMFA(t *testing.T) *mfaFixture {
+	db := setupAttemptTestDB()
+	require.NoError(t, db.AutoMigrate(&models.UserMFA{}, &models.MFARecoveryCode{}))
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mfa, err := services.NewMFAService(db, rdb, config.MFAConfig{
+		Issuer:        "Pathshala",
+		EncryptionKey: "0123456789abcdef0123456789abcdef",
+		RequiredRoles: []string{utils.RoleTeacher},
+		ChallengeTTL:  time.Minute,
+	})
+	require.NoError(t, err)
+	f := &mfaFixture{db: db, redis: mr, mfa: mfa, guard: newTestLoginGuard(rdb), now: time.Unix(1700000000, 0)}
+	mfa.Now = func() time.Time { return f.now }
+
+	password, _ := utils.HashPassword("secret")
+	f.teacher = models.User{Name: "Ana", Email: "ana@example.com", Password: password, Role: utils.RoleTeacher}
+	f.student = models.User{Name: "Ben", Email: "ben@example.com", Password: password, Role: utils.RoleStudent}
+	db.Create(&f.teacher)
+	db.Create(&f.student)
+
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	auth := controllers.NewAuthController(db, rdb, tokens, nil, "", mfa, services.NewSessionService(rdb, tokens), nil, f.guard, nil)
+	f.router = gin.New()
+	f.router.POST("/login", auth.Login)
+	f.router.POST("/login/mfa", auth.VerifyMFALogin)
+	f.router.POST("/login/mfa/enroll", auth.EnrollMFALogin)
+	return f
+}
+
+func (f *mfaFixture) post(t *testing.T, path string, body gin.H) (int, map[string]interface{}) {
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out), w.Body.String())
+	return w.Code, out
+}
+
+// code returns the current TOTP code of a secret, stepping the clock first
+// so each call yields a code that has not been used
+func (f *mfaFixture) code(t *testing.T, secret string) string {
+	f.now = f.now.Add(utils.TOTPPeriod)
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(f.now))
+	require.NoError(t, err)
+	return code
+}
+
+func TestMFAEnrollmentAndRecoveryCodes(t *testing.T) {
+	f := setupMFA(t)
+
+	enrollment, err := f.mfa.BeginEnrollment(&f.student)
+	require.NoError(t, err)
+	var stored models.UserMFA
+	require.NoError(t, f.db.First(&stored, f.student.ID).Error)
+	assert.NotContains(t, stored.Secret, enrollment.Secret, "the secret is stored encrypted")
+	assert.ErrorIs(t, f.mfa.Verify(f.student.ID, f.code(t, enrollment.Secret)), services.ErrMFANotEnrolled, "nothing is protected before confirming")
+
+	_, err = f.mfa.ConfirmEnrollment(f.student.ID, "000000")
+	assert.ErrorIs(t, err, services.ErrMFAInvalidCode)
+	codes, err := f.mfa.ConfirmEnrollment(f.student.ID, f.code(t, enrollment.Secret))
+	require.NoError(t, err)
+	assert.Len(t, codes, services.RecoveryCodeCount)
+	_, err = f.mfa.BeginEnrollment(&f.student)
+	assert.ErrorIs(t, err, services.ErrMFAAlreadyEnabled)
+
+	current := f.code(t, enrollment.Secret)
+	require.NoError(t, f.mfa.Verify(f.student.ID, current))
+	assert.ErrorIs(t, f.mfa.Verify(f.student.ID, current), services.ErrMFAInvalidCode, "a code is accepted once")
+
+	require.NoError(t, f.mfa.Verify(f.student.ID, codes[0]))
+	assert.ErrorIs(t, f.mfa.Verify(f.student.ID, codes[0]), services.ErrMFAInvalidCode, "recovery codes are single use")
+	status, err := f.mfa.Status(&f.student)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.False(t, status.Required)
+	assert.Equal(t, int64(services.RecoveryCodeCount-1), status.RecoveryCodesLeft)
+
+	fresh, err := f.mfa.RegenerateRecoveryCodes(f.student.ID, f.code(t, enrollment.Secret))
+	require.NoError(t, err)
+	assert.ErrorIs(t, f.mfa.Verify(f.student.ID, codes[1]), services.ErrMFAInvalidCode, "old codes stop working")
+	require.NoError(t, f.mfa.Disable(&f.student, fresh[0]))
+	needed, err := f.mfa.LoginNeedsMFA(&f.student)
+	require.NoError(t, err)
+	assert.False(t, needed)
+}
+
+func TestMFAIsMandatoryForRequiredRoles(t *testing.T) {
+	f := setupMFA(t)
+
+	status, body := f.post(t, "/login", gin.H{"email": "ana@example.com", "password": "secret"})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, body["mfa_required"])
+	assert.Equal(t, true, body["enrollment_required"])
+	assert.Nil(t, body["access_token"], "no tokens before the second factor")
+	token := body["mfa_token"].(string)
+
+	status, body = f.post(t, "/login/mfa/enroll", gin.H{"mfa_token": token})
+	require.Equal(t, http.StatusOK, status)
+	secret := body["secret"].(string)
+
+	status, body = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": f.code(t, secret)})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.NotEmpty(t, body["access_token"])
+	assert.Len(t, body["recovery_codes"], services.RecoveryCodeCount)
+
+	status, _ = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": f.code(t, secret)})
+	assert.Equal(t, http.StatusUnauthorized, status, "a challenge logs in once")
+
+	assert.ErrorIs(t, f.mfa.Disable(&f.teacher, f.code(t, secret)), services.ErrMFARequired)
+
+	// Students have no second factor unless they opt in
+	status, body = f.post(t, "/login", gin.H{"email": "ben@example.com", "password": "secret"})
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body["access_token"])
+}
+
+func TestMFAChallengeEndsAfterTooManyWrongCodes(t *testing.T) {
+	f := setupMFA(t)
+	enrollment, err := f.mfa.BeginEnrollment(&f.teacher)
+	require.NoError(t, err)
+	_, err = f.mfa.ConfirmEnrollment(f.teacher.ID, f.code(t, enrollment.Secret))
+	require.NoError(t, err)
+
+	_, body := f.post(t, "/login", gin.H{"email": "ana@example.com", "password": "secret"})
+	assert.Equal(t, false, body["enrollment_required"])
+	token := body["mfa_token"].(string)
+
+	status, _ := f.post(t, "/login/mfa/enroll", gin.H{"mfa_token": token})
+	assert.Equal(t, http.StatusConflict, status, "an enrolled user cannot replace the secret mid-login")
+
+	for i := 0; i < 5; i++ {
+		status, _ := f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, status)
+		// Wrong codes are throttled per account too; this is about the challenge
+		require.NoError(t, f.guard.Unlock(context.Background(), services.LockAccount, "ana@example.com"))
+	}
+	status, body = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": f.code(t, enrollment.Secret)})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, services.ErrMFAChallengeInvalid.Error(), body["error"])
+}
+
+func TestWrongMFACodesCountAsFailedLogins(t *testing.T) {
+	f := setupMFA(t)
+	enrollment, err := f.mfa.BeginEnrollment(&f.teacher)
+	require.NoError(t, err)
+	_, err = f.mfa.ConfirmEnrollment(f.teacher.ID, f.code(t, enrollment.Secret))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		status, _ := f.post(t, "/login", gin.H{"email": "ana@example.com", "password": "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+	status, body := f.post(t, "/login", gin.H{"email": "ana@example.com", "password": "secret"})
+	require.Equal(t, http.StatusOK, status, "the right password is let through to the second step")
+	token := body["mfa_token"].(string)
+
+	status, _ = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": f.code(t, enrollment.Secret)})
+	assert.Equal(t, http.StatusTooManyRequests, status, "the password did not clear the failures, and wrong codes add to them")
+
+	f.redis.FastForward(2 * time.Second)
+	status, _ = f.post(t, "/login/mfa", gin.H{"mfa_token": token, "code": f.code(t, enrollment.Secret)})
+	require.Equal(t, http.StatusOK, status)
+	assert.NoError(t, f.guard.Attempt(context.Background(), "ana@example.com", "192.0.2.1"), "finishing the login clears the failures")
+}
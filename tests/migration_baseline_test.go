@@ -0,0 +1,350 @@
+package tests
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"pathshala/migrations"
+	"pathshala/models"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The models as AutoMigrate created them in the first release, before the
+// baseline migration existed
+
+type oldCollegeType struct {
+	ID              uint   `gorm:"primaryKey"`
+	Name            string `gorm:"unique;not null"`
+	TypeDescription string
+}
+
+func (oldCollegeType) TableName() string { return "college_types" }
+
+type oldCollege struct {
+	ID               uint `gorm:"primaryKey"`
+	Name             string
+	Description      string
+	State            string
+	CollegeTypeID    uint
+	ActiveCandidates int
+	CollegeType      oldCollegeType `gorm:"foreignKey:CollegeTypeID;references:ID"`
+}
+
+func (oldCollege) TableName() string { return "colleges" }
+
+type oldUser struct {
+	ID             uint `gorm:"primaryKey"`
+	Name           string
+	Email          string `gorm:"unique"`
+	Password       string `gorm:"not null"`
+	CollegeID      *uint
+	College        oldCollege `gorm:"foreignKey:CollegeID"`
+	Role           string
+	SecondaryEmail *string
+	Profile_image  string
+}
+
+func (oldUser) TableName() string { return "users" }
+
+type oldStudent struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint
+	Status string
+	User   oldUser `gorm:"foreignKey:UserID"`
+	Branch string
+	Gender string
+}
+
+func (oldStudent) TableName() string { return "students" }
+
+type oldTeacher struct {
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint
+	State       string
+	TeacherType string
+	User        oldUser `gorm:"foreignKey:UserID"`
+	Super       bool
+	Status      string
+}
+
+func (oldTeacher) TableName() string { return "teachers" }
+
+type oldMacroCategory struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"type:varchar(100);not null"`
+	Description string `gorm:"type:text"`
+}
+
+func (oldMacroCategory) TableName() string { return "macro_categories" }
+
+type oldCategory struct {
+	ID              uint   `gorm:"primaryKey"`
+	Name            string `gorm:"type:varchar(100);not null"`
+	MacroCategoryID *uint
+	MacroCategory   *oldMacroCategory `gorm:"foreignKey:MacroCategoryID"`
+	CollegeName     *string           `gorm:"type:varchar(100)"`
+	State           *string           `gorm:"type:varchar(100)"`
+	CreatorName     string            `gorm:"type:varchar(100)"`
+	Description     *string           `gorm:"type:text"`
+	ImagePath       *string           `gorm:"type:text"`
+	Status          string            `gorm:"default:'draft'"`
+}
+
+func (oldCategory) TableName() string { return "categories" }
+
+type oldQuestion struct {
+	ID                 uint        `gorm:"primaryKey"`
+	QuestionType       string      `gorm:"type:varchar(20);not null"`
+	QuestionText       string      `gorm:"type:text;not null"`
+	CorrectOptionID    *uint       `gorm:"default:null"`
+	Difficulty         string      `gorm:"type:varchar(10);not null"`
+	CategoryID         uint        `gorm:"not null"`
+	Category           oldCategory `gorm:"foreignKey:CategoryID;references:ID"`
+	Image1             string      `gorm:"type:text;default:null"`
+	Image1DisplayTime  *int        `gorm:"default:null"`
+	Image2             string      `gorm:"type:text;default:null"`
+	Image2DisplayTime  *int        `gorm:"default:null"`
+	Comment            string      `gorm:"type:text;default:null"`
+	CommentDisplayTime *int        `gorm:"default:null"`
+	CreatedAt          time.Time   `gorm:"autoCreateTime"`
+	UpdatedAt          time.Time   `gorm:"autoUpdateTime"`
+
+	Options []oldQuestionOption `gorm:"foreignKey:QuestionID"`
+}
+
+func (oldQuestion) TableName() string { return "questions" }
+
+type oldQuestionOption struct {
+	ID         uint   `gorm:"primaryKey"`
+	QuestionID uint   `gorm:"not null"`
+	OptionID   uint   `gorm:"not null"`
+	OptionText string `gorm:"type:text;not null"`
+	IsCorrect  bool   `gorm:"not null;default:false"`
+}
+
+func (oldQuestionOption) TableName() string { return "question_options" }
+
+type oldTest struct {
+	ID           uint `gorm:"primaryKey"`
+	TestName     string
+	UserID       uint
+	User         oldUser `gorm:"foreignKey:UserID"`
+	MinQuestions int
+}
+
+func (oldTest) TableName() string { return "tests" }
+
+type oldTestQuestion struct {
+	ID         uint `gorm:"primaryKey"`
+	TestID     uint `gorm:"not null"`
+	QuestionID uint `gorm:"not null"`
+}
+
+func (oldTestQuestion) TableName() string { return "test_questions" }
+
+type oldStudentAnswer struct {
+	gorm.Model
+	TestID     uint
+	StudentID  uint
+	QuestionID uint
+	Selected   string
+}
+
+func (oldStudentAnswer) TableName() string { return "student_answers" }
+
+type oldStudentTest struct {
+	ID        uint `gorm:"primaryKey"`
+	StudentID uint
+	TestID    uint
+	StartTime time.Time
+}
+
+func (oldStudentTest) TableName() string { return "student_tests" }
+
+type oldResult struct {
+	gorm.Model
+	TestID    uint
+	UserID    uint
+	Score     int
+	Correct   int
+	Incorrect int
+	Ignored   int
+	TimeTaken string
+}
+
+func (oldResult) TableName() string { return "results" }
+
+type oldSurvey struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name         string    `gorm:"not null"`
+	Description  string
+	Category     string
+	SurveyType   string
+	ShowResults  bool
+	NumQuestions int
+	CreatedBy    uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (oldSurvey) TableName() string { return "surveys" }
+
+type oldReportType struct {
+	ID   uint   `gorm:"primaryKey"`
+	Type string `gorm:"not null;unique"`
+}
+
+func (oldReportType) TableName() string { return "report_types" }
+
+// autoMigrateFirstRelease creates the schema the way the first release did
+func autoMigrateFirstRelease(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.AutoMigrate(&oldUser{}, &oldCollegeType{}, &oldCollege{}))
+	require.NoError(t, db.AutoMigrate(&oldTeacher{}, &oldStudent{}))
+	require.NoError(t, db.AutoMigrate(&oldMacroCategory{}, &oldCategory{}))
+	require.NoError(t, db.AutoMigrate(&oldQuestion{}, &oldQuestionOption{}))
+	require.NoError(t, db.AutoMigrate(&oldTest{}, &oldTestQuestion{}))
+	require.NoError(t, db.AutoMigrate(&oldStudentAnswer{}, &oldStudentTest{}, &oldResult{}))
+	require.NoError(t, db.AutoMigrate(&oldSurvey{}, &oldReportType{}))
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS "(\w+)" \((.*?)\n\);`)
+	columnPattern      = regexp.MustCompile(`(?m)^\s+"(\w+)" `)
+	indexPattern       = regexp.MustCompile(`CREATE (?:UNIQUE )?INDEX IF NOT EXISTS "\w+" ON "(\w+)"`)
+)
+
+func TestBaselineMigrationAddsColumnsMissingFromFirstRelease(t *testing.T) {
+	script, err := fs.ReadFile(migrations.Files, "sql/0001_baseline.up.sql")
+	require.NoError(t, err)
+	up := string(script)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	autoMigrateFirstRelease(t, db)
+
+	// The first index on each table must come after the columns it may cover
+	firstIndex := map[string]int{}
+	for _, match := range indexPattern.FindAllStringSubmatchIndex(up, -1) {
+		table := up[match[2]:match[3]]
+		if _, ok := firstIndex[table]; !ok {
+			firstIndex[table] = match[0]
+		}
+	}
+
+	for _, table := range createTablePattern.FindAllStringSubmatch(up, -1) {
+		name := table[1]
+		if !db.Migrator().HasTable(name) {
+			continue // Created by the baseline itself
+		}
+		for _, column := range columnPattern.FindAllStringSubmatch(table[2], -1) {
+			if db.Migrator().HasColumn(name, column[1]) {
+				continue
+			}
+			alter := fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS "%s" `, name, column[1])
+			at := strings.Index(up, alter)
+			if !assert.GreaterOrEqual(t, at, 0, "%s.%s is added to existing tables", name, column[1]) {
+				continue
+			}
+			if index, ok := firstIndex[name]; ok {
+				assert.Less(t, at, index, "%s.%s is added before the table's indexes", name, column[1])
+			}
+		}
+	}
+}
+
+// currentModels are every model the application reads and writes
+var currentModels = []interface{}{
+	&models.CollegeType{}, &models.College{}, &models.User{}, &models.Student{}, &models.Teacher{},
+	&models.RolePermission{}, &models.RoleAssignment{}, &models.UserMFA{}, &models.MFARecoveryCode{},
+	&models.MacroCategory{}, &models.Category{}, &models.Question{}, &models.QuestionOption{},
+	&models.QuestionRevision{}, &models.RubricCriterion{}, &models.Test{}, &models.TestQuestion{},
+	&models.TestBlueprint{}, &models.StudentAnswer{}, &models.StudentTest{}, &models.StudentTestQuestion{},
+	&models.Result{}, &models.AnswerCriterionScore{}, &models.AnswerBatch{}, &models.Survey{},
+	&models.SurveyQuestion{}, &models.SurveyAssignment{}, &models.SurveyResponse{}, &models.SurveyAnswer{},
+	&models.ReportType{}, &models.AuditLog{},
+}
+
+func TestMigrationsUpgradeFirstReleaseSchemaOnPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	// A schema of its own keeps the test away from any data in the database
+	schema := fmt.Sprintf("migration_test_%d", time.Now().UnixNano())
+	require.NoError(t, db.Exec(`CREATE SCHEMA "`+schema+`"`).Error)
+	t.Cleanup(func() {
+		db.Exec(`SET search_path TO public`)
+		db.Exec(`DROP SCHEMA "` + schema + `" CASCADE`)
+		sqlDB.Close()
+	})
+	require.NoError(t, db.Exec(`SET search_path TO "`+schema+`"`).Error)
+
+	autoMigrateFirstRelease(t, db)
+	iit := "IIT Delhi"
+	require.NoError(t, db.Create(&oldCollegeType{Name: "Engineering"}).Error)
+	require.NoError(t, db.Create(&oldCollege{Name: iit, CollegeTypeID: 1}).Error)
+	require.NoError(t, db.Create(&oldCategory{Name: "Physics", CollegeName: &iit}).Error)
+	unknown := "Govt. College, Ajmer"
+	require.NoError(t, db.Create(&oldCategory{Name: "Botany", CollegeName: &unknown}).Error)
+	for _, selected := range []string{"A", "B"} {
+		require.NoError(t, db.Create(&oldStudentAnswer{TestID: 1, StudentID: 1, QuestionID: 1, Selected: selected}).Error)
+	}
+	require.NoError(t, db.Create(&oldSurvey{Name: "Feedback", CreatedBy: uuid.New()}).Error)
+
+	migrator, err := migrations.NewMigrator(db, migrations.Files)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	for _, model := range currentModels {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(model))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" {
+				assert.True(t, db.Migrator().HasColumn(model, field.DBName), "%s.%s exists", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			assert.True(t, db.Migrator().HasIndex(model, index.Name), "%s has index %s", stmt.Schema.Table, index.Name)
+		}
+	}
+
+	var category models.Category
+	require.NoError(t, db.First(&category).Error)
+	require.NotNil(t, category.CollegeID)
+	assert.Equal(t, uint(1), *category.CollegeID, "categories are linked to the college they named")
+
+	var unmatched models.Category
+	require.NoError(t, db.Where("name = ?", "Botany").First(&unmatched).Error)
+	require.NotNil(t, unmatched.CollegeID, "a category naming an unknown college does not become platform content")
+	var added models.College
+	require.NoError(t, db.First(&added, *unmatched.CollegeID).Error)
+	assert.Equal(t, unknown, added.Name)
+
+	var answers []models.StudentAnswer
+	require.NoError(t, db.Find(&answers).Error)
+	require.Len(t, answers, 1, "duplicate answers are dropped")
+	assert.Equal(t, "B", answers[0].Selected)
+
+	var survey models.Survey
+	require.NoError(t, db.First(&survey).Error)
+	assert.Zero(t, survey.CreatedBy)
+}
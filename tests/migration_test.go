@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"bytes"
+	"pathshala/migrations"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupMigrator(t *testing.T, files fstest.MapFS) (*migrations.Migrator, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	loaded, err := migrations.Load(files)
+	require.NoError(t, err)
+	return &migrations.Migrator{DB: db, Migrations: loaded}, db
+}
+
+var sampleMigrations = fstest.MapFS{
+	"0001_create_books.up.sql":   {Data: []byte("CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT);")},
+	"0001_create_books.down.sql": {Data: []byte("DROP TABLE books;")},
+	"0002_book_index.up.sql":     {Data: []byte("ALTER TABLE books ADD COLUMN author TEXT;\nCREATE INDEX idx_books_author ON books (author);")},
+	"0002_book_index.down.sql":   {Data: []byte("DROP INDEX idx_books_author;\nALTER TABLE books DROP COLUMN author;")},
+}
+
+func TestMigratorUpDownAndCheck(t *testing.T) {
+	migrator, db := setupMigrator(t, sampleMigrations)
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPendingMigrations)
+
+	count, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	require.NoError(t, migrator.Check())
+	assert.True(t, db.Migrator().HasIndex("books", "idx_books_author"))
+
+	count, err = migrator.Up()
+	require.NoError(t, err)
+	assert.Zero(t, count, "applied migrations are not run again")
+
+	rolledBack, err := migrator.Down()
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), rolledBack.Version)
+	assert.False(t, db.Migrator().HasColumn("books", "author"))
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPendingMigrations)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+}
+
+func TestMigratorFailedScriptLeavesSchemaDirty(t *testing.T) {
+	files := fstest.MapFS{
+		"0001_create_books.up.sql":   sampleMigrations["0001_create_books.up.sql"],
+		"0001_create_books.down.sql": sampleMigrations["0001_create_books.down.sql"],
+		"0002_broken.up.sql":         {Data: []byte("ALTER TABLE missing ADD COLUMN author TEXT;")},
+		"0002_broken.down.sql":       {Data: []byte("SELECT 1;")},
+	}
+	migrator, _ := setupMigrator(t, files)
+
+	count, err := migrator.Up()
+	require.Error(t, err)
+	assert.Equal(t, 1, count)
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrDirtySchema)
+	_, err = migrator.Up()
+	assert.ErrorIs(t, err, migrations.ErrDirtySchema, "nothing runs on a dirty schema")
+
+	var out bytes.Buffer
+	require.NoError(t, migrations.RunCommand(migrator, []string{"status"}, &out))
+	assert.Contains(t, out.String(), "dirty")
+
+	require.NoError(t, migrator.Force(1))
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPendingMigrations)
+	assert.ErrorIs(t, migrator.Force(3), migrations.ErrUnknownVersion)
+}
+
+func TestLoadRejectsIncompleteMigrations(t *testing.T) {
+	_, err := migrations.Load(fstest.MapFS{"0001_create_books.up.sql": sampleMigrations["0001_create_books.up.sql"]})
+	assert.ErrorContains(t, err, "needs both an up and a down script")
+
+	_, err = migrations.Load(fstest.MapFS{"create_books.sql": {Data: []byte("SELECT 1;")}})
+	assert.ErrorContains(t, err, "unexpected migration file")
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrator, err := migrations.NewMigrator(nil, migrations.Files)
+	require.NoError(t, err)
+	for i, migration := range migrator.Migrations {
+		assert.Equal(t, uint(i+1), migration.Version, "versions have no gaps")
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pathshala/config"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capturingMailer hands the links it is asked to send to sent, blocking until
+// the test takes them
+type capturingMailer struct {
+	sent chan string
+}
+
+func newCapturingMailer() *capturingMailer {
+	return &capturingMailer{sent: make(chan string)}
+}
+
+func (m *capturingMailer) SendResetEmail(toEmail, resetLink string) error {
+	m.sent <- resetLink
+	return nil
+}
+
+// taskGroup runs the work controllers hand to app.Go, so tests can wait for it
+type taskGroup struct {
+	sync.WaitGroup
+}
+
+func (g *taskGroup) Go(task func(ctx context.Context)) {
+	g.Add(1)
+	go func() {
+		defer g.Done()
+		task(context.Background())
+	}()
+}
+
+// nextToken waits for the next link to be sent and returns its token
+func (m *capturingMailer) nextToken(t *testing.T) string {
+	select {
+	case resetLink := <-m.sent:
+		link, err := url.Parse(resetLink)
+		require.NoError(t, err)
+		return link.Query().Get("token")
+	case <-time.After(time.Second):
+		t.Fatal("no reset link was sent")
+		return ""
+	}
+}
+
+func TestPasswordResetTokensAreSingleUseAndEndSessions(t *testing.T) {
+	db := setupAttemptTestDB()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	sessions := services.NewSessionService(rdb, tokens)
+	resets := services.NewPasswordResetService(db, rdb, sessions, time.Minute)
+	mailer := newCapturingMailer()
+	var tasks taskGroup
+	auth := controllers.NewAuthController(db, rdb, tokens, mailer, "https://app.example", nil, sessions, resets, newTestLoginGuard(rdb), tasks.Go)
+
+	password, _ := utils.HashPassword("Old-pass1")
+	user := models.User{Name: "Ana", Email: "ana@example.com", Password: password, Role: utils.RoleStudent}
+	db.Create(&user)
+	session, err := sessions.Create(context.Background(), &user, services.Device{UserAgent: "Firefox"})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/forgot-password", auth.ForgotPassword)
+	router.POST("/reset-password", auth.ResetPassword)
+	post := func(path string, body gin.H) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+		return w
+	}
+
+	known := post("/forgot-password", gin.H{"email": "ana@example.com"})
+	unknown := post("/forgot-password", gin.H{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, unknown.Code)
+	assert.Equal(t, known.Body.String(), unknown.Body.String(), "unknown emails get the same answer")
+	first := mailer.nextToken(t)
+	assert.NotContains(t, known.Body.String(), first, "the token only goes out by email")
+
+	post("/forgot-password", gin.H{"email": "ana@example.com"})
+	second := mailer.nextToken(t)
+	keys, _ := rdb.Keys(context.Background(), "password_reset:*").Result()
+	require.Len(t, keys, 1)
+	assert.NotContains(t, keys[0], second, "Redis only holds a hash of the token")
+
+	reset := func(token string) int {
+		return post("/reset-password", gin.H{"token": token, "new_password": "New-pass1", "confirm_password": "New-pass1"}).Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, reset(first), "a newer link replaces the older one")
+	assert.Equal(t, http.StatusUnauthorized, reset(session.AccessToken), "access tokens do not reset passwords")
+	assert.Equal(t, http.StatusOK, reset(second))
+	assert.Equal(t, http.StatusUnauthorized, reset(second), "a link works once")
+
+	post("/forgot-password", gin.H{"email": "ana@example.com"})
+	mailer.nextToken(t)
+	w := post("/forgot-password", gin.H{"email": "ana@example.com"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "an account gets a few links per window")
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	tasks.Wait()
+
+	db.First(&user, user.ID)
+	assert.True(t, utils.CheckPasswordHash("New-pass1", user.Password))
+	_, err = sessions.Refresh(context.Background(), session.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrSessionInvalid, "a reset logs every device out")
+}
+
+func TestForgotPasswordAnswersBeforeMailing(t *testing.T) {
+	db := setupAttemptTestDB()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	sessions := services.NewSessionService(rdb, tokens)
+	resets := services.NewPasswordResetService(db, rdb, sessions, time.Minute)
+	mailer := newCapturingMailer()
+	var tasks taskGroup
+	auth := controllers.NewAuthController(db, rdb, tokens, mailer, "https://app.example", nil, sessions, resets, newTestLoginGuard(rdb), tasks.Go)
+	db.Create(&models.User{Name: "Ana", Email: "ana@example.com", Password: "x", Role: utils.RoleStudent})
+
+	router := gin.New()
+	router.POST("/forgot-password", auth.ForgotPassword)
+	answered := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/forgot-password", bytes.NewReader([]byte(`{"email":"ana@example.com"}`))))
+		answered <- w.Code
+	}()
+
+	// The mailer does not return until its link is taken below
+	select {
+	case code := <-answered:
+		assert.Equal(t, http.StatusOK, code)
+	case <-time.After(time.Second):
+		t.Fatal("known emails wait for the email to be sent, unlike unknown ones")
+	}
+	assert.NotEmpty(t, mailer.nextToken(t))
+	tasks.Wait()
+}
+
+func TestConcurrentResetRequestsLeaveOneWorkingLink(t *testing.T) {
+	db := setupAttemptTestDB()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	resets := services.NewPasswordResetService(db, rdb, nil, time.Minute)
+	db.Create(&models.User{Name: "Ana", Email: "ana@example.com", Password: "x", Role: utils.RoleStudent})
+
+	const requests = 20
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := resets.CreateToken(context.Background(), "ana@example.com")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	keys, err := rdb.Keys(context.Background(), "password_reset:*").Result()
+	require.NoError(t, err)
+	assert.Len(t, keys, 1, "every link but the last is dropped")
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedPermissions creates colleges 1 and 2 in Delhi and college 3 in Goa, an
+// admin, a teacher and a super teacher of college 1, and a teacher of college
+// 2, each of the teachers with a test of their own
+func seedPermissions(t *testing.T) *gorm.DB {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.College{}, &models.Teacher{}, &models.RolePermission{}, &models.RoleAssignment{})
+	require.NoError(t, utils.SeedRolePermissions(db))
+	require.NoError(t, utils.SeedRolePermissions(db), "seeding twice keeps one row per permission")
+
+	one, two, three := uint(1), uint(2), uint(3)
+	db.Create(&[]models.College{
+		{ID: one, Name: "IIT Delhi", State: "Delhi"},
+		{ID: two, Name: "DU", State: "Delhi"},
+		{ID: three, Name: "NIT Goa", State: "Goa"},
+	})
+	db.Create(&[]models.User{
+		{ID: 1, Name: "Admin", Email: "admin@example.com", Password: "x", Role: "admin"},
+		{ID: 2, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "teacher", CollegeID: &one},
+		{ID: 3, Name: "Ravi", Email: "ravi@example.com", Password: "x", Role: "teacher", CollegeID: &one},
+		{ID: 4, Name: "Meera", Email: "meera@example.com", Password: "x", Role: "teacher", CollegeID: &two},
+		{ID: 5, Name: "John", Email: "john@example.com", Password: "x", Role: "teacher"},
+	})
+	db.Create(&[]models.Teacher{
+		{UserID: 2, State: "Delhi"},
+		{UserID: 3, State: "Delhi", Super: true},
+		{UserID: 4, State: "Delhi"},
+	})
+	db.Create(&[]models.Test{
+		{ID: 1, TestName: "Asha's test", UserID: 2},
+		{ID: 2, TestName: "Meera's test", UserID: 4},
+	})
+	return db
+}
+
+func loadSubject(t *testing.T, db *gorm.DB, userID uint) *utils.Subject {
+	subject, err := utils.LoadSubject(db, userID)
+	require.NoError(t, err)
+	return subject
+}
+
+func testResource(t *testing.T, db *gorm.DB, testID uint) utils.Resource {
+	res, err := utils.TestResource(db, testID)
+	require.NoError(t, err)
+	return res
+}
+
+func TestAdminHoldsEveryPermission(t *testing.T) {
+	db := seedPermissions(t)
+	admin := loadSubject(t, db, 1)
+
+	assert.True(t, admin.Can(utils.PermTestSend, testResource(t, db, 2)))
+	assert.True(t, admin.Can(utils.PermCollegeManage, utils.Resource{}))
+	assert.True(t, admin.HasPermission(utils.PermRoleManage))
+}
+
+func TestTeacherPermissionsAreScopedToOwnTests(t *testing.T) {
+	db := seedPermissions(t)
+	teacher := loadSubject(t, db, 2)
+
+	assert.True(t, teacher.Can(utils.PermTestSend, testResource(t, db, 1)))
+	assert.False(t, teacher.Can(utils.PermTestSend, testResource(t, db, 2)))
+	assert.True(t, teacher.Can(utils.PermQuestionEdit, utils.Resource{}))
+	assert.False(t, teacher.HasPermission(utils.PermCollegeManage))
+	assert.False(t, teacher.HasPermission(utils.PermTeacherManage))
+
+	college, err := utils.CollegeResource(db, 1)
+	require.NoError(t, err)
+	assert.True(t, teacher.Can(utils.PermUserManage, college), "teachers manage students of their college")
+	other, err := utils.CollegeResource(db, 2)
+	require.NoError(t, err)
+	assert.False(t, teacher.Can(utils.PermUserManage, other))
+
+	_, err = utils.TestResource(db, 99)
+	assert.ErrorIs(t, err, utils.ErrTestNotFound)
+}
+
+func TestSuperTeacherManagesTheirCollege(t *testing.T) {
+	db := seedPermissions(t)
+	super := loadSubject(t, db, 3)
+
+	assert.True(t, super.Can(utils.PermTestEdit, testResource(t, db, 1)), "a test of a colleague in the same college")
+	assert.True(t, super.Can(utils.PermReportView, testResource(t, db, 1)))
+	assert.False(t, super.Can(utils.PermTestEdit, testResource(t, db, 2)), "a test of another college")
+
+	college, err := utils.CollegeResource(db, 1)
+	require.NoError(t, err)
+	assert.True(t, super.Can(utils.PermTeacherManage, college))
+
+	// Teachers without a college get no college-scoped grants
+	loner := loadSubject(t, db, 5)
+	assert.False(t, loner.HasPermission(utils.PermUserManage))
+}
+
+func TestStateCoordinatorAssignment(t *testing.T) {
+	db := seedPermissions(t)
+	roles := services.NewRoleService(db)
+
+	_, err := roles.AssignRole(5, services.RoleAssignmentInput{Role: utils.RoleStateCoordinator}, 1)
+	assert.ErrorIs(t, err, services.ErrInvalidRoleAssignment, "a scope is required")
+	_, err = roles.AssignRole(5, services.RoleAssignmentInput{Role: utils.RoleAdmin, State: "Delhi"}, 1)
+	assert.ErrorIs(t, err, services.ErrInvalidRoleAssignment, "user roles cannot be assigned")
+	_, err = roles.AssignRole(5, services.RoleAssignmentInput{Role: "dean", State: "Delhi"}, 1)
+	assert.ErrorIs(t, err, services.ErrUnknownRole)
+
+	assignment, err := roles.AssignRole(5, services.RoleAssignmentInput{Role: utils.RoleStateCoordinator, State: "Delhi"}, 1)
+	require.NoError(t, err)
+
+	coordinator := loadSubject(t, db, 5)
+	assert.True(t, coordinator.Can(utils.PermReportView, testResource(t, db, 1)))
+	assert.True(t, coordinator.Can(utils.PermReportView, testResource(t, db, 2)), "every college of the state")
+	assert.False(t, coordinator.Can(utils.PermTestEdit, testResource(t, db, 2)), "coordinators view but do not edit tests")
+
+	delhi, err := utils.CollegeResource(db, 2)
+	require.NoError(t, err)
+	goa, err := utils.CollegeResource(db, 3)
+	require.NoError(t, err)
+	assert.True(t, coordinator.Can(utils.PermCollegeManage, delhi))
+	assert.False(t, coordinator.Can(utils.PermCollegeManage, goa))
+
+	definitions, err := roles.ListRoles()
+	require.NoError(t, err)
+	assert.Len(t, definitions, 5)
+
+	require.NoError(t, roles.RevokeRole(5, assignment.ID))
+	assert.False(t, loadSubject(t, db, 5).HasPermission(utils.PermCollegeManage))
+	assert.ErrorIs(t, roles.RevokeRole(5, assignment.ID), services.ErrRoleAssignmentNotFound)
+}
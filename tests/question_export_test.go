@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"pathshala/models"
+	"pathshala/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func seedExportBank(db *gorm.DB) {
+	db.AutoMigrate(&models.Category{})
+	db.Create(&models.Category{ID: 1, Name: "Maths"})
+	commentTime := 10
+
+	db.Create(&models.Question{ID: 1, QuestionType: "MCQ", QuestionText: "What is 2 + 2? {hint: add}", Difficulty: "EASY", CategoryID: 1,
+		Comment: "Count on your fingers", CommentDisplayTime: &commentTime})
+	db.Create(&[]models.QuestionOption{
+		{QuestionID: 1, OptionID: 1, OptionText: "3"},
+		{QuestionID: 1, OptionID: 2, OptionText: "4 = four", IsCorrect: true},
+		{QuestionID: 1, OptionID: 3, OptionText: "5"},
+	})
+	db.Create(&models.Question{ID: 2, QuestionType: "TRUE_FALSE", QuestionText: "The earth is flat", Difficulty: "MEDIUM", CategoryID: 1})
+	db.Create(&[]models.QuestionOption{
+		{QuestionID: 2, OptionID: 1, OptionText: "True"},
+		{QuestionID: 2, OptionID: 2, OptionText: "False", IsCorrect: true},
+	})
+	db.Create(&models.Question{ID: 3, QuestionType: "DESCRIPTIVE", QuestionText: "Define a group", Difficulty: "HARD", CategoryID: 1})
+	db.Create(&models.QuestionOption{QuestionID: 3, OptionID: 1, OptionText: "A set with an associative operation:\nidentity and inverses", IsCorrect: true})
+}
+
+func noImages(string) ([]byte, error) { return nil, io.EOF }
+
+func TestGIFTExportRoundTrips(t *testing.T) {
+	db := setupAttemptTestDB()
+	seedExportBank(db)
+
+	questions, err := services.LoadExportQuestions(db, services.ExportScope{CategoryID: 1})
+	require.NoError(t, err)
+	require.Len(t, questions, 3)
+
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteGIFT(&buf, questions))
+
+	rows, rowErrors, err := services.ParseGIFT(&buf)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	for _, errs := range rowErrors {
+		assert.Empty(t, errs)
+	}
+
+	assert.Equal(t, "MCQ", rows[0].QuestionType)
+	assert.Equal(t, "What is 2 + 2? {hint: add}", rows[0].QuestionText)
+	assert.Equal(t, []string{"3", "4 = four", "5"}, rows[0].Options)
+	assert.Equal(t, uint(2), rows[0].CorrectOptionID)
+	assert.Equal(t, "Count on your fingers", rows[0].Comment)
+	require.NotNil(t, rows[0].CommentTime)
+	assert.Equal(t, 10, *rows[0].CommentTime)
+	assert.Equal(t, uint(1), rows[0].CategoryID)
+	assert.Equal(t, "easy", rows[0].Difficulty)
+
+	assert.Equal(t, "TRUE_FALSE", rows[1].QuestionType)
+	assert.Equal(t, uint(2), rows[1].CorrectOptionID)
+
+	assert.Equal(t, "DESCRIPTIVE", rows[2].QuestionType)
+	assert.Equal(t, "A set with an associative operation:\nidentity and inverses", rows[2].DescriptiveAnswer)
+}
+
+func TestMoodleXMLExportImportsBack(t *testing.T) {
+	db := setupAttemptTestDB()
+	seedExportBank(db)
+
+	questions, err := services.LoadExportQuestions(db, services.ExportScope{CategoryID: 1})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteMoodleXML(&buf, questions, noImages))
+	assert.Contains(t, buf.String(), `<question type="multichoice">`)
+
+	report := postImport(t, db, "bank.xml", buf.String(), nil, false)
+	require.Equal(t, 3, report.Created, report.Rows)
+
+	var imported models.Question
+	require.NoError(t, db.Preload("Options").First(&imported, report.Rows[0].QuestionID).Error)
+	assert.Equal(t, "What is 2 + 2? {hint: add}", imported.QuestionText)
+	assert.Equal(t, "Count on your fingers", imported.Comment)
+	require.Len(t, imported.Options, 3)
+	assert.True(t, imported.Options[1].IsCorrect)
+	assert.Equal(t, "4 = four", imported.Options[1].OptionText)
+
+	var essay models.Question
+	require.NoError(t, db.Preload("Options").First(&essay, report.Rows[2].QuestionID).Error)
+	assert.Equal(t, "hard", essay.Difficulty)
+	assert.Equal(t, "A set with an associative operation:\nidentity and inverses", essay.Options[0].OptionText)
+}
+
+func TestQTIPackageHasManifestAndItems(t *testing.T) {
+	db := setupAttemptTestDB()
+	seedExportBank(db)
+
+	questions, err := services.LoadExportQuestions(db, services.ExportScope{CategoryID: 1})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteQTIPackage(&buf, questions, noImages))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	manifest := files["imsmanifest.xml"]
+	assert.Contains(t, manifest, `href="items/item_1.xml"`)
+	assert.Contains(t, manifest, "<imsmd:value>difficult</imsmd:value>")
+
+	item := files["items/item_1.xml"]
+	assert.Contains(t, item, "<value>choice_2</value>")
+	assert.Contains(t, item, `<simpleChoice identifier="choice_2">4 = four</simpleChoice>`)
+	assert.Contains(t, files["items/item_3.xml"], "<extendedTextInteraction")
+}
+
+func TestExportFailsOnUnreadableImages(t *testing.T) {
+	db := setupAttemptTestDB()
+	seedExportBank(db)
+	db.Model(&models.Question{}).Where("id = ?", 1).Update("image1", "questions/diagram.png")
+
+	questions, err := services.LoadExportQuestions(db, services.ExportScope{CategoryID: 1})
+	require.NoError(t, err)
+	err = services.WriteQTIPackage(io.Discard, questions, noImages)
+	assert.ErrorIs(t, err, services.ErrExportImage)
+	assert.ErrorContains(t, err, "questions/diagram.png of question 1")
+	assert.ErrorIs(t, services.WriteMoodleXML(io.Discard, questions, noImages), services.ErrExportImage)
+
+	var buf bytes.Buffer
+	readImage := func(string) ([]byte, error) { return pngImage, nil }
+	require.NoError(t, services.WriteMoodleXML(&buf, questions, readImage))
+	assert.Contains(t, buf.String(), `@@PLUGINFILE@@/diagram.png`)
+}
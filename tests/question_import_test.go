@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const importCSV = `question_type,question_text,difficulty,category_id,option_1,option_2,option_3,correct_option_id,descriptive_answer,image1,image1_display_time,comment,comment_display_time
+MCQ,What is 2 + 2?,EASY,1,3,4,5,2,,,,,
+TRUE_FALSE,The earth is flat,easy,1,,,,2,,,,Think about it,
+DESCRIPTIVE,Define a group,hard,1,,,,,A set with an operation,diagram.png,5,,
+MCQ,Pick one,medium,9,a,,,3,,,,,
+MCQ,Bad time,easy,1,a,b,,1,,,,,soon
+`
+
+// postImport sends a question file, and optionally an images zip, to the import endpoint
+func postImport(t *testing.T, db *gorm.DB, filename, content string, images map[string][]byte, dryRun bool) services.ImportReport {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	if images != nil {
+		archive := &bytes.Buffer{}
+		zipWriter := zip.NewWriter(archive)
+		for name, data := range images {
+			f, _ := zipWriter.Create(name)
+			f.Write(data)
+		}
+		zipWriter.Close()
+		part, _ := writer.CreateFormFile("images", "images.zip")
+		part.Write(archive.Bytes())
+	}
+	if dryRun {
+		writer.WriteField("dry_run", "true")
+	}
+	writer.Close()
+
+	router := gin.New()
+	router.POST("/import", asSubject(db, adminSubject()), func(c *gin.Context) { controllers.ImportQuestions(c, db, storage.NewLocal(t.TempDir(), nil)) })
+	req := httptest.NewRequest(http.MethodPost, "/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report services.ImportReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return report
+}
+
+func TestImportQuestionsDryRunReportsEveryRow(t *testing.T) {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.Category{})
+	db.Create(&models.Category{ID: 1, Name: "Maths"})
+
+	report := postImport(t, db, "bank.csv", importCSV, map[string][]byte{"diagram.png": []byte("png")}, true)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, 2, report.Valid)
+	assert.Equal(t, 3, report.Failed)
+
+	assert.Equal(t, services.ImportValid, report.Rows[0].Status)
+	assert.Contains(t, report.Rows[1].Errors, "comment_display_time required if comment is provided")
+	assert.Equal(t, services.ImportValid, report.Rows[2].Status)
+	assert.Contains(t, report.Rows[3].Errors, "category 9 does not exist")
+	assert.Contains(t, report.Rows[3].Errors, "option_3 is the correct option but is empty")
+	assert.Contains(t, report.Rows[4].Errors, "comment_display_time must be a number")
+
+	var count int64
+	db.Model(&models.Question{}).Count(&count)
+	assert.Zero(t, count, "a dry run saves nothing")
+}
+
+func TestImportQuestionsFromJSON(t *testing.T) {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.Category{})
+	db.Create(&models.Category{ID: 1, Name: "Maths"})
+
+	content := `[
+		{"question_type": "MCQ", "question_text": "Largest prime below 10?", "difficulty": "medium", "category_id": 1,
+		 "options": ["5", "7", "9"], "correct_option_id": 2},
+		{"question_type": "MCQ", "question_text": "Out of range", "difficulty": "easy", "category_id": 1,
+		 "options": ["a", "b"], "correct_option_id": 6},
+		{"question_type": "DESCRIPTIVE", "question_text": "Missing image", "difficulty": "hard", "category_id": 1,
+		 "descriptive_answer": "x", "image1": "missing.png", "image1_display_time": 3}
+	]`
+	report := postImport(t, db, "bank.json", content, nil, false)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, []string{"CorrectOptionID: Invalid value"}, report.Rows[1].Errors)
+	assert.Equal(t, []string{`image1 "missing.png" is not in the images archive`}, report.Rows[2].Errors)
+
+	var question models.Question
+	require.NoError(t, db.Preload("Options").First(&question, report.Rows[0].QuestionID).Error)
+	assert.Len(t, question.Options, 3)
+	assert.True(t, question.Options[1].IsCorrect)
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
+	"pathshala/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// editQuestion sends an edit form for a question to the edit endpoint
+func editQuestion(t *testing.T, db *gorm.DB, questionID uint, fields map[string]string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	router := gin.New()
+	router.PUT("/questions/:id", func(c *gin.Context) {
+		c.Set("user_id", float64(1))
+		c.Set("subject", adminSubject())
+		controllers.EditQuestion(c, db, storage.NewLocal(t.TempDir(), nil))
+	})
+	req := httptest.NewRequest(http.MethodPut, "/questions/"+strconv.Itoa(int(questionID)), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestEditedQuestionKeepsPastAttemptsUntilRegraded(t *testing.T) {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.Category{})
+	db.Create(&models.Category{ID: 1, Name: "Maths"})
+	test, questions := seedAttempt(db)
+	mcq := questions[0]
+	attempts := services.NewAttemptService(db)
+	revisions := services.NewRevisionService(db, attempts)
+
+	var options []models.QuestionOption
+	db.Where("question_id = ?", mcq.ID).Order("option_id").Find(&options)
+
+	_, err := attempts.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	require.NoError(t, attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: mcq.ID, OptionID: &options[0].ID}}))
+	result, err := attempts.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Correct)
+
+	// The teacher decides "3" was the right answer after all
+	editQuestion(t, db, mcq.ID, map[string]string{
+		"question_type":     "MCQ",
+		"question_text":     "2 + 2 = ?",
+		"difficulty":        "easy",
+		"category_id":       "1",
+		"option_1":          "3",
+		"option_2":          "4",
+		"correct_option_id": "1",
+	})
+
+	result, err = attempts.RescoreAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Correct, "the attempt is still read against the revision it was served")
+
+	history, err := revisions.GetHistory(mcq.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 2, history[0].Revision)
+	require.NotNil(t, history[0].EditedBy)
+	fields := []string{}
+	for _, change := range history[0].Changes {
+		fields = append(fields, change.Field)
+	}
+	assert.Contains(t, fields, "correct_option_id")
+	assert.Empty(t, history[1].Changes)
+
+	affected, err := revisions.RegradeTests(mcq.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{test.ID}, affected)
+	summary, err := revisions.RegradeWithRevision(mcq.ID, 2, affected)
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Attempts)
+	assert.Equal(t, 1, summary.Rescored)
+
+	var stored models.Result
+	db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&stored)
+	assert.Equal(t, 1, stored.Correct)
+
+	var answer models.StudentAnswer
+	db.Where("test_id = ? AND student_id = ? AND question_id = ?", test.ID, 2, mcq.ID).First(&answer)
+	require.NotNil(t, answer.SelectedOptionID)
+	assert.NotEqual(t, options[0].ID, *answer.SelectedOptionID, "the answer moves to option 1 of the new revision")
+
+	_, err = revisions.RegradeWithRevision(mcq.ID, 9, affected)
+	assert.ErrorIs(t, err, services.ErrRevisionNotFound)
+}
+
+func TestRegradeOnlyTouchesTestsTheCallerGrades(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	mcq := questions[0]
+	attempts := services.NewAttemptService(db)
+
+	// Another teacher's test uses the same question
+	other := models.Test{TestName: "Other college", UserID: 3}
+	db.Create(&other)
+	db.Create(&models.TestQuestion{TestID: other.ID, QuestionID: mcq.ID})
+	db.Create(&models.StudentTest{StudentID: 5, TestID: other.ID, Status: services.AttemptAssigned})
+	for _, attempt := range []struct{ testID, studentID uint }{{test.ID, 2}, {other.ID, 5}} {
+		_, err := attempts.StartAttempt(attempt.testID, attempt.studentID)
+		require.NoError(t, err)
+		require.NoError(t, attempts.SaveAnswers(attempt.testID, attempt.studentID, []services.AnswerInput{{QuestionID: mcq.ID, OptionID: &mcq.Options[0].ID}}))
+		_, err = attempts.SubmitAttempt(attempt.testID, attempt.studentID)
+		require.NoError(t, err)
+	}
+	editQuestion(t, db, mcq.ID, map[string]string{
+		"question_type": "MCQ", "question_text": "2 + 2 = ?", "difficulty": "easy", "category_id": "1",
+		"option_1": "3", "option_2": "4", "correct_option_id": "1",
+	})
+
+	revisionController := controllers.NewRevisionController(db, services.NewRevisionService(db, attempts))
+	regrade := func(userID uint) *httptest.ResponseRecorder {
+		subject := teacherSubject(userID, 1)
+		subject.Grants = append(subject.Grants, utils.Grant{Role: utils.RoleTeacher, Permission: utils.PermTestGrade, Scope: utils.ScopeOwn})
+		router := gin.New()
+		router.POST("/questions/:id/revisions/:revision/regrade", asSubject(db, subject), revisionController.Regrade)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/questions/%d/revisions/2/regrade", mcq.ID), nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, regrade(7).Code, "a teacher without any of the tests regrades nothing")
+
+	w := regrade(1)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"skipped_tests":1`)
+
+	var results []models.Result
+	db.Order("test_id").Find(&results)
+	require.Len(t, results, 2)
+	assert.Equal(t, 1, results[0].Correct, "the caller's test is regraded")
+	assert.Equal(t, 0, results[1].Correct, "the other teacher's test is left alone")
+}
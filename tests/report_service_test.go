@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/csv"
+	"io"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedReports creates four students of two colleges, and one without a
+// college, who took test 7 and scored 90%, 60%, 60% and 20%
+func seedReports(t *testing.T) (*gorm.DB, *services.ReportService) {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.College{}, &models.ReportType{})
+	require.NoError(t, services.SeedReportTypes(db))
+	require.NoError(t, services.SeedReportTypes(db), "seeding twice keeps one row per type")
+
+	iit, nit := uint(1), uint(2)
+	db.Create(&[]models.College{{ID: iit, Name: "IIT", State: "Delhi"}, {ID: nit, Name: "NIT", State: "Goa"}})
+	db.Create(&[]models.User{
+		{ID: 2, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "student", CollegeID: &iit},
+		{ID: 3, Name: "Ravi", Email: "ravi@example.com", Password: "x", Role: "student", CollegeID: &iit},
+		{ID: 4, Name: "Meera", Email: "meera@example.com", Password: "x", Role: "student", CollegeID: &nit},
+		{ID: 5, Name: "John", Email: "john@example.com", Password: "x", Role: "student"},
+	})
+	db.Create(&[]models.Result{
+		{TestID: 7, UserID: 2, Score: 9, MaxScore: 10},
+		{TestID: 7, UserID: 3, Score: 6, MaxScore: 10},
+		{TestID: 7, UserID: 4, Score: 6, MaxScore: 10},
+		{TestID: 7, UserID: 5, Score: 2, MaxScore: 10},
+	})
+	db.Create(&[]models.StudentTest{
+		{StudentID: 2, TestID: 7, Status: services.AttemptSubmitted},
+		{StudentID: 2, TestID: 8, Status: services.AttemptSubmitted},
+		{StudentID: 3, TestID: 7, Status: services.AttemptSubmitted},
+		{StudentID: 3, TestID: 8, Status: services.AttemptAssigned},
+		{StudentID: 4, TestID: 7, Status: services.AttemptSubmitted},
+		{StudentID: 5, TestID: 8, Status: services.AttemptAssigned},
+	})
+	return db, services.NewReportService(db)
+}
+
+func TestReportTypesAreListed(t *testing.T) {
+	_, service := seedReports(t)
+
+	types, err := service.GetAllReportTypes()
+	require.NoError(t, err)
+	assert.Len(t, types, len(services.DefaultReportTypes))
+
+	_, err = service.GenerateReport("nope", services.ReportParams{})
+	assert.ErrorIs(t, err, services.ErrUnknownReport)
+	_, err = service.GenerateReport(services.ReportScoreDistribution, services.ReportParams{})
+	assert.ErrorIs(t, err, services.ErrReportNeedsTest)
+}
+
+func TestScoreDistributionReport(t *testing.T) {
+	_, service := seedReports(t)
+
+	report, err := service.GenerateReport(services.ReportScoreDistribution, services.ReportParams{TestID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, "Score distribution", report.Title)
+	require.Len(t, report.Rows, 10)
+	assert.Equal(t, 1, report.Rows[2]["students"])
+	assert.Equal(t, 2, report.Rows[6]["students"])
+	assert.Equal(t, 1, report.Rows[9]["students"])
+	assert.Equal(t, 57.5, report.Summary["mean"])
+	assert.Equal(t, 60.0, report.Summary["median"])
+}
+
+func TestPercentileRanksReport(t *testing.T) {
+	_, service := seedReports(t)
+
+	report, err := service.PercentileRanks(7)
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 4)
+	assert.Equal(t, "Asha", report.Rows[0]["student_name"])
+	assert.Equal(t, 87.5, report.Rows[0]["percentile_rank"])
+	assert.Equal(t, 2, report.Rows[1]["rank"])
+	assert.Equal(t, 2, report.Rows[2]["rank"], "tied students share a rank")
+	assert.Equal(t, 50.0, report.Rows[2]["percentile_rank"])
+	assert.Equal(t, "No college", report.Rows[3]["college"])
+	assert.Equal(t, 12.5, report.Rows[3]["percentile_rank"])
+}
+
+func TestCollegeAndStateComparisonReports(t *testing.T) {
+	_, service := seedReports(t)
+
+	colleges, err := service.CollegeComparison(7)
+	require.NoError(t, err)
+	require.Len(t, colleges.Rows, 3)
+	assert.Equal(t, "IIT", colleges.Rows[0]["group"])
+	assert.Equal(t, 75.0, colleges.Rows[0]["mean"])
+	assert.Equal(t, 2, colleges.Rows[0]["students"])
+	assert.Equal(t, "No college", colleges.Rows[2]["group"])
+
+	states, err := service.StateComparison(7)
+	require.NoError(t, err)
+	require.Len(t, states.Rows, 3)
+	assert.Equal(t, "Delhi", states.Rows[0]["group"])
+	assert.Equal(t, "Goa", states.Rows[1]["group"])
+	assert.Equal(t, "Unknown", states.Rows[2]["group"])
+}
+
+func TestParticipationRankingReport(t *testing.T) {
+	_, service := seedReports(t)
+
+	report, err := service.ParticipationRanking(0)
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 4)
+	names := []string{}
+	for _, row := range report.Rows {
+		names = append(names, row["student_name"].(string))
+	}
+	assert.Equal(t, []string{"Asha", "Meera", "Ravi", "John"}, names)
+	assert.Equal(t, 50.0, report.Rows[2]["participation"])
+
+	limited, err := service.ParticipationRanking(2)
+	require.NoError(t, err)
+	assert.Len(t, limited.Rows, 2)
+}
+
+func TestReportsExportAsCSVAndPDF(t *testing.T) {
+	_, service := seedReports(t)
+	report, err := service.GenerateReport(services.ReportPercentileRanks, services.ReportParams{TestID: 7})
+	require.NoError(t, err)
+
+	var csvBuf bytes.Buffer
+	require.NoError(t, services.WriteReportCSV(&csvBuf, report))
+	records, err := csv.NewReader(&csvBuf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, []string{"Rank", "Student", "College", "Score", "Max", "%", "Percentile"}, records[0])
+	assert.Equal(t, []string{"1", "Asha", "IIT", "9", "10", "90", "87.5"}, records[1])
+
+	var pdfBuf bytes.Buffer
+	require.NoError(t, services.WriteReportPDF(&pdfBuf, report))
+	assert.True(t, strings.HasPrefix(pdfBuf.String(), "%PDF-"))
+	assert.True(t, strings.HasSuffix(pdfBuf.String(), "%%EOF\n"))
+	lines := pdfLines(t, pdfBuf.Bytes())
+	assert.Equal(t, "Percentile ranks", lines[0])
+	assert.Contains(t, strings.Join(lines, "\n"), "Asha")
+}
+
+func TestReportExportsKeepUnicodeAndDefuseFormulas(t *testing.T) {
+	report := &services.Report{
+		Title:   "Percentile ranks",
+		Columns: []services.ReportColumn{{Key: "student", Label: "Student"}, {Key: "score", Label: "Score"}},
+		Rows: []map[string]interface{}{
+			{"student": "अंकिता शर्मा", "score": 9.0},
+			{"student": "=HYPERLINK(\"http://evil.example\")", "score": -1.5},
+			{"student": "@SUM(A1:A2)", "score": 0.0},
+		},
+	}
+
+	var csvBuf bytes.Buffer
+	require.NoError(t, services.WriteReportCSV(&csvBuf, report))
+	records, err := csv.NewReader(&csvBuf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"अंकिता शर्मा", "9"}, records[1])
+	assert.Equal(t, []string{"'=HYPERLINK(\"http://evil.example\")", "-1.5"}, records[2], "negative numbers stay numbers")
+	assert.Equal(t, "'@SUM(A1:A2)", records[3][0])
+
+	var pdfBuf bytes.Buffer
+	require.NoError(t, services.WriteReportPDF(&pdfBuf, report))
+	text := strings.Join(pdfLines(t, pdfBuf.Bytes()), "\n")
+	assert.Contains(t, text, "अंकिता शर्मा")
+	assert.NotContains(t, text, "?")
+
+	assert.Error(t, utils.SetPDFFont([]byte("not a font")))
+}
+
+// pdfLines extracts the text shown by the content streams of a PDF, one
+// string per text operator
+func pdfLines(t *testing.T, pdf []byte) []string {
+	var lines []string
+	streams := regexp.MustCompile(`(?s)<<([^>]*)>>\s*stream\r?\n(.*?)\r?\nendstream`).FindAllSubmatch(pdf, -1)
+	for _, stream := range streams {
+		if !bytes.Contains(stream[1], []byte("FlateDecode")) {
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(stream[2]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		if !bytes.Contains(content, []byte(")Tj")) {
+			continue
+		}
+		for _, shown := range regexp.MustCompile(`(?s)Td \((.*?[^\\])\)Tj`).FindAllSubmatch(content, -1) {
+			// Strings are UTF-16BE with \, ( and ) escaped
+			raw := regexp.MustCompile(`\\(.)`).ReplaceAll(shown[1], []byte("$1"))
+			units := make([]uint16, len(raw)/2)
+			for i := range units {
+				units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+			}
+			lines = append(lines, string(utf16.Decode(units)))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"pathshala/models"
+	"pathshala/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoringPolicyMarks(t *testing.T) {
+	policy := &services.ScoringPolicy{
+		NegativeMarking: 0.25,
+		DifficultyMarks: map[string]float64{"easy": 1, "medium": 2, "hard": 4},
+		QuestionMarks:   map[uint]float64{7: 10},
+		PartialCredit:   true,
+	}
+
+	hard := models.Question{ID: 1, Difficulty: "HARD"}
+	assert.Equal(t, 4.0, policy.Marks(hard), "difficulty is case-insensitive")
+	assert.Equal(t, 10.0, policy.Marks(models.Question{ID: 7, Difficulty: "EASY"}), "per-question marks win")
+	assert.Equal(t, 1.0, policy.Marks(models.Question{ID: 2, Difficulty: "unknown"}))
+
+	assert.Equal(t, 4.0, policy.ScoreObjective(hard, true))
+	assert.Equal(t, -1.0, policy.ScoreObjective(hard, false))
+
+	assert.Equal(t, 3.0, policy.ScoreDescriptive(hard, 3, 4))
+	policy.PartialCredit = false
+	assert.Equal(t, 0.0, policy.ScoreDescriptive(hard, 3, 4))
+	assert.Equal(t, 4.0, policy.ScoreDescriptive(hard, 4, 4))
+}
+
+func TestRescoreAfterPolicyChange(t *testing.T) {
+	db := setupAttemptTestDB()
+	test, questions := seedAttempt(db)
+	attempts := services.NewAttemptService(db)
+	grading := services.NewGradingService(db, attempts)
+
+	_, err := attempts.StartAttempt(test.ID, 2)
+	require.NoError(t, err)
+	require.NoError(t, attempts.SaveAnswers(test.ID, 2, []services.AnswerInput{{QuestionID: questions[0].ID, Selected: "1"}}))
+
+	result, err := attempts.SubmitAttempt(test.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, result.Score, "no negative marking by default")
+	assert.Equal(t, 4.0, result.MaxScore, "an easy and a hard question")
+
+	_, err = grading.SetScoringPolicy(test.ID, services.ScoringInput{NegativeMarking: 0.5, EasyMarks: 1, MediumMarks: 2, HardMarks: 3})
+	require.NoError(t, err)
+	marks := 4.0
+	_, err = grading.SetQuestionMarks(test.ID, questions[0].ID, &marks)
+	require.NoError(t, err)
+
+	_, err = grading.SetQuestionMarks(test.ID, 999, &marks)
+	assert.ErrorIs(t, err, services.ErrQuestionNotInTest)
+
+	rescored, err := grading.RescoreTest(test.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rescored)
+
+	var stored models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", test.ID, 2).First(&stored).Error)
+	assert.Equal(t, -2.0, stored.Score)
+	assert.Equal(t, 7.0, stored.MaxScore)
+}
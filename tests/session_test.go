@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"pathshala/config"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessions(t *testing.T) (*services.SessionService, *redis.Client) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	return services.NewSessionService(rdb, tokens), rdb
+}
+
+func accessTokenValid(t *testing.T, rdb *redis.Client, token string) bool {
+	exists, err := rdb.Exists(context.Background(), "access_token:"+token).Result()
+	require.NoError(t, err)
+	return exists == 1
+}
+
+func TestSessionsOnSeveralDevices(t *testing.T) {
+	sessions, rdb := setupSessions(t)
+	ctx := context.Background()
+	user := &models.User{ID: 7, Email: "ana@example.com"}
+
+	laptop, err := sessions.Create(ctx, user, services.Device{UserAgent: "Firefox", IP: "10.0.0.1"})
+	require.NoError(t, err)
+	phone, err := sessions.Create(ctx, user, services.Device{UserAgent: "Android", IP: "10.0.0.2"})
+	require.NoError(t, err)
+	assert.True(t, accessTokenValid(t, rdb, laptop.AccessToken), "logging in on the phone keeps the laptop session")
+
+	claims, err := sessions.Tokens.ValidateToken(ctx, phone.AccessToken, false)
+	require.NoError(t, err)
+	phoneID := claims["sid"].(string)
+	list, err := sessions.List(ctx, user.ID, phoneID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	var current []string
+	for _, s := range list {
+		if s.Current {
+			current = append(current, s.UserAgent)
+		}
+	}
+	assert.Equal(t, []string{"Android"}, current)
+
+	assert.ErrorIs(t, sessions.Revoke(ctx, 8, phoneID), services.ErrSessionNotFound, "users only revoke their own sessions")
+	require.NoError(t, sessions.Revoke(ctx, user.ID, phoneID))
+	assert.False(t, accessTokenValid(t, rdb, phone.AccessToken))
+	_, err = sessions.Refresh(ctx, phone.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrSessionInvalid)
+	_, err = sessions.Refresh(ctx, laptop.RefreshToken, services.Device{})
+	assert.NoError(t, err)
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	sessions, rdb := setupSessions(t)
+	ctx := context.Background()
+	user := &models.User{ID: 7, Email: "ana@example.com"}
+
+	first, err := sessions.Create(ctx, user, services.Device{UserAgent: "Firefox"})
+	require.NoError(t, err)
+	second, err := sessions.Refresh(ctx, first.RefreshToken, services.Device{UserAgent: "Firefox"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.False(t, accessTokenValid(t, rdb, first.AccessToken), "rotation replaces the access token")
+	assert.True(t, accessTokenValid(t, rdb, second.AccessToken))
+
+	// Someone replays the first refresh token: the whole family goes
+	_, err = sessions.Refresh(ctx, first.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenReused)
+	assert.False(t, accessTokenValid(t, rdb, second.AccessToken))
+	_, err = sessions.Refresh(ctx, second.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrSessionInvalid)
+
+	list, err := sessions.List(ctx, user.ID, "")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pathshala/config"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/storage"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01")
+
+// testStorageBackend checks the behaviour every backend shares
+func testStorageBackend(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	key, err := storage.Save(ctx, store, storage.FolderQuestions, bytes.NewReader(pngImage), int64(len(pngImage)), storage.ImageTypes)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "questions/"))
+	assert.True(t, strings.HasSuffix(key, ".png"), "the extension follows the sniffed type")
+
+	_, err = storage.Save(ctx, store, storage.FolderQuestions, strings.NewReader("<html><script>"), 14, storage.ImageTypes)
+	assert.ErrorIs(t, err, storage.ErrUnsupportedType)
+
+	data, err := storage.ReadAll(ctx, store, key)
+	require.NoError(t, err)
+	assert.Equal(t, pngImage, data)
+	info, err := store.Stat(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", info.ContentType)
+	assert.Equal(t, int64(len(pngImage)), info.Size)
+
+	var walked []string
+	require.NoError(t, store.Walk(ctx, func(info storage.Info) error {
+		walked = append(walked, info.Key)
+		return nil
+	}))
+	assert.Contains(t, walked, key)
+
+	url, err := store.URL(ctx, key, time.Minute)
+	require.NoError(t, err)
+	assert.NotEmpty(t, url)
+
+	require.NoError(t, store.Delete(ctx, key))
+	_, err = store.Stat(ctx, key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, key), "deleting a missing file is not an error")
+
+	_, _, err = store.Get(ctx, "../etc/passwd")
+	assert.ErrorIs(t, err, storage.ErrInvalidKey)
+}
+
+func TestLocalStorage(t *testing.T) {
+	testStorageBackend(t, storage.NewLocal(t.TempDir(), []byte("secret")))
+}
+
+// TestS3Storage runs against an S3-compatible server such as a local MinIO,
+// e.g. S3_TEST_ENDPOINT=localhost:9000 S3_TEST_BUCKET=pathshala-test
+// S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	store, err := storage.NewS3(context.Background(), config.S3Config{
+		Endpoint:  endpoint,
+		Region:    "us-east-1",
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	require.NoError(t, err)
+	testStorageBackend(t, store)
+}
+
+func TestLocalSignedURLs(t *testing.T) {
+	store := storage.NewLocal(t.TempDir(), []byte("secret"))
+	link, err := store.URL(context.Background(), "categories/a.png", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, storage.LocalURLPrefix+"categories/a.png?"))
+
+	query := httptest.NewRequest(http.MethodGet, link, nil).URL.Query()
+	expires, signature := query.Get("expires"), query.Get("signature")
+	now := time.Now()
+	assert.NoError(t, store.Verify("categories/a.png", expires, signature, now))
+	assert.ErrorIs(t, store.Verify("categories/b.png", expires, signature, now), storage.ErrInvalidURL, "a signature only opens its own key")
+	assert.ErrorIs(t, store.Verify("categories/a.png", expires, signature, now.Add(2*time.Minute)), storage.ErrInvalidURL, "links expire")
+	later := strconv.FormatInt(now.Add(time.Hour).Unix(), 10)
+	assert.ErrorIs(t, store.Verify("categories/a.png", later, signature, now), storage.ErrInvalidURL, "the expiry is signed")
+}
+
+func TestCopyBetweenBackends(t *testing.T) {
+	ctx := context.Background()
+	from := storage.NewLocal(t.TempDir(), nil)
+	to := storage.NewLocal(t.TempDir(), nil)
+	for _, key := range []string{"questions/a.png", "profiles/b.png"} {
+		require.NoError(t, from.Put(ctx, key, bytes.NewReader(pngImage), int64(len(pngImage)), "image/png"))
+	}
+	require.NoError(t, to.Put(ctx, "profiles/b.png", bytes.NewReader(pngImage), int64(len(pngImage)), "image/png"))
+
+	report, err := storage.Copy(ctx, from, to, false, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, storage.CopyReport{Copied: 1, Skipped: 1}, report)
+
+	report, err = storage.Copy(ctx, from, to, true, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, storage.CopyReport{Skipped: 2, Deleted: 2}, report, "a rerun copies nothing again")
+
+	_, err = from.Stat(ctx, "questions/a.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	data, err := storage.ReadAll(ctx, to, "questions/a.png")
+	require.NoError(t, err)
+	assert.Equal(t, pngImage, data)
+}
+
+func TestFileLinksFollowRecordVisibility(t *testing.T) {
+	db := seedTenants(t)
+	store := storage.NewLocal(t.TempDir(), []byte("secret"))
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "categories/nit.png", bytes.NewReader(pngImage), int64(len(pngImage)), "image/png"))
+	key := "categories/nit.png"
+	db.Model(&models.Category{}).Where("id = ?", 2).Update("image_path", key)
+
+	fileController := controllers.NewFileController(db, store, time.Minute)
+	linkFor := func(teacherID, collegeID uint) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/api/files/*key", asSubject(db, teacherSubject(teacherID, collegeID)), fileController.GetFileURL)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/files/"+key, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, linkFor(1, 1).Code, "IIT cannot see NIT's private category")
+
+	w := linkFor(3, 2)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var body struct {
+		URL string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	files := gin.New()
+	files.GET("/files/*key", fileController.ServeLocalFile)
+	w = httptest.NewRecorder()
+	files.ServeHTTP(w, httptest.NewRequest(http.MethodGet, body.URL, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, pngImage, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	files.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.Replace(body.URL, "nit.png", "other.png", 1), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "a link only opens the file it was made for")
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"pathshala/models"
+	"pathshala/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupSurveyTestDB() *gorm.DB {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.College{}, &models.Survey{}, &models.SurveyQuestion{}, &models.SurveyAssignment{},
+		&models.SurveyResponse{}, &models.SurveyAnswer{})
+	return db
+}
+
+// seedSurvey creates a course feedback survey by teacher 1 with a Likert, a
+// multiple choice and a free-text question, and students 2 and 3 of college 1
+func seedSurvey(t *testing.T, db *gorm.DB, anonymous bool) (*services.SurveyService, *models.Survey) {
+	college := uint(1)
+	db.Create(&models.College{ID: college, Name: "IIT", State: "Delhi"})
+	db.Create(&[]models.User{
+		{ID: 1, Name: "Teacher", Email: "teacher@example.com", Password: "x", Role: "teacher"},
+		{ID: 2, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "student", CollegeID: &college},
+		{ID: 3, Name: "Ravi", Email: "ravi@example.com", Password: "x", Role: "student", CollegeID: &college},
+		{ID: 4, Name: "Meera", Email: "meera@example.com", Password: "x", Role: "student"},
+	})
+
+	service := services.NewSurveyService(db)
+	survey, err := service.CreateSurvey(&models.Survey{
+		Name: "Algebra feedback", SurveyType: "course_feedback", Anonymous: anonymous, CreatedBy: 1,
+		Questions: []models.SurveyQuestion{
+			{QuestionType: models.SurveyLikert, QuestionText: "The pace was right", Required: true},
+			{QuestionType: models.SurveyMultipleChoice, QuestionText: "Best part", Options: []string{"Lectures", "Labs"}},
+			{QuestionType: models.SurveyText, QuestionText: "Anything else?"},
+		},
+	})
+	require.NoError(t, err)
+	return service, survey
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestCreateSurveyValidatesQuestions(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, false)
+
+	stored, err := service.GetSurveyByID(survey.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.NumQuestions)
+	require.Len(t, stored.Questions, 3)
+	assert.Equal(t, 5, stored.Questions[0].Scale, "Likert questions default to a 5-point scale")
+	assert.Equal(t, []string{"Lectures", "Labs"}, stored.Questions[1].Options)
+
+	_, err = service.CreateSurvey(&models.Survey{Name: "Bad", Questions: []models.SurveyQuestion{
+		{QuestionType: models.SurveyMultipleChoice, QuestionText: "Pick", Options: []string{"Only"}},
+	}})
+	assert.ErrorIs(t, err, services.ErrInvalidSurvey)
+
+	res, err := service.SurveyResource(survey.ID)
+	require.NoError(t, err)
+	require.NotNil(t, res.OwnerID)
+	assert.Equal(t, uint(1), *res.OwnerID, "surveys are owned by their creator")
+}
+
+func TestAssignSurveyToCollegeAndStudents(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, false)
+
+	college := uint(1)
+	assigned, err := service.AssignSurvey(survey.ID, services.SurveyAssignInput{CollegeID: &college})
+	require.NoError(t, err)
+	assert.Equal(t, 2, assigned)
+
+	assigned, err = service.AssignSurvey(survey.ID, services.SurveyAssignInput{StudentIDs: []uint{2, 4}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, assigned, "students who already have the survey are skipped")
+
+	_, err = service.AssignSurvey(survey.ID, services.SurveyAssignInput{StudentIDs: []uint{1}})
+	assert.ErrorIs(t, err, services.ErrInvalidSurvey, "teachers cannot be assigned surveys")
+
+	surveys, err := service.GetAssignedSurveys(4)
+	require.NoError(t, err)
+	require.Len(t, surveys, 1)
+	assert.Equal(t, survey.ID, surveys[0].SurveyID)
+	assert.Equal(t, services.SurveyAssigned, surveys[0].Status)
+}
+
+func TestSubmitSurveyResponse(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, false)
+	_, err := service.AssignSurvey(survey.ID, services.SurveyAssignInput{StudentIDs: []uint{2}})
+	require.NoError(t, err)
+	q := survey.Questions
+
+	_, err = service.SubmitResponse(survey.ID, 3, nil)
+	assert.ErrorIs(t, err, services.ErrSurveyNotAssigned)
+
+	_, err = service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{{QuestionID: q[2].ID, Text: "More labs"}})
+	assert.ErrorIs(t, err, services.ErrInvalidSurveyAnswer, "the Likert question is required")
+
+	_, err = service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{{QuestionID: q[0].ID, LikertValue: intPtr(6)}})
+	assert.ErrorIs(t, err, services.ErrInvalidSurveyAnswer, "6 is off the scale")
+
+	response, err := service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{
+		{QuestionID: q[0].ID, LikertValue: intPtr(4)},
+		{QuestionID: q[1].ID, OptionIndex: intPtr(1)},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, response.StudentID)
+	assert.Equal(t, uint(2), *response.StudentID)
+	assert.Len(t, response.Answers, 2)
+
+	_, err = service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{{QuestionID: q[0].ID, LikertValue: intPtr(4)}})
+	assert.ErrorIs(t, err, services.ErrSurveyCompleted)
+
+	_, err = service.SetQuestions(survey.ID, nil)
+	assert.ErrorIs(t, err, services.ErrSurveyHasResponses)
+}
+
+func TestAnonymousSurveyResponsesAreUnattributed(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, true)
+	_, err := service.AssignSurvey(survey.ID, services.SurveyAssignInput{StudentIDs: []uint{2}})
+	require.NoError(t, err)
+
+	_, err = service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{{QuestionID: survey.Questions[0].ID, LikertValue: intPtr(3)}})
+	require.NoError(t, err)
+
+	responses, err := service.GetResponses(survey.ID)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.Nil(t, responses[0].StudentID)
+
+	surveys, err := service.GetAssignedSurveys(2)
+	require.NoError(t, err)
+	assert.Equal(t, services.SurveyCompleted, surveys[0].Status)
+
+	_, err = service.UpdateSurvey(survey.ID, map[string]interface{}{"anonymous": false})
+	assert.ErrorIs(t, err, services.ErrSurveyHasResponses)
+}
+
+func TestSurveyResultsAggregation(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, false)
+	college := uint(1)
+	_, err := service.AssignSurvey(survey.ID, services.SurveyAssignInput{CollegeID: &college})
+	require.NoError(t, err)
+	q := survey.Questions
+
+	_, err = service.SubmitResponse(survey.ID, 2, []services.SurveyAnswerInput{
+		{QuestionID: q[0].ID, LikertValue: intPtr(5)},
+		{QuestionID: q[1].ID, OptionIndex: intPtr(0)},
+		{QuestionID: q[2].ID, Text: "Great course"},
+	})
+	require.NoError(t, err)
+
+	_, err = service.GetStudentResults(survey.ID, 2)
+	assert.ErrorIs(t, err, services.ErrSurveyResultsHidden)
+
+	_, err = service.SubmitResponse(survey.ID, 3, []services.SurveyAnswerInput{
+		{QuestionID: q[0].ID, LikertValue: intPtr(2)},
+		{QuestionID: q[1].ID, OptionIndex: intPtr(0)},
+	})
+	require.NoError(t, err)
+
+	results, err := service.GetResults(survey.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), results.Assigned)
+	assert.Equal(t, int64(2), results.Responses)
+	require.Len(t, results.Questions, 3)
+
+	likert := results.Questions[0]
+	require.NotNil(t, likert.Mean)
+	assert.Equal(t, 3.5, *likert.Mean)
+	require.Len(t, likert.Distribution, 5)
+	assert.Equal(t, 1, likert.Distribution[1].Count)
+	assert.Equal(t, 50.0, likert.Distribution[4].Percentage)
+
+	choice := results.Questions[1]
+	assert.Equal(t, "Lectures", choice.Distribution[0].Label)
+	assert.Equal(t, 2, choice.Distribution[0].Count)
+	assert.Equal(t, 100.0, choice.Distribution[0].Percentage)
+	assert.Equal(t, []string{"Great course"}, results.Questions[2].Texts)
+
+	_, err = service.UpdateSurvey(survey.ID, map[string]interface{}{"show_results": true})
+	require.NoError(t, err)
+	shared, err := service.GetStudentResults(survey.ID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3.5, *shared.Questions[0].Mean)
+	assert.Nil(t, shared.Questions[2].Texts, "students never see free-text answers")
+}
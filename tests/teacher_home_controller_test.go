@@ -101,7 +101,6 @@ func TestGetTeacherHomeStat(t *testing.T) {
 
 	db.Create(&models.Student{
 		UserID: 2,
-		Status: "active",
 		Branch: "CSE",
 		Gender: "male",
 	})
@@ -0,0 +1,354 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/controllers"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func adminSubject() *utils.Subject {
+	return &utils.Subject{UserID: 1, Role: utils.RoleAdmin, Grants: []utils.Grant{
+		{Role: utils.RoleAdmin, Permission: utils.PermAll, Scope: utils.ScopeGlobal},
+	}}
+}
+
+func teacherSubject(userID, collegeID uint) *utils.Subject {
+	return &utils.Subject{UserID: userID, Role: utils.RoleTeacher, CollegeID: &collegeID, Grants: []utils.Grant{
+		{Role: utils.RoleTeacher, Permission: utils.PermCategoryManage, Scope: utils.ScopeGlobal},
+	}}
+}
+
+// asSubject logs a subject in like PermissionMiddleware does, without
+// loading its grants from the database
+func asSubject(db *gorm.DB, subject *utils.Subject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", float64(subject.UserID))
+		c.Set("subject", subject)
+		tenant, err := utils.LoadTenant(db, subject)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Request = c.Request.WithContext(utils.WithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+// seedTenants creates IIT and AIIMS in Delhi and NIT in Goa, a teacher and a
+// student in each of IIT and NIT, and categories with one question each:
+// IIT's, NIT's private and shared ones, and a platform category
+func seedTenants(t *testing.T) *gorm.DB {
+	db := setupAttemptTestDB()
+	db.AutoMigrate(&models.College{}, &models.Category{})
+	require.NoError(t, utils.RegisterTenantScopes(db))
+
+	iit, nit, aiims := uint(1), uint(2), uint(3)
+	db.Create(&[]models.College{{ID: iit, Name: "IIT", State: "Delhi"}, {ID: nit, Name: "NIT", State: "Goa"}, {ID: aiims, Name: "AIIMS", State: "Delhi"}})
+	db.Create(&[]models.User{
+		{ID: 1, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "teacher", CollegeID: &iit},
+		{ID: 2, Name: "Ravi", Email: "ravi@example.com", Password: "x", Role: "student", CollegeID: &iit},
+		{ID: 3, Name: "Meera", Email: "meera@example.com", Password: "x", Role: "teacher", CollegeID: &nit},
+		{ID: 4, Name: "John", Email: "john@example.com", Password: "x", Role: "student", CollegeID: &nit},
+	})
+	db.Create(&[]models.Category{
+		{ID: 1, Name: "IIT Algebra", CollegeID: &iit},
+		{ID: 2, Name: "NIT Private", CollegeID: &nit},
+		{ID: 3, Name: "NIT Shared", CollegeID: &nit, Shared: true},
+		{ID: 4, Name: "Platform"},
+	})
+	for id := uint(1); id <= 4; id++ {
+		db.Create(&models.Question{ID: id, QuestionType: "MCQ", QuestionText: "Question", Difficulty: "easy", CategoryID: id})
+	}
+	db.Create(&[]models.Test{{ID: 1, TestName: "IIT test", UserID: 1}, {ID: 2, TestName: "NIT test", UserID: 3}})
+	return db
+}
+
+func tenantContext(t *testing.T, db *gorm.DB, subject *utils.Subject) context.Context {
+	tenant, err := utils.LoadTenant(db, subject)
+	require.NoError(t, err)
+	return utils.WithTenant(context.Background(), tenant)
+}
+
+func TestLoadTenant(t *testing.T) {
+	db := seedTenants(t)
+
+	tenant, err := utils.LoadTenant(db, adminSubject())
+	require.NoError(t, err)
+	assert.True(t, tenant.All)
+
+	tenant, err = utils.LoadTenant(db, teacherSubject(1, 1))
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1}, tenant.CollegeIDs)
+
+	coordinator := &utils.Subject{UserID: 5, Role: utils.RoleTeacher, Grants: []utils.Grant{
+		{Role: utils.RoleStateCoordinator, Permission: utils.PermTestView, Scope: utils.ScopeState, State: "Delhi"},
+	}}
+	tenant, err = utils.LoadTenant(db, coordinator)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1, 3}, tenant.CollegeIDs, "state coordinators see every college of their state")
+	assert.Equal(t, "c1,3", tenant.Key())
+}
+
+func TestTenantScopesReads(t *testing.T) {
+	db := seedTenants(t)
+	iit := db.WithContext(tenantContext(t, db, teacherSubject(1, 1)))
+
+	var categories []string
+	iit.Model(&models.Category{}).Order("id").Pluck("name", &categories)
+	assert.Equal(t, []string{"IIT Algebra", "NIT Shared", "Platform"}, categories)
+
+	var questions []struct{ ID uint }
+	iit.Table("questions").Select("questions.id").
+		Joins("LEFT JOIN categories ON questions.category_id = categories.id").Order("questions.id").Scan(&questions)
+	require.Len(t, questions, 3, "questions follow their category")
+	assert.Equal(t, uint(3), questions[1].ID)
+
+	var count int64
+	iit.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	var tests []models.Test
+	iit.Find(&tests)
+	require.Len(t, tests, 1)
+	assert.Equal(t, "IIT test", tests[0].TestName)
+
+	var category models.Category
+	err := iit.First(&category, 2).Error
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "private categories of other colleges are hidden")
+
+	all := db.WithContext(tenantContext(t, db, adminSubject()))
+	all.Model(&models.Category{}).Count(&count)
+	assert.Equal(t, int64(4), count, "admins see across tenants")
+	db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(4), count, "queries without a tenant are not scoped")
+}
+
+func TestTenantScopesWrites(t *testing.T) {
+	db := seedTenants(t)
+	iit := db.WithContext(tenantContext(t, db, teacherSubject(1, 1)))
+
+	for _, id := range []uint{2, 3, 4} {
+		result := iit.Model(&models.Category{ID: id}).Update("name", "Taken")
+		require.NoError(t, result.Error)
+		assert.Zero(t, result.RowsAffected, "category %d belongs to another college or the platform", id)
+		result = iit.Model(&models.Question{}).Where("id = ?", id).Update("question_text", "Taken")
+		require.NoError(t, result.Error)
+		assert.Zero(t, result.RowsAffected, "question %d belongs to another college or the platform", id)
+	}
+	result := iit.Delete(&models.Question{}, 3)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected, "shared questions cannot be deleted by other colleges")
+	result = iit.Delete(&models.User{}, 4)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected)
+	result = iit.Model(&models.Test{}).Where("id = ?", 2).Update("test_name", "Taken")
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected)
+
+	var names []string
+	db.Model(&models.Category{}).Order("id").Pluck("name", &names)
+	assert.Equal(t, []string{"IIT Algebra", "NIT Private", "NIT Shared", "Platform"}, names)
+
+	result = iit.Model(&models.Category{ID: 1}).Update("name", "IIT Geometry")
+	require.NoError(t, result.Error)
+	assert.Equal(t, int64(1), result.RowsAffected, "colleges change their own categories")
+	result = db.WithContext(tenantContext(t, db, adminSubject())).Model(&models.Category{ID: 4}).Update("name", "Platform Maths")
+	require.NoError(t, result.Error)
+	assert.Equal(t, int64(1), result.RowsAffected, "admins change platform content")
+
+	ctx := utils.RequestContext(&gin.Context{Request: httptest.NewRequest(http.MethodPost, "/", nil)})
+	err := db.WithContext(ctx).Model(&models.Category{ID: 1}).Update("name", "Lost").Error
+	assert.ErrorIs(t, err, utils.ErrNoTenant, "requests without a tenant write nothing")
+}
+
+func TestReportsOnlyListStudentsOfTheTenant(t *testing.T) {
+	db := seedTenants(t)
+	db.AutoMigrate(&models.ReportType{})
+	require.NoError(t, services.SeedReportTypes(db))
+	db.Create(&[]models.StudentTest{
+		{TestID: 1, StudentID: 2, Status: services.AttemptSubmitted},
+		{TestID: 1, StudentID: 4, Status: services.AttemptSubmitted},
+	})
+	db.Create(&[]models.Result{
+		{TestID: 1, UserID: 2, Score: 8, MaxScore: 10},
+		{TestID: 1, UserID: 4, Score: 6, MaxScore: 10},
+	})
+
+	names := func(report *services.Report) []string {
+		var names []string
+		for _, row := range report.Rows {
+			names = append(names, row["student_name"].(string))
+		}
+		return names
+	}
+
+	reports := services.NewReportService(db).WithContext(tenantContext(t, db, teacherSubject(3, 2)))
+	report, err := reports.GenerateReport(services.ReportPercentileRanks, services.ReportParams{TestID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"John"}, names(report))
+	report, err = reports.GenerateReport(services.ReportParticipationRanking, services.ReportParams{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"John"}, names(report))
+	assert.Equal(t, 60.0, report.Rows[0]["mean_score"])
+
+	reports = services.NewReportService(db).WithContext(tenantContext(t, db, adminSubject()))
+	report, err = reports.GenerateReport(services.ReportPercentileRanks, services.ReportParams{TestID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ravi", "John"}, names(report))
+}
+
+func TestCategoriesAreIsolatedByCollege(t *testing.T) {
+	db := seedTenants(t)
+	db.AutoMigrate(&models.MacroCategory{})
+
+	router := gin.New()
+	router.Use(asSubject(db, teacherSubject(1, 1)))
+	router.GET("/categories", func(c *gin.Context) { controllers.GetAllCategories(c, db) })
+	router.GET("/categories/:id", func(c *gin.Context) { controllers.GetCategoryByID(c, db) })
+	router.DELETE("/categories/:id", func(c *gin.Context) { controllers.DeleteCategory(c, db) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/categories", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "NIT Shared")
+	assert.NotContains(t, w.Body.String(), "NIT Private")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/categories/2", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/categories/3", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "shared categories stay read-only for other colleges")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/categories/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequestsWithoutTenantFailClosed(t *testing.T) {
+	db := seedTenants(t)
+
+	var err error
+	router := gin.New()
+	router.GET("/questions/:id", func(c *gin.Context) {
+		err = utils.RequestDB(c, db).First(&models.Question{}, c.Param("id")).Error
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/questions/1", nil))
+	assert.ErrorIs(t, err, utils.ErrNoTenant, "a request nobody is logged in to sees no college")
+
+	router = gin.New()
+	router.GET("/questions/:id", asSubject(db, teacherSubject(1, 1)), func(c *gin.Context) {
+		err = utils.RequestDB(c, db).First(&models.Question{}, c.Param("id")).Error
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/questions/2", nil))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/questions/3", nil))
+	assert.NoError(t, err)
+}
+
+func TestQuestionsOfOtherCollegesCannotBeExported(t *testing.T) {
+	db := seedTenants(t)
+	db.Model(&models.Question{}).Where("id = ?", 2).Update("question_text", "NIT private question")
+	db.Model(&models.Question{}).Where("id = ?", 3).Update("question_text", "NIT shared question")
+	for id := uint(1); id <= 4; id++ {
+		db.Create(&[]models.QuestionOption{
+			{QuestionID: id, OptionID: 1, OptionText: "Yes", IsCorrect: true},
+			{QuestionID: id, OptionID: 2, OptionText: "No"},
+		})
+	}
+
+	export := func(query string) string {
+		router := gin.New()
+		router.GET("/export", asSubject(db, teacherSubject(1, 1)), func(c *gin.Context) {
+			controllers.ExportQuestions(c, utils.RequestDB(c, db), nil)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?format=gift&"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	assert.NotContains(t, export("category_id=2"), "NIT private question")
+	assert.Contains(t, export("category_id=3"), "NIT shared question")
+}
+
+func TestRevisionHistoryFollowsQuestionVisibility(t *testing.T) {
+	db := seedTenants(t)
+	revisionController := controllers.NewRevisionController(db, services.NewRevisionService(db, services.NewAttemptService(db)))
+
+	get := func(subject *utils.Subject, path string) int {
+		router := gin.New()
+		router.Use(asSubject(db, subject))
+		router.GET("/questions/:id/revisions", revisionController.GetHistory)
+		router.GET("/questions/:id/revisions/:revision", revisionController.GetRevision)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get(teacherSubject(3, 2), "/questions/2/revisions"))
+	assert.Equal(t, http.StatusOK, get(teacherSubject(3, 2), "/questions/2/revisions/1"))
+	assert.Equal(t, http.StatusNotFound, get(teacherSubject(1, 1), "/questions/2/revisions"), "IIT cannot read NIT's private question")
+	assert.Equal(t, http.StatusNotFound, get(teacherSubject(1, 1), "/questions/2/revisions/1"))
+	assert.Equal(t, http.StatusOK, get(teacherSubject(1, 1), "/questions/3/revisions"), "shared questions stay readable")
+}
+
+func TestStudentsTakeTestsFromOutsideTheirCollege(t *testing.T) {
+	db := seedTenants(t)
+	db.Create(&models.User{ID: 5, Name: "Admin", Email: "admin@example.com", Password: "x", Role: utils.RoleAdmin})
+	db.Create(&[]models.QuestionOption{
+		{QuestionID: 2, OptionID: 1, OptionText: "Yes", IsCorrect: true},
+		{QuestionID: 2, OptionID: 2, OptionText: "No"},
+	})
+	db.Create(&models.Test{ID: 3, TestName: "Platform test", UserID: 5})
+	db.Create(&models.TestQuestion{TestID: 3, QuestionID: 2})
+	db.Create(&models.StudentTest{TestID: 3, StudentID: 2, Status: services.AttemptAssigned})
+
+	iit := uint(1)
+	student := &utils.Subject{UserID: 2, Role: utils.RoleStudent, CollegeID: &iit}
+	attempts := controllers.NewStudentTestController(services.NewAttemptService(db))
+	router := gin.New()
+	router.Use(asSubject(db, student))
+	router.POST("/tests/:test_id/start", attempts.StartTest)
+	router.GET("/tests/:test_id/questions", attempts.GetTestQuestions)
+	router.POST("/tests/:test_id/answers", attempts.SaveAnswers)
+	router.POST("/tests/:test_id/submit", attempts.SubmitTest)
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := call(http.MethodPost, "/tests/3/start", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = call(http.MethodGet, "/tests/3/questions", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"id":2`, "the question of another college is served for the assigned test")
+
+	var option models.QuestionOption
+	db.Where("question_id = ? AND option_id = ?", 2, 1).First(&option)
+	w = call(http.MethodPost, "/tests/3/answers", fmt.Sprintf(`[{"question_id":2,"option_id":%d}]`, option.ID))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = call(http.MethodPost, "/tests/3/submit", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var result models.Result
+	require.NoError(t, db.Where("test_id = ? AND user_id = ?", 3, 2).First(&result).Error)
+	assert.Equal(t, 1, result.Correct)
+
+	w = call(http.MethodPost, "/tests/2/start", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "tests not assigned stay out of reach")
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTrashTest(t *testing.T) (*services.TrashService, *gorm.DB, *storage.Local) {
+	db := setupAttemptTestDB()
+	require.NoError(t, db.AutoMigrate(&models.College{}, &models.Category{}, &models.Student{}, &models.Teacher{}, &models.RoleAssignment{}))
+	store := storage.NewLocal(t.TempDir(), nil)
+	return services.NewTrashService(db, store, 24*time.Hour), db, store
+}
+
+func TestTrashTestCascadesAndRestores(t *testing.T) {
+	service, db, _ := setupTrashTest(t)
+	test, questions := seedAttempt(db)
+	db.Create(&models.Result{TestID: test.ID, UserID: 2, Score: 1})
+	db.Create(&models.StudentAnswer{TestID: test.ID, StudentID: 2, QuestionID: questions[0].ID, Selected: "4"})
+
+	require.NoError(t, service.Delete(services.TrashTests, test.ID))
+
+	var attempts, results, answers int64
+	db.Model(&models.StudentTest{}).Where("test_id = ?", test.ID).Count(&attempts)
+	db.Model(&models.Result{}).Where("test_id = ?", test.ID).Count(&results)
+	db.Model(&models.StudentAnswer{}).Where("test_id = ?", test.ID).Count(&answers)
+	assert.Zero(t, attempts+results+answers, "assignments, results and answers go to the trash with the test")
+
+	items, total, err := service.ListTrash(services.TrashTests, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, "Algebra", items[0].Name)
+	assert.Equal(t, items[0].DeletedAt.Add(24*time.Hour), items[0].PurgeAt)
+
+	require.NoError(t, service.Restore(services.TrashTests, test.ID))
+	db.Model(&models.StudentTest{}).Where("test_id = ?", test.ID).Count(&attempts)
+	db.Model(&models.Result{}).Where("test_id = ?", test.ID).Count(&results)
+	assert.Equal(t, int64(1), attempts)
+	assert.Equal(t, int64(1), results)
+
+	assert.ErrorIs(t, service.Restore(services.TrashTests, test.ID), services.ErrNotInTrash)
+	assert.ErrorIs(t, service.Delete("surveys", 1), services.ErrUnknownTrashType)
+}
+
+func TestTrashQuestionRestoreWaitsForCategory(t *testing.T) {
+	service, db, _ := setupTrashTest(t)
+	db.Create(&models.Category{ID: 1, Name: "Algebra"})
+	earlier := models.Question{QuestionType: "MCQ", QuestionText: "Deleted first", Difficulty: "easy", CategoryID: 1}
+	later := models.Question{QuestionType: "MCQ", QuestionText: "Deleted with category", Difficulty: "easy", CategoryID: 1}
+	db.Create(&earlier)
+	db.Create(&later)
+
+	require.NoError(t, service.Delete(services.TrashQuestions, earlier.ID))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, service.Delete(services.TrashCategories, 1))
+
+	assert.ErrorIs(t, service.Restore(services.TrashQuestions, later.ID), services.ErrTrashParentDeleted)
+
+	require.NoError(t, service.Restore(services.TrashCategories, 1))
+	var restored []models.Question
+	db.Find(&restored)
+	require.Len(t, restored, 1, "questions deleted before the category stay in the trash")
+	assert.Equal(t, later.ID, restored[0].ID)
+}
+
+func TestTrashCollegeInUse(t *testing.T) {
+	service, db, _ := setupTrashTest(t)
+	college := uint(1)
+	db.Create(&models.College{ID: college, Name: "IIT", State: "Delhi"})
+	db.Create(&models.User{ID: 5, Name: "Asha", Email: "asha@example.com", Password: "x", Role: "teacher", CollegeID: &college})
+	require.NoError(t, service.Delete(services.TrashUsers, 5))
+
+	assert.ErrorIs(t, service.Delete(services.TrashColleges, college), services.ErrCollegeInUse, "trashed users still belong to the college")
+}
+
+func TestTrashPurgeRespectsRetentionAndUse(t *testing.T) {
+	service, db, store := setupTrashTest(t)
+	test, questions := seedAttempt(db)
+	db.Create(&models.TestQuestion{TestID: test.ID, QuestionID: questions[0].ID})
+	require.NoError(t, store.Put(context.Background(), "questions/unused.png", strings.NewReader("png"), 3, "image/png"))
+	unused := models.Question{QuestionType: "MCQ", QuestionText: "Unused", Difficulty: "easy", CategoryID: 1, Image1: "questions/unused.png"}
+	db.Create(&unused)
+
+	require.NoError(t, service.Delete(services.TrashQuestions, questions[0].ID))
+	require.NoError(t, service.Delete(services.TrashQuestions, unused.ID))
+
+	purged, err := service.PurgeExpired(time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, purged, "items inside the retention period are kept")
+
+	purged, err = service.PurgeExpired(time.Now().Add(48 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged, "a question used by a test is kept")
+
+	var left []uint
+	db.Unscoped().Model(&models.Question{}).Where("deleted_at IS NOT NULL").Pluck("id", &left)
+	assert.Equal(t, []uint{questions[0].ID}, left)
+	_, err = store.Stat(context.Background(), "questions/unused.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "images of purged questions are deleted")
+
+	var options int64
+	db.Model(&models.QuestionOption{}).Where("question_id = ?", unused.ID).Count(&options)
+	assert.Zero(t, options)
+}
+
+func TestTrashPurgeOutlivesFailingItems(t *testing.T) {
+	service, db, _ := setupTrashTest(t)
+	test, _ := seedAttempt(db)
+	unused := models.Question{QuestionType: "MCQ", QuestionText: "Unused", Difficulty: "easy", CategoryID: 1}
+	db.Create(&unused)
+	require.NoError(t, service.Delete(services.TrashTests, test.ID))
+	require.NoError(t, service.Delete(services.TrashQuestions, unused.ID))
+
+	// Purging the test fails halfway, and its transaction rolls back
+	require.NoError(t, db.Migrator().DropTable(&models.TestBlueprint{}))
+
+	purged, err := service.PurgeExpired(time.Now().Add(48 * time.Hour))
+	assert.ErrorContains(t, err, "purging tests")
+	assert.Equal(t, 1, purged, "the question is purged after the test failed")
+
+	var tests int64
+	db.Unscoped().Model(&models.Test{}).Where("id = ?", test.ID).Count(&tests)
+	assert.Equal(t, int64(1), tests, "the test stays in the trash for the next run")
+}
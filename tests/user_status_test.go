@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pathshala/config"
+	"pathshala/controllers"
+	"pathshala/middlewares"
+	"pathshala/models"
+	"pathshala/services"
+	"pathshala/utils"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserStatusTransitions(t *testing.T) {
+	db := setupAttemptTestDB()
+	statuses := services.NewUserStatusService(db, nil, nil)
+	teacher := models.User{Name: "Ana", Email: "ana@example.com", Password: "x", Role: utils.RoleTeacher, Status: utils.StatusInvited}
+	db.Create(&teacher)
+
+	assert.ErrorIs(t, statuses.ChangeStatus(context.Background(), &teacher, "inactive"), services.ErrInvalidUserStatus)
+	assert.ErrorIs(t, statuses.ChangeStatus(context.Background(), &teacher, utils.StatusSuspended), services.ErrStatusTransition,
+		"invited users are activated or archived, not suspended")
+	require.NoError(t, statuses.ChangeStatus(context.Background(), &teacher, utils.StatusActive))
+	assert.ErrorIs(t, statuses.ChangeStatus(context.Background(), &teacher, utils.StatusGraduated), services.ErrStatusTransition,
+		"only students graduate")
+
+	stale := teacher
+	stale.Status = utils.StatusInvited
+	assert.ErrorIs(t, statuses.ChangeStatus(context.Background(), &stale, utils.StatusActive), services.ErrStatusTransition)
+}
+
+func TestSuspendedUsersAreLockedOut(t *testing.T) {
+	db := setupAttemptTestDB()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	sessions := services.NewSessionService(rdb, tokens)
+	statuses := services.NewUserStatusService(db, rdb, sessions)
+	require.NoError(t, db.AutoMigrate(&models.UserMFA{}, &models.MFARecoveryCode{}))
+	mfa, err := services.NewMFAService(db, rdb, config.MFAConfig{
+		Issuer:        "Pathshala",
+		EncryptionKey: "0123456789abcdef0123456789abcdef",
+		ChallengeTTL:  time.Minute,
+	})
+	require.NoError(t, err)
+	auth := controllers.NewAuthController(db, rdb, tokens, nil, "", mfa, sessions, nil, newTestLoginGuard(rdb), nil)
+
+	password, _ := utils.HashPassword("secret")
+	student := models.User{Name: "Ben", Email: "ben@example.com", Password: password, Role: utils.RoleStudent}
+	db.Create(&student)
+	db.First(&student, student.ID)
+	assert.Equal(t, utils.StatusActive, student.Status, "users are active unless created otherwise")
+	session, err := sessions.Create(context.Background(), &student, services.Device{})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/login", auth.Login)
+	router.GET("/me", middlewares.AuthMiddleware(db, rdb, tokens), func(c *gin.Context) { c.Status(http.StatusOK) })
+	me := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	login := func() int {
+		payload, _ := json.Marshal(gin.H{"email": "ben@example.com", "password": "secret"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, me(), "the status is now cached")
+	require.NoError(t, statuses.ChangeStatus(context.Background(), &student, utils.StatusSuspended))
+	assert.Equal(t, http.StatusForbidden, me(), "the cached status is dropped on change")
+	assert.Equal(t, http.StatusForbidden, login())
+	_, err = sessions.Refresh(context.Background(), session.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrSessionInvalid, "suspension ends every session")
+
+	require.NoError(t, statuses.ChangeStatus(context.Background(), &student, utils.StatusActive))
+	assert.Equal(t, http.StatusOK, login())
+}
+
+func TestOnlyActiveStudentsAreSentSurveys(t *testing.T) {
+	db := setupSurveyTestDB()
+	service, survey := seedSurvey(t, db, false)
+	db.Model(&models.User{}).Where("id = ?", 3).Update("status", utils.StatusGraduated)
+
+	college := uint(1)
+	assigned, err := service.AssignSurvey(survey.ID, services.SurveyAssignInput{CollegeID: &college})
+	require.NoError(t, err)
+	assert.Equal(t, 1, assigned, "Ravi has graduated")
+
+	_, err = service.AssignSurvey(survey.ID, services.SurveyAssignInput{StudentIDs: []uint{3}})
+	assert.ErrorIs(t, err, services.ErrInvalidSurvey)
+}
+
+func TestDeletedUsersAreLoggedOut(t *testing.T) {
+	db := seedTenants(t)
+	require.NoError(t, db.AutoMigrate(&models.Student{}, &models.Teacher{}))
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tokens := utils.NewTokens(config.JWTConfig{Secret: "access", RefreshSecret: "refresh"}, rdb)
+	sessions := services.NewSessionService(rdb, tokens)
+
+	var student models.User
+	require.NoError(t, db.First(&student, 2).Error)
+	session, err := sessions.Create(context.Background(), &student, services.Device{})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/me", middlewares.AuthMiddleware(db, rdb, tokens), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.DELETE("/users/:id", asSubject(db, adminSubject()), func(c *gin.Context) {
+		controllers.DeleteUser(c, utils.RequestDB(c, db), rdb, sessions)
+	})
+	me := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, me(), "the user is now cached")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/2", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, me(), "the cached user is dropped")
+	_, err = sessions.Refresh(context.Background(), session.RefreshToken, services.Device{})
+	assert.ErrorIs(t, err, services.ErrSessionInvalid, "deletion ends every session")
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditChange is what a handler changed, recorded by AuditMiddleware with
+// the request it came from
+type AuditChange struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+const auditKey = "audit_change"
+
+// Audit describes the change a request made. Requests that do not call it
+// are still recorded, with the action and entity taken from the route.
+func Audit(c *gin.Context, action, entityType string, entityID interface{}, before, after interface{}) {
+	c.Set(auditKey, &AuditChange{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// AuditedChange returns the change stored by Audit
+func AuditedChange(c *gin.Context) (*AuditChange, bool) {
+	value, ok := c.Get(auditKey)
+	if !ok {
+		return nil, false
+	}
+	change, ok := value.(*AuditChange)
+	return change, ok
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "strconv"
+
+// CSVCell keeps a spreadsheet from running a cell as a formula. Text that
+// starts with =, +, -, @, a tab or a carriage return is prefixed with a
+// quote; numbers such as -1.5 are left alone.
+func CSVCell(value string) string {
+	if value == "" {
+		return value
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+		return "'" + value
+	}
+	return value
+}
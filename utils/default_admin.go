@@ -1,40 +1,47 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"log"
-	"os"
 	"pathshala/config"
 	"pathshala/models"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-func SeedAdminUser() {
+// SeedAdminUser creates the default admin when there are no users yet
+func SeedAdminUser(db *gorm.DB, cfg config.AdminConfig) error {
 	var count int64
-	if err := config.DB.Model(&models.User{}).Count(&count).Error; err != nil {
-		log.Fatalf("Failed to count users: %v", err)
+	if err := db.Model(&models.User{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count users: %w", err)
 	}
 
-	if count == 0 {
-		// Hash the password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(os.Getenv("ADMIN_PASSWORD")), bcrypt.DefaultCost)
-		if err != nil {
-			log.Fatalf("Failed to hash admin password: %v", err)
-		}
-
-		admin := models.User{
-			Name:     os.Getenv("ADMIN_NAME"),
-			Email:    os.Getenv("ADMIN_EMAIL"),
-			Password: string(hashedPassword),
-			Role:     "admin", // if you use roles
-		}
+	if count > 0 {
+		log.Println("Users already exist. Skipping admin seed.")
+		return nil
+	}
+	if cfg.Email == "" || cfg.Password == "" {
+		return errors.New("ADMIN_EMAIL and ADMIN_PASSWORD are required to create the default admin")
+	}
 
-		if err := config.DB.Create(&admin).Error; err != nil {
-			log.Fatalf("Failed to create default admin user: %v", err)
-		}
+	// Hash the password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash admin password: %w", err)
+	}
 
-		log.Println("Default admin user created.")
-	} else {
-		log.Println("Users already exist. Skipping admin seed.")
+	admin := models.User{
+		Name:     cfg.Name,
+		Email:    cfg.Email,
+		Password: string(hashedPassword),
+		Role:     RoleAdmin,
 	}
+	if err := db.Create(&admin).Error; err != nil {
+		return fmt.Errorf("failed to create default admin user: %w", err)
+	}
+
+	log.Println("Default admin user created.")
+	return nil
 }
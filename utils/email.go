@@ -3,14 +3,29 @@ package utils
 import (
 	"fmt"
 	"html"
-	"os"
+	"pathshala/config"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
-func SendResetEmailGrid(toEmail string, resetLink string) error {
-	from := mail.NewEmail("Pathashala", os.Getenv("EMAIL_FROM")) // e.g., noreply@yourdomain.com
+// Mailer sends the emails of the platform
+type Mailer interface {
+	SendResetEmail(toEmail string, resetLink string) error
+}
+
+// SendGridMailer sends email through SendGrid
+type SendGridMailer struct {
+	APIKey string
+	From   string // e.g., noreply@yourdomain.com
+}
+
+func NewSendGridMailer(cfg config.MailConfig) *SendGridMailer {
+	return &SendGridMailer{APIKey: cfg.SendGridAPIKey, From: cfg.From}
+}
+
+func (m *SendGridMailer) SendResetEmail(toEmail string, resetLink string) error {
+	from := mail.NewEmail("Pathashala", m.From)
 	subject := "Reset Your Password"
 	to := mail.NewEmail("User", toEmail)
 
@@ -47,7 +62,7 @@ func SendResetEmailGrid(toEmail string, resetLink string) error {
 
 	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
 
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
+	client := sendgrid.NewSendClient(m.APIKey)
 	response, err := client.Send(message)
 	if err != nil {
 		return err
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	_ "embed"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Layout of WriteTextPDF: A4 portrait in points, set in 9pt DejaVu Sans Mono
+const (
+	pdfMargin     = 40
+	pdfFontSize   = 9
+	pdfLineHeight = 12
+	PDFLineChars  = 95 // The font is 0.6em wide, so this many characters fit a line
+)
+
+// DejaVu Sans Mono covers Latin, Greek, Cyrillic and most symbols; see
+// fonts/DejaVu-LICENSE
+//
+//go:embed fonts/DejaVuSansMono.ttf
+var defaultPDFFont []byte
+
+var (
+	pdfFontMu sync.RWMutex
+	pdfFont   = defaultPDFFont
+)
+
+// SetPDFFont replaces the TrueType font WriteTextPDF embeds, e.g. with one
+// that has Devanagari glyphs. A monospaced font keeps report columns aligned.
+func SetPDFFont(ttf []byte) error {
+	if len(ttf) < 4 || (string(ttf[:4]) != "\x00\x01\x00\x00" && string(ttf[:4]) != "true") {
+		return errors.New("not a TrueType font")
+	}
+	// Laying out a line checks the font can be parsed and used
+	probe := newTextPDF(ttf)
+	probe.AddPage()
+	probe.Cell(0, pdfLineHeight, "Pathshala")
+	if err := probe.Error(); err != nil {
+		return errors.New("not a usable TrueType font: " + err.Error())
+	}
+
+	pdfFontMu.Lock()
+	defer pdfFontMu.Unlock()
+	pdfFont = ttf
+	return nil
+}
+
+// WriteTextPDF writes lines of monospaced text as a PDF document, starting a
+// new page whenever one is full. The font is embedded, so any text it has
+// glyphs for prints as is; lines longer than PDFLineChars are cut.
+func WriteTextPDF(w io.Writer, lines []string) error {
+	pdfFontMu.RLock()
+	ttf := pdfFont
+	pdfFontMu.RUnlock()
+
+	pdf := newTextPDF(ttf)
+	pdf.AddPage()
+	for _, line := range lines {
+		pdf.Cell(0, pdfLineHeight, pdfText(line))
+		pdf.Ln(-1)
+	}
+	return pdf.Output(w)
+}
+
+func newTextPDF(ttf []byte) *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.AddUTF8FontFromBytes("text", "", ttf)
+	pdf.SetFont("text", "", pdfFontSize)
+	return pdf
+}
+
+// pdfText cuts a line to PDFLineChars characters and drops control characters
+func pdfText(line string) string {
+	runes := make([]rune, 0, len(line))
+	for _, r := range line {
+		if len(runes) == PDFLineChars {
+			break
+		}
+		if r < 32 || r == 127 {
+			r = ' '
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"errors"
+	"pathshala/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Permissions checked by PermissionMiddleware and Authorize
+const (
+	PermAll            = "*"
+	PermUserView       = "user:view"
+	PermUserManage     = "user:manage"    // Create, edit and delete students
+	PermTeacherManage  = "teacher:manage" // Create teachers
+	PermRoleManage     = "role:manage"    // Create admins and assign scoped roles
+	PermCollegeView    = "college:view"
+	PermCollegeManage  = "college:manage"
+	PermCategoryManage = "category:manage"
+	PermQuestionView   = "question:view"
+	PermQuestionEdit   = "question:edit"
+	PermTestView       = "test:view"
+	PermTestCreate     = "test:create"
+	PermTestEdit       = "test:edit"
+	PermTestSend       = "test:send"
+	PermTestGrade      = "test:grade"
+	PermReportView     = "report:view"
+	PermSurveyManage   = "survey:manage"
+	PermDashboardView  = "dashboard:view"
+	PermProfileEdit    = "profile:edit"
+	PermTestTake       = "test:take"
+	PermSurveyRespond  = "survey:respond"
+	PermCrossTenant    = "tenant:all" // Read data of every college
+	PermAuditView      = "audit:view"
+	PermTrashManage    = "trash:manage" // List and restore deleted items
+)
+
+// Scopes a permission is granted in
+const (
+	ScopeGlobal  = "global"
+	ScopeState   = "state"
+	ScopeCollege = "college"
+	ScopeOwn     = "own"
+)
+
+// Roles. Admins, teachers and students are the role of the user; super
+// teachers are teachers with Teacher.Super set, and state coordinators are
+// assigned with a RoleAssignment.
+const (
+	RoleAdmin            = "admin"
+	RoleTeacher          = "teacher"
+	RoleStudent          = "student"
+	RoleSuperTeacher     = "super_teacher"
+	RoleStateCoordinator = "state_coordinator"
+)
+
+var (
+	ErrForbidden    = errors.New("permission denied")
+	ErrTestNotFound = errors.New("test not found")
+)
+
+// DefaultRolePermissions is seeded into role_permissions; rows already there
+// are left alone, so permissions changed in the database are kept
+var DefaultRolePermissions = []models.RolePermission{
+	{Role: RoleAdmin, Permission: PermAll, Scope: ScopeGlobal},
+
+	{Role: RoleTeacher, Permission: PermUserView, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermUserManage, Scope: ScopeCollege},
+	{Role: RoleTeacher, Permission: PermCollegeView, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermCategoryManage, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermQuestionView, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermQuestionEdit, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermTestView, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermTestCreate, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermTestEdit, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermTestSend, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermTestGrade, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermReportView, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermSurveyManage, Scope: ScopeOwn},
+	{Role: RoleTeacher, Permission: PermDashboardView, Scope: ScopeGlobal},
+	{Role: RoleTeacher, Permission: PermProfileEdit, Scope: ScopeGlobal},
+
+	{Role: RoleSuperTeacher, Permission: PermTeacherManage, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermTestView, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermTestEdit, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermTestSend, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermTestGrade, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermReportView, Scope: ScopeCollege},
+	{Role: RoleSuperTeacher, Permission: PermSurveyManage, Scope: ScopeCollege},
+
+	{Role: RoleStateCoordinator, Permission: PermUserView, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermUserManage, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermTeacherManage, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermCollegeView, Scope: ScopeGlobal},
+	{Role: RoleStateCoordinator, Permission: PermCollegeManage, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermTestView, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermReportView, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermSurveyManage, Scope: ScopeState},
+	{Role: RoleStateCoordinator, Permission: PermDashboardView, Scope: ScopeGlobal},
+	{Role: RoleStateCoordinator, Permission: PermProfileEdit, Scope: ScopeGlobal},
+
+	{Role: RoleStudent, Permission: PermTestTake, Scope: ScopeOwn},
+	{Role: RoleStudent, Permission: PermSurveyRespond, Scope: ScopeOwn},
+}
+
+func SeedRolePermissions(db *gorm.DB) error {
+	permissions := make([]models.RolePermission, len(DefaultRolePermissions))
+	copy(permissions, DefaultRolePermissions)
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}, {Name: "permission"}},
+		DoNothing: true,
+	}).Create(&permissions).Error
+}
+
+// Grant is a permission a subject holds in a scope. CollegeID and State
+// bound college and state scopes.
+type Grant struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+	Scope      string `json:"scope"`
+	CollegeID  *uint  `json:"college_id,omitempty"`
+	State      string `json:"state,omitempty"`
+}
+
+// Subject is a logged-in user with every permission they hold
+type Subject struct {
+	UserID    uint    `json:"user_id"`
+	Role      string  `json:"role"`
+	CollegeID *uint   `json:"college_id"`
+	State     string  `json:"state"`
+	Grants    []Grant `json:"grants"`
+}
+
+// Resource is what a permission is checked against: who created it and the
+// college and state it belongs to. The zero Resource is only reachable with
+// global grants.
+type Resource struct {
+	OwnerID   *uint
+	CollegeID *uint
+	State     string
+}
+
+// LoadSubject collects the permissions of a user: those of their role, of
+// super teacher for teachers marked Super, and of their role assignments
+func LoadSubject(db *gorm.DB, userID uint) (*Subject, error) {
+	var user models.User
+	if err := db.Preload("College").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	subject := &Subject{UserID: user.ID, Role: user.Role, CollegeID: user.CollegeID, State: user.College.State, Grants: []Grant{}}
+
+	type scopedRole struct {
+		role      string
+		collegeID *uint
+		state     string
+	}
+	roles := []scopedRole{{role: user.Role, collegeID: user.CollegeID, state: user.College.State}}
+
+	if user.Role == RoleTeacher {
+		var teacher models.Teacher
+		err := db.Where("user_id = ?", user.ID).First(&teacher).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && teacher.Super {
+			roles = append(roles, scopedRole{role: RoleSuperTeacher, collegeID: user.CollegeID, state: user.College.State})
+		}
+	}
+
+	var assignments []models.RoleAssignment
+	if err := db.Where("user_id = ?", user.ID).Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range assignments {
+		roles = append(roles, scopedRole{role: a.Role, collegeID: a.CollegeID, state: a.State})
+	}
+
+	for _, r := range roles {
+		var permissions []models.RolePermission
+		if err := db.Where("role = ?", r.role).Find(&permissions).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range permissions {
+			grant := Grant{Role: r.role, Permission: p.Permission, Scope: p.Scope}
+			switch p.Scope {
+			case ScopeCollege:
+				if r.collegeID == nil {
+					continue // Nothing to bound the grant to
+				}
+				grant.CollegeID = r.collegeID
+			case ScopeState:
+				if r.state == "" {
+					continue
+				}
+				grant.State = r.state
+			}
+			subject.Grants = append(subject.Grants, grant)
+		}
+	}
+	return subject, nil
+}
+
+// HasPermission reports whether the subject holds a permission in any scope
+func (s *Subject) HasPermission(permission string) bool {
+	for _, g := range s.Grants {
+		if g.Permission == permission || g.Permission == PermAll {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the subject holds a permission over a resource
+func (s *Subject) Can(permission string, res Resource) bool {
+	for _, g := range s.Grants {
+		if g.Permission != permission && g.Permission != PermAll {
+			continue
+		}
+		switch g.Scope {
+		case ScopeGlobal:
+			return true
+		case ScopeState:
+			if res.State != "" && res.State == g.State {
+				return true
+			}
+		case ScopeCollege:
+			if res.CollegeID != nil && g.CollegeID != nil && *res.CollegeID == *g.CollegeID {
+				return true
+			}
+		case ScopeOwn:
+			if res.OwnerID != nil && *res.OwnerID == s.UserID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UserResource is a user as a resource, in their college and its state
+func UserResource(db *gorm.DB, userID uint) (Resource, error) {
+	var user models.User
+	if err := db.Preload("College").First(&user, userID).Error; err != nil {
+		return Resource{}, err
+	}
+	return Resource{OwnerID: &user.ID, CollegeID: user.CollegeID, State: user.College.State}, nil
+}
+
+// OwnedResource is something a user created; it belongs to their college
+func OwnedResource(db *gorm.DB, ownerID uint) (Resource, error) {
+	res, err := UserResource(db, ownerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Resource{OwnerID: &ownerID}, nil // The creator was removed
+	}
+	return res, err
+}
+
+func CollegeResource(db *gorm.DB, collegeID uint) (Resource, error) {
+	var college models.College
+	if err := db.First(&college, collegeID).Error; err != nil {
+		return Resource{}, err
+	}
+	return Resource{CollegeID: &college.ID, State: college.State}, nil
+}
+
+func TestResource(db *gorm.DB, testID uint) (Resource, error) {
+	var test models.Test
+	if err := db.First(&test, testID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Resource{}, ErrTestNotFound
+		}
+		return Resource{}, err
+	}
+	return OwnedResource(db, test.UserID)
+}
+
+// CurrentSubject returns the subject PermissionMiddleware stored on the
+// request, loading it when the route has no such middleware
+func CurrentSubject(c *gin.Context, db *gorm.DB) (*Subject, error) {
+	if value, ok := c.Get("subject"); ok {
+		if subject, ok := value.(*Subject); ok {
+			return subject, nil
+		}
+	}
+	userID, ok := c.Get("user_id")
+	userIDFloat, isFloat := userID.(float64)
+	if !ok || !isFloat {
+		return nil, ErrForbidden
+	}
+	subject, err := LoadSubject(db, uint(userIDFloat))
+	if err != nil {
+		return nil, err
+	}
+	c.Set("subject", subject)
+	return subject, nil
+}
+
+// Authorize checks that the logged-in user holds a permission over a resource
+func Authorize(c *gin.Context, db *gorm.DB, permission string, res Resource) error {
+	subject, err := CurrentSubject(c, db)
+	if err != nil {
+		return err
+	}
+	if !subject.Can(permission, res) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeTest checks a permission over a test, returning ErrTestNotFound
+// for unknown tests
+func AuthorizeTest(c *gin.Context, db *gorm.DB, permission string, testID uint) error {
+	res, err := TestResource(db, testID)
+	if err != nil {
+		return err
+	}
+	return Authorize(c, db, permission, res)
+}
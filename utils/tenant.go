@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"pathshala/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tenant is the set of colleges whose data a request may read. Subjects
+// holding tenant:all globally read across every college.
+type Tenant struct {
+	All        bool
+	CollegeIDs []uint
+}
+
+type tenantKey struct{}
+
+// requestKey marks a context as serving an HTTP request
+type requestKey struct{}
+
+// ownedKey marks a context whose reads were authorized by ownership instead
+type ownedKey struct{}
+
+// ErrNoTenant fails a read of a tenant-owned table made for a request whose
+// tenant is unknown, rather than letting it see every college
+var ErrNoTenant = errors.New("request has no tenant")
+
+// WithTenant stores a tenant on a context; queries run with that context
+// are filtered by the scopes RegisterTenantScopes installs
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	if ctx == nil {
+		return Tenant{}, false
+	}
+	tenant, ok := ctx.Value(tenantKey{}).(Tenant)
+	return tenant, ok
+}
+
+// LoadTenant collects the colleges a subject belongs to or holds college or
+// state scoped grants over
+func LoadTenant(db *gorm.DB, subject *Subject) (Tenant, error) {
+	if subject.Can(PermCrossTenant, Resource{}) {
+		return Tenant{All: true}, nil
+	}
+
+	ids := map[uint]bool{}
+	if subject.CollegeID != nil {
+		ids[*subject.CollegeID] = true
+	}
+	var states []string
+	for _, g := range subject.Grants {
+		switch g.Scope {
+		case ScopeCollege:
+			if g.CollegeID != nil {
+				ids[*g.CollegeID] = true
+			}
+		case ScopeState:
+			states = append(states, g.State)
+		}
+	}
+	if len(states) > 0 {
+		var stateColleges []uint
+		if err := db.Model(&models.College{}).Where("state IN ?", states).Pluck("id", &stateColleges).Error; err != nil {
+			return Tenant{}, err
+		}
+		for _, id := range stateColleges {
+			ids[id] = true
+		}
+	}
+
+	tenant := Tenant{CollegeIDs: make([]uint, 0, len(ids))}
+	for id := range ids {
+		tenant.CollegeIDs = append(tenant.CollegeIDs, id)
+	}
+	sort.Slice(tenant.CollegeIDs, func(i, j int) bool { return tenant.CollegeIDs[i] < tenant.CollegeIDs[j] })
+	return tenant, nil
+}
+
+// Includes reports whether data of a college is visible to the tenant.
+// Data without a college is platform content everyone can read.
+func (t Tenant) Includes(collegeID *uint) bool {
+	if t.All || collegeID == nil {
+		return true
+	}
+	for _, id := range t.CollegeIDs {
+		if id == *collegeID {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns reports whether the tenant may change data of a college. Platform
+// content is only changed by cross-tenant subjects.
+func (t Tenant) Owns(collegeID *uint) bool {
+	if t.All {
+		return true
+	}
+	return collegeID != nil && t.Includes(collegeID)
+}
+
+// Key identifies the tenant in cache keys
+func (t Tenant) Key() string {
+	if t.All {
+		return "all"
+	}
+	ids := make([]string, len(t.CollegeIDs))
+	for i, id := range t.CollegeIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return "c" + strings.Join(ids, ",")
+}
+
+// tenantRules restrict each tenant-owned table to the rows a tenant may
+// read. Categories are visible to their college, when shared, and when they
+// belong to no college; questions follow their category; users and the tests
+// they created belong to their college.
+var tenantRules = map[string]func(ids []uint) clause.Expression{
+	"categories": func(ids []uint) clause.Expression {
+		return clause.Expr{
+			SQL:  "(categories.college_id IN ? OR categories.shared = ? OR categories.college_id IS NULL)",
+			Vars: []interface{}{ids, true},
+		}
+	},
+	"questions": func(ids []uint) clause.Expression {
+		return clause.Expr{
+			SQL:  "questions.category_id IN (SELECT id FROM categories WHERE college_id IN ? OR shared = ? OR college_id IS NULL)",
+			Vars: []interface{}{ids, true},
+		}
+	},
+	"users": func(ids []uint) clause.Expression {
+		return clause.Expr{SQL: "users.college_id IN ?", Vars: []interface{}{ids}}
+	},
+	"tests": func(ids []uint) clause.Expression {
+		return clause.Expr{
+			SQL:  "tests.user_id IN (SELECT id FROM users WHERE college_id IN ?)",
+			Vars: []interface{}{ids},
+		}
+	},
+}
+
+// tenantWriteRules restrict updates and deletes to the rows a tenant owns:
+// shared categories and platform content stay read-only outside their college
+var tenantWriteRules = map[string]func(ids []uint) clause.Expression{
+	"categories": func(ids []uint) clause.Expression {
+		return clause.Expr{SQL: "categories.college_id IN ?", Vars: []interface{}{ids}}
+	},
+	"questions": func(ids []uint) clause.Expression {
+		return clause.Expr{
+			SQL:  "questions.category_id IN (SELECT id FROM categories WHERE college_id IN ?)",
+			Vars: []interface{}{ids},
+		}
+	},
+	"users": tenantRules["users"],
+	"tests": tenantRules["tests"],
+}
+
+// RegisterTenantScopes filters reads of tenant-owned tables by the tenant on
+// the statement context, and updates and deletes by what the tenant owns.
+// Statements without a tenant are left alone, e.g. those of workers, unless
+// they run for a request: those fail with ErrNoTenant.
+func RegisterTenantScopes(db *gorm.DB) error {
+	read := tenantScope(tenantRules)
+	write := tenantScope(tenantWriteRules)
+	if err := db.Callback().Query().Before("gorm:query").Register("tenant:scope", read); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenant:scope", read); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenant:scope", write); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("tenant:scope", write)
+}
+
+func tenantScope(rules map[string]func(ids []uint) clause.Expression) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if condition, ok := tenantCondition(db, rules, db.Statement.Table); ok {
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+		}
+	}
+}
+
+// tenantCondition is the rule limiting table to the tenant on the statement
+// context, if any applies
+func tenantCondition(db *gorm.DB, rules map[string]func(ids []uint) clause.Expression, table string) (clause.Expression, bool) {
+	rule, ok := rules[table]
+	if !ok {
+		return nil, false
+	}
+	if db.Statement.Context != nil && db.Statement.Context.Value(ownedKey{}) != nil {
+		return nil, false
+	}
+	tenant, ok := TenantFromContext(db.Statement.Context)
+	if !ok {
+		if db.Statement.Context != nil && db.Statement.Context.Value(requestKey{}) != nil {
+			db.AddError(ErrNoTenant)
+		}
+		return nil, false
+	}
+	if tenant.All {
+		return nil, false
+	}
+	ids := tenant.CollegeIDs
+	if len(ids) == 0 {
+		ids = []uint{0} // Matches no college
+	}
+	return rule(ids), true
+}
+
+// ScopeJoined is a gorm scope limiting a query to the rows of a joined
+// tenant-owned table the tenant may read. The tenant scopes only see the
+// table a query is on, so queries reaching e.g. users through a join use it.
+func ScopeJoined(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if condition, ok := tenantCondition(db, tenantRules, table); ok {
+			return db.Where(condition)
+		}
+		return db
+	}
+}
+
+// SkipTenantScope lets reads with ctx past the tenant scopes. It is for data the
+// caller was found to own another way, e.g. the test of an attempt assigned
+// to a student, which may come from outside their college.
+func SkipTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownedKey{}, true)
+}
+
+// CurrentTenant returns the tenant of the logged-in user, loading it when
+// PermissionMiddleware has not
+func CurrentTenant(c *gin.Context, db *gorm.DB) (Tenant, error) {
+	if tenant, ok := TenantFromContext(c.Request.Context()); ok {
+		return tenant, nil
+	}
+	subject, err := CurrentSubject(c, db)
+	if err != nil {
+		return Tenant{}, err
+	}
+	tenant, err := LoadTenant(db, subject)
+	if err != nil {
+		return Tenant{}, err
+	}
+	c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+	return tenant, nil
+}
+
+// RequestContext is the context database work for a request runs with: the
+// request's context, carrying the tenant PermissionMiddleware loaded, marked
+// so that reads of tenant-owned tables fail when there is no tenant
+func RequestContext(c *gin.Context) context.Context {
+	return context.WithValue(c.Request.Context(), requestKey{}, true)
+}
+
+// RequestDB binds db to RequestContext, first loading the logged-in user's
+// tenant when PermissionMiddleware has not. Without a logged-in user, or when
+// the tenant cannot be loaded, reads of tenant-owned tables fail.
+func RequestDB(c *gin.Context, db *gorm.DB) *gorm.DB {
+	if _, ok := c.Get("user_id"); ok {
+		// A failure leaves the request without a tenant, so its reads fail
+		CurrentTenant(c, db)
+	}
+	return db.WithContext(RequestContext(c))
+}
+
+// ScopeToTenant limits reads through db to the logged-in user's tenant. When
+// the tenant cannot be loaded only platform content is visible.
+func ScopeToTenant(c *gin.Context, db *gorm.DB) *gorm.DB {
+	tenant, err := CurrentTenant(c, db)
+	if err != nil {
+		tenant = Tenant{}
+	}
+	return db.WithContext(WithTenant(c.Request.Context(), tenant))
+}
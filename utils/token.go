@@ -2,27 +2,53 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"fmt"
-	"os"
 	"pathshala/config"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-var refreshSecret = []byte(os.Getenv("JWT_REFRESH_SECRET"))
+// Tokens issues and checks JWTs. Logged-out tokens are blacklisted in Redis.
+type Tokens struct {
+	accessSecret  []byte
+	refreshSecret []byte
+	Redis         *redis.Client
+}
+
+func NewTokens(cfg config.JWTConfig, rdb *redis.Client) *Tokens {
+	return &Tokens{accessSecret: []byte(cfg.Secret), refreshSecret: []byte(cfg.RefreshSecret), Redis: rdb}
+}
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// GenerateSessionTokens creates the token pair of a login session. Both
+// tokens name the session ("sid"); the refresh token also carries its own id
+// ("jti") so each rotation can be told apart.
+func (t *Tokens) GenerateSessionTokens(email string, id uint, sessionID, refreshID string) (string, string, error) {
+	// Access tokens get a random id too, or two issued within a second
+	// would be the same token
+	accessID := make([]byte, 16)
+	if _, err := rand.Read(accessID); err != nil {
+		return "", "", err
+	}
 
-// Generate access and refresh tokens
-func GenerateTokens(email string, id uint) (string, string, error) {
 	// Access Token (15 minutes)
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"email":   email,
 		"user_id": id,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+		"sid":     sessionID,
+		"jti":     hex.EncodeToString(accessID),
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
 	})
-	accessTokenString, err := accessToken.SignedString(jwtSecret)
+	accessTokenString, err := accessToken.SignedString(t.accessSecret)
 	if err != nil {
 		return "", "", err
 	}
@@ -31,9 +57,11 @@ func GenerateTokens(email string, id uint) (string, string, error) {
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"email":   email,
 		"user_id": id,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"sid":     sessionID,
+		"jti":     refreshID,
+		"exp":     time.Now().Add(RefreshTokenTTL).Unix(),
 	})
-	refreshTokenString, err := refreshToken.SignedString(refreshSecret)
+	refreshTokenString, err := refreshToken.SignedString(t.refreshSecret)
 	if err != nil {
 		return "", "", err
 	}
@@ -42,22 +70,20 @@ func GenerateTokens(email string, id uint) (string, string, error) {
 }
 
 // Validate Access Token
-func ValidateToken(tokenString string, isRefresh bool) (map[string]interface{}, error) {
+func (t *Tokens) ValidateToken(ctx context.Context, tokenString string, isRefresh bool) (map[string]interface{}, error) {
 
 	//Check Redis blacklist first
-	exists, err := config.RedisClient.Exists(config.Ctx, tokenString).Result()
-	fmt.Println(exists)
+	exists, err := t.Redis.Exists(ctx, tokenString).Result()
 	if err != nil {
 		return nil, errors.New("error checking token blacklist")
 	}
 	if exists == 1 {
-		fmt.Println("I am here")
 		return nil, errors.New("token is blacklisted (logged out)")
 	}
 
-	secret := jwtSecret
+	secret := t.accessSecret
 	if isRefresh {
-		secret = refreshSecret
+		secret = t.refreshSecret
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"pathshala/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Lifecycle statuses of a user. Only active users can log in, use their
+// tokens or be sent tests and surveys.
+const (
+	StatusInvited   = "invited" // Created, waiting to set a password from a reset link
+	StatusActive    = "active"
+	StatusSuspended = "suspended" // Blocked for now, e.g. by the college
+	StatusGraduated = "graduated" // A student who has finished; results are kept
+	StatusArchived  = "archived"  // Left the platform
+)
+
+// statusTransitions lists the statuses each status can change to
+var statusTransitions = map[string][]string{
+	StatusInvited:   {StatusActive, StatusArchived},
+	StatusActive:    {StatusSuspended, StatusGraduated, StatusArchived},
+	StatusSuspended: {StatusActive, StatusArchived},
+	StatusGraduated: {StatusActive, StatusArchived},
+	StatusArchived:  {StatusActive},
+}
+
+// ValidUserStatus reports whether status is a lifecycle status
+func ValidUserStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanChangeStatus reports whether a user may go from one status to another
+func CanChangeStatus(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusMessage explains to a user why their status keeps them out
+func StatusMessage(status string) string {
+	switch status {
+	case StatusInvited:
+		return "Set a password from your invitation or a password reset link to activate your account"
+	case StatusSuspended:
+		return "Your account is suspended"
+	case StatusGraduated, StatusArchived:
+		return "Your account is no longer active"
+	}
+	return "Your account is not active"
+}
+
+// CachedUser is the role and status of a user as AuthMiddleware checks them
+// on every request. It is kept in Redis for userCacheTTL; anything that
+// changes either must call InvalidateUserCache.
+type CachedUser struct {
+	Role   string
+	Status string
+}
+
+const userCacheTTL = 15 * time.Minute
+
+func userCacheKey(userID uint) string {
+	return "user:auth:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// LoadCachedUser returns the role and status of a user, from Redis when
+// cached. gorm.ErrRecordNotFound means the user is gone.
+func LoadCachedUser(ctx context.Context, db *gorm.DB, rdb *redis.Client, userID uint) (CachedUser, error) {
+	key := userCacheKey(userID)
+	if fields, err := rdb.HGetAll(ctx, key).Result(); err == nil && fields["role"] != "" {
+		return CachedUser{Role: fields["role"], Status: fields["status"]}, nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "role", "status").First(&user, userID).Error; err != nil {
+		return CachedUser{}, err
+	}
+	cached := CachedUser{Role: user.Role, Status: user.Status}
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "role", cached.Role, "status", cached.Status)
+	pipe.Expire(ctx, key, userCacheTTL)
+	_, _ = pipe.Exec(ctx)
+	return cached, nil
+}
+
+// InvalidateUserCache makes the next request of the user read their role and
+// status from the database
+func InvalidateUserCache(ctx context.Context, rdb *redis.Client, userID uint) error {
+	if rdb == nil {
+		return nil
+	}
+	return rdb.Del(ctx, userCacheKey(userID)).Err()
+}
@@ -0,0 +1,31 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"pathshala/services"
+	"time"
+)
+
+// RunAttemptExpiry periodically finalizes attempts whose deadline has passed
+// into results, until ctx is cancelled.
+func RunAttemptExpiry(ctx context.Context, attemptService *services.AttemptService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			finalized, err := attemptService.FinalizeExpiredAttempts(now)
+			if err != nil {
+				log.Printf("Attempt expiry worker failed: %v", err)
+				continue
+			}
+			if finalized > 0 {
+				log.Printf("Auto-submitted %d expired attempts", finalized)
+			}
+		}
+	}
+}
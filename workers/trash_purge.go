@@ -0,0 +1,30 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"pathshala/services"
+	"time"
+)
+
+// RunTrashPurge periodically removes items that have been in the trash
+// longer than the retention period, until ctx is cancelled.
+func RunTrashPurge(ctx context.Context, trashService *services.TrashService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := trashService.PurgeExpired(now)
+			if err != nil {
+				log.Printf("Trash purge worker failed: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d items from the trash", purged)
+			}
+		}
+	}
+}